@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+)
+
+// logOutput opens the log destination selected in config
+func logOutput(cfg config.LogConfig) (io.Writer, error) {
+	if cfg.Output == "" || cfg.Output == config.LogOutputStdout {
+		return os.Stdout, nil
+	}
+
+	file, err := logger.NewRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Output == config.LogOutputBoth {
+		return io.MultiWriter(os.Stdout, file), nil
+	}
+	return file, nil
+}
+
+// logLevel picks the level from config, then the LOG_LEVEL environment
+// variable, defaulting to INFO
+func logLevel(cfg *config.PipelineConfig, getenv func(string) string) (logger.LogLevel, error) {
+	name := firstNonEmpty(cfg.LogLevel, getenv("LOG_LEVEL"))
+	if name == "" {
+		return logger.INFO, nil
+	}
+	return logger.ParseLevel(name)
+}
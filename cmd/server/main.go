@@ -1,63 +1,93 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
-	"net/http"
+	"os"
 
-	"github.com/gin-gonic/gin"
 	"github.com/sleepstars/deepempower/internal/config"
-	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/logger"
 	"github.com/sleepstars/deepempower/internal/orchestrator"
+	"github.com/sleepstars/deepempower/internal/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func main() {
 	// 解析命令行标志
-	configPath := flag.String("config", "/app/config.yaml", "Path to the configuration file")
-	flag.Parse()
+	opts, err := parseOptions(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Load configuration from file
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := config.LoadConfig(opts.configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Initialize logging before any component grabs the default logger
+	output, err := logOutput(cfg.Log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	level, err := logLevel(cfg, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.InitLogger(level, "server", logger.WithOutput(output))
+
+	// Join the caller's trace from W3C traceparent and baggage headers. Spans
+	// are only recorded once a tracer provider is installed.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
 	// Create pipeline
-	pipeline := orchestrator.NewHybridPipeline(cfg)
+	pipeline, err := newPipeline(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Setup router
-	r := gin.Default()
-
-	// Middleware to check API key
-	r.Use(func(c *gin.Context) {
-		apiKey := c.GetHeader("Authorization")
-		if apiKey != cfg.APIKey {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-			c.Abort()
-			return
-		}
-		c.Next()
-	})
-
-	// Chat completions endpoint
-	r.POST("/v1/chat/completions", func(c *gin.Context) {
-		var req models.ChatCompletionRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+	srv := server.New(cfg, pipeline)
+	srv.SetReloader(func() (*config.PipelineConfig, *orchestrator.HybridPipeline, error) {
+		cfg, err := config.LoadConfig(opts.configPath)
+		if err != nil {
+			return nil, nil, err
 		}
-
-		resp, err := pipeline.Execute(c.Request.Context(), &req)
+		pipeline, err := newPipeline(cfg)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, nil, err
 		}
-
-		c.JSON(http.StatusOK, resp)
+		return cfg, pipeline, nil
 	})
+	r := srv.Router()
 
 	// Start server
-	if err := r.Run(":8080"); err != nil {
+	if err := r.Run(opts.addr); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// newPipeline creates the pipeline for cfg with its shadow pipeline attached
+func newPipeline(cfg *config.PipelineConfig) (*orchestrator.HybridPipeline, error) {
+	pipeline, err := orchestrator.NewHybridPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Shadow != nil && cfg.Shadow.Rate > 0 {
+		shadowCfg, err := config.LoadConfig(cfg.Shadow.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		shadowPipeline, err := orchestrator.NewHybridPipeline(shadowCfg)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.SetShadow(orchestrator.NewShadowRunner(*cfg.Shadow, shadowPipeline))
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultConfigPath = "/app/config.yaml"
+	defaultAddr       = ":8080"
+	// defaultConfigFile is loaded when the config path names a directory
+	defaultConfigFile = "models.yaml"
+)
+
+// options holds the server startup settings
+type options struct {
+	configPath string
+	addr       string
+}
+
+// parseOptions resolves the startup settings. Flags take precedence over the
+// CONFIG_PATH and SERVER_ADDR environment variables, which take precedence
+// over the defaults.
+func parseOptions(args []string, getenv func(string) string) (*options, error) {
+	fs := flag.NewFlagSet("deepempower", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to the configuration file or directory (env CONFIG_PATH, default "+defaultConfigPath+")")
+	addr := fs.String("addr", "", "Address to listen on (env SERVER_ADDR, default "+defaultAddr+")")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return &options{
+		configPath: resolveConfigPath(firstNonEmpty(*configPath, getenv("CONFIG_PATH"), defaultConfigPath)),
+		addr:       firstNonEmpty(*addr, getenv("SERVER_ADDR"), defaultAddr),
+	}, nil
+}
+
+// resolveConfigPath points directories at the config file inside them
+func resolveConfigPath(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, defaultConfigFile)
+	}
+	return path
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
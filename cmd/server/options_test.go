@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	configDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, defaultConfigFile), nil, 0644))
+
+	testCases := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		expectConfig string
+		expectAddr   string
+	}{
+		{
+			name:         "defaults",
+			expectConfig: defaultConfigPath,
+			expectAddr:   defaultAddr,
+		},
+		{
+			name:         "env only",
+			env:          map[string]string{"CONFIG_PATH": "/env/config.yaml", "SERVER_ADDR": ":9090"},
+			expectConfig: "/env/config.yaml",
+			expectAddr:   ":9090",
+		},
+		{
+			name:         "flags override env",
+			args:         []string{"-config", "/flag/config.yaml", "-addr", "127.0.0.1:7070"},
+			env:          map[string]string{"CONFIG_PATH": "/env/config.yaml", "SERVER_ADDR": ":9090"},
+			expectConfig: "/flag/config.yaml",
+			expectAddr:   "127.0.0.1:7070",
+		},
+		{
+			name:         "flag for one setting env for the other",
+			args:         []string{"-addr", ":7070"},
+			env:          map[string]string{"CONFIG_PATH": "/env/config.yaml"},
+			expectConfig: "/env/config.yaml",
+			expectAddr:   ":7070",
+		},
+		{
+			name:         "config directory",
+			env:          map[string]string{"CONFIG_PATH": configDir},
+			expectConfig: filepath.Join(configDir, defaultConfigFile),
+			expectAddr:   defaultAddr,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := parseOptions(tc.args, func(key string) string { return tc.env[key] })
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectConfig, opts.configPath)
+			assert.Equal(t, tc.expectAddr, opts.addr)
+		})
+	}
+}
+
+func TestParseOptions_UnknownFlag(t *testing.T) {
+	_, err := parseOptions([]string{"-port", "8080"}, func(string) string { return "" })
+	assert.Error(t, err)
+}
+
+func TestLogOutput(t *testing.T) {
+	w, err := logOutput(config.LogConfig{})
+	require.NoError(t, err)
+	assert.Same(t, os.Stdout, w)
+
+	path := filepath.Join(t.TempDir(), "server.log")
+	w, err = logOutput(config.LogConfig{Output: config.LogOutputFile, File: path, MaxSizeMB: 1})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello\n"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+}
+
+func TestLogLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		env      string
+		expected logger.LogLevel
+		wantErr  bool
+	}{
+		{name: "default", expected: logger.INFO},
+		{name: "env", env: "debug", expected: logger.DEBUG},
+		{name: "config over env", config: "error", env: "debug", expected: logger.ERROR},
+		{name: "invalid env", env: "loud", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			level, err := logLevel(&config.PipelineConfig{LogLevel: tc.config}, func(key string) string {
+				if key == "LOG_LEVEL" {
+					return tc.env
+				}
+				return ""
+			})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, level)
+		})
+	}
+}
@@ -0,0 +1,470 @@
+package clients
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// anthropicVersion is the Messages API version sent with every request
+const anthropicVersion = "2023-06-01"
+
+// DefaultAnthropicMaxTokens is sent when neither the request nor the default
+// params set max_tokens, which the Messages API requires
+const DefaultAnthropicMaxTokens = 4096
+
+// AnthropicError is an error response from the Anthropic API
+type AnthropicError struct {
+	HTTPStatusCode int
+	Type           string
+	Message        string
+}
+
+func (e *AnthropicError) Error() string {
+	return fmt.Sprintf("anthropic error, status code: %d, type: %s, message: %s", e.HTTPStatusCode, e.Type, e.Message)
+}
+
+// AnthropicClient implements ModelClient on Anthropic's native Messages API.
+// The API key is sent through ExtraHeaders as x-api-key.
+type AnthropicClient struct {
+	config  ModelClientConfig
+	baseURL string
+	doer    openai.HTTPDoer
+}
+
+// NewAnthropicClient creates a client for the Messages API under config.APIBase,
+// e.g. https://api.anthropic.com/v1
+func NewAnthropicClient(config ModelClientConfig) *AnthropicClient {
+	baseURL := BaseURL(strings.TrimSuffix(config.APIBase, "/"))
+	return &AnthropicClient{
+		config:  config,
+		baseURL: baseURL,
+		doer:    newHTTPClient(config),
+	}
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	TopP          *float32           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+// anthropicContent is a content block. Requests use text and image blocks;
+// responses carry text and thinking blocks.
+type anthropicContent struct {
+	Type     string                `json:"type"`
+	Text     string                `json:"text,omitempty"`
+	Thinking string                `json:"thinking,omitempty"`
+	Source   *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string             `json:"id"`
+	Model      string             `json:"model"`
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      anthropicUsage     `json:"usage"`
+}
+
+// anthropicEvent is a server-sent event of a streamed response
+type anthropicEvent struct {
+	Type    string            `json:"type"`
+	Message anthropicResponse `json:"message"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		Thinking   string `json:"thinking"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicErrorStatus gives the HTTP status the API uses for each error
+// type, for errors that arrive inside a stream after the 200 response
+var anthropicErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// prepareRequest converts the request to the Messages API format. System
+// messages become the system prompt and consecutive messages of the same
+// role are merged, since the API expects user and assistant to alternate.
+func (c *AnthropicClient) prepareRequest(req *models.ChatCompletionRequest) anthropicRequest {
+	if req.Model == "" {
+		req.Model = c.config.Model
+	}
+
+	areq := anthropicRequest{Model: req.Model, MaxTokens: DefaultAnthropicMaxTokens}
+	var system []string
+	for _, msg := range req.Messages {
+		if msg.Role == "system" || msg.Role == "developer" {
+			system = append(system, msg.Content)
+			continue
+		}
+		// Tool results are passed on as user text
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "assistant"
+		}
+		content := anthropicBlocks(msg)
+		if n := len(areq.Messages); n > 0 && areq.Messages[n-1].Role == role {
+			areq.Messages[n-1].Content = append(areq.Messages[n-1].Content, content...)
+			continue
+		}
+		areq.Messages = append(areq.Messages, anthropicMessage{Role: role, Content: content})
+	}
+	areq.System = strings.Join(system, "\n\n")
+	trimPrefill(areq.Messages)
+
+	for k, v := range outboundParams(c.config, req) {
+		switch k {
+		case "max_tokens":
+			if v, ok := toInt(v); ok && v > 0 {
+				areq.MaxTokens = v
+			}
+		case "temperature":
+			if v, ok := toFloat32(v); ok {
+				areq.Temperature = &v
+			}
+		case "top_p":
+			if v, ok := toFloat32(v); ok {
+				areq.TopP = &v
+			}
+		case "top_k":
+			if v, ok := toInt(v); ok {
+				areq.TopK = &v
+			}
+		case "stop":
+			if v, ok := toStringSlice(v); ok {
+				areq.StopSequences = v
+			}
+		}
+	}
+	return areq
+}
+
+// trimPrefill strips trailing whitespace from a final assistant message. The
+// API continues such a message as a prefill but rejects it if it ends in
+// whitespace.
+func trimPrefill(messages []anthropicMessage) {
+	n := len(messages)
+	if n == 0 || messages[n-1].Role != "assistant" {
+		return
+	}
+	blocks := messages[n-1].Content
+	if last := &blocks[len(blocks)-1]; last.Type == "text" {
+		last.Text = strings.TrimRight(last.Text, " \t\r\n")
+	}
+}
+
+// anthropicBlocks converts the content of a message to content blocks
+func anthropicBlocks(msg models.ChatCompletionMessage) []anthropicContent {
+	if len(msg.MultiContent) == 0 {
+		return []anthropicContent{{Type: "text", Text: msg.Content}}
+	}
+	blocks := make([]anthropicContent, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		if part.ImageURL == nil {
+			blocks = append(blocks, anthropicContent{Type: "text", Text: part.Text})
+			continue
+		}
+		blocks = append(blocks, anthropicContent{Type: "image", Source: anthropicImage(part.ImageURL.URL)})
+	}
+	return blocks
+}
+
+// anthropicImage converts an image URL, either a base64 data URL or a plain
+// URL, to an image source
+func anthropicImage(url string) *anthropicImageSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &anthropicImageSource{Type: "url", URL: url}
+}
+
+// anthropicFinishReason maps a stop reason to the OpenAI finish reason
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "":
+		return ""
+	case "max_tokens":
+		return string(openai.FinishReasonLength)
+	case "tool_use":
+		return string(openai.FinishReasonToolCalls)
+	default:
+		return string(openai.FinishReasonStop)
+	}
+}
+
+func (u anthropicUsage) convert() *models.Usage {
+	return &models.Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// post sends the request and returns the response body, or an
+// AnthropicError for a non-2xx status
+func (c *AnthropicClient) post(ctx context.Context, areq anthropicRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(areq)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	if areq.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.doer.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &AnthropicError{HTTPStatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var errBody struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if data, _ := io.ReadAll(resp.Body); json.Unmarshal(data, &errBody) == nil && errBody.Error.Message != "" {
+		apiErr.Type = errBody.Error.Type
+		apiErr.Message = errBody.Error.Message
+	}
+	return nil, apiErr
+}
+
+// Complete sends a non-streaming Messages request
+func (c *AnthropicClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	areq := c.prepareRequest(req)
+
+	var aresp anthropicResponse
+	err := withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		body, err := c.post(ctx, areq)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		return json.NewDecoder(body).Decode(&aresp)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create message: %w", err)
+	}
+
+	msg := models.ChatCompletionMessage{Role: "assistant"}
+	var content strings.Builder
+	for _, block := range aresp.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "thinking":
+			msg.ReasoningContent = append(msg.ReasoningContent, block.Thinking)
+		}
+	}
+	msg.Content = content.String()
+
+	return &models.ChatCompletionResponse{
+		ID:    aresp.ID,
+		Model: aresp.Model,
+		Choices: []models.ChatCompletionChoice{
+			{Message: msg, FinishReason: anthropicFinishReason(aresp.StopReason)},
+		},
+		Usage: aresp.Usage.convert(),
+	}, nil
+}
+
+// CompleteStream sends a streaming Messages request. Text deltas become
+// content and thinking deltas become reasoning content.
+func (c *AnthropicClient) CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	areq := c.prepareRequest(req)
+	areq.Stream = true
+
+	// Retries stop once the upstream has accepted the stream
+	var body io.ReadCloser
+	err := withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		var err error
+		body, err = c.post(ctx, areq)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create message stream: %w", err)
+	}
+
+	resultChan := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(resultChan)
+		defer body.Close()
+
+		var contentBuilder strings.Builder
+		var usage anthropicUsage
+		w := &streamWriter{ctx: ctx, out: resultChan}
+		events := newSSEReader(body)
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			data, err := events.next()
+			if err != nil {
+				// Keep what arrived unless the request was cancelled
+				if ctx.Err() == nil {
+					w.flush()
+				}
+				return
+			}
+			var event anthropicEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				continue
+			}
+
+			var chunk models.ChatCompletionChoice
+			switch event.Type {
+			case "message_start":
+				usage.InputTokens = event.Message.Usage.InputTokens
+				continue
+			case "content_block_delta":
+				switch event.Delta.Type {
+				case "text_delta":
+					if event.Delta.Text == "" {
+						continue
+					}
+					contentBuilder.WriteString(event.Delta.Text)
+					chunk.Message.Content = event.Delta.Text
+					if c.config.StreamMode == StreamModeAggregate {
+						chunk.Message.Content = contentBuilder.String()
+					}
+				case "thinking_delta":
+					if event.Delta.Thinking == "" {
+						continue
+					}
+					chunk.Message.ReasoningContent = []string{event.Delta.Thinking}
+				default:
+					continue
+				}
+			case "message_delta":
+				if event.Usage != nil {
+					usage.OutputTokens = event.Usage.OutputTokens
+					w.usage = usage.convert()
+				}
+				if event.Delta.StopReason == "" {
+					continue
+				}
+				chunk.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			case "message_stop":
+				w.flush()
+				return
+			case "error":
+				// What arrived so far is kept and the stream fails with the
+				// error, so callers do not take it for a complete answer
+				status, ok := anthropicErrorStatus[event.Error.Type]
+				if !ok {
+					status = http.StatusInternalServerError
+				}
+				w.flush()
+				w.emit(&models.ChatCompletionResponse{
+					Err: &AnthropicError{HTTPStatusCode: status, Type: event.Error.Type, Message: event.Error.Message},
+				})
+				return
+			default:
+				continue
+			}
+
+			chunk.Message.Role = "assistant"
+			w.send(&models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{chunk}})
+		}
+	}()
+
+	return resultChan, nil
+}
+
+// sseReader reads the data of server-sent events
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// next returns the data of the next event, joining multi-line data fields
+func (s *sseReader) next() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := s.r.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(data) > 0 {
+				return data, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+		}
+		if err != nil {
+			if len(data) > 0 {
+				return data, nil
+			}
+			return nil, err
+		}
+	}
+}
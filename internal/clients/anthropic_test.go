@@ -0,0 +1,252 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// anthropicServer serves the Messages API with handler after checking the
+// request path and version header
+func anthropicServer(t *testing.T, handler func(w http.ResponseWriter, req anthropicRequest)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+
+		var req anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		handler(w, req)
+	}))
+}
+
+func newTestAnthropicClient(server *httptest.Server) *AnthropicClient {
+	return NewAnthropicClient(ModelClientConfig{
+		APIBase:      server.URL + "/v1",
+		Model:        "claude-sonnet",
+		ExtraHeaders: map[string]string{"x-api-key": "test-key"},
+	})
+}
+
+func TestAnthropicClient_Complete(t *testing.T) {
+	var received anthropicRequest
+	server := anthropicServer(t, func(w http.ResponseWriter, req anthropicRequest) {
+		received = req
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "msg_1",
+			"model": "claude-sonnet",
+			"content": [
+				{"type": "thinking", "thinking": "let me think"},
+				{"type": "text", "text": "Hello"},
+				{"type": "text", "text": " world"}
+			],
+			"stop_reason": "max_tokens",
+			"usage": {"input_tokens": 10, "output_tokens": 5}
+		}`)
+	})
+	defer server.Close()
+
+	resp, err := newTestAnthropicClient(server).Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "first"},
+			{Role: "user", Content: "second"},
+			{Role: "assistant", Content: "ok"},
+			{Role: "user", MultiContent: []models.ContentPart{
+				{Type: "text", Text: "what is this"},
+				{Type: "image_url", ImageURL: &models.ImageURL{URL: "data:image/png;base64,aGk="}},
+			}},
+		},
+		Temperature: 0.5,
+		Stop:        []string{"END"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-sonnet", received.Model)
+	assert.Equal(t, DefaultAnthropicMaxTokens, received.MaxTokens)
+	assert.Equal(t, "be brief", received.System)
+	require.Len(t, received.Messages, 3)
+	assert.Equal(t, "user", received.Messages[0].Role)
+	assert.Equal(t, []anthropicContent{{Type: "text", Text: "first"}, {Type: "text", Text: "second"}}, received.Messages[0].Content)
+	assert.Equal(t, "assistant", received.Messages[1].Role)
+	assert.Equal(t, &anthropicImageSource{Type: "base64", MediaType: "image/png", Data: "aGk="}, received.Messages[2].Content[1].Source)
+	require.NotNil(t, received.Temperature)
+	assert.Equal(t, float32(0.5), *received.Temperature)
+	assert.Equal(t, []string{"END"}, received.StopSequences)
+	assert.False(t, received.Stream)
+
+	assert.Equal(t, "msg_1", resp.ID)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Hello world", resp.Choices[0].Message.Content)
+	assert.Equal(t, []string{"let me think"}, resp.Choices[0].Message.ReasoningContent)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, resp.Usage)
+}
+
+func TestAnthropicClient_Prefill(t *testing.T) {
+	var received anthropicRequest
+	server := anthropicServer(t, func(w http.ResponseWriter, req anthropicRequest) {
+		received = req
+		fmt.Fprint(w, `{"id":"msg_1","content":[{"type":"text","text":" leaves drift down"}],"stop_reason":"end_turn"}`)
+	})
+	defer server.Close()
+
+	resp, err := newTestAnthropicClient(server).Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "Write a haiku"},
+			{Role: "assistant", Content: "Crimson \n"},
+		},
+	})
+	require.NoError(t, err)
+
+	// The prefill is the final assistant turn, without trailing whitespace
+	require.Len(t, received.Messages, 2)
+	assert.Equal(t, "assistant", received.Messages[1].Role)
+	assert.Equal(t, []anthropicContent{{Type: "text", Text: "Crimson"}}, received.Messages[1].Content)
+	assert.Equal(t, " leaves drift down", resp.Choices[0].Message.Content)
+}
+
+func TestAnthropicClient_CompleteStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"step 1"}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+	server := anthropicServer(t, func(w http.ResponseWriter, req anthropicRequest) {
+		assert.True(t, req.Stream)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var e struct{ Type string }
+			require.NoError(t, json.Unmarshal([]byte(event), &e))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, event)
+		}
+	})
+	defer server.Close()
+
+	stream, err := newTestAnthropicClient(server).CompleteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+
+	var reasoning, content []string
+	var finishReason string
+	var usage *models.Usage
+	for chunk := range stream {
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			reasoning = append(reasoning, choice.Message.ReasoningContent...)
+			if choice.Message.Content != "" {
+				content = append(content, choice.Message.Content)
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"step 1"}, reasoning)
+	assert.Equal(t, []string{"Hello", " world"}, content)
+	assert.Equal(t, "stop", finishReason)
+	assert.Equal(t, &models.Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17}, usage)
+}
+
+func TestAnthropicClient_StreamErrorEvent(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	}
+	server := anthropicServer(t, func(w http.ResponseWriter, req anthropicRequest) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var e struct{ Type string }
+			require.NoError(t, json.Unmarshal([]byte(event), &e))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, event)
+		}
+	})
+	defer server.Close()
+
+	stream, err := newTestAnthropicClient(server).CompleteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+
+	var content string
+	var streamErr error
+	for chunk := range stream {
+		if chunk.Err != nil {
+			streamErr = chunk.Err
+			continue
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Message.Content
+		}
+	}
+
+	assert.Equal(t, "Hello", content)
+	require.Error(t, streamErr)
+	var apiErr *AnthropicError
+	require.True(t, errors.As(streamErr, &apiErr))
+	assert.Equal(t, "overloaded_error", apiErr.Type)
+	assert.Equal(t, "Overloaded", apiErr.Message)
+	assert.Equal(t, 529, HTTPStatus(streamErr))
+}
+
+func TestAnthropicClient_Error(t *testing.T) {
+	server := anthropicServer(t, func(w http.ResponseWriter, req anthropicRequest) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: too large"}}`)
+	})
+	defer server.Close()
+
+	_, err := newTestAnthropicClient(server).Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.Error(t, err)
+
+	var apiErr *AnthropicError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "invalid_request_error", apiErr.Type)
+	assert.Equal(t, "max_tokens: too large", apiErr.Message)
+	assert.Equal(t, http.StatusBadRequest, HTTPStatus(err))
+}
+
+func TestAnthropicClient_RetryOverloaded(t *testing.T) {
+	var calls int32
+	server := anthropicServer(t, func(w http.ResponseWriter, req anthropicRequest) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(529)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"msg_1","content":[{"type":"text","text":"recovered"}],"stop_reason":"end_turn"}`)
+	})
+	defer server.Close()
+
+	client := newTestAnthropicClient(server)
+	client.config.Retry = testRetry
+	resp, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "recovered", resp.Choices[0].Message.Content)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,139 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync/atomic"
+
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// Endpoint is one backend of a model served by several API bases
+type Endpoint struct {
+	APIBase string
+	Weight  int // Share of the calls; zero counts as one
+}
+
+// Load balancing strategies of a BalancedClient
+const (
+	// BalanceWeighted picks each endpoint at random in proportion to its weight
+	BalanceWeighted = "weighted"
+	// BalanceRoundRobin takes the endpoints in turn, each as many times as its weight
+	BalanceRoundRobin = "round_robin"
+)
+
+// BalancedClient spreads calls over the clients of several endpoints. Each
+// call starts on the endpoint picked by the strategy and fails over to the
+// following endpoints while they cannot be reached.
+type BalancedClient struct {
+	clients  []ModelClient
+	weights  []int
+	total    int
+	strategy string
+	next     atomic.Uint64
+}
+
+// NewBalancedClient balances calls over clients, weighted by the matching
+// entry of weights. An empty strategy selects BalanceWeighted.
+func NewBalancedClient(clients []ModelClient, weights []int, strategy string) *BalancedClient {
+	b := &BalancedClient{
+		clients:  clients,
+		weights:  make([]int, len(clients)),
+		strategy: strategy,
+	}
+	for i := range clients {
+		b.weights[i] = 1
+		if i < len(weights) && weights[i] > 0 {
+			b.weights[i] = weights[i]
+		}
+		b.total += b.weights[i]
+	}
+	return b
+}
+
+// newEndpointsClient creates a client per endpoint of cfg on provider and
+// balances the calls over them
+func newEndpointsClient(provider string, cfg ModelClientConfig) (ModelClient, error) {
+	clients := make([]ModelClient, len(cfg.Endpoints))
+	weights := make([]int, len(cfg.Endpoints))
+	for i, endpoint := range cfg.Endpoints {
+		endpointCfg := cfg
+		endpointCfg.APIBase = endpoint.APIBase
+		endpointCfg.Endpoints = nil
+		client, err := NewModelClient(provider, endpointCfg)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = client
+		weights[i] = endpoint.Weight
+	}
+	return NewBalancedClient(clients, weights, cfg.LoadBalancing), nil
+}
+
+// Complete sends the request to the picked endpoint, failing over to the
+// next one when it cannot be reached
+func (b *BalancedClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	var resp *models.ChatCompletionResponse
+	err := b.failover(ctx, func(client ModelClient) error {
+		var err error
+		resp, err = client.Complete(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// CompleteStream opens the stream on the picked endpoint, failing over to
+// the next one when it cannot be reached. A stream that has started is not
+// moved to another endpoint.
+func (b *BalancedClient) CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	var stream <-chan *models.ChatCompletionResponse
+	err := b.failover(ctx, func(client ModelClient) error {
+		var err error
+		stream, err = client.CompleteStream(ctx, req)
+		return err
+	})
+	return stream, err
+}
+
+// failover calls call with the picked client and then with the following
+// ones until an endpoint is reached or all of them have been tried
+func (b *BalancedClient) failover(ctx context.Context, call func(client ModelClient) error) error {
+	start := b.pick()
+	var err error
+	for i := range b.clients {
+		err = call(b.clients[(start+i)%len(b.clients)])
+		if err == nil || !isUnreachable(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// pick returns the index of the endpoint a call starts on
+func (b *BalancedClient) pick() int {
+	var n int
+	if b.strategy == BalanceRoundRobin {
+		n = int((b.next.Add(1) - 1) % uint64(b.total))
+	} else {
+		n = rand.Intn(b.total)
+	}
+	for i, weight := range b.weights {
+		if n < weight {
+			return i
+		}
+		n -= weight
+	}
+	return 0
+}
+
+// isUnreachable reports whether err means the endpoint could not be
+// reached, as opposed to an error response it sent
+func isUnreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || HTTPStatus(err) != 0 {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
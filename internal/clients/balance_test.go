@@ -0,0 +1,143 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// endpointStub answers with its name, or fails with err when set
+type endpointStub struct {
+	name  string
+	err   error
+	calls atomic.Int32
+}
+
+func (s *endpointStub) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	s.calls.Add(1)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.ChatCompletionResponse{
+		Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: s.name}}},
+	}, nil
+}
+
+func (s *endpointStub) CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	resp, err := s.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *models.ChatCompletionResponse, 1)
+	ch <- resp
+	close(ch)
+	return ch, nil
+}
+
+func TestBalancedClient_Distribution(t *testing.T) {
+	const requests = 4000
+	tests := []struct {
+		strategy  string
+		tolerance int
+	}{
+		{BalanceWeighted, 200},
+		{BalanceRoundRobin, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			a, b := &endpointStub{name: "a"}, &endpointStub{name: "b"}
+			client := NewBalancedClient([]ModelClient{a, b}, []int{3, 1}, tt.strategy)
+
+			counts := map[string]int{}
+			for i := 0; i < requests; i++ {
+				resp, err := client.Complete(context.Background(), &models.ChatCompletionRequest{})
+				require.NoError(t, err)
+				counts[resp.Choices[0].Message.Content]++
+			}
+			assert.InDelta(t, requests*3/4, counts["a"], float64(tt.tolerance))
+			assert.InDelta(t, requests/4, counts["b"], float64(tt.tolerance))
+		})
+	}
+}
+
+func TestBalancedClient_ZeroWeightCountsAsOne(t *testing.T) {
+	a, b := &endpointStub{name: "a"}, &endpointStub{name: "b"}
+	client := NewBalancedClient([]ModelClient{a, b}, nil, BalanceRoundRobin)
+	for i := 0; i < 10; i++ {
+		_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(5), a.calls.Load())
+	assert.Equal(t, int32(5), b.calls.Load())
+}
+
+func TestBalancedClient_ErrorResponseDoesNotFailOver(t *testing.T) {
+	apiErr := &openai.APIError{HTTPStatusCode: http.StatusBadRequest, Message: "bad request"}
+	a, b := &endpointStub{name: "a", err: apiErr}, &endpointStub{name: "b"}
+	client := NewBalancedClient([]ModelClient{a, b}, []int{1, 0}, BalanceRoundRobin)
+
+	_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{})
+	assert.ErrorIs(t, err, apiErr)
+	assert.Equal(t, int32(0), b.calls.Load())
+}
+
+func TestNewModelClient_EndpointsFailOver(t *testing.T) {
+	var served atomic.Int32
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+			},
+		})
+	}))
+	defer live.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	client, err := NewModelClient(config.ProviderOpenAI, ModelClientConfig{
+		Model:         "test-model",
+		Endpoints:     []Endpoint{{APIBase: dead.URL}, {APIBase: live.URL}},
+		LoadBalancing: BalanceRoundRobin,
+	})
+	require.NoError(t, err)
+	require.IsType(t, &BalancedClient{}, client)
+
+	// Every call succeeds whichever endpoint it starts on
+	for i := 0; i < 4; i++ {
+		resp, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+			Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ok", resp.Choices[0].Message.Content)
+	}
+	assert.Equal(t, int32(4), served.Load())
+}
+
+func TestNewModelClient_AllEndpointsDown(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	client, err := NewModelClient(config.ProviderOpenAI, ModelClientConfig{
+		Model:     "test-model",
+		Endpoints: []Endpoint{{APIBase: dead.URL}, {APIBase: dead.URL}},
+	})
+	require.NoError(t, err)
+
+	_, err = client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.Error(t, err)
+	assert.True(t, isUnreachable(context.Background(), err), "unexpected error: %v", err)
+}
@@ -0,0 +1,105 @@
+package clients
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+)
+
+// MaxRawDebugBytes bounds how much of each raw upstream response is logged
+const MaxRawDebugBytes = 16 << 10
+
+// sensitiveHeaders are never logged in full
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Goog-Api-Key", "Api-Key"}
+
+// debugLogf writes raw upstream responses; tests replace it to capture them
+var debugLogf = func(format string, args ...interface{}) {
+	logger.GetLogger().WithComponent("clients").Debug(format, args...)
+}
+
+// rawDebugTransport logs the raw bytes of every upstream response at DEBUG
+// once its body is closed, together with the request headers with
+// credentials and extra headers redacted
+type rawDebugTransport struct {
+	base     http.RoundTripper
+	redacted map[string]bool
+}
+
+func newRawDebugTransport(base http.RoundTripper, extraHeaders map[string]string) *rawDebugTransport {
+	t := &rawDebugTransport{base: base, redacted: make(map[string]bool)}
+	for _, name := range sensitiveHeaders {
+		t.redacted[http.CanonicalHeaderKey(name)] = true
+	}
+	for name := range extraHeaders {
+		t.redacted[http.CanonicalHeaderKey(name)] = true
+	}
+	return t
+}
+
+func (t *rawDebugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	headers := t.redact(req.Header)
+	resp.Body = &rawDebugBody{
+		ReadCloser: resp.Body,
+		log: func(raw []byte, size int) {
+			truncated := ""
+			if size > len(raw) {
+				truncated = " (truncated)"
+			}
+			debugLogf("Raw upstream response for %s %s: status=%d headers=%s bytes=%d%s body=%s",
+				req.Method, req.URL.Redacted(), resp.StatusCode, headers, size, truncated, raw)
+		},
+	}
+	return resp, nil
+}
+
+// redact renders the headers with sensitive values replaced
+func (t *rawDebugTransport) redact(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header[name], ",")
+		if t.redacted[http.CanonicalHeaderKey(name)] {
+			value = "[REDACTED]"
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return "{" + strings.Join(parts, "; ") + "}"
+}
+
+// rawDebugBody keeps the first MaxRawDebugBytes read from the body and logs
+// them when the body is closed
+type rawDebugBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	size int
+	once sync.Once
+	log  func(raw []byte, size int)
+}
+
+func (b *rawDebugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := MaxRawDebugBytes - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	b.size += n
+	return n, err
+}
+
+func (b *rawDebugBody) Close() error {
+	b.once.Do(func() { b.log(b.buf.Bytes(), b.size) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,55 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var (
+	// ErrNoChoices is returned when the upstream response contains no choices
+	ErrNoChoices = errors.New("no choices in response")
+	// ErrStreamClosed is returned when a stream ends before delivering any response
+	ErrStreamClosed = errors.New("stream closed before any response")
+)
+
+// StreamIdleError ends a stream whose upstream sent no data for longer than
+// the configured idle timeout
+type StreamIdleError struct {
+	Timeout time.Duration
+}
+
+func (e *StreamIdleError) Error() string {
+	return fmt.Sprintf("stream idle for more than %s", e.Timeout)
+}
+
+// Is reports the idle stream as a deadline error so it is handled like any
+// other timeout
+func (e *StreamIdleError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// HTTPStatus returns the upstream HTTP status code carried by err, or 0 when
+// the error did not come from an HTTP response
+func HTTPStatus(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	var anthropicErr *AnthropicError
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.HTTPStatusCode
+	}
+	var geminiErr *GeminiError
+	if errors.As(err, &geminiErr) {
+		return geminiErr.HTTPStatusCode
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusTooManyRequests, HTTPStatus(fmt.Errorf("create chat completion: %w",
+		&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests})))
+	assert.Equal(t, http.StatusBadGateway, HTTPStatus(fmt.Errorf("create chat completion: %w",
+		&openai.RequestError{HTTPStatusCode: http.StatusBadGateway})))
+	assert.Equal(t, 0, HTTPStatus(errors.New("connection reset")))
+}
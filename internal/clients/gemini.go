@@ -0,0 +1,413 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// GeminiError is an error response from the Gemini API
+type GeminiError struct {
+	HTTPStatusCode int
+	Status         string
+	Message        string
+}
+
+func (e *GeminiError) Error() string {
+	return fmt.Sprintf("gemini error, status code: %d, status: %s, message: %s", e.HTTPStatusCode, e.Status, e.Message)
+}
+
+// GeminiClient implements ModelClient on Google's Gemini generateContent API.
+// The API key is sent through ExtraHeaders as x-goog-api-key.
+type GeminiClient struct {
+	config  ModelClientConfig
+	baseURL string
+	doer    openai.HTTPDoer
+}
+
+// NewGeminiClient creates a client for the Gemini API under config.APIBase,
+// e.g. https://generativelanguage.googleapis.com/v1beta
+func NewGeminiClient(config ModelClientConfig) *GeminiClient {
+	baseURL := BaseURL(strings.TrimSuffix(config.APIBase, "/"))
+	return &GeminiClient{
+		config:  config,
+		baseURL: baseURL,
+		doer:    newHTTPClient(config),
+	}
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is a content part. Requests use text and image parts; responses
+// carry text parts, with thought set on the model's reasoning.
+type geminiPart struct {
+	Text       string            `json:"text,omitempty"`
+	Thought    bool              `json:"thought,omitempty"`
+	InlineData *geminiInlineData `json:"inlineData,omitempty"`
+	FileData   *geminiFileData   `json:"fileData,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float32              `json:"temperature,omitempty"`
+	TopP            *float32              `json:"topP,omitempty"`
+	TopK            *int                  `json:"topK,omitempty"`
+	MaxOutputTokens int                   `json:"maxOutputTokens,omitempty"`
+	CandidateCount  int                   `json:"candidateCount,omitempty"`
+	StopSequences   []string              `json:"stopSequences,omitempty"`
+	ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+	ThinkingBudget  *int `json:"thinkingBudget,omitempty"`
+}
+
+type geminiResponse struct {
+	ResponseID    string            `json:"responseId"`
+	ModelVersion  string            `json:"modelVersion"`
+	Candidates    []geminiCandidate `json:"candidates"`
+	UsageMetadata *geminiUsage      `json:"usageMetadata"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+	Index        int           `json:"index"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// prepareRequest converts the request to the generateContent format. System
+// messages become the system instruction and consecutive messages of the
+// same role are merged, since the API expects user and model to alternate.
+func (c *GeminiClient) prepareRequest(req *models.ChatCompletionRequest) geminiRequest {
+	if req.Model == "" {
+		req.Model = c.config.Model
+	}
+
+	var greq geminiRequest
+	var system []geminiPart
+	for _, msg := range req.Messages {
+		if msg.Role == "system" || msg.Role == "developer" {
+			system = append(system, geminiPart{Text: msg.Content})
+			continue
+		}
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+		parts := geminiParts(msg)
+		if n := len(greq.Contents); n > 0 && greq.Contents[n-1].Role == role {
+			greq.Contents[n-1].Parts = append(greq.Contents[n-1].Parts, parts...)
+			continue
+		}
+		greq.Contents = append(greq.Contents, geminiContent{Role: role, Parts: parts})
+	}
+	if len(system) > 0 {
+		greq.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	var gen geminiGenerationConfig
+	var thinking geminiThinkingConfig
+	for k, v := range outboundParams(c.config, req) {
+		switch k {
+		case "max_tokens":
+			if v, ok := toInt(v); ok {
+				gen.MaxOutputTokens = v
+			}
+		case "n":
+			if v, ok := toInt(v); ok {
+				gen.CandidateCount = v
+			}
+		case "temperature":
+			if v, ok := toFloat32(v); ok {
+				gen.Temperature = &v
+			}
+		case "top_p":
+			if v, ok := toFloat32(v); ok {
+				gen.TopP = &v
+			}
+		case "top_k":
+			if v, ok := toInt(v); ok {
+				gen.TopK = &v
+			}
+		case "stop":
+			if v, ok := toStringSlice(v); ok {
+				gen.StopSequences = v
+			}
+		case "include_thoughts":
+			if v, ok := v.(bool); ok {
+				thinking.IncludeThoughts = v
+			}
+		case "thinking_budget":
+			if v, ok := toInt(v); ok {
+				thinking.ThinkingBudget = &v
+			}
+		}
+	}
+	if thinking.IncludeThoughts || thinking.ThinkingBudget != nil {
+		gen.ThinkingConfig = &thinking
+	}
+	greq.GenerationConfig = &gen
+	return greq
+}
+
+// geminiParts converts the content of a message to parts
+func geminiParts(msg models.ChatCompletionMessage) []geminiPart {
+	if len(msg.MultiContent) == 0 {
+		return []geminiPart{{Text: msg.Content}}
+	}
+	parts := make([]geminiPart, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		if part.ImageURL == nil {
+			parts = append(parts, geminiPart{Text: part.Text})
+			continue
+		}
+		parts = append(parts, geminiImage(part.ImageURL.URL))
+	}
+	return parts
+}
+
+// geminiImage converts an image URL, either a base64 data URL or a file URI,
+// to a part
+func geminiImage(url string) geminiPart {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mimeType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return geminiPart{InlineData: &geminiInlineData{MimeType: mimeType, Data: data}}
+		}
+	}
+	return geminiPart{FileData: &geminiFileData{FileURI: url}}
+}
+
+// geminiFinishReason maps a Gemini finish reason to the OpenAI finish reason
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "", "FINISH_REASON_UNSPECIFIED":
+		return ""
+	case "MAX_TOKENS":
+		return string(openai.FinishReasonLength)
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return string(openai.FinishReasonContentFilter)
+	default:
+		return string(openai.FinishReasonStop)
+	}
+}
+
+// convert counts thinking tokens as completion tokens, as OpenAI does for
+// reasoning models
+func (u geminiUsage) convert() *models.Usage {
+	return &models.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+}
+
+// splitParts returns the text and thought text of a candidate's parts
+func (cand geminiCandidate) splitParts() (content string, thoughts []string) {
+	var b strings.Builder
+	for _, part := range cand.Content.Parts {
+		if part.Thought {
+			if part.Text != "" {
+				thoughts = append(thoughts, part.Text)
+			}
+			continue
+		}
+		b.WriteString(part.Text)
+	}
+	return b.String(), thoughts
+}
+
+// post sends the request to the model method and returns the response body,
+// or a GeminiError for a non-2xx status
+func (c *GeminiClient) post(ctx context.Context, model, method string, greq geminiRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(greq)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	endpoint := c.baseURL + "/models/" + url.PathEscape(model) + ":" + method
+	if method == "streamGenerateContent" {
+		endpoint += "?alt=sse"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.doer.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &GeminiError{HTTPStatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var errBody struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if data, _ := io.ReadAll(resp.Body); json.Unmarshal(data, &errBody) == nil && errBody.Error.Message != "" {
+		apiErr.Status = errBody.Error.Status
+		apiErr.Message = errBody.Error.Message
+	}
+	return nil, apiErr
+}
+
+// Complete sends a generateContent request
+func (c *GeminiClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	greq := c.prepareRequest(req)
+
+	var gresp geminiResponse
+	err := withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		body, err := c.post(ctx, req.Model, "generateContent", greq)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		return json.NewDecoder(body).Decode(&gresp)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generate content: %w", err)
+	}
+	if len(gresp.Candidates) == 0 {
+		return nil, ErrNoChoices
+	}
+
+	resp := &models.ChatCompletionResponse{
+		ID:    gresp.ResponseID,
+		Model: gresp.ModelVersion,
+	}
+	for _, cand := range gresp.Candidates {
+		content, thoughts := cand.splitParts()
+		resp.Choices = append(resp.Choices, models.ChatCompletionChoice{
+			Index: cand.Index,
+			Message: models.ChatCompletionMessage{
+				Role:             "assistant",
+				Content:          content,
+				ReasoningContent: thoughts,
+			},
+			FinishReason: geminiFinishReason(cand.FinishReason),
+		})
+	}
+	if gresp.UsageMetadata != nil {
+		resp.Usage = gresp.UsageMetadata.convert()
+	}
+	return resp, nil
+}
+
+// CompleteStream sends a streamGenerateContent request. Text parts become
+// content and thought parts become reasoning content. Only the first
+// candidate is streamed.
+func (c *GeminiClient) CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	greq := c.prepareRequest(req)
+
+	// Retries stop once the upstream has accepted the stream
+	var body io.ReadCloser
+	err := withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		var err error
+		body, err = c.post(ctx, req.Model, "streamGenerateContent", greq)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stream generate content: %w", err)
+	}
+
+	resultChan := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(resultChan)
+		defer body.Close()
+
+		var contentBuilder strings.Builder
+		w := &streamWriter{ctx: ctx, out: resultChan}
+		events := newSSEReader(body)
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			data, err := events.next()
+			if err != nil {
+				// Keep what arrived unless the request was cancelled
+				if ctx.Err() == nil {
+					w.flush()
+				}
+				return
+			}
+			var chunk geminiResponse
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				continue
+			}
+			// Every chunk reports the usage so far
+			if chunk.UsageMetadata != nil {
+				w.usage = chunk.UsageMetadata.convert()
+			}
+			if len(chunk.Candidates) == 0 {
+				continue
+			}
+
+			cand := chunk.Candidates[0]
+			content, thoughts := cand.splitParts()
+			finishReason := geminiFinishReason(cand.FinishReason)
+			if content == "" && len(thoughts) == 0 && finishReason == "" {
+				continue
+			}
+			if content != "" {
+				contentBuilder.WriteString(content)
+				if c.config.StreamMode == StreamModeAggregate {
+					content = contentBuilder.String()
+				}
+			}
+			w.send(&models.ChatCompletionResponse{
+				ID:    chunk.ResponseID,
+				Model: chunk.ModelVersion,
+				Choices: []models.ChatCompletionChoice{{
+					Message: models.ChatCompletionMessage{
+						Role:             "assistant",
+						Content:          content,
+						ReasoningContent: thoughts,
+					},
+					FinishReason: finishReason,
+				}},
+			})
+		}
+	}()
+
+	return resultChan, nil
+}
@@ -0,0 +1,186 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// geminiServer serves the Gemini API with handler after checking the API key
+func geminiServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, req geminiRequest)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "test-key", r.Header.Get("x-goog-api-key"))
+
+		var req geminiRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		handler(w, r, req)
+	}))
+}
+
+func newTestGeminiClient(server *httptest.Server) *GeminiClient {
+	return NewGeminiClient(ModelClientConfig{
+		APIBase:       server.URL + "/v1beta",
+		Model:         "gemini-2.5-pro",
+		ExtraHeaders:  map[string]string{"x-goog-api-key": "test-key"},
+		DefaultParams: map[string]interface{}{"include_thoughts": true},
+	})
+}
+
+func TestGeminiClient_Complete(t *testing.T) {
+	var received geminiRequest
+	server := geminiServer(t, func(w http.ResponseWriter, r *http.Request, req geminiRequest) {
+		assert.Equal(t, "/v1beta/models/gemini-2.5-pro:generateContent", r.URL.Path)
+		received = req
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"responseId": "resp_1",
+			"modelVersion": "gemini-2.5-pro",
+			"candidates": [{
+				"content": {"role": "model", "parts": [
+					{"text": "let me think", "thought": true},
+					{"text": "Hello"},
+					{"text": " world"}
+				]},
+				"finishReason": "MAX_TOKENS"
+			}],
+			"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "thoughtsTokenCount": 3, "totalTokenCount": 18}
+		}`)
+	})
+	defer server.Close()
+
+	resp, err := newTestGeminiClient(server).Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "first"},
+			{Role: "user", Content: "second"},
+			{Role: "assistant", Content: "ok"},
+			{Role: "user", MultiContent: []models.ContentPart{
+				{Type: "text", Text: "what is this"},
+				{Type: "image_url", ImageURL: &models.ImageURL{URL: "data:image/png;base64,aGk="}},
+			}},
+		},
+		MaxTokens:   100,
+		Temperature: 0.5,
+		Stop:        []string{"END"},
+	})
+	require.NoError(t, err)
+
+	require.NotNil(t, received.SystemInstruction)
+	assert.Equal(t, []geminiPart{{Text: "be brief"}}, received.SystemInstruction.Parts)
+	require.Len(t, received.Contents, 3)
+	assert.Equal(t, geminiContent{Role: "user", Parts: []geminiPart{{Text: "first"}, {Text: "second"}}}, received.Contents[0])
+	assert.Equal(t, "model", received.Contents[1].Role)
+	assert.Equal(t, &geminiInlineData{MimeType: "image/png", Data: "aGk="}, received.Contents[2].Parts[1].InlineData)
+	require.NotNil(t, received.GenerationConfig)
+	assert.Equal(t, 100, received.GenerationConfig.MaxOutputTokens)
+	require.NotNil(t, received.GenerationConfig.Temperature)
+	assert.Equal(t, float32(0.5), *received.GenerationConfig.Temperature)
+	assert.Equal(t, []string{"END"}, received.GenerationConfig.StopSequences)
+	assert.Equal(t, &geminiThinkingConfig{IncludeThoughts: true}, received.GenerationConfig.ThinkingConfig)
+
+	assert.Equal(t, "resp_1", resp.ID)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Hello world", resp.Choices[0].Message.Content)
+	assert.Equal(t, []string{"let me think"}, resp.Choices[0].Message.ReasoningContent)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, &models.Usage{PromptTokens: 10, CompletionTokens: 8, TotalTokens: 18}, resp.Usage)
+}
+
+func TestGeminiClient_CompleteNoCandidates(t *testing.T) {
+	server := geminiServer(t, func(w http.ResponseWriter, r *http.Request, req geminiRequest) {
+		fmt.Fprint(w, `{"promptFeedback": {"blockReason": "SAFETY"}}`)
+	})
+	defer server.Close()
+
+	_, err := newTestGeminiClient(server).Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	assert.ErrorIs(t, err, ErrNoChoices)
+}
+
+func TestGeminiClient_CompleteStream(t *testing.T) {
+	chunks := []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"step 1","thought":true}]}}],"usageMetadata":{"promptTokenCount":10,"thoughtsTokenCount":3,"totalTokenCount":13}}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":1,"thoughtsTokenCount":3,"totalTokenCount":14}}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":" world"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4,"thoughtsTokenCount":3,"totalTokenCount":17}}`,
+	}
+	server := geminiServer(t, func(w http.ResponseWriter, r *http.Request, req geminiRequest) {
+		assert.Equal(t, "/v1beta/models/gemini-2.5-pro:streamGenerateContent", r.URL.Path)
+		assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+		}
+	})
+	defer server.Close()
+
+	stream, err := newTestGeminiClient(server).CompleteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+
+	var reasoning, content []string
+	var finishReason string
+	var usage *models.Usage
+	for chunk := range stream {
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			reasoning = append(reasoning, choice.Message.ReasoningContent...)
+			if choice.Message.Content != "" {
+				content = append(content, choice.Message.Content)
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"step 1"}, reasoning)
+	assert.Equal(t, []string{"Hello", " world"}, content)
+	assert.Equal(t, "stop", finishReason)
+	assert.Equal(t, &models.Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17}, usage)
+}
+
+func TestGeminiClient_Error(t *testing.T) {
+	server := geminiServer(t, func(w http.ResponseWriter, r *http.Request, req geminiRequest) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}`)
+	})
+	defer server.Close()
+
+	_, err := newTestGeminiClient(server).CompleteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.Error(t, err)
+
+	var apiErr *GeminiError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "INVALID_ARGUMENT", apiErr.Status)
+	assert.Equal(t, "API key not valid", apiErr.Message)
+	assert.Equal(t, http.StatusBadRequest, HTTPStatus(err))
+}
+
+func TestGeminiFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		"STOP":       "stop",
+		"MAX_TOKENS": "length",
+		"SAFETY":     "content_filter",
+		"RECITATION": "content_filter",
+		"OTHER":      "stop",
+	}
+	for reason, expected := range tests {
+		assert.Equal(t, expected, geminiFinishReason(reason), reason)
+	}
+}
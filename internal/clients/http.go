@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newHTTPClient builds the HTTP client for upstream calls, routing them
+// through the configured proxy, adding the extra headers and logging raw
+// responses when DebugRaw is set
+func newHTTPClient(config ModelClientConfig) openai.HTTPDoer {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.ProxyURL != "" {
+		proxy, err := parseProxyURL(config.ProxyURL)
+		if err != nil {
+			// Fail every call rather than silently bypassing the proxy
+			transport.Proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+		} else {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+
+	var rt http.RoundTripper = transport
+	if config.DebugRaw {
+		rt = newRawDebugTransport(rt, config.ExtraHeaders)
+	}
+	if len(config.ExtraHeaders) > 0 {
+		rt = &headerTransport{base: rt, headers: config.ExtraHeaders}
+	}
+	return &retryAfterDoer{doer: &http.Client{Transport: rt}}
+}
+
+// BaseURL returns apiBase with an http:// scheme when it has none, the way
+// the clients call it
+func BaseURL(apiBase string) string {
+	if !strings.HasPrefix(apiBase, "http://") && !strings.HasPrefix(apiBase, "https://") {
+		return "http://" + apiBase
+	}
+	return apiBase
+}
+
+// parseProxyURL parses an absolute proxy URL
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxy, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	if proxy.Scheme == "" || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: scheme and host are required", raw)
+	}
+	return proxy, nil
+}
+
+// headerTransport sets extra headers on every outgoing request, replacing
+// any value already set for the same header
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
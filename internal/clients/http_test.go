@@ -0,0 +1,159 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// completionHandler answers every request with a fixed completion and
+// passes the request to inspect
+func completionHandler(inspect func(r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inspect(r)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+			},
+		})
+	}
+}
+
+var newTestClients = []struct {
+	name      string
+	newClient func(cfg ModelClientConfig) ModelClient
+}{
+	{"normal", func(cfg ModelClientConfig) ModelClient { return NewNormalClient(cfg) }},
+	{"reasoner", func(cfg ModelClientConfig) ModelClient { return NewReasonerClient(cfg) }},
+}
+
+func testRequest() *models.ChatCompletionRequest {
+	return &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	}
+}
+
+func TestClient_ExtraHeaders(t *testing.T) {
+	for _, tc := range newTestClients {
+		t.Run(tc.name, func(t *testing.T) {
+			var headers http.Header
+			server := httptest.NewServer(completionHandler(func(r *http.Request) { headers = r.Header.Clone() }))
+			defer server.Close()
+
+			client := tc.newClient(ModelClientConfig{
+				APIBase:      server.URL,
+				ExtraHeaders: map[string]string{"X-Org-Id": "org-42"},
+			})
+			_, err := client.Complete(context.Background(), testRequest())
+			require.NoError(t, err)
+			assert.Equal(t, "org-42", headers.Get("X-Org-Id"))
+			assert.Equal(t, "application/json", headers.Get("Content-Type"))
+
+			_, err = client.CompleteStream(context.Background(), testRequest())
+			require.NoError(t, err)
+			assert.Equal(t, "org-42", headers.Get("X-Org-Id"))
+		})
+	}
+}
+
+func TestClient_ProxyURL(t *testing.T) {
+	for _, tc := range newTestClients {
+		t.Run(tc.name, func(t *testing.T) {
+			// A forward proxy receives the absolute URL of the upstream request
+			var proxied string
+			proxy := httptest.NewServer(completionHandler(func(r *http.Request) { proxied = r.URL.String() }))
+			defer proxy.Close()
+
+			client := tc.newClient(ModelClientConfig{
+				APIBase:  "http://upstream.invalid/v1",
+				ProxyURL: proxy.URL,
+			})
+			resp, err := client.Complete(context.Background(), testRequest())
+			require.NoError(t, err)
+			assert.Equal(t, "ok", resp.Choices[0].Message.Content)
+			assert.Equal(t, "http://upstream.invalid/v1/chat/completions", proxied)
+		})
+	}
+}
+
+func TestClient_InvalidProxyURL(t *testing.T) {
+	called := false
+	server := httptest.NewServer(completionHandler(func(r *http.Request) { called = true }))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{APIBase: server.URL, ProxyURL: "not a url"})
+	_, err := client.Complete(context.Background(), testRequest())
+	assert.ErrorContains(t, err, "invalid proxy url")
+	assert.False(t, called)
+}
+
+// captureDebugLog collects the raw responses logged while a test runs
+func captureDebugLog(t *testing.T) *[]string {
+	var lines []string
+	original := debugLogf
+	debugLogf = func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	t.Cleanup(func() { debugLogf = original })
+	return &lines
+}
+
+func TestClient_DebugRaw(t *testing.T) {
+	for _, tc := range newTestClients {
+		for _, enabled := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/enabled=%v", tc.name, enabled), func(t *testing.T) {
+				lines := captureDebugLog(t)
+				server := httptest.NewServer(completionHandler(func(r *http.Request) {}))
+				defer server.Close()
+
+				client := tc.newClient(ModelClientConfig{
+					APIBase:      server.URL,
+					DebugRaw:     enabled,
+					ExtraHeaders: map[string]string{"Authorization": "Bearer secret", "X-Org-Id": "org-42"},
+				})
+				_, err := client.Complete(context.Background(), testRequest())
+				require.NoError(t, err)
+
+				if !enabled {
+					assert.Empty(t, *lines)
+					return
+				}
+				require.Len(t, *lines, 1)
+				line := (*lines)[0]
+				assert.Contains(t, line, "POST "+server.URL+"/chat/completions")
+				assert.Contains(t, line, "status=200")
+				assert.Contains(t, line, `"content":"ok"`)
+				assert.Contains(t, line, "Authorization: [REDACTED]")
+				assert.Contains(t, line, "X-Org-Id: [REDACTED]")
+				assert.NotContains(t, line, "secret")
+				assert.NotContains(t, line, "org-42")
+			})
+		}
+	}
+}
+
+func TestRawDebugBody_Truncates(t *testing.T) {
+	var raw []byte
+	var size int
+	body := &rawDebugBody{
+		ReadCloser: io.NopCloser(strings.NewReader(strings.Repeat("a", MaxRawDebugBytes+100))),
+		log:        func(b []byte, n int) { raw, size = b, n },
+	}
+	_, err := io.Copy(io.Discard, body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+
+	assert.Len(t, raw, MaxRawDebugBytes)
+	assert.Equal(t, MaxRawDebugBytes+100, size)
+}
@@ -0,0 +1,77 @@
+package clients
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// fromOpenAILogProbs converts the logprobs of a response choice to our format
+func fromOpenAILogProbs(logprobs *openai.LogProbs) *models.LogProbs {
+	if logprobs == nil {
+		return nil
+	}
+	result := &models.LogProbs{Content: make([]models.LogProb, len(logprobs.Content))}
+	for i, lp := range logprobs.Content {
+		result.Content[i] = models.LogProb{
+			Token:       lp.Token,
+			LogProb:     lp.LogProb,
+			Bytes:       bytesToInts(lp.Bytes),
+			TopLogProbs: make([]models.TopLogProb, len(lp.TopLogProbs)),
+		}
+		for j, top := range lp.TopLogProbs {
+			result.Content[i].TopLogProbs[j] = models.TopLogProb{
+				Token:   top.Token,
+				LogProb: top.LogProb,
+				Bytes:   bytesToInts(top.Bytes),
+			}
+		}
+	}
+	return result
+}
+
+// fromOpenAIStreamLogProbs converts the logprobs of a stream chunk to our format
+func fromOpenAIStreamLogProbs(logprobs *openai.ChatCompletionStreamChoiceLogprobs) *models.LogProbs {
+	if logprobs == nil || len(logprobs.Content) == 0 {
+		return nil
+	}
+	result := &models.LogProbs{Content: make([]models.LogProb, len(logprobs.Content))}
+	for i, lp := range logprobs.Content {
+		result.Content[i] = models.LogProb{
+			Token:       lp.Token,
+			LogProb:     lp.Logprob,
+			Bytes:       int64sToInts(lp.Bytes),
+			TopLogProbs: make([]models.TopLogProb, len(lp.TopLogprobs)),
+		}
+		for j, top := range lp.TopLogprobs {
+			result.Content[i].TopLogProbs[j] = models.TopLogProb{
+				Token:   top.Token,
+				LogProb: top.Logprob,
+				Bytes:   int64sToInts(top.Bytes),
+			}
+		}
+	}
+	return result
+}
+
+// bytesToInts converts token bytes to the integer list the API reports them as
+func bytesToInts(b []byte) []int {
+	if b == nil {
+		return nil
+	}
+	result := make([]int, len(b))
+	for i, v := range b {
+		result[i] = int(v)
+	}
+	return result
+}
+
+func int64sToInts(b []int64) []int {
+	if b == nil {
+		return nil
+	}
+	result := make([]int, len(b))
+	for i, v := range b {
+		result[i] = int(v)
+	}
+	return result
+}
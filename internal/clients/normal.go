@@ -2,6 +2,7 @@ package clients
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	openai "github.com/sashabaranov/go-openai"
@@ -17,12 +18,8 @@ type NormalClient struct {
 // NewNormalClient creates a new Normal model client
 func NewNormalClient(config ModelClientConfig) *NormalClient {
 	clientConfig := openai.DefaultConfig("")
-	clientConfig.BaseURL = config.APIBase
-	
-	// Ensure URL has scheme
-	if !strings.HasPrefix(clientConfig.BaseURL, "http://") && !strings.HasPrefix(clientConfig.BaseURL, "https://") {
-		clientConfig.BaseURL = "http://" + clientConfig.BaseURL
-	}
+	clientConfig.BaseURL = BaseURL(config.APIBase)
+	clientConfig.HTTPClient = newHTTPClient(config)
 	
 	return &NormalClient{
 		config: config,
@@ -39,13 +36,18 @@ func (c *NormalClient) Complete(ctx context.Context, req *models.ChatCompletionR
 	}
 
 	// Call OpenAI API
-	resp, err := c.client.CreateChatCompletion(ctx, openaiReq)
+	var resp openai.ChatCompletionResponse
+	err = withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		var err error
+		resp, err = c.client.CreateChatCompletion(ctx, openaiReq)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("create chat completion: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in response")
+		return nil, ErrNoChoices
 	}
 
 	// Convert response
@@ -60,9 +62,15 @@ func (c *NormalClient) CompleteStream(ctx context.Context, req *models.ChatCompl
 		return nil, err
 	}
 	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 
-	// Create stream
-	stream, err := c.client.CreateChatCompletionStream(ctx, openaiReq)
+	// Create stream. Retries stop once the upstream has accepted the stream.
+	var stream *openai.ChatCompletionStream
+	err = withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		var err error
+		stream, err = c.client.CreateChatCompletionStream(ctx, openaiReq)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("create chat completion stream: %w", err)
 	}
@@ -75,7 +83,7 @@ func (c *NormalClient) CompleteStream(ctx context.Context, req *models.ChatCompl
 		defer stream.Close()
 
 		var contentBuilder strings.Builder
-		var partialContent []string
+		w := &streamWriter{ctx: ctx, out: resultChan}
 
 		for {
 			select {
@@ -84,26 +92,43 @@ func (c *NormalClient) CompleteStream(ctx context.Context, req *models.ChatCompl
 			default:
 				chunk, err := stream.Recv()
 				if err != nil {
+					// io.EOF marks the [DONE] sentinel; keep what arrived
+					// before any other error
+					if ctx.Err() == nil {
+						w.flush()
+					}
 					return
 				}
 
-				if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-					content := chunk.Choices[0].Delta.Content
-					contentBuilder.WriteString(content)
-					partialContent = append(partialContent, content)
-
-					resultChan <- &models.ChatCompletionResponse{
-						Choices: []models.ChatCompletionChoice{
-							{
-								Message: models.ChatCompletionMessage{
-									Role:    chunk.Choices[0].Delta.Role,
-									Content: content,
-								},
-								FinishReason: string(chunk.Choices[0].FinishReason),
+				w.setUsage(chunk)
+				if len(chunk.Choices) == 0 {
+					continue
+				}
+				choice := chunk.Choices[0]
+				if choice.Delta.Content == "" && choice.FinishReason == "" && len(choice.Delta.ToolCalls) == 0 && choice.Logprobs == nil {
+					continue
+				}
+
+				content := choice.Delta.Content
+				contentBuilder.WriteString(content)
+				if c.config.StreamMode == StreamModeAggregate {
+					content = contentBuilder.String()
+				}
+
+				w.send(&models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{
+							Index: choice.Index,
+							Message: models.ChatCompletionMessage{
+								Role:      choice.Delta.Role,
+								Content:   content,
+								ToolCalls: fromOpenAIToolCalls(choice.Delta.ToolCalls),
 							},
+							LogProbs:     fromOpenAIStreamLogProbs(choice.Logprobs),
+							FinishReason: string(choice.FinishReason),
 						},
-					}
-				}
+					},
+				})
 			}
 		}
 	}()
@@ -126,16 +151,8 @@ func (c *NormalClient) prepareRequest(req *models.ChatCompletionRequest) (openai
 		Messages: convertMessages(req.Messages),
 	}
 
-	// Apply default parameters
-	applyDefaultParams(&openaiReq, c.config.DefaultParams)
-
-	// Override with request parameters if provided
-	if req.Temperature != 0 {
-		openaiReq.Temperature = req.Temperature
-	}
-	if req.MaxTokens != 0 {
-		openaiReq.MaxTokens = req.MaxTokens
-	}
+	// Apply default parameters overridden by the request
+	applyDefaultParams(&openaiReq, outboundParams(c.config, req))
 
 	return openaiReq, nil
 }
@@ -145,40 +162,289 @@ func convertMessages(msgs []models.ChatCompletionMessage) []openai.ChatCompletio
 	result := make([]openai.ChatCompletionMessage, len(msgs))
 	for i, msg := range msgs {
 		result[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:       msg.Role,
+			ToolCalls:  toOpenAIToolCalls(msg.ToolCalls),
+			ToolCallID: msg.ToolCallID,
+		}
+		if len(msg.MultiContent) == 0 {
+			result[i].Content = msg.Content
+			continue
+		}
+		// go-openai rejects messages that set both Content and MultiContent
+		result[i].MultiContent = make([]openai.ChatMessagePart, len(msg.MultiContent))
+		for j, part := range msg.MultiContent {
+			result[i].MultiContent[j] = openai.ChatMessagePart{
+				Type: openai.ChatMessagePartType(part.Type),
+				Text: part.Text,
+			}
+			if part.ImageURL != nil {
+				result[i].MultiContent[j].ImageURL = &openai.ChatMessageImageURL{
+					URL:    part.ImageURL.URL,
+					Detail: openai.ImageURLDetail(part.ImageURL.Detail),
+				}
+			}
 		}
 	}
 	return result
 }
 
-// convertResponse converts OpenAI's response to our format
+// convertResponse converts OpenAI's response to our format, keeping every choice
 func convertResponse(resp openai.ChatCompletionResponse) *models.ChatCompletionResponse {
-	return &models.ChatCompletionResponse{
-		Choices: []models.ChatCompletionChoice{
-			{
-				Message: models.ChatCompletionMessage{
-					Role:    resp.Choices[0].Message.Role,
-					Content: resp.Choices[0].Message.Content,
-				},
-				FinishReason: string(resp.Choices[0].FinishReason),
+	choices := make([]models.ChatCompletionChoice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choices[i] = models.ChatCompletionChoice{
+			Index: choice.Index,
+			Message: models.ChatCompletionMessage{
+				Role:      choice.Message.Role,
+				Content:   choice.Message.Content,
+				ToolCalls: fromOpenAIToolCalls(choice.Message.ToolCalls),
 			},
-		},
+			LogProbs:     fromOpenAILogProbs(choice.LogProbs),
+			FinishReason: string(choice.FinishReason),
+		}
+	}
+	return &models.ChatCompletionResponse{
+		Usage:   convertUsage(resp.Usage),
+		Choices: choices,
+	}
+}
+
+// convertUsage converts OpenAI's token usage to our format
+func convertUsage(usage openai.Usage) *models.Usage {
+	return &models.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
+// outboundParams merges the configured default parameters with the request's
+// extra params and then its explicit fields, later sources taking precedence,
+// and drops the disabled parameters
+func outboundParams(cfg ModelClientConfig, req *models.ChatCompletionRequest) map[string]interface{} {
+	params := make(map[string]interface{}, len(cfg.DefaultParams)+len(req.ExtraParams)+10)
+	for k, v := range cfg.DefaultParams {
+		params[k] = v
+	}
+	for k, v := range req.ExtraParams {
+		params[k] = v
+	}
+	if req.Temperature != 0 {
+		params["temperature"] = req.Temperature
+	}
+	if req.MaxTokens != 0 {
+		params["max_tokens"] = req.MaxTokens
+	}
+	if req.N != 0 {
+		params["n"] = req.N
+	}
+	if len(req.Stop) > 0 {
+		params["stop"] = []string(req.Stop)
+	}
+	if req.TopP != 0 {
+		params["top_p"] = req.TopP
+	}
+	if req.PresencePenalty != 0 {
+		params["presence_penalty"] = req.PresencePenalty
+	}
+	if req.FrequencyPenalty != 0 {
+		params["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.Seed != nil {
+		params["seed"] = *req.Seed
+	}
+	if req.ResponseFormat != nil {
+		params["response_format"] = req.ResponseFormat
+	}
+	if len(req.Tools) > 0 {
+		params["tools"] = req.Tools
 	}
+	if len(req.ToolChoice) > 0 {
+		params["tool_choice"] = req.ToolChoice
+	}
+	if req.LogProbs {
+		params["logprobs"] = true
+	}
+	if req.TopLogProbs != 0 {
+		params["top_logprobs"] = req.TopLogProbs
+	}
+	for _, name := range cfg.DisabledParams {
+		delete(params, name)
+	}
+	return params
 }
 
-// applyDefaultParams applies default parameters from config
+// applyDefaultParams applies parameters such as those from outboundParams
 func applyDefaultParams(req *openai.ChatCompletionRequest, params map[string]interface{}) {
 	for k, v := range params {
 		switch k {
 		case "temperature":
-			if v, ok := v.(float64); ok {
-				req.Temperature = float32(v)
+			if v, ok := toFloat32(v); ok {
+				req.Temperature = v
 			}
 		case "max_tokens":
-			if v, ok := v.(int); ok {
+			if v, ok := toInt(v); ok {
 				req.MaxTokens = v
 			}
+		case "n":
+			if v, ok := toInt(v); ok {
+				req.N = v
+			}
+		case "top_p":
+			if v, ok := toFloat32(v); ok {
+				req.TopP = v
+			}
+		case "presence_penalty":
+			if v, ok := toFloat32(v); ok {
+				req.PresencePenalty = v
+			}
+		case "frequency_penalty":
+			if v, ok := toFloat32(v); ok {
+				req.FrequencyPenalty = v
+			}
+		case "stop":
+			if v, ok := toStringSlice(v); ok {
+				req.Stop = v
+			}
+		case "seed":
+			if v, ok := toInt(v); ok {
+				req.Seed = &v
+			}
+		case "response_format":
+			if v, ok := v.(*models.ResponseFormat); ok {
+				req.ResponseFormat = convertResponseFormat(v)
+			}
+		case "tools":
+			if v, ok := v.([]models.Tool); ok {
+				req.Tools = convertTools(v)
+			}
+		case "tool_choice":
+			if v, ok := v.(json.RawMessage); ok {
+				req.ToolChoice = v
+			}
+		case "logprobs":
+			if v, ok := v.(bool); ok {
+				req.LogProbs = v
+			}
+		case "top_logprobs":
+			if v, ok := toInt(v); ok {
+				req.TopLogProbs = v
+			}
+		case "max_completion_tokens":
+			if v, ok := toInt(v); ok {
+				req.MaxCompletionTokens = v
+			}
+		case "logit_bias":
+			if v, ok := toLogitBias(v); ok {
+				req.LogitBias = v
+			}
+		case "user":
+			if v, ok := v.(string); ok {
+				req.User = v
+			}
+		case "parallel_tool_calls":
+			if v, ok := v.(bool); ok {
+				req.ParallelToolCalls = v
+			}
+		case "reasoning_effort":
+			if v, ok := v.(string); ok {
+				req.ReasoningEffort = v
+			}
+		}
+	}
+}
+
+// toLogitBias converts a token ID to bias map, as decoded from JSON or YAML
+func toLogitBias(v interface{}) (map[string]int, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	bias := make(map[string]int, len(m))
+	for token, value := range m {
+		n, ok := toInt(value)
+		if !ok {
+			return nil, false
+		}
+		bias[token] = n
+	}
+	return bias, true
+}
+
+// convertResponseFormat converts our response format to OpenAI's format
+func convertResponseFormat(f *models.ResponseFormat) *openai.ChatCompletionResponseFormat {
+	format := &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatType(f.Type)}
+	if s := f.JSONSchema; s != nil {
+		format.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        s.Name,
+			Description: s.Description,
+			Strict:      s.Strict,
+		}
+		if len(s.Schema) > 0 {
+			format.JSONSchema.Schema = s.Schema
+		}
+	}
+	return format
+}
+
+// toFloat32 converts a YAML/JSON decoded number to float32
+func toFloat32(v interface{}) (float32, bool) {
+	switch n := v.(type) {
+	case float64:
+		return float32(n), true
+	case float32:
+		return n, true
+	case int:
+		return float32(n), true
+	case int64:
+		return float32(n), true
+	default:
+		return 0, false
+	}
+}
+
+// toInt converts a YAML/JSON decoded number to int
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			f, err := n.Float64()
+			if err != nil {
+				return 0, false
+			}
+			return int(f), true
+		}
+		return int(i), true
+	default:
+		return 0, false
+	}
+}
+
+// toStringSlice converts a single string or a decoded list of strings to []string
+func toStringSlice(v interface{}) ([]string, bool) {
+	switch s := v.(type) {
+	case string:
+		return []string{s}, true
+	case []string:
+		return s, true
+	case []interface{}:
+		result := make([]string, 0, len(s))
+		for _, item := range s {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, str)
 		}
+		return result, true
+	default:
+		return nil, false
 	}
 }
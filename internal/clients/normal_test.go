@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/config"
 	"github.com/sleepstars/deepempower/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestNormalClient_Complete(t *testing.T) {
@@ -59,6 +63,7 @@ func TestNormalClient_Complete(t *testing.T) {
 						FinishReason: openai.FinishReasonStop,
 					},
 				},
+				Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
 			},
 			expectedResult: &models.ChatCompletionResponse{
 				Choices: []models.ChatCompletionChoice{
@@ -70,6 +75,51 @@ func TestNormalClient_Complete(t *testing.T) {
 						FinishReason: "stop",
 					},
 				},
+				Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			},
+		},
+		{
+			name: "two choices",
+			config: ModelClientConfig{
+				APIBase: "test-server",
+				Model:   "test-model",
+			},
+			request: &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{
+					{Role: "user", Content: "test"},
+				},
+				N: 2,
+			},
+			expectedReq: openai.ChatCompletionRequest{N: 2},
+			response: openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Index:        0,
+						Message:      openai.ChatCompletionMessage{Role: "assistant", Content: "first"},
+						FinishReason: openai.FinishReasonStop,
+					},
+					{
+						Index:        1,
+						Message:      openai.ChatCompletionMessage{Role: "assistant", Content: "second"},
+						FinishReason: openai.FinishReasonLength,
+					},
+				},
+				Usage: openai.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+			},
+			expectedResult: &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{
+						Index:        0,
+						Message:      models.ChatCompletionMessage{Role: "assistant", Content: "first"},
+						FinishReason: "stop",
+					},
+					{
+						Index:        1,
+						Message:      models.ChatCompletionMessage{Role: "assistant", Content: "second"},
+						FinishReason: "length",
+					},
+				},
+				Usage: &models.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
 			},
 		},
 		{
@@ -102,6 +152,7 @@ func TestNormalClient_Complete(t *testing.T) {
 				var req openai.ChatCompletionRequest
 				err := json.NewDecoder(r.Body).Decode(&req)
 				require.NoError(t, err)
+				assert.Equal(t, tc.expectedReq.N, req.N)
 
 				// Send response
 				w.Header().Set("Content-Type", "application/json")
@@ -138,6 +189,7 @@ func TestNormalClient_CompleteStream(t *testing.T) {
 		responses   []openai.ChatCompletionStreamResponse
 		expectedErr string
 		expected    []string
+		finish      []string
 	}{
 		{
 			name: "successful stream",
@@ -173,6 +225,44 @@ func TestNormalClient_CompleteStream(t *testing.T) {
 				},
 			},
 			expected: []string{"part 1", "part 2"},
+			finish:   []string{"", "stop"},
+		},
+		{
+			name: "aggregate stream",
+			config: ModelClientConfig{
+				APIBase:    "test-server",
+				Model:      "test-model",
+				StreamMode: StreamModeAggregate,
+			},
+			request: &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{
+					{Role: "user", Content: "test"},
+				},
+			},
+			responses: []openai.ChatCompletionStreamResponse{
+				{
+					Choices: []openai.ChatCompletionStreamChoice{
+						{
+							Delta: openai.ChatCompletionStreamChoiceDelta{
+								Role:    "assistant",
+								Content: "part 1",
+							},
+						},
+					},
+				},
+				{
+					Choices: []openai.ChatCompletionStreamChoice{
+						{
+							Delta: openai.ChatCompletionStreamChoiceDelta{
+								Content: ", part 2",
+							},
+							FinishReason: openai.FinishReasonStop,
+						},
+					},
+				},
+			},
+			expected: []string{"part 1", "part 1, part 2"},
+			finish:   []string{"", "stop"},
 		},
 	}
 
@@ -214,12 +304,427 @@ func TestNormalClient_CompleteStream(t *testing.T) {
 			assert.NoError(t, err)
 			require.NotNil(t, respChan)
 
-			var received []string
+			var received, finish []string
 			for resp := range respChan {
 				received = append(received, resp.Choices[0].Message.Content)
+				finish = append(finish, resp.Choices[0].FinishReason)
 			}
 
 			assert.Equal(t, tc.expected, received)
+			assert.Equal(t, tc.finish, finish)
+		})
+	}
+}
+
+func TestNormalClient_DefaultParams(t *testing.T) {
+	// Decode params the same way LoadConfig does so numbers arrive as int or float64
+	var params map[string]interface{}
+	err := yaml.Unmarshal([]byte(`
+temperature: 1
+top_p: 0.9
+presence_penalty: 0.5
+frequency_penalty: 1
+stop: ["\n\n", "END"]
+`), &params)
+	require.NoError(t, err)
+
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{
+		APIBase:       server.URL,
+		Model:         "test-model",
+		DefaultParams: params,
+	})
+
+	_, err = client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, float32(1), received.Temperature)
+	assert.Equal(t, float32(0.9), received.TopP)
+	assert.Equal(t, float32(0.5), received.PresencePenalty)
+	assert.Equal(t, float32(1), received.FrequencyPenalty)
+	assert.Equal(t, []string{"\n\n", "END"}, received.Stop)
+}
+
+func TestNormalClient_SamplingParams(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{
+		APIBase:       server.URL,
+		Model:         "test-model",
+		DefaultParams: map[string]interface{}{"stop": "DEFAULT", "top_p": 0.5},
+	})
+
+	_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages:         []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		Stop:             models.StopSequences{"END"},
+		TopP:             0.9,
+		PresencePenalty:  0.2,
+		FrequencyPenalty: 0.3,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"END"}, received.Stop)
+	assert.Equal(t, float32(0.9), received.TopP)
+	assert.Equal(t, float32(0.2), received.PresencePenalty)
+	assert.Equal(t, float32(0.3), received.FrequencyPenalty)
+}
+
+func TestNormalClient_ResponseFormat(t *testing.T) {
+	format := &models.ResponseFormat{
+		Type: models.ResponseFormatJSONSchema,
+		JSONSchema: &models.JSONSchema{
+			Name:   "answer",
+			Schema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+			Strict: true,
+		},
+	}
+	tests := []struct {
+		name     string
+		disabled []string
+		expected string
+	}{
+		{
+			name:     "forwarded",
+			expected: `{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object","properties":{"city":{"type":"string"}}},"strict":true}}`,
+		},
+		{name: "disabled", disabled: []string{"response_format"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received map[string]json.RawMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Role: "assistant", Content: `{"city":"Paris"}`}},
+					},
+				})
+			}))
+			defer server.Close()
+
+			client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Model: "test-model", DisabledParams: tt.disabled})
+			_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+				Messages:       []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+				ResponseFormat: format,
+			})
+			require.NoError(t, err)
+
+			if tt.expected == "" {
+				assert.NotContains(t, received, "response_format")
+				return
+			}
+			assert.JSONEq(t, tt.expected, string(received["response_format"]))
+		})
+	}
+}
+
+func TestNormalClient_MultiContent(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "a cat"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+	_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "system", Content: "describe images"},
+			{
+				Role:    "user",
+				Content: "what is this?",
+				MultiContent: []models.ContentPart{
+					{Type: models.ContentPartText, Text: "what is this?"},
+					{Type: models.ContentPartImageURL, ImageURL: &models.ImageURL{URL: "https://example.com/cat.png"}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	messages := received["messages"].([]interface{})
+	assert.Equal(t, "describe images", messages[0].(map[string]interface{})["content"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "text", "text": "what is this?"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/cat.png"}},
+	}, messages[1].(map[string]interface{})["content"])
+}
+
+func TestNormalClient_ExtraParams(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{
+		APIBase:       server.URL,
+		Model:         "test-model",
+		DefaultParams: map[string]interface{}{"temperature": 0.2, "max_tokens": 100},
+	})
+
+	// Decoded the way the server binds JSON, so numbers arrive as float64
+	var req models.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"messages": [{"role": "user", "content": "test"}],
+		"extra_params": {
+			"temperature": 1.2,
+			"top_p": 0.8,
+			"logit_bias": {"1639": -100},
+			"user": "user-42",
+			"max_completion_tokens": 200,
+			"parallel_tool_calls": false,
+			"reasoning_effort": "low"
+		}
+	}`), &req))
+	_, err := client.Complete(context.Background(), &req)
+	require.NoError(t, err)
+
+	assert.Equal(t, float32(1.2), received.Temperature)
+	assert.Equal(t, float32(0.8), received.TopP)
+	assert.Equal(t, 100, received.MaxTokens)
+	assert.Equal(t, map[string]int{"1639": -100}, received.LogitBias)
+	assert.Equal(t, "user-42", received.User)
+	assert.Equal(t, 200, received.MaxCompletionTokens)
+	assert.Equal(t, false, received.ParallelToolCalls)
+	assert.Equal(t, "low", received.ReasoningEffort)
+}
+
+func TestApplyDefaultParams_MaxTokens(t *testing.T) {
+	for _, v := range []interface{}{1000, float64(1000), json.Number("1000")} {
+		var req openai.ChatCompletionRequest
+		applyDefaultParams(&req, map[string]interface{}{"max_tokens": v})
+		assert.Equal(t, 1000, req.MaxTokens, "max_tokens of type %T", v)
+	}
+}
+
+func TestNormalClient_MaxTokensFromConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`models:
+  Normal:
+    api_base: "http://localhost:8001"
+    model: "gpt-3.5-turbo"
+    default_params:
+      max_tokens: 1000
+  Reasoner:
+    api_base: "http://localhost:8002"
+    model: "gpt-4"
+prompts:
+  pre_process: "pre"
+  reasoning: "reason"
+  post_process: "post"
+`), 0644)
+	require.NoError(t, err)
+
+	cfg, err := config.LoadConfig(configPath)
+	require.NoError(t, err)
+
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+			},
 		})
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{
+		APIBase:       server.URL,
+		Model:         cfg.Models.Normal.Model,
+		DefaultParams: cfg.Models.Normal.DefaultParams,
+	})
+
+	_, err = client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1000, received.MaxTokens)
+}
+
+func TestNormalClient_Tools(t *testing.T) {
+	var received map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"",
+			"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+	resp, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", ToolCalls: []models.ToolCall{
+				{ID: "call_0", Type: models.ToolTypeFunction, Function: models.FunctionCall{Name: "get_weather", Arguments: `{"city":"Rome"}`}},
+			}},
+			{Role: "tool", ToolCallID: "call_0", Content: "sunny"},
+		},
+		Tools: []models.Tool{{Type: models.ToolTypeFunction, Function: &models.FunctionDefinition{
+			Name:       "get_weather",
+			Parameters: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		}}},
+		ToolChoice: json.RawMessage(`"auto"`),
+	})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]`,
+		string(received["tools"]))
+	assert.JSONEq(t, `"auto"`, string(received["tool_choice"]))
+	var messages []map[string]interface{}
+	require.NoError(t, json.Unmarshal(received["messages"], &messages))
+	require.Len(t, messages, 3)
+	assert.Equal(t, "call_0", messages[1]["tool_calls"].([]interface{})[0].(map[string]interface{})["id"])
+	assert.Equal(t, "call_0", messages[2]["tool_call_id"])
+
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+	assert.Equal(t, []models.ToolCall{{
+		ID:       "call_1",
+		Type:     models.ToolTypeFunction,
+		Function: models.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+	}}, resp.Choices[0].Message.ToolCalls)
+}
+
+func TestNormalClient_ToolsDisabled(t *testing.T) {
+	var received map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Model: "test-model", DisabledParams: []string{"tools", "tool_choice"}})
+	_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages:   []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		Tools:      []models.Tool{{Type: models.ToolTypeFunction, Function: &models.FunctionDefinition{Name: "get_weather"}}},
+		ToolChoice: json.RawMessage(`"auto"`),
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, received, "tools")
+	assert.NotContains(t, received, "tool_choice")
+}
+
+func TestNormalClient_Seed(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults map[string]interface{}
+		seed     *int
+		expected string
+	}{
+		{name: "no seed"},
+		{name: "request seed", seed: func() *int { v := 42; return &v }(), expected: "42"},
+		{name: "default seed", defaults: map[string]interface{}{"seed": 7}, expected: "7"},
+		{
+			name:     "request overrides default",
+			defaults: map[string]interface{}{"seed": 7},
+			seed:     func() *int { v := 0; return &v }(),
+			expected: "0",
+		},
 	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var received map[string]json.RawMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+			}))
+			defer server.Close()
+
+			client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Model: "test-model", DefaultParams: tc.defaults})
+			_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+				Seed:     tc.seed,
+			})
+			require.NoError(t, err)
+			if tc.expected == "" {
+				assert.NotContains(t, received, "seed")
+				return
+			}
+			assert.Equal(t, tc.expected, string(received["seed"]))
+		})
+	}
+}
+
+func TestNormalClient_LogProbs(t *testing.T) {
+	var received map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"Hi"},
+			"logprobs":{"content":[{"token":"Hi","logprob":-0.25,"bytes":[72,105],
+				"top_logprobs":[{"token":"Hi","logprob":-0.25,"bytes":[72,105]},{"token":"Hey","logprob":-1.5}]}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+	resp, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages:    []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		LogProbs:    true,
+		TopLogProbs: 2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "true", string(received["logprobs"]))
+	assert.Equal(t, "2", string(received["top_logprobs"]))
+	assert.Equal(t, &models.LogProbs{Content: []models.LogProb{{
+		Token:   "Hi",
+		LogProb: -0.25,
+		Bytes:   []int{72, 105},
+		TopLogProbs: []models.TopLogProb{
+			{Token: "Hi", LogProb: -0.25, Bytes: []int{72, 105}},
+			{Token: "Hey", LogProb: -1.5},
+		},
+	}}}, resp.Choices[0].LogProbs)
+
+	// Without logprobs requested neither parameter is sent
+	received = nil
+	_, err = client.Complete(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, received, "logprobs")
+	assert.NotContains(t, received, "top_logprobs")
 }
@@ -0,0 +1,29 @@
+package clients
+
+import (
+	"fmt"
+
+	"github.com/sleepstars/deepempower/internal/config"
+)
+
+// NewModelClient creates the client for provider, one of the
+// config.Provider values. An empty provider selects the OpenAI compatible
+// client. A config with endpoints gets a BalancedClient over one client per
+// endpoint.
+func NewModelClient(provider string, cfg ModelClientConfig) (ModelClient, error) {
+	if len(cfg.Endpoints) > 0 {
+		return newEndpointsClient(provider, cfg)
+	}
+	switch provider {
+	case "", config.ProviderOpenAI:
+		return NewNormalClient(cfg), nil
+	case config.ProviderReasoner:
+		return NewReasonerClient(cfg), nil
+	case config.ProviderAnthropic:
+		return NewAnthropicClient(cfg), nil
+	case config.ProviderGemini:
+		return NewGeminiClient(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+}
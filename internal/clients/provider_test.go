@@ -0,0 +1,37 @@
+package clients
+
+import (
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewModelClient(t *testing.T) {
+	tests := []struct {
+		provider string
+		expected ModelClient
+	}{
+		{"", &NormalClient{}},
+		{config.ProviderOpenAI, &NormalClient{}},
+		{config.ProviderReasoner, &ReasonerClient{}},
+		{config.ProviderAnthropic, &AnthropicClient{}},
+		{config.ProviderGemini, &GeminiClient{}},
+	}
+
+	cfg := ModelClientConfig{APIBase: "http://localhost:8000/v1", Model: "test-model"}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			client, err := NewModelClient(tt.provider, cfg)
+			require.NoError(t, err)
+			assert.IsType(t, tt.expected, client)
+		})
+	}
+}
+
+func TestNewModelClient_UnknownProvider(t *testing.T) {
+	client, err := NewModelClient("bedrock", ModelClientConfig{})
+	assert.EqualError(t, err, `unknown provider "bedrock"`)
+	assert.Nil(t, client)
+}
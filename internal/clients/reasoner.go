@@ -3,7 +3,9 @@ package clients
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -19,10 +21,8 @@ type ReasonerClient struct {
 // NewReasonerClient creates a new Reasoner model client
 func NewReasonerClient(config ModelClientConfig) *ReasonerClient {
 	clientConfig := openai.DefaultConfig("")
-	clientConfig.BaseURL = config.APIBase
-	if !strings.HasPrefix(clientConfig.BaseURL, "http://") && !strings.HasPrefix(clientConfig.BaseURL, "https://") {
-		clientConfig.BaseURL = "http://" + clientConfig.BaseURL
-	}
+	clientConfig.BaseURL = BaseURL(config.APIBase)
+	clientConfig.HTTPClient = newHTTPClient(config)
 
 	return &ReasonerClient{
 		config: config,
@@ -30,97 +30,67 @@ func NewReasonerClient(config ModelClientConfig) *ReasonerClient {
 	}
 }
 
-// filterDisabledParams removes parameters that are not supported by the Reasoner model
-func (c *ReasonerClient) filterDisabledParams(req *models.ChatCompletionRequest) {
-	// Create a copy of the request for modification
-	reqMap := make(map[string]interface{})
-	data, _ := json.Marshal(req)
-	json.Unmarshal(data, &reqMap)
-
-	// Remove disabled parameters
-	for _, param := range c.config.DisabledParams {
-		delete(reqMap, param)
-	}
-
-	// Update the request
-	data, _ = json.Marshal(reqMap)
-	json.Unmarshal(data, req)
-}
-
-func (c *ReasonerClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
-	// Remove unsupported parameters
-	c.filterDisabledParams(req)
-
+// prepareRequest converts the request to the OpenAI format with the
+// configured default parameters applied and disabled parameters removed
+func (c *ReasonerClient) prepareRequest(req *models.ChatCompletionRequest) openai.ChatCompletionRequest {
 	// Set model from config if not specified
 	if req.Model == "" {
 		req.Model = c.config.Model
 	}
 
-	// Convert to openai request format
 	openaiReq := openai.ChatCompletionRequest{
 		Model:    req.Model,
-		Messages: make([]openai.ChatCompletionMessage, len(req.Messages)),
+		Messages: convertMessages(req.Messages),
 	}
+	applyDefaultParams(&openaiReq, outboundParams(c.config, req))
+	// Reasoning models reject logprobs
+	openaiReq.LogProbs = false
+	openaiReq.TopLogProbs = 0
+	return openaiReq
+}
 
-	// Convert messages
-	for i, msg := range req.Messages {
-		openaiReq.Messages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
+func (c *ReasonerClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	// Convert to openai request format
+	openaiReq := c.prepareRequest(req)
 
 	// Call OpenAI API
-	resp, err := c.client.CreateChatCompletion(ctx, openaiReq)
+	var resp openai.ChatCompletionResponse
+	err := withRetry(ctx, c.config.Retry, func(ctx context.Context) error {
+		var err error
+		resp, err = c.client.CreateChatCompletion(ctx, openaiReq)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("create chat completion: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in response")
+		return nil, ErrNoChoices
 	}
 
 	// Convert response back to our format
-	return &models.ChatCompletionResponse{
-		Choices: []models.ChatCompletionChoice{
-			{
-				Message: models.ChatCompletionMessage{
-					Role:    resp.Choices[0].Message.Role,
-					Content: resp.Choices[0].Message.Content,
-				},
-				FinishReason: string(resp.Choices[0].FinishReason),
-			},
-		},
-	}, nil
+	return convertResponse(resp), nil
 }
 
 func (c *ReasonerClient) CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
-	// Remove unsupported parameters
-	c.filterDisabledParams(req)
-
-	// Set model from config if not specified
-	if req.Model == "" {
-		req.Model = c.config.Model
-	}
-
 	// Convert to openai request format
-	openaiReq := openai.ChatCompletionRequest{
-		Model:    req.Model,
-		Messages: make([]openai.ChatCompletionMessage, len(req.Messages)),
-		Stream:   true,
-	}
-
-	// Convert messages
-	for i, msg := range req.Messages {
-		openaiReq.Messages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
-
-	// Create stream
-	stream, err := c.client.CreateChatCompletionStream(ctx, openaiReq)
+	openaiReq := c.prepareRequest(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	// The stream reads with its own context so that the idle timer can cut
+	// off a stalled upstream
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	// Create stream. Retries stop once the upstream has accepted the stream.
+	var stream *openai.ChatCompletionStream
+	err := withRetry(streamCtx, c.config.Retry, func(ctx context.Context) error {
+		var err error
+		stream, err = c.client.CreateChatCompletionStream(ctx, openaiReq)
+		return err
+	})
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("create chat completion stream: %w", err)
 	}
 
@@ -129,44 +99,123 @@ func (c *ReasonerClient) CompleteStream(ctx context.Context, req *models.ChatCom
 	// Start goroutine to read streaming response
 	go func() {
 		defer close(resultChan)
+		defer cancel()
 		defer stream.Close()
 
+		idle := newIdleTimer(c.config.StreamIdleTimeout, cancel)
+		defer idle.stop()
+
 		var contentBuilder strings.Builder
 		var partialContent []string
+		// Role is usually only sent with the first delta
+		role := "assistant"
+		finished := false
+		w := &streamWriter{ctx: ctx, out: resultChan}
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
-				resp, err := stream.Recv()
+				resp, reasoning, err := recvReasoning(stream)
 				if err != nil {
-					// End of stream or error
+					if ctx.Err() != nil {
+						return
+					}
+					// Keep what arrived and end the stream with the timeout
+					if idle.expired() {
+						w.flush()
+						w.emit(&models.ChatCompletionResponse{
+							Err: &StreamIdleError{Timeout: c.config.StreamIdleTimeout},
+						})
+						return
+					}
+					// io.EOF marks the [DONE] sentinel. Providers that end the
+					// stream without a finish reason completed normally.
+					if errors.Is(err, io.EOF) && !finished {
+						w.send(&models.ChatCompletionResponse{
+							Choices: []models.ChatCompletionChoice{
+								{
+									Message:      models.ChatCompletionMessage{Role: role},
+									FinishReason: string(openai.FinishReasonStop),
+								},
+							},
+						})
+					}
+					w.flush()
 					return
 				}
 
-				if len(resp.Choices) > 0 && resp.Choices[0].Delta.Content != "" {
-					content := resp.Choices[0].Delta.Content
-					contentBuilder.WriteString(content)
-					partialContent = append(partialContent, content)
-
-					// Convert to standard response format
-					resultChan <- &models.ChatCompletionResponse{
-						Choices: []models.ChatCompletionChoice{
-							{
-								Message: models.ChatCompletionMessage{
-									Role:             resp.Choices[0].Delta.Role,
-									Content:          content,
-									ReasoningContent: []string{},
-								},
-								FinishReason: string(resp.Choices[0].FinishReason),
+				idle.reset()
+				w.setUsage(resp)
+				if len(resp.Choices) == 0 {
+					continue
+				}
+				choice := resp.Choices[0]
+				if choice.Delta.Role != "" {
+					role = choice.Delta.Role
+				}
+				if choice.FinishReason != "" {
+					finished = true
+				}
+				if choice.Delta.Content == "" && reasoning == "" && choice.FinishReason == "" {
+					continue
+				}
+
+				content := choice.Delta.Content
+				contentBuilder.WriteString(content)
+				partialContent = append(partialContent, content)
+
+				reasoningContent := []string{}
+				if reasoning != "" {
+					reasoningContent = []string{reasoning}
+				}
+
+				// Convert to standard response format
+				w.send(&models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{
+							Index: choice.Index,
+							Message: models.ChatCompletionMessage{
+								Role:             role,
+								Content:          content,
+								ReasoningContent: reasoningContent,
 							},
+							FinishReason: string(choice.FinishReason),
 						},
-					}
-				}
+					},
+				})
 			}
 		}
 	}()
 
 	return resultChan, nil
 }
+
+// reasoningDelta holds the reasoning_content delta that reasoning models such
+// as DeepSeek R1 stream ahead of the answer. go-openai does not decode it.
+type reasoningDelta struct {
+	Choices []struct {
+		Delta struct {
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// recvReasoning reads the next chunk of the stream together with the
+// reasoning content of its first choice
+func recvReasoning(stream *openai.ChatCompletionStream) (openai.ChatCompletionStreamResponse, string, error) {
+	var resp openai.ChatCompletionStreamResponse
+	raw, err := stream.RecvRaw()
+	if err != nil {
+		return resp, "", err
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return resp, "", fmt.Errorf("decode stream chunk: %w", err)
+	}
+	var delta reasoningDelta
+	if err := json.Unmarshal(raw, &delta); err != nil || len(delta.Choices) == 0 {
+		return resp, "", nil
+	}
+	return resp, delta.Choices[0].Delta.ReasoningContent, nil
+}
@@ -3,10 +3,12 @@ package clients
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/sleepstars/deepempower/internal/models"
@@ -48,6 +50,7 @@ func TestReasonerClient_Complete(t *testing.T) {
 						FinishReason: openai.FinishReasonStop,
 					},
 				},
+				Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
 			},
 			expectedResult: &models.ChatCompletionResponse{
 				Choices: []models.ChatCompletionChoice{
@@ -59,6 +62,51 @@ func TestReasonerClient_Complete(t *testing.T) {
 						FinishReason: "stop",
 					},
 				},
+				Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			},
+		},
+		{
+			name: "two choices",
+			config: ModelClientConfig{
+				APIBase: "test-server",
+				Model:   "test-model",
+			},
+			request: &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{
+					{Role: "user", Content: "test"},
+				},
+				N: 2,
+			},
+			expectedReq: openai.ChatCompletionRequest{N: 2},
+			response: openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Index:        0,
+						Message:      openai.ChatCompletionMessage{Role: "assistant", Content: "first"},
+						FinishReason: openai.FinishReasonStop,
+					},
+					{
+						Index:        1,
+						Message:      openai.ChatCompletionMessage{Role: "assistant", Content: "second"},
+						FinishReason: openai.FinishReasonLength,
+					},
+				},
+				Usage: openai.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+			},
+			expectedResult: &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{
+						Index:        0,
+						Message:      models.ChatCompletionMessage{Role: "assistant", Content: "first"},
+						FinishReason: "stop",
+					},
+					{
+						Index:        1,
+						Message:      models.ChatCompletionMessage{Role: "assistant", Content: "second"},
+						FinishReason: "length",
+					},
+				},
+				Usage: &models.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
 			},
 		},
 		{
@@ -97,6 +145,9 @@ func TestReasonerClient_Complete(t *testing.T) {
 					_, hasParam := reqMap[param]
 					assert.False(t, hasParam, "disabled parameter %s should not be present", param)
 				}
+				if tc.expectedReq.N != 0 {
+					assert.EqualValues(t, tc.expectedReq.N, reqMap["n"])
+				}
 
 				// Send response
 				w.Header().Set("Content-Type", "application/json")
@@ -125,6 +176,117 @@ func TestReasonerClient_Complete(t *testing.T) {
 	}
 }
 
+func TestReasonerClient_DefaultParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled []string
+		request  *models.ChatCompletionRequest
+		expected map[string]interface{}
+	}{
+		{
+			name:     "defaults applied",
+			expected: map[string]interface{}{"temperature": 0.6, "max_tokens": 512.0, "top_p": 0.9},
+		},
+		{
+			name:     "disabled default dropped",
+			disabled: []string{"temperature", "top_p"},
+			expected: map[string]interface{}{"max_tokens": 512.0},
+		},
+		{
+			name:     "request overrides default",
+			request:  &models.ChatCompletionRequest{MaxTokens: 100},
+			expected: map[string]interface{}{"temperature": 0.6, "max_tokens": 100.0, "top_p": 0.9},
+		},
+		{
+			name:     "disabled request param dropped",
+			disabled: []string{"temperature"},
+			request:  &models.ChatCompletionRequest{Temperature: 0.2},
+			expected: map[string]interface{}{"max_tokens": 512.0, "top_p": 0.9},
+		},
+		{
+			name:     "extra params override default",
+			request:  &models.ChatCompletionRequest{ExtraParams: map[string]interface{}{"temperature": 1.0}},
+			expected: map[string]interface{}{"temperature": 1.0, "max_tokens": 512.0, "top_p": 0.9},
+		},
+		{
+			name:     "disabled extra param dropped",
+			disabled: []string{"temperature"},
+			request:  &models.ChatCompletionRequest{ExtraParams: map[string]interface{}{"temperature": 1.0}},
+			expected: map[string]interface{}{"max_tokens": 512.0, "top_p": 0.9},
+		},
+		{
+			name:     "disabled sampling params dropped",
+			disabled: []string{"top_p", "stop", "presence_penalty"},
+			request: &models.ChatCompletionRequest{
+				TopP:            0.5,
+				Stop:            models.StopSequences{"END"},
+				PresencePenalty: 0.5,
+			},
+			expected: map[string]interface{}{"temperature": 0.6, "max_tokens": 512.0},
+		},
+		{
+			name:     "seed forwarded",
+			request:  &models.ChatCompletionRequest{Seed: func() *int { v := 42; return &v }()},
+			expected: map[string]interface{}{"temperature": 0.6, "max_tokens": 512.0, "top_p": 0.9, "seed": 42.0},
+		},
+		{
+			name:     "logprobs stripped",
+			request:  &models.ChatCompletionRequest{LogProbs: true, TopLogProbs: 3},
+			expected: map[string]interface{}{"temperature": 0.6, "max_tokens": 512.0, "top_p": 0.9},
+		},
+		{
+			name:     "disabled seed dropped",
+			disabled: []string{"seed"},
+			request:  &models.ChatCompletionRequest{Seed: func() *int { v := 42; return &v }()},
+			expected: map[string]interface{}{"temperature": 0.6, "max_tokens": 512.0, "top_p": 0.9},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var received map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+					},
+				})
+			}))
+			defer server.Close()
+
+			client := NewReasonerClient(ModelClientConfig{
+				APIBase:        server.URL,
+				Model:          "test-model",
+				DefaultParams:  map[string]interface{}{"temperature": 0.6, "max_tokens": 512, "top_p": 0.9},
+				DisabledParams: tc.disabled,
+			})
+
+			req := tc.request
+			if req == nil {
+				req = &models.ChatCompletionRequest{}
+			}
+			req.Messages = []models.ChatCompletionMessage{{Role: "user", Content: "test"}}
+			_, err := client.Complete(context.Background(), req)
+			require.NoError(t, err)
+
+			assert.NotContains(t, received, "stop")
+			assert.NotContains(t, received, "presence_penalty")
+			assert.NotContains(t, received, "logprobs")
+			assert.NotContains(t, received, "top_logprobs")
+			for _, param := range []string{"temperature", "max_tokens", "top_p", "seed"} {
+				want, ok := tc.expected[param]
+				if !ok {
+					assert.NotContains(t, received, param)
+					continue
+				}
+				assert.InDelta(t, want, received[param], 1e-6, param)
+			}
+		})
+	}
+}
+
 func TestReasonerClient_CompleteStream(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -242,3 +404,154 @@ func TestReasonerClient_CompleteStream(t *testing.T) {
 		})
 	}
 }
+
+func TestReasonerClient_CompleteStreamFinishReason(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     []openai.ChatCompletionStreamResponse
+		contents      []string
+		finishReasons []string
+	}{
+		{
+			name: "finish reason on content-less final chunk",
+			responses: []openai.ChatCompletionStreamResponse{
+				{
+					Choices: []openai.ChatCompletionStreamChoice{
+						{Delta: openai.ChatCompletionStreamChoiceDelta{Role: "assistant", Content: "partial"}},
+					},
+				},
+				{
+					Choices: []openai.ChatCompletionStreamChoice{
+						{FinishReason: openai.FinishReasonLength},
+					},
+				},
+			},
+			contents:      []string{"partial", ""},
+			finishReasons: []string{"", "length"},
+		},
+		{
+			name: "stop when the stream ends without a finish reason",
+			responses: []openai.ChatCompletionStreamResponse{
+				{
+					Choices: []openai.ChatCompletionStreamChoice{
+						{Delta: openai.ChatCompletionStreamChoiceDelta{Role: "assistant", Content: "answer"}},
+					},
+				},
+			},
+			contents:      []string{"answer", ""},
+			finishReasons: []string{"", "stop"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for _, resp := range tc.responses {
+					data, _ := json.Marshal(resp)
+					fmt.Fprintf(w, "data: %s\n\n", data)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+
+			client := NewReasonerClient(ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+			respChan, err := client.CompleteStream(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			})
+			require.NoError(t, err)
+
+			var contents, finishReasons []string
+			for resp := range respChan {
+				assert.Equal(t, "assistant", resp.Choices[0].Message.Role)
+				contents = append(contents, resp.Choices[0].Message.Content)
+				finishReasons = append(finishReasons, resp.Choices[0].FinishReason)
+			}
+			assert.Equal(t, tc.contents, contents)
+			assert.Equal(t, tc.finishReasons, finishReasons)
+		})
+	}
+}
+
+func TestReasonerClient_CompleteStreamReasoningContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":null,"reasoning_content":"Let me"}}]}
+
+data: {"choices":[{"index":0,"delta":{"content":null,"reasoning_content":" think"}}]}
+
+data: {"choices":[{"index":0,"delta":{"content":"Answer","reasoning_content":null}}]}
+
+data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`)
+	}))
+	defer server.Close()
+
+	client := NewReasonerClient(ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+	respChan, err := client.CompleteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+
+	var reasoning, contents []string
+	for resp := range respChan {
+		reasoning = append(reasoning, resp.Choices[0].Message.ReasoningContent...)
+		if content := resp.Choices[0].Message.Content; content != "" {
+			// Reasoning arrives before the answer
+			assert.Len(t, reasoning, 2)
+			contents = append(contents, content)
+		}
+	}
+	assert.Equal(t, []string{"Let me", " think"}, reasoning)
+	assert.Equal(t, []string{"Answer"}, contents)
+}
+
+func TestReasonerClient_CompleteStreamIdleTimeout(t *testing.T) {
+	// The server sends one chunk and then stalls without closing the stream
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"reasoning_content\":\"step 1\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := NewReasonerClient(ModelClientConfig{
+		APIBase:           server.URL,
+		Model:             "test-model",
+		StreamIdleTimeout: 50 * time.Millisecond,
+	})
+	respChan, err := client.CompleteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+
+	var responses []*models.ChatCompletionResponse
+	timeout := time.After(5 * time.Second)
+	for collecting := true; collecting; {
+		select {
+		case resp, ok := <-respChan:
+			if !ok {
+				collecting = false
+				break
+			}
+			responses = append(responses, resp)
+		case <-timeout:
+			t.Fatal("stalled stream was not closed")
+		}
+	}
+
+	require.Len(t, responses, 2)
+	assert.Equal(t, []string{"step 1"}, responses[0].Choices[0].Message.ReasoningContent)
+	var idleErr *StreamIdleError
+	require.True(t, errors.As(responses[1].Err, &idleErr))
+	assert.Equal(t, 50*time.Millisecond, idleErr.Timeout)
+	assert.ErrorIs(t, responses[1].Err, context.DeadlineExceeded)
+}
@@ -0,0 +1,151 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Defaults applied when retries are enabled without explicit delays
+const (
+	DefaultRetryBaseDelay = 200 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Second
+	DefaultMaxRetryAfter  = 30 * time.Second
+)
+
+// RetryConfig controls how clients retry transient upstream failures.
+// Delays grow exponentially from BaseDelay up to MaxDelay. Jitter is the
+// fraction of each delay, between 0 and 1, that is randomised. A Retry-After
+// header on a 429 response replaces the delay, capped at MaxRetryAfter.
+type RetryConfig struct {
+	MaxRetries    int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Jitter        float64
+	MaxRetryAfter time.Duration
+}
+
+// retryableStatus lists the upstream status codes worth retrying
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+	529:                            true, // Anthropic overloaded
+}
+
+// withRetry runs call until it succeeds, fails with an error that is not
+// transient, runs out of retries or ctx is done. call must issue its request
+// with the context it is given so that Retry-After headers are seen.
+func withRetry(ctx context.Context, cfg RetryConfig, call func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		hint := &retryHint{}
+		err := call(context.WithValue(ctx, retryHintKey{}, hint))
+		if err == nil || attempt >= cfg.MaxRetries || !isTransient(ctx, err) {
+			return err
+		}
+
+		delay := cfg.delay(attempt)
+		if hint.after > 0 {
+			delay = cfg.retryAfter(hint.after)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// isTransient reports whether err is a retryable status or a network error
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if status := HTTPStatus(err); status != 0 {
+		return retryableStatus[status]
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// delay returns the wait before the retry following the given attempt
+func (r RetryConfig) delay(attempt int) time.Duration {
+	base, maxDelay := r.BaseDelay, r.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+
+	d := maxDelay
+	if attempt < 32 && base<<attempt > 0 && base<<attempt < maxDelay {
+		d = base << attempt
+	}
+	if r.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * min(r.Jitter, 1) * float64(d))
+	}
+	return d
+}
+
+// retryAfter caps the wait requested by a Retry-After header
+func (r RetryConfig) retryAfter(d time.Duration) time.Duration {
+	maxWait := r.MaxRetryAfter
+	if maxWait <= 0 {
+		maxWait = DefaultMaxRetryAfter
+	}
+	return min(d, maxWait)
+}
+
+// retryHintKey is the context key of the retryHint for the current attempt
+type retryHintKey struct{}
+
+// retryHint carries the Retry-After of a failed attempt back to withRetry
+type retryHint struct {
+	after time.Duration
+}
+
+// retryAfterDoer records the Retry-After header of 429 responses in the
+// retryHint of the request context, since go-openai errors drop the headers
+type retryAfterDoer struct {
+	doer openai.HTTPDoer
+}
+
+func (d *retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	if hint, ok := req.Context().Value(retryHintKey{}).(*retryHint); ok {
+		hint.after = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return resp, nil
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an
+// HTTP date. It returns 0 when the value is missing, invalid or in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,253 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetry = RetryConfig{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Jitter: 0.5}
+
+// flakyServer fails the first failures requests with status and then serves
+// a completion, either as JSON or as an event stream
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"error":{"message":"upstream unavailable"}}`)
+			return
+		}
+
+		var req openai.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, usageStream)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "recovered"}},
+			},
+		})
+	}))
+	return server, &calls
+}
+
+func TestCompleteRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		retry         RetryConfig
+		expectedCalls int32
+		expectError   bool
+	}{
+		{"recovers after transient failures", http.StatusServiceUnavailable, testRetry, 3, false},
+		{"rate limited", http.StatusTooManyRequests, testRetry, 3, false},
+		{"client error is not retried", http.StatusBadRequest, testRetry, 1, true},
+		{"retries disabled", http.StatusBadGateway, RetryConfig{}, 1, true},
+		{"retries exhausted", http.StatusBadGateway, RetryConfig{MaxRetries: 1, BaseDelay: time.Millisecond}, 2, true},
+	}
+
+	clientsUnderTest := []struct {
+		name      string
+		newClient func(cfg ModelClientConfig) ModelClient
+	}{
+		{"normal", func(cfg ModelClientConfig) ModelClient { return NewNormalClient(cfg) }},
+		{"reasoner", func(cfg ModelClientConfig) ModelClient { return NewReasonerClient(cfg) }},
+	}
+
+	for _, cc := range clientsUnderTest {
+		for _, tc := range tests {
+			t.Run(cc.name+"/"+tc.name, func(t *testing.T) {
+				server, calls := flakyServer(t, 2, tc.status)
+				defer server.Close()
+
+				client := cc.newClient(ModelClientConfig{APIBase: server.URL, Model: "test-model", Retry: tc.retry})
+				resp, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+					Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+				})
+
+				assert.Equal(t, tc.expectedCalls, atomic.LoadInt32(calls))
+				if tc.expectError {
+					require.Error(t, err)
+					assert.Equal(t, tc.status, HTTPStatus(err))
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, "recovered", resp.Choices[0].Message.Content)
+			})
+		}
+	}
+}
+
+func TestCompleteStreamRetry(t *testing.T) {
+	for _, newClient := range []func(cfg ModelClientConfig) ModelClient{
+		func(cfg ModelClientConfig) ModelClient { return NewNormalClient(cfg) },
+		func(cfg ModelClientConfig) ModelClient { return NewReasonerClient(cfg) },
+	} {
+		server, calls := flakyServer(t, 2, http.StatusBadGateway)
+
+		client := newClient(ModelClientConfig{APIBase: server.URL, Model: "test-model", Retry: testRetry})
+		respChan, err := client.CompleteStream(context.Background(), &models.ChatCompletionRequest{
+			Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		require.NoError(t, err)
+
+		var content string
+		for resp := range respChan {
+			content += resp.Choices[0].Message.Content
+		}
+		assert.Equal(t, "Hello world", content)
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+		server.Close()
+	}
+}
+
+func TestCompleteRetry_ContextCancelled(t *testing.T) {
+	server, calls := flakyServer(t, 10, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewNormalClient(ModelClientConfig{
+		APIBase: server.URL,
+		Retry:   RetryConfig{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour},
+	})
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.Complete(ctx, &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryConfig_Delay(t *testing.T) {
+	r := RetryConfig{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	assert.Equal(t, 100*time.Millisecond, r.delay(0))
+	assert.Equal(t, 200*time.Millisecond, r.delay(1))
+	assert.Equal(t, 800*time.Millisecond, r.delay(3))
+	assert.Equal(t, time.Second, r.delay(4))
+	assert.Equal(t, time.Second, r.delay(100))
+
+	r.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := r.delay(1)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, isTransient(ctx, &openai.APIError{HTTPStatusCode: http.StatusGatewayTimeout}))
+	assert.False(t, isTransient(ctx, &openai.APIError{HTTPStatusCode: http.StatusUnauthorized}))
+	assert.False(t, isTransient(ctx, ErrNoChoices))
+
+	// Connection failures surface as network errors
+	_, err := http.Get("http://127.0.0.1:1")
+	require.Error(t, err)
+	assert.True(t, isTransient(ctx, err))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, isTransient(cancelled, err))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{"seconds", "3", 3 * time.Second},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{"date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"missing", "", 0},
+		{"invalid", "soon", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseRetryAfter(tc.value, now))
+		})
+	}
+}
+
+func TestRetryConfig_RetryAfterCap(t *testing.T) {
+	assert.Equal(t, 2*time.Second, RetryConfig{}.retryAfter(2*time.Second))
+	assert.Equal(t, DefaultMaxRetryAfter, RetryConfig{}.retryAfter(time.Hour))
+	assert.Equal(t, time.Second, RetryConfig{MaxRetryAfter: time.Second}.retryAfter(time.Minute))
+}
+
+func TestCompleteRetry_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		retry      RetryConfig
+		minWait    time.Duration
+	}{
+		{
+			name:       "header replaces backoff",
+			retryAfter: "1",
+			retry:      RetryConfig{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			minWait:    time.Second,
+		},
+		{
+			name:       "header capped",
+			retryAfter: "3600",
+			retry:      RetryConfig{MaxRetries: 1, BaseDelay: time.Millisecond, MaxRetryAfter: 50 * time.Millisecond},
+			minWait:    50 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.Header().Set("Retry-After", tc.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					fmt.Fprint(w, `{"error":{"message":"rate limited"}}`)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}},
+					},
+				})
+			}))
+			defer server.Close()
+
+			client := NewNormalClient(ModelClientConfig{APIBase: server.URL, Retry: tc.retry})
+			start := time.Now()
+			_, err := client.Complete(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			})
+			require.NoError(t, err)
+
+			elapsed := time.Since(start)
+			assert.GreaterOrEqual(t, elapsed, tc.minWait)
+			assert.Less(t, elapsed, tc.minWait+time.Second)
+			assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package clients
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// streamWriter holds back the latest response until the next one arrives so
+// that a trailing usage chunk, which providers send after the finish reason,
+// can be attached to the last response of the stream
+type streamWriter struct {
+	ctx     context.Context
+	out     chan<- *models.ChatCompletionResponse
+	pending *models.ChatCompletionResponse
+	usage   *models.Usage
+}
+
+// send emits the previously held response and holds resp in its place
+func (w *streamWriter) send(resp *models.ChatCompletionResponse) {
+	if w.pending != nil {
+		w.emit(w.pending)
+	}
+	w.pending = resp
+}
+
+// setUsage records the usage reported by chunk, if any
+func (w *streamWriter) setUsage(chunk openai.ChatCompletionStreamResponse) {
+	if chunk.Usage != nil {
+		w.usage = convertUsage(*chunk.Usage)
+	}
+}
+
+// flush emits the held response with the stream usage attached. A stream
+// that only reported usage ends with a usage-only response.
+func (w *streamWriter) flush() {
+	if w.pending == nil {
+		if w.usage == nil {
+			return
+		}
+		w.pending = &models.ChatCompletionResponse{}
+	}
+	if w.usage != nil {
+		w.pending.Usage = w.usage
+	}
+	w.emit(w.pending)
+	w.pending = nil
+}
+
+// emit writes resp to out, or drops it once the caller is gone and ctx is done
+func (w *streamWriter) emit(resp *models.ChatCompletionResponse) {
+	select {
+	case w.out <- resp:
+	case <-w.ctx.Done():
+	}
+}
+
+// idleTimer cancels a stream that receives no data for timeout. It never
+// fires when timeout is zero.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+// newIdleTimer starts a timer that calls cancel once timeout passes without
+// a reset
+func newIdleTimer(timeout time.Duration, cancel context.CancelFunc) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			t.fired.Store(true)
+			cancel()
+		})
+	}
+	return t
+}
+
+// reset restarts the timeout after data arrived
+func (t *idleTimer) reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+// stop releases the timer
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// expired reports whether the timer cancelled the stream
+func (t *idleTimer) expired() bool {
+	return t.fired.Load()
+}
@@ -0,0 +1,92 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usageStream is an OpenAI style SSE stream whose usage arrives in a
+// choice-less chunk after the finish reason, followed by [DONE]
+const usageStream = `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}
+
+data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}
+
+data: {"id":"1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}
+
+data: [DONE]
+
+`
+
+func TestCompleteStream_TrailingUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		newClient func(cfg ModelClientConfig) ModelClient
+	}{
+		{"normal", func(cfg ModelClientConfig) ModelClient { return NewNormalClient(cfg) }},
+		{"reasoner", func(cfg ModelClientConfig) ModelClient { return NewReasonerClient(cfg) }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				assert.Equal(t, map[string]interface{}{"include_usage": true}, body["stream_options"])
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, usageStream)
+			}))
+			defer server.Close()
+
+			client := tc.newClient(ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+			respChan, err := client.CompleteStream(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			})
+			require.NoError(t, err)
+
+			var responses []*models.ChatCompletionResponse
+			for resp := range respChan {
+				responses = append(responses, resp)
+			}
+
+			require.Len(t, responses, 2)
+			assert.Equal(t, "Hello", responses[0].Choices[0].Message.Content)
+			assert.Nil(t, responses[0].Usage)
+
+			last := responses[1]
+			assert.Equal(t, " world", last.Choices[0].Message.Content)
+			assert.Equal(t, "stop", last.Choices[0].FinishReason)
+			assert.Equal(t, &models.Usage{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9}, last.Usage)
+		})
+	}
+}
+
+func TestStreamWriter_DropsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan *models.ChatCompletionResponse)
+	w := &streamWriter{ctx: ctx, out: out}
+	cancel()
+
+	// Nobody reads out any more, so the writer must not block
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.send(&models.ChatCompletionResponse{})
+		w.send(&models.ChatCompletionResponse{})
+		w.flush()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream writer blocked after cancellation")
+	}
+}
@@ -0,0 +1,65 @@
+package clients
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// convertTools converts our tool definitions to OpenAI's format
+func convertTools(tools []models.Tool) []openai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	result := make([]openai.Tool, len(tools))
+	for i, tool := range tools {
+		result[i] = openai.Tool{Type: openai.ToolType(tool.Type)}
+		if tool.Function == nil {
+			continue
+		}
+		result[i].Function = &openai.FunctionDefinition{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Strict:      tool.Function.Strict,
+		}
+		// A nil schema would be sent as null
+		if len(tool.Function.Parameters) > 0 {
+			result[i].Function.Parameters = tool.Function.Parameters
+		}
+	}
+	return result
+}
+
+// toOpenAIToolCalls converts the tool calls of one of our messages to
+// OpenAI's format
+func toOpenAIToolCalls(calls []models.ToolCall) []openai.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	result := make([]openai.ToolCall, len(calls))
+	for i, call := range calls {
+		result[i] = openai.ToolCall{
+			Index:    call.Index,
+			ID:       call.ID,
+			Type:     openai.ToolType(call.Type),
+			Function: openai.FunctionCall{Name: call.Function.Name, Arguments: call.Function.Arguments},
+		}
+	}
+	return result
+}
+
+// fromOpenAIToolCalls converts OpenAI tool calls to our format
+func fromOpenAIToolCalls(calls []openai.ToolCall) []models.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	result := make([]models.ToolCall, len(calls))
+	for i, call := range calls {
+		result[i] = models.ToolCall{
+			Index:    call.Index,
+			ID:       call.ID,
+			Type:     string(call.Type),
+			Function: models.FunctionCall{Name: call.Function.Name, Arguments: call.Function.Arguments},
+		}
+	}
+	return result
+}
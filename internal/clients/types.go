@@ -2,6 +2,7 @@ package clients
 
 import (
 	"context"
+	"time"
 
 	"github.com/sleepstars/deepempower/internal/models"
 )
@@ -15,10 +16,31 @@ type ModelClient interface {
 	CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error)
 }
 
+// Stream modes supported by CompleteStream
+const (
+	// StreamModeDelta emits each upstream delta as its own response
+	StreamModeDelta = "delta"
+	// StreamModeAggregate emits the running accumulated content on every response
+	StreamModeAggregate = "aggregate"
+)
+
 // ModelClientConfig contains configuration for model clients
 type ModelClientConfig struct {
 	APIBase        string
 	Model          string // 添加Model字段用于指定模型名称
 	DisabledParams []string
 	DefaultParams  map[string]interface{}
+	StreamMode     string // StreamModeDelta (default) or StreamModeAggregate
+	Retry          RetryConfig
+	ExtraHeaders   map[string]string // Added to every upstream request
+	ProxyURL       string            // Routes upstream requests through an HTTP proxy
+	Provider       string            // Selects the client in NewModelClient
+	DebugRaw       bool              // Logs raw upstream responses at DEBUG
+	// StreamIdleTimeout ends a Reasoner stream that sends nothing for this
+	// long with a StreamIdleError. Zero disables it.
+	StreamIdleTimeout time.Duration
+	// Endpoints replaces APIBase with several backends that NewModelClient
+	// balances the calls over using the LoadBalancing strategy
+	Endpoints     []Endpoint
+	LoadBalancing string // BalanceWeighted (default) or BalanceRoundRobin
 }
@@ -1,8 +1,18 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
 
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/metrics"
+	"github.com/sleepstars/deepempower/internal/prompt"
 	"gopkg.in/yaml.v3"
 )
 
@@ -11,19 +21,208 @@ type PipelineConfig struct {
 	Prompts PromptsConfig `yaml:"prompts"`
 	Models  ModelsConfig  `yaml:"models"`
 	APIKey  string        `yaml:"api_key"`
+	APIKeys []string      `yaml:"api_keys,omitempty"`
+	Shadow  *ShadowConfig `yaml:"shadow,omitempty"`
+
+	Confidence *ConfidenceConfig `yaml:"confidence,omitempty"`
+	Retry      RetryConfig       `yaml:"retry,omitempty"`
+	Complexity *ComplexityConfig `yaml:"complexity,omitempty"`
+	Stages     StagesConfig      `yaml:"stages,omitempty"`
+	Log        LogConfig         `yaml:"log,omitempty"`
+	LogLevel   string            `yaml:"log_level,omitempty"`
+	RateLimit  *RateLimitConfig  `yaml:"rate_limit,omitempty"`
+
+	// ReasonerFallback answers the reasoning stage with the Normal model when
+	// the Reasoner fails or returns no reasoning
+	ReasonerFallback bool `yaml:"reasoner_fallback,omitempty"`
+
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+
+	// StageTimeout bounds every pipeline stage attempt; zero disables it
+	StageTimeout time.Duration `yaml:"stage_timeout,omitempty"`
+	// DefaultRequestTimeout bounds a run whose context has no deadline of
+	// its own; zero disables it
+	DefaultRequestTimeout time.Duration `yaml:"default_request_timeout,omitempty"`
+
+	// IncludeReasoning returns the reasoning chain to callers unless the
+	// request overrides it. Off by default so chain-of-thought is not exposed.
+	IncludeReasoning bool `yaml:"include_reasoning,omitempty"`
+
+	Cache *CacheConfig `yaml:"cache,omitempty"`
+
+	// Mode selects the default pipeline mode: hybrid (default) runs all
+	// stages, passthrough answers with a single PassthroughModel call
+	Mode             string `yaml:"mode,omitempty"`
+	PassthroughModel string `yaml:"passthrough_model,omitempty"`
+
+	// Mock replaces the model clients with scripted ones so the pipeline
+	// runs without any upstream
+	Mock *MockConfig `yaml:"mock,omitempty"`
+
+	// SystemPrompt is sent as the first system message of every stage
+	// request, ahead of the stage's own prompt
+	SystemPrompt string `yaml:"system_prompt,omitempty"`
+
+	// MaxReasoningSteps stops the reasoning stage once this many steps have
+	// been collected; zero means unlimited
+	MaxReasoningSteps int `yaml:"max_reasoning_steps,omitempty"`
+
+	// TokenBudget fails a run once its stages have used more prompt plus
+	// completion tokens than this; zero means unlimited
+	TokenBudget int `yaml:"token_budget,omitempty"`
+
+	// MaxRequestBytes limits the size of request bodies; zero uses the
+	// server default of 10 MiB
+	MaxRequestBytes int64 `yaml:"max_request_bytes,omitempty"`
+	// MaxMessages limits the number of messages in a request; zero means
+	// unlimited
+	MaxMessages int `yaml:"max_messages,omitempty"`
+
+	CORS *CORSConfig `yaml:"cors,omitempty"`
+
+	// MetadataLabels lists the request metadata keys recorded as metric
+	// labels. Other keys only appear in logs, keeping metrics bounded.
+	MetadataLabels []string `yaml:"metadata_labels,omitempty"`
+
+	// ReasoningContinuations is how many times a Reasoner that stopped at
+	// its length limit is asked to continue before postprocessing; zero
+	// hands the truncated reasoning on as is
+	ReasoningContinuations int `yaml:"reasoning_continuations,omitempty"`
+
+	// DefaultParams apply to every model call; a model's own default_params
+	// and the request's parameters take precedence over them
+	DefaultParams map[string]interface{} `yaml:"default_params,omitempty"`
+
+	// Examples are few-shot messages placed before the user turn of a stage
+	Examples ExamplesConfig `yaml:"examples,omitempty"`
+
+	// LogLatency logs the connect, first byte and total time of every model
+	// call at DEBUG
+	LogLatency bool `yaml:"log_latency,omitempty"`
+
+	// ReasoningFormat controls how the reasoning steps are joined into the
+	// ReasoningText field of the post_process prompt
+	ReasoningFormat ReasoningFormatConfig `yaml:"reasoning_format,omitempty"`
+
+	// DisablePreprocessing drops the preprocessing stage so that the
+	// reasoner works on the user input directly
+	DisablePreprocessing bool `yaml:"disable_preprocessing,omitempty"`
+
+	// DegradedOutput answers with the reasoner's result, flagged as degraded,
+	// when the postprocessing stage fails instead of failing the request
+	DegradedOutput bool `yaml:"degraded_output,omitempty"`
+
+	// StreamUsage is where the token usage of streamed model calls comes
+	// from: provider, the default, or estimate
+	StreamUsage string `yaml:"stream_usage,omitempty"`
+
+	// RejectOverContext fails stages whose prompt is estimated to exceed the
+	// model's context_window instead of only logging a warning
+	RejectOverContext bool `yaml:"reject_over_context,omitempty"`
+
+	// RequireReasoning fails requests whose reasoning stage produced no
+	// reasoning steps
+	RequireReasoning bool `yaml:"require_reasoning,omitempty"`
+
+	// Safety checks the final answer before it is returned
+	Safety *SafetyConfig `yaml:"safety,omitempty"`
+
+	// MaxTotalLatency bounds a whole run, on top of the stage timeouts and the
+	// caller's deadline; zero disables it
+	MaxTotalLatency time.Duration `yaml:"max_total_latency,omitempty"`
+}
+
+// ReasoningFormatConfig controls how the reasoning is rendered. Left empty
+// the reasoning is used as written; otherwise each non-blank line is a step.
+type ReasoningFormatConfig struct {
+	// Separator goes between the steps; empty uses a newline when Numbered
+	// is set
+	Separator string `yaml:"separator,omitempty"`
+	// Numbered prefixes each step with its number, as in "1. "
+	Numbered bool `yaml:"numbered,omitempty"`
 }
 
+// MaxMetadataLabels bounds the number of metadata keys used as metric labels
+const MaxMetadataLabels = 8
+
+// reservedMetricLabels are the labels the pipeline metrics set themselves
+var reservedMetricLabels = map[string]bool{"outcome": true, "type": true}
+
 // PromptsConfig contains prompt templates for different stages
 type PromptsConfig struct {
 	PreProcess  string `yaml:"pre_process"`
 	Reasoning   string `yaml:"reasoning"`
 	PostProcess string `yaml:"post_process"`
+	// PostProcessNoReasoning replaces PostProcess when the reasoning stage
+	// produced no reasoning steps; a built-in prompt is used when empty
+	PostProcessNoReasoning string `yaml:"post_process_no_reasoning,omitempty"`
+	// Dir holds <name>.md files, e.g. reasoning.md, for the prompts not set
+	// inline. LoadConfig resolves a relative Dir against the directory of
+	// the config file.
+	Dir string `yaml:"dir,omitempty"`
 }
 
-// ModelsConfig contains configurations for different models
+// Pipeline modes
+const (
+	ModeHybrid      = "hybrid"
+	ModePassthrough = "passthrough"
+)
+
+// Sources of streamed token usage
+const (
+	// StreamUsageProvider takes the usage the provider reports at the end of
+	// a stream
+	StreamUsageProvider = "provider"
+	// StreamUsageEstimate estimates the usage from the streamed text
+	StreamUsageEstimate = "estimate"
+)
+
+// Names of the built-in models
+const (
+	ModelNormal   = "Normal"
+	ModelReasoner = "Reasoner"
+)
+
+// ModelsConfig contains configurations for different models. Normal and
+// Reasoner are the defaults; any other key under models is a named model
+// that stages can reference.
 type ModelsConfig struct {
-	Normal   ModelConfig `yaml:"Normal"`
-	Reasoner ModelConfig `yaml:"Reasoner"`
+	Normal   ModelConfig            `yaml:"Normal"`
+	Reasoner ModelConfig            `yaml:"Reasoner"`
+	Named    map[string]ModelConfig `yaml:",inline"`
+}
+
+// Lookup returns the model configured under name
+func (m ModelsConfig) Lookup(name string) (ModelConfig, bool) {
+	switch name {
+	case ModelNormal:
+		return m.Normal, true
+	case ModelReasoner:
+		return m.Reasoner, true
+	}
+	cfg, ok := m.Named[name]
+	return cfg, ok
+}
+
+// StagesConfig names the model each stage runs on. Empty entries default to
+// Normal for pre/post processing and Reasoner for reasoning.
+type StagesConfig struct {
+	PreProcess  string `yaml:"pre_process,omitempty"`
+	Reasoning   string `yaml:"reasoning,omitempty"`
+	PostProcess string `yaml:"post_process,omitempty"`
+}
+
+// ExamplesConfig lists the few-shot example messages of each stage
+type ExamplesConfig struct {
+	PreProcess  []ExampleMessage `yaml:"pre_process,omitempty"`
+	Reasoning   []ExampleMessage `yaml:"reasoning,omitempty"`
+	PostProcess []ExampleMessage `yaml:"post_process,omitempty"`
+}
+
+// ExampleMessage is one user or assistant turn of a few-shot example
+type ExampleMessage struct {
+	Role    string `yaml:"role"`
+	Content string `yaml:"content"`
 }
 
 // ModelConfig contains configuration for a specific model
@@ -32,6 +231,204 @@ type ModelConfig struct {
 	Model          string                 `yaml:"model"`
 	DefaultParams  map[string]interface{} `yaml:"default_params,omitempty"`
 	DisabledParams []string               `yaml:"disabled_params,omitempty"`
+	StreamMode     string                 `yaml:"stream_mode,omitempty"`
+	Retry          *ClientRetryConfig     `yaml:"retry,omitempty"`
+	ExtraHeaders   map[string]string      `yaml:"extra_headers,omitempty"`
+	ProxyURL       string                 `yaml:"proxy_url,omitempty"`
+	// MaxConcurrent caps the calls in flight to this model; further calls
+	// wait for a free slot. Zero means unlimited.
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+	// Provider selects the client the model is called through: openai,
+	// reasoner, anthropic or gemini. Defaults to reasoner for the Reasoner model and
+	// openai otherwise.
+	Provider string `yaml:"provider,omitempty"`
+	// DebugRaw logs the raw responses of this model at DEBUG level, with
+	// credentials redacted, to diagnose unexpected upstream output
+	DebugRaw bool `yaml:"debug_raw,omitempty"`
+	// StreamIdleTimeout ends a Reasoner stream that sends no data for this
+	// long, so a stalled upstream cannot hold the request forever. Zero
+	// disables it.
+	StreamIdleTimeout time.Duration `yaml:"stream_idle_timeout,omitempty"`
+	// Endpoints spreads the calls over several API compatible backends
+	// instead of the single api_base, failing over to the next endpoint when
+	// one cannot be reached
+	Endpoints []EndpointConfig `yaml:"endpoints,omitempty"`
+	// LoadBalancing picks the endpoint of each call: weighted (default)
+	// chooses at random in proportion to the weights, round_robin takes
+	// them in turn
+	LoadBalancing string `yaml:"load_balancing,omitempty"`
+	// ContextWindow is the number of tokens the model accepts; stage
+	// prompts estimated to exceed it are reported. Zero disables the check.
+	ContextWindow int `yaml:"context_window,omitempty"`
+}
+
+// EndpointConfig is one backend of a model served by several endpoints
+type EndpointConfig struct {
+	APIBase string `yaml:"api_base"`
+	// Weight is the endpoint's share of the calls; zero counts as one
+	Weight int `yaml:"weight,omitempty"`
+}
+
+// Load balancing strategies across the endpoints of a model
+const (
+	LoadBalancingWeighted   = "weighted"
+	LoadBalancingRoundRobin = "round_robin"
+)
+
+// APIBases returns the API base of every endpoint of the model
+func (m ModelConfig) APIBases() []string {
+	if len(m.Endpoints) == 0 {
+		return []string{m.APIBase}
+	}
+	bases := make([]string, len(m.Endpoints))
+	for i, endpoint := range m.Endpoints {
+		bases[i] = endpoint.APIBase
+	}
+	return bases
+}
+
+// Model providers
+const (
+	// ProviderOpenAI calls an OpenAI compatible chat completions API
+	ProviderOpenAI = "openai"
+	// ProviderReasoner calls an OpenAI compatible API that returns
+	// reasoning_content, reading its event stream directly
+	ProviderReasoner = "reasoner"
+	// ProviderAnthropic calls Anthropic's Messages API
+	ProviderAnthropic = "anthropic"
+	// ProviderGemini calls Google's Gemini generateContent API
+	ProviderGemini = "gemini"
+)
+
+// ClientRetryConfig controls how a model client retries transient upstream
+// failures (429, 5xx and network errors). Delays grow exponentially from
+// BaseDelay up to MaxDelay; Jitter randomises that fraction of each delay.
+// A Retry-After header on a 429 response is honoured up to MaxRetryAfter.
+type ClientRetryConfig struct {
+	MaxRetries    int           `yaml:"max_retries"`
+	BaseDelay     time.Duration `yaml:"base_delay,omitempty"`
+	MaxDelay      time.Duration `yaml:"max_delay,omitempty"`
+	Jitter        float64       `yaml:"jitter,omitempty"`
+	MaxRetryAfter time.Duration `yaml:"max_retry_after,omitempty"`
+}
+
+// ShadowConfig controls mirroring of a sample of requests to a secondary
+// pipeline whose results are logged for comparison but never returned
+type ShadowConfig struct {
+	Rate          float64       `yaml:"rate"`
+	Pipeline      string        `yaml:"pipeline"`
+	MaxConcurrent int           `yaml:"max_concurrent,omitempty"`
+	Timeout       time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ConfidenceConfig selects the strategy used to score answers when clients
+// request a confidence value
+type ConfidenceConfig struct {
+	Strategy string `yaml:"strategy"`
+}
+
+// ComplexityConfig enables classifying requests before the pipeline runs.
+// Requests scoring below Threshold are answered directly by the Normal model
+// without preprocessing or reasoning.
+type ComplexityConfig struct {
+	Strategy  string  `yaml:"strategy"`
+	Threshold float64 `yaml:"threshold,omitempty"`
+}
+
+// Actions of the safety stage on a flagged answer
+const (
+	SafetyActionBlock   = "block"
+	SafetyActionRewrite = "rewrite"
+)
+
+// SafetyConfig enables the content safety stage, which checks the final
+// answer against a denylist of regular expressions, a moderation endpoint or
+// both. Flagged answers are blocked, the default, or rewritten to Replacement.
+type SafetyConfig struct {
+	Denylist []string `yaml:"denylist,omitempty"`
+	// ModerationURL is an OpenAI compatible moderations endpoint
+	ModerationURL   string        `yaml:"moderation_url,omitempty"`
+	ModerationModel string        `yaml:"moderation_model,omitempty"`
+	APIKey          string        `yaml:"api_key,omitempty"`
+	Timeout         time.Duration `yaml:"timeout,omitempty"`
+	Action          string        `yaml:"action,omitempty"`
+	Replacement     string        `yaml:"replacement,omitempty"`
+}
+
+// Log output destinations
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputBoth   = "both"
+)
+
+// LogConfig controls where logs are written. Output is stdout (default), file
+// or both. Files are rotated once they exceed MaxSizeMB, keeping MaxBackups
+// rotated copies; a zero MaxSizeMB disables rotation.
+type LogConfig struct {
+	Output     string `yaml:"output,omitempty"`
+	File       string `yaml:"file,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+}
+
+// RateLimitConfig limits requests per API key (or remote IP when
+// unauthenticated) with a token bucket. Burst defaults to the rate rounded up.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst,omitempty"`
+}
+
+// CircuitBreakerConfig enables a circuit breaker per model client. After
+// FailureThreshold consecutive failures calls to that model fail fast for
+// Cooldown before a single probe call is let through. Zero values use the
+// defaults of 5 failures and 30s.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold,omitempty"`
+	Cooldown         time.Duration `yaml:"cooldown,omitempty"`
+}
+
+// CORSConfig allows browsers on AllowedOrigins to call the API. "*" allows
+// any origin but cannot be combined with AllowCredentials. Methods default
+// to GET, POST and OPTIONS; headers to Authorization and Content-Type.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods,omitempty"`
+	AllowedHeaders   []string      `yaml:"allowed_headers,omitempty"`
+	AllowCredentials bool          `yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `yaml:"max_age,omitempty"`
+}
+
+// CacheConfig enables an in-memory LRU cache of non-streaming responses keyed
+// by request content. Size defaults to 1000 entries; a zero TTL keeps entries
+// until they are evicted.
+type CacheConfig struct {
+	Size int           `yaml:"size,omitempty"`
+	TTL  time.Duration `yaml:"ttl,omitempty"`
+}
+
+// MockConfig scripts the answers of the Normal and Reasoner models in call
+// order; the last answer is repeated once a script runs out. Models without a
+// script return fixed placeholder answers.
+type MockConfig struct {
+	Normal   []MockResponse `yaml:"normal,omitempty"`
+	Reasoner []MockResponse `yaml:"reasoner,omitempty"`
+}
+
+// MockResponse is one scripted model answer
+type MockResponse struct {
+	Content      string   `yaml:"content"`
+	Reasoning    []string `yaml:"reasoning,omitempty"`
+	FinishReason string   `yaml:"finish_reason,omitempty"`
+}
+
+// RetryConfig controls how failed pipeline stages are retried. Backoff doubles
+// after every attempt. RetryOn lists the retryable error categories:
+// model_call, rate_limit, server_error and timeout.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+	RetryOn     []string      `yaml:"retry_on"`
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -44,5 +441,271 @@ func LoadConfig(path string) (*PipelineConfig, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	cfg.expandEnv()
+	// A relative prompts directory is found next to the config file,
+	// wherever the server is started from
+	if cfg.Prompts.Dir != "" && !filepath.IsAbs(cfg.Prompts.Dir) {
+		cfg.Prompts.Dir = filepath.Join(filepath.Dir(path), cfg.Prompts.Dir)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
 	return &cfg, nil
 }
+
+// Validate checks that the models and prompts required to run the pipeline
+// are present. All problems are reported together, each naming its field.
+func (c *PipelineConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs, c.Models.Normal.validate("models."+ModelNormal)...)
+	errs = append(errs, c.Models.Reasoner.validate("models."+ModelReasoner)...)
+	names := make([]string, 0, len(c.Models.Named))
+	for name := range c.Models.Named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		errs = append(errs, c.Models.Named[name].validate("models."+name)...)
+	}
+
+	for _, stage := range []struct{ field, model string }{
+		{"stages.pre_process", c.Stages.PreProcess},
+		{"stages.reasoning", c.Stages.Reasoning},
+		{"stages.post_process", c.Stages.PostProcess},
+	} {
+		if _, ok := c.Models.Lookup(stage.model); stage.model != "" && !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown model %q", stage.field, stage.model))
+		}
+	}
+
+	for _, stage := range []struct {
+		field    string
+		examples []ExampleMessage
+	}{
+		{"examples.pre_process", c.Examples.PreProcess},
+		{"examples.reasoning", c.Examples.Reasoning},
+		{"examples.post_process", c.Examples.PostProcess},
+	} {
+		for i, example := range stage.examples {
+			if example.Role != "user" && example.Role != "assistant" {
+				errs = append(errs, fmt.Errorf("%s[%d].role: must be user or assistant, got %q", stage.field, i, example.Role))
+			}
+			if example.Content == "" {
+				errs = append(errs, fmt.Errorf("%s[%d].content is required", stage.field, i))
+			}
+		}
+	}
+
+	switch c.Mode {
+	case "", ModeHybrid, ModePassthrough:
+	default:
+		errs = append(errs, fmt.Errorf("mode: unknown mode %q", c.Mode))
+	}
+	if s := c.Safety; s != nil {
+		if len(s.Denylist) == 0 && s.ModerationURL == "" {
+			errs = append(errs, errors.New("safety: denylist or moderation_url is required"))
+		}
+		for i, pattern := range s.Denylist {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("safety.denylist[%d]: %w", i, err))
+			}
+		}
+		if s.ModerationURL != "" {
+			if u, err := url.Parse(s.ModerationURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("safety.moderation_url: invalid url %q", s.ModerationURL))
+			}
+		}
+		if s.Timeout < 0 {
+			errs = append(errs, errors.New("safety.timeout must not be negative"))
+		}
+		switch s.Action {
+		case "", SafetyActionBlock:
+		case SafetyActionRewrite:
+			if s.Replacement == "" {
+				errs = append(errs, errors.New("safety.replacement is required for the rewrite action"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("safety.action: must be %s or %s, got %q", SafetyActionBlock, SafetyActionRewrite, s.Action))
+		}
+	}
+	switch c.StreamUsage {
+	case "", StreamUsageProvider, StreamUsageEstimate:
+	default:
+		errs = append(errs, fmt.Errorf("stream_usage: must be %s or %s, got %q", StreamUsageProvider, StreamUsageEstimate, c.StreamUsage))
+	}
+	if _, ok := c.Models.Lookup(c.PassthroughModel); c.PassthroughModel != "" && !ok {
+		errs = append(errs, fmt.Errorf("passthrough_model: unknown model %q", c.PassthroughModel))
+	}
+
+	if c.MaxReasoningSteps < 0 {
+		errs = append(errs, errors.New("max_reasoning_steps must not be negative"))
+	}
+	if c.TokenBudget < 0 {
+		errs = append(errs, errors.New("token_budget must not be negative"))
+	}
+	if c.MaxRequestBytes < 0 {
+		errs = append(errs, errors.New("max_request_bytes must not be negative"))
+	}
+	if c.MaxMessages < 0 {
+		errs = append(errs, errors.New("max_messages must not be negative"))
+	}
+	if c.ReasoningContinuations < 0 {
+		errs = append(errs, errors.New("reasoning_continuations must not be negative"))
+	}
+	if c.MaxTotalLatency < 0 {
+		errs = append(errs, errors.New("max_total_latency must not be negative"))
+	}
+	if len(c.MetadataLabels) > MaxMetadataLabels {
+		errs = append(errs, fmt.Errorf("metadata_labels must not contain more than %d labels", MaxMetadataLabels))
+	}
+	seenLabels := make(map[string]bool, len(c.MetadataLabels))
+	for _, label := range c.MetadataLabels {
+		switch {
+		case !metrics.ValidLabelName(label):
+			errs = append(errs, fmt.Errorf("metadata_labels: invalid label name %q", label))
+		case reservedMetricLabels[label]:
+			errs = append(errs, fmt.Errorf("metadata_labels: %q is reserved", label))
+		case seenLabels[label]:
+			errs = append(errs, fmt.Errorf("metadata_labels: duplicate label %q", label))
+		}
+		seenLabels[label] = true
+	}
+	if c.CORS != nil && c.CORS.AllowCredentials {
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New(`cors.allow_credentials cannot be combined with the "*" origin`))
+				break
+			}
+		}
+	}
+
+	for _, tmpl := range []struct{ field, text string }{
+		{"prompts.pre_process", c.Prompts.PreProcess},
+		{"prompts.reasoning", c.Prompts.Reasoning},
+		{"prompts.post_process", c.Prompts.PostProcess},
+	} {
+		if tmpl.text == "" {
+			// The prompt is read from the prompts directory instead
+			if c.Prompts.Dir == "" {
+				errs = append(errs, fmt.Errorf("%s is required", tmpl.field))
+			}
+			continue
+		}
+		if _, err := prompt.Parse(tmpl.field, tmpl.text); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tmpl.field, err))
+		}
+	}
+	if c.Prompts.PostProcessNoReasoning != "" {
+		if _, err := prompt.Parse("prompts.post_process_no_reasoning", c.Prompts.PostProcessNoReasoning); err != nil {
+			errs = append(errs, fmt.Errorf("prompts.post_process_no_reasoning: %w", err))
+		}
+	}
+
+	if c.LogLevel != "" {
+		if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("log_level: %w", err))
+		}
+	}
+
+	switch c.Log.Output {
+	case "", LogOutputStdout:
+	case LogOutputFile, LogOutputBoth:
+		if c.Log.File == "" {
+			errs = append(errs, fmt.Errorf("log.file is required when log.output is %q", c.Log.Output))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("log.output: unknown output %q", c.Log.Output))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m ModelConfig) validate(field string) []error {
+	var errs []error
+	if m.APIBase == "" && len(m.Endpoints) == 0 {
+		errs = append(errs, fmt.Errorf("%s.api_base is required", field))
+	}
+	for i, endpoint := range m.Endpoints {
+		if endpoint.APIBase == "" {
+			errs = append(errs, fmt.Errorf("%s.endpoints[%d].api_base is required", field, i))
+		}
+		if endpoint.Weight < 0 {
+			errs = append(errs, fmt.Errorf("%s.endpoints[%d].weight must not be negative", field, i))
+		}
+	}
+	switch m.LoadBalancing {
+	case "", LoadBalancingWeighted, LoadBalancingRoundRobin:
+	default:
+		errs = append(errs, fmt.Errorf("%s.load_balancing: unknown strategy %q", field, m.LoadBalancing))
+	}
+	if m.Model == "" {
+		errs = append(errs, fmt.Errorf("%s.model is required", field))
+	}
+	switch m.Provider {
+	case "", ProviderOpenAI, ProviderReasoner, ProviderAnthropic, ProviderGemini:
+	default:
+		errs = append(errs, fmt.Errorf("%s.provider: unknown provider %q", field, m.Provider))
+	}
+	if m.MaxConcurrent < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_concurrent must not be negative", field))
+	}
+	if m.StreamIdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("%s.stream_idle_timeout must not be negative", field))
+	}
+	if m.ContextWindow < 0 {
+		errs = append(errs, fmt.Errorf("%s.context_window must not be negative", field))
+	}
+	if m.ProxyURL != "" {
+		if proxy, err := url.Parse(m.ProxyURL); err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.proxy_url: invalid url %q", field, m.ProxyURL))
+		}
+	}
+	return errs
+}
+
+// envRef matches ${VAR} and ${VAR:-default}
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} references with the value of the environment
+// variable. ${VAR:-default} uses default when VAR is unset or empty. Strings
+// without references are returned unchanged.
+func expandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		match := envRef.FindStringSubmatch(ref)
+		if value := os.Getenv(match[1]); value != "" || match[2] == "" {
+			return value
+		}
+		return match[3]
+	})
+}
+
+// expandEnv expands environment references in the connection settings.
+// Prompts are left alone since templates may contain their own ${...} placeholders.
+func (c *PipelineConfig) expandEnv() {
+	c.APIKey = expandEnv(c.APIKey)
+	for i, key := range c.APIKeys {
+		c.APIKeys[i] = expandEnv(key)
+	}
+	if c.Safety != nil {
+		c.Safety.APIKey = expandEnv(c.Safety.APIKey)
+	}
+	c.Models.Normal.expandEnv()
+	c.Models.Reasoner.expandEnv()
+	for name, model := range c.Models.Named {
+		model.expandEnv()
+		c.Models.Named[name] = model
+	}
+}
+
+func (m *ModelConfig) expandEnv() {
+	m.APIBase = expandEnv(m.APIBase)
+	m.Model = expandEnv(m.Model)
+	m.ProxyURL = expandEnv(m.ProxyURL)
+	for i := range m.Endpoints {
+		m.Endpoints[i].APIBase = expandEnv(m.Endpoints[i].APIBase)
+	}
+	for name, value := range m.ExtraHeaders {
+		m.ExtraHeaders[name] = expandEnv(value)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -85,9 +86,8 @@ prompts:
 		err := os.WriteFile(emptyPath, []byte{}, 0644)
 		assert.NoError(t, err)
 
-		cfg, err := LoadConfig(emptyPath)
-		assert.NoError(t, err)
-		assert.Empty(t, cfg.Models.Normal.APIBase)
+		_, err = LoadConfig(emptyPath)
+		assert.ErrorContains(t, err, "models.Normal.api_base is required")
 	})
 }
 
@@ -109,6 +109,16 @@ func TestModelConfig(t *testing.T) {
 	assert.Contains(t, cfg.DisabledParams, "presence_penalty")
 }
 
+func TestModelConfig_APIBases(t *testing.T) {
+	assert.Equal(t, []string{"http://test"}, ModelConfig{APIBase: "http://test"}.APIBases())
+
+	cfg := ModelConfig{
+		APIBase:   "http://ignored",
+		Endpoints: []EndpointConfig{{APIBase: "http://a", Weight: 2}, {APIBase: "http://b"}},
+	}
+	assert.Equal(t, []string{"http://a", "http://b"}, cfg.APIBases())
+}
+
 func TestPromptsConfig(t *testing.T) {
 	cfg := PromptsConfig{
 		PreProcess:  "test pre {{.Var}}",
@@ -138,3 +148,501 @@ func TestModelsConfig(t *testing.T) {
 	assert.Equal(t, "http://reasoner", cfg.Reasoner.APIBase)
 	assert.Equal(t, "reasoner-model", cfg.Reasoner.Model)
 }
+
+func TestLoadConfig_NamedModels(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	testConfig := `models:
+  Normal:
+    api_base: "http://localhost:8001"
+    model: "gpt-3.5-turbo"
+  Reasoner:
+    api_base: "http://localhost:8002"
+    model: "gpt-4"
+  Cheap:
+    api_base: "http://localhost:8003"
+    model: "cheap-model"
+    default_params:
+      temperature: 0.2
+  Summarizer:
+    api_base: "http://localhost:8004"
+    model: "summary-model"
+
+stages:
+  pre_process: "Cheap"
+  post_process: "Summarizer"
+
+prompts:
+  pre_process: "pre"
+  reasoning: "reason"
+  post_process: "post"
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfig), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+
+	// The default models keep their dedicated fields
+	assert.Equal(t, "gpt-3.5-turbo", cfg.Models.Normal.Model)
+	assert.Equal(t, "gpt-4", cfg.Models.Reasoner.Model)
+	assert.Len(t, cfg.Models.Named, 2)
+
+	assert.Equal(t, "Cheap", cfg.Stages.PreProcess)
+	assert.Empty(t, cfg.Stages.Reasoning)
+	assert.Equal(t, "Summarizer", cfg.Stages.PostProcess)
+
+	cheap, ok := cfg.Models.Lookup("Cheap")
+	assert.True(t, ok)
+	assert.Equal(t, "http://localhost:8003", cheap.APIBase)
+	assert.Equal(t, "cheap-model", cheap.Model)
+	assert.Equal(t, 0.2, cheap.DefaultParams["temperature"])
+
+	reasoner, ok := cfg.Models.Lookup(ModelReasoner)
+	assert.True(t, ok)
+	assert.Equal(t, "gpt-4", reasoner.Model)
+
+	_, ok = cfg.Models.Lookup("Missing")
+	assert.False(t, ok)
+}
+
+func TestLoadConfig_LegacyModelsHaveNoNamedModels(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	testConfig := `models:
+  Normal:
+    api_base: "http://localhost:8001"
+    model: "gpt-3.5-turbo"
+  Reasoner:
+    api_base: "http://localhost:8002"
+    model: "gpt-4"
+prompts:
+  pre_process: "pre"
+  reasoning: "reason"
+  post_process: "post"
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfig), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Models.Named)
+	assert.Equal(t, StagesConfig{}, cfg.Stages)
+}
+
+func TestLoadConfig_PromptsDir(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	testConfig := `models:
+  Normal:
+    api_base: "http://localhost:8001"
+    model: "gpt-3.5-turbo"
+  Reasoner:
+    api_base: "http://localhost:8002"
+    model: "gpt-4"
+prompts:
+  dir: `
+	// A relative directory is taken from the config file's directory
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfig+"prompts/hybrid\n"), 0644))
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "prompts", "hybrid"), cfg.Prompts.Dir)
+
+	abs := filepath.Join(t.TempDir(), "prompts")
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfig+abs+"\n"), 0644))
+	cfg, err = LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, abs, cfg.Prompts.Dir)
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("DE_TEST_SET", "value")
+	t.Setenv("DE_TEST_EMPTY", "")
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "literal", input: "http://localhost:8001", expected: "http://localhost:8001"},
+		{name: "literal with dollar", input: "pa$$word", expected: "pa$$word"},
+		{name: "set variable", input: "${DE_TEST_SET}", expected: "value"},
+		{name: "embedded variable", input: "http://${DE_TEST_SET}:8001/v1", expected: "http://value:8001/v1"},
+		{name: "unset variable", input: "${DE_TEST_UNSET}", expected: ""},
+		{name: "default for unset", input: "${DE_TEST_UNSET:-fallback}", expected: "fallback"},
+		{name: "default for empty", input: "${DE_TEST_EMPTY:-fallback}", expected: "fallback"},
+		{name: "default ignored when set", input: "${DE_TEST_SET:-fallback}", expected: "value"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, expandEnv(tc.input))
+		})
+	}
+}
+
+func TestLoadConfig_EnvSubstitution(t *testing.T) {
+	t.Setenv("DE_TEST_API_KEY", "sk-secret")
+	t.Setenv("DE_TEST_NORMAL_BASE", "http://normal:8001")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	testConfig := `api_key: "${DE_TEST_API_KEY}"
+models:
+  Normal:
+    api_base: "${DE_TEST_NORMAL_BASE}"
+    model: "${DE_TEST_NORMAL_MODEL:-gpt-3.5-turbo}"
+  Reasoner:
+    api_base: "${DE_TEST_REASONER_BASE:-http://reasoner:8002}"
+    model: "gpt-4"
+    proxy_url: "${DE_TEST_PROXY:-http://proxy:3128}"
+    extra_headers:
+      X-Org-Id: "${DE_TEST_API_KEY}"
+  Cheap:
+    api_base: "${DE_TEST_NORMAL_BASE}"
+    model: "${DE_TEST_CHEAP_MODEL:-cheap-model}"
+prompts:
+  pre_process: "Analyze: ${input}"
+  reasoning: "reason"
+  post_process: "post"
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfig), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-secret", cfg.APIKey)
+	assert.Equal(t, "http://normal:8001", cfg.Models.Normal.APIBase)
+	assert.Equal(t, "gpt-3.5-turbo", cfg.Models.Normal.Model)
+	assert.Equal(t, "http://reasoner:8002", cfg.Models.Reasoner.APIBase)
+	assert.Equal(t, "gpt-4", cfg.Models.Reasoner.Model)
+	assert.Equal(t, "http://proxy:3128", cfg.Models.Reasoner.ProxyURL)
+	assert.Equal(t, map[string]string{"X-Org-Id": "sk-secret"}, cfg.Models.Reasoner.ExtraHeaders)
+	assert.Equal(t, "http://normal:8001", cfg.Models.Named["Cheap"].APIBase)
+	assert.Equal(t, "cheap-model", cfg.Models.Named["Cheap"].Model)
+
+	// Prompt placeholders are not environment references
+	assert.Equal(t, "Analyze: ${input}", cfg.Prompts.PreProcess)
+}
+
+func validConfig() *PipelineConfig {
+	return &PipelineConfig{
+		Models: ModelsConfig{
+			Normal:   ModelConfig{APIBase: "http://normal", Model: "normal-model"},
+			Reasoner: ModelConfig{APIBase: "http://reasoner", Model: "reasoner-model"},
+		},
+		Prompts: PromptsConfig{
+			PreProcess:  "Analyze: {{.UserInput}}",
+			Reasoning:   "Think about: {{.StructuredInput}}",
+			PostProcess: "Summarize: {{.ReasoningChain}}",
+		},
+	}
+}
+
+func TestPipelineConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(cfg *PipelineConfig)
+		expected string
+	}{
+		{name: "valid", modify: func(cfg *PipelineConfig) {}},
+		{
+			name:     "missing normal api base",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Normal.APIBase = "" },
+			expected: "models.Normal.api_base is required",
+		},
+		{
+			name:     "missing normal model",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Normal.Model = "" },
+			expected: "models.Normal.model is required",
+		},
+		{
+			name:     "missing reasoner api base",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Reasoner.APIBase = "" },
+			expected: "models.Reasoner.api_base is required",
+		},
+		{
+			name:     "missing reasoner model",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Reasoner.Model = "" },
+			expected: "models.Reasoner.model is required",
+		},
+		{
+			name: "incomplete named model",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Models.Named = map[string]ModelConfig{"Cheap": {Model: "cheap-model"}}
+			},
+			expected: "models.Cheap.api_base is required",
+		},
+		{
+			name:   "proxy url",
+			modify: func(cfg *PipelineConfig) { cfg.Models.Reasoner.ProxyURL = "http://proxy.internal:3128" },
+		},
+		{
+			name:     "invalid proxy url",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Reasoner.ProxyURL = "proxy.internal" },
+			expected: `models.Reasoner.proxy_url: invalid url "proxy.internal"`,
+		},
+		{
+			name: "cors credentials with any origin",
+			modify: func(cfg *PipelineConfig) {
+				cfg.CORS = &CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+			},
+			expected: `cors.allow_credentials cannot be combined with the "*" origin`,
+		},
+		{
+			name:     "negative max request bytes",
+			modify:   func(cfg *PipelineConfig) { cfg.MaxRequestBytes = -1 },
+			expected: "max_request_bytes must not be negative",
+		},
+		{
+			name:     "negative token budget",
+			modify:   func(cfg *PipelineConfig) { cfg.TokenBudget = -1 },
+			expected: "token_budget must not be negative",
+		},
+		{
+			name:     "negative max reasoning steps",
+			modify:   func(cfg *PipelineConfig) { cfg.MaxReasoningSteps = -1 },
+			expected: "max_reasoning_steps must not be negative",
+		},
+		{
+			name:     "negative max concurrent",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Normal.MaxConcurrent = -1 },
+			expected: "models.Normal.max_concurrent must not be negative",
+		},
+		{
+			name:     "negative reasoning continuations",
+			modify:   func(cfg *PipelineConfig) { cfg.ReasoningContinuations = -1 },
+			expected: "reasoning_continuations must not be negative",
+		},
+		{
+			name: "safety denylist",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Safety = &SafetyConfig{Denylist: []string{`(?i)secret`}, Action: SafetyActionRewrite, Replacement: "[removed]"}
+			},
+		},
+		{
+			name:     "safety without checks",
+			modify:   func(cfg *PipelineConfig) { cfg.Safety = &SafetyConfig{} },
+			expected: "safety: denylist or moderation_url is required",
+		},
+		{
+			name:     "invalid safety pattern",
+			modify:   func(cfg *PipelineConfig) { cfg.Safety = &SafetyConfig{Denylist: []string{"("}} },
+			expected: "safety.denylist[0]: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name:     "invalid moderation url",
+			modify:   func(cfg *PipelineConfig) { cfg.Safety = &SafetyConfig{ModerationURL: "moderations"} },
+			expected: `safety.moderation_url: invalid url "moderations"`,
+		},
+		{
+			name: "rewrite without replacement",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Safety = &SafetyConfig{Denylist: []string{"secret"}, Action: SafetyActionRewrite}
+			},
+			expected: "safety.replacement is required for the rewrite action",
+		},
+		{
+			name:     "unknown safety action",
+			modify:   func(cfg *PipelineConfig) { cfg.Safety = &SafetyConfig{Denylist: []string{"secret"}, Action: "drop"} },
+			expected: `safety.action: must be block or rewrite, got "drop"`,
+		},
+		{
+			name:     "negative max total latency",
+			modify:   func(cfg *PipelineConfig) { cfg.MaxTotalLatency = -time.Second },
+			expected: "max_total_latency must not be negative",
+		},
+		{
+			name:     "negative stream idle timeout",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Reasoner.StreamIdleTimeout = -time.Second },
+			expected: "models.Reasoner.stream_idle_timeout must not be negative",
+		},
+		{
+			name: "endpoints instead of api base",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Models.Normal.APIBase = ""
+				cfg.Models.Normal.Endpoints = []EndpointConfig{{APIBase: "http://a", Weight: 3}, {APIBase: "http://b"}}
+				cfg.Models.Normal.LoadBalancing = LoadBalancingRoundRobin
+			},
+		},
+		{
+			name:     "endpoint without api base",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Normal.Endpoints = []EndpointConfig{{Weight: 1}} },
+			expected: "models.Normal.endpoints[0].api_base is required",
+		},
+		{
+			name: "negative endpoint weight",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Models.Normal.Endpoints = []EndpointConfig{{APIBase: "http://a"}, {APIBase: "http://b", Weight: -1}}
+			},
+			expected: "models.Normal.endpoints[1].weight must not be negative",
+		},
+		{
+			name:     "unknown load balancing",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Normal.LoadBalancing = "least_conn" },
+			expected: `models.Normal.load_balancing: unknown strategy "least_conn"`,
+		},
+		{
+			name:   "anthropic provider",
+			modify: func(cfg *PipelineConfig) { cfg.Models.Reasoner.Provider = ProviderAnthropic },
+		},
+		{
+			name:   "gemini provider",
+			modify: func(cfg *PipelineConfig) { cfg.Models.Reasoner.Provider = ProviderGemini },
+		},
+		{
+			name:   "reasoner provider",
+			modify: func(cfg *PipelineConfig) { cfg.Models.Normal.Provider = ProviderReasoner },
+		},
+		{
+			name:     "unknown provider",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Normal.Provider = "bedrock" },
+			expected: `models.Normal.provider: unknown provider "bedrock"`,
+		},
+		{
+			name:   "passthrough mode",
+			modify: func(cfg *PipelineConfig) { cfg.Mode = ModePassthrough; cfg.PassthroughModel = ModelReasoner },
+		},
+		{
+			name:     "unknown mode",
+			modify:   func(cfg *PipelineConfig) { cfg.Mode = "direct" },
+			expected: `mode: unknown mode "direct"`,
+		},
+		{
+			name:     "negative context window",
+			modify:   func(cfg *PipelineConfig) { cfg.Models.Reasoner.ContextWindow = -1 },
+			expected: "models.Reasoner.context_window must not be negative",
+		},
+		{
+			name:   "estimated stream usage",
+			modify: func(cfg *PipelineConfig) { cfg.StreamUsage = StreamUsageEstimate },
+		},
+		{
+			name:     "unknown stream usage",
+			modify:   func(cfg *PipelineConfig) { cfg.StreamUsage = "exact" },
+			expected: `stream_usage: must be provider or estimate, got "exact"`,
+		},
+		{
+			name:     "unknown passthrough model",
+			modify:   func(cfg *PipelineConfig) { cfg.PassthroughModel = "Missing" },
+			expected: `passthrough_model: unknown model "Missing"`,
+		},
+		{
+			name:     "unknown stage model",
+			modify:   func(cfg *PipelineConfig) { cfg.Stages.PostProcess = "Missing" },
+			expected: `stages.post_process: unknown model "Missing"`,
+		},
+		{
+			name: "example with unknown role",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Examples.Reasoning = []ExampleMessage{{Role: "user", Content: "Q"}, {Role: "system", Content: "A"}}
+			},
+			expected: `examples.reasoning[1].role: must be user or assistant, got "system"`,
+		},
+		{
+			name: "example without content",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Examples.PreProcess = []ExampleMessage{{Role: "user"}}
+			},
+			expected: "examples.pre_process[0].content is required",
+		},
+		{
+			name:     "missing pre_process prompt",
+			modify:   func(cfg *PipelineConfig) { cfg.Prompts.PreProcess = "" },
+			expected: "prompts.pre_process is required",
+		},
+		{
+			name:     "missing reasoning prompt",
+			modify:   func(cfg *PipelineConfig) { cfg.Prompts.Reasoning = "" },
+			expected: "prompts.reasoning is required",
+		},
+		{
+			name:     "missing post_process prompt",
+			modify:   func(cfg *PipelineConfig) { cfg.Prompts.PostProcess = "" },
+			expected: "prompts.post_process is required",
+		},
+		{
+			name: "prompts from directory",
+			modify: func(cfg *PipelineConfig) {
+				cfg.Prompts.PreProcess = ""
+				cfg.Prompts.Dir = "configs/prompts/hybrid"
+			},
+		},
+		{
+			name:   "prompt template functions",
+			modify: func(cfg *PipelineConfig) { cfg.Prompts.PostProcess = `{{join .ReasoningChain "\n" | trim}}` },
+		},
+		{
+			name:     "malformed no-reasoning prompt",
+			modify:   func(cfg *PipelineConfig) { cfg.Prompts.PostProcessNoReasoning = "{{.IntermediateResult" },
+			expected: "prompts.post_process_no_reasoning:",
+		},
+		{
+			name:   "metadata labels",
+			modify: func(cfg *PipelineConfig) { cfg.MetadataLabels = []string{"tenant", "feature"} },
+		},
+		{
+			name:     "invalid metadata label",
+			modify:   func(cfg *PipelineConfig) { cfg.MetadataLabels = []string{"team-name"} },
+			expected: `metadata_labels: invalid label name "team-name"`,
+		},
+		{
+			name:     "reserved metadata label",
+			modify:   func(cfg *PipelineConfig) { cfg.MetadataLabels = []string{"outcome"} },
+			expected: `metadata_labels: "outcome" is reserved`,
+		},
+		{
+			name:     "duplicate metadata label",
+			modify:   func(cfg *PipelineConfig) { cfg.MetadataLabels = []string{"tenant", "tenant"} },
+			expected: `metadata_labels: duplicate label "tenant"`,
+		},
+		{
+			name:     "too many metadata labels",
+			modify:   func(cfg *PipelineConfig) { cfg.MetadataLabels = []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"} },
+			expected: "metadata_labels must not contain more than 8 labels",
+		},
+		{
+			name:   "log level",
+			modify: func(cfg *PipelineConfig) { cfg.LogLevel = "Debug" },
+		},
+		{
+			name:     "invalid log level",
+			modify:   func(cfg *PipelineConfig) { cfg.LogLevel = "verbose" },
+			expected: `log_level: unknown log level "verbose"`,
+		},
+		{
+			name:   "file log output",
+			modify: func(cfg *PipelineConfig) { cfg.Log = LogConfig{Output: LogOutputBoth, File: "/tmp/app.log"} },
+		},
+		{
+			name:     "file log output without file",
+			modify:   func(cfg *PipelineConfig) { cfg.Log = LogConfig{Output: LogOutputFile} },
+			expected: "log.file is required",
+		},
+		{
+			name:     "unknown log output",
+			modify:   func(cfg *PipelineConfig) { cfg.Log = LogConfig{Output: "syslog"} },
+			expected: `log.output: unknown output "syslog"`,
+		},
+		{
+			name:     "unparseable prompt",
+			modify:   func(cfg *PipelineConfig) { cfg.Prompts.Reasoning = "Think about: {{.StructuredInput" },
+			expected: "prompts.reasoning:",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.modify(cfg)
+
+			err := cfg.Validate()
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+func TestPipelineConfig_ValidateReportsAllErrors(t *testing.T) {
+	err := (&PipelineConfig{}).Validate()
+	assert.ErrorContains(t, err, "models.Normal.api_base is required")
+	assert.ErrorContains(t, err, "models.Reasoner.model is required")
+	assert.ErrorContains(t, err, "prompts.post_process is required")
+}
@@ -1,10 +1,16 @@
 package logger
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // LogLevel represents different logging levels
@@ -31,44 +37,142 @@ var levelNames = map[LogLevel]string{
 	FATAL: "FATAL",
 }
 
+// ParseLevel converts a level name such as "debug" or "WARN" into a LogLevel
+func ParseLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(name), levelName) {
+			return level, nil
+		}
+	}
+	return INFO, fmt.Errorf("unknown log level %q", name)
+}
+
+// Format selects how log lines are rendered
+type Format int
+
+const (
+	// TextFormat renders "[LEVEL][component] message" lines
+	TextFormat Format = iota
+	// JSONFormat renders one JSON object per line with level, component, msg, ts and fields
+	JSONFormat
+)
+
+// Option configures the logger created by InitLogger
+type Option func(*Logger)
+
+// WithFormat selects the output format. Without it the LOG_FORMAT environment
+// variable is used ("json" or "text"), defaulting to text.
+func WithFormat(format Format) Option {
+	return func(l *Logger) {
+		l.setFormat(format)
+	}
+}
+
+// WithOutput sends log lines to w instead of os.Stdout. Use io.MultiWriter to
+// write to several destinations.
+func WithOutput(w io.Writer) Option {
+	return func(l *Logger) {
+		l.logger.SetOutput(w)
+	}
+}
+
 // Logger represents our custom logger with levels
 type Logger struct {
 	level     LogLevel
 	logger    *log.Logger
 	mu        sync.Mutex
 	component string
+	format    Format
+	fields    map[string]interface{}
 }
 
 var (
 	defaultLogger *Logger
-	once         sync.Once
+	defaultMu     sync.Mutex
 )
 
-// InitLogger initializes the default logger
-func InitLogger(level LogLevel, component string) {
-	once.Do(func() {
-		defaultLogger = &Logger{
-			level:     level,
-			logger:    log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds),
-			component: component,
-		}
-	})
+// InitLogger initializes the default logger. Only the first call takes
+// effect; later calls keep the existing logger until ResetLogger is called.
+func InitLogger(level LogLevel, component string, opts ...Option) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultLogger == nil {
+		defaultLogger = newDefaultLogger(level, component, opts)
+	}
+}
+
+// newDefaultLogger builds the logger set up by InitLogger
+func newDefaultLogger(level LogLevel, component string, opts []Option) *Logger {
+	l := &Logger{
+		level:     level,
+		logger:    log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds),
+		component: component,
+	}
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		l.setFormat(JSONFormat)
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// ResetLogger discards the default logger so the next InitLogger call
+// configures a new one. It is meant for tests that need another level, format
+// or output; loggers already derived from the old default keep its settings.
+func ResetLogger() {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = nil
+}
+
+// setFormat switches the format. JSON lines carry their own timestamp so the
+// standard log prefix is dropped.
+func (l *Logger) setFormat(format Format) {
+	l.format = format
+	if format == JSONFormat {
+		l.logger.SetFlags(0)
+	} else {
+		l.logger.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	}
 }
 
 // GetLogger returns the default logger instance
 func GetLogger() *Logger {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
 	if defaultLogger == nil {
-		InitLogger(INFO, "default")
+		defaultLogger = newDefaultLogger(INFO, "default", nil)
 	}
 	return defaultLogger
 }
 
 // WithComponent creates a new logger with the specified component name
 func (l *Logger) WithComponent(component string) *Logger {
+	child := l.clone()
+	child.component = component
+	return child
+}
+
+// WithField creates a new logger that attaches key=value to every message
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	child := l.clone()
+	child.fields = make(map[string]interface{}, len(l.fields)+1)
+	for k, v := range l.fields {
+		child.fields[k] = v
+	}
+	child.fields[key] = value
+	return child
+}
+
+// clone copies the logger settings into a new logger sharing the same output
+func (l *Logger) clone() *Logger {
 	return &Logger{
 		level:     l.level,
 		logger:    l.logger,
-		component: component,
+		component: l.component,
+		format:    l.format,
+		fields:    l.fields,
 	}
 }
 
@@ -89,13 +193,57 @@ func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 	defer l.mu.Unlock()
 
 	msg := fmt.Sprintf(format, args...)
-	l.logger.Printf("[%s][%s] %s", levelNames[level], l.component, msg)
+	if l.format == JSONFormat {
+		l.logger.Print(l.jsonLine(level, msg))
+	} else {
+		l.logger.Printf("[%s][%s] %s%s", levelNames[level], l.component, msg, l.textFields())
+	}
 
 	if level == FATAL {
 		os.Exit(1)
 	}
 }
 
+// jsonLine renders a message as a single JSON object. Fields never override
+// the level, component, msg and ts keys.
+func (l *Logger) jsonLine(level LogLevel, msg string) string {
+	entry := make(map[string]interface{}, len(l.fields)+4)
+	for k, v := range l.fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["level"] = levelNames[level]
+	entry["component"] = l.component
+	entry["msg"] = msg
+	entry["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf(`{"level":%q,"component":%q,"msg":%q,"log_error":%q}`, levelNames[level], l.component, msg, err.Error())
+	}
+	return string(data)
+}
+
+// textFields renders the attached fields as " key=value" pairs sorted by key
+func (l *Logger) textFields() string {
+	if len(l.fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, l.fields[k])
+	}
+	return b.String()
+}
+
 // Debug logs debug level messages
 func (l *Logger) Debug(format string, args ...interface{}) {
 	l.log(DEBUG, format, args...)
@@ -121,11 +269,45 @@ func (l *Logger) Fatal(format string, args ...interface{}) {
 	l.log(FATAL, format, args...)
 }
 
-// WithError creates an error message with stack trace
+// WithError creates a new logger that records err in the "error" field
 func (l *Logger) WithError(err error) *Logger {
-	return &Logger{
-		level:     l.level,
-		logger:    l.logger,
-		component: fmt.Sprintf("%s: %v", l.component, err),
+	return l.WithField("error", err)
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying the request ID picked up by WithContext
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type metadataKey struct{}
+
+// ContextWithMetadata returns a context carrying request metadata picked up by WithContext
+func ContextWithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+// MetadataFromContext returns the request metadata stored in ctx, if any
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
+
+// WithContext returns a logger that tags every message with the request ID
+// and metadata carried by ctx. Without either the logger is returned unchanged.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		l = l.WithField("request_id", id)
+	}
+	if metadata := MetadataFromContext(ctx); len(metadata) > 0 {
+		l = l.WithField("metadata", metadata)
 	}
+	return l
 }
@@ -2,21 +2,26 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"log"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLogger(t *testing.T) {
 	// Capture log output
 	var buf bytes.Buffer
-	defaultLogger = &Logger{
-		level:     INFO,
-		logger:    log.New(&buf, "", log.LstdFlags|log.Lmicroseconds),
-		component: "test",
-	}
+	ResetLogger()
+	t.Cleanup(ResetLogger)
+	InitLogger(INFO, "test", WithFormat(TextFormat), WithOutput(&buf))
+	defaultLogger := GetLogger()
 
 	tests := []struct {
 		name     string
@@ -85,8 +90,17 @@ func TestLoggerWithComponent(t *testing.T) {
 
 func TestLoggerWithError(t *testing.T) {
 	err := assert.AnError
-	logger := GetLogger().WithError(err)
-	assert.True(t, strings.Contains(logger.component, err.Error()))
+	parent := GetLogger().WithComponent("test-component")
+	logger := parent.WithError(err)
+	assert.Equal(t, "test-component", logger.component, "component should not change")
+	assert.Equal(t, err, logger.fields["error"])
+	assert.Empty(t, parent.fields, "parent logger should not gain the field")
+
+	var buf bytes.Buffer
+	logger.logger = log.New(&buf, "", 0)
+	logger.level = INFO
+	logger.Error("call failed")
+	assert.Equal(t, "[ERROR][test-component] call failed error="+err.Error()+"\n", buf.String())
 }
 
 func TestLogLevelNames(t *testing.T) {
@@ -98,8 +112,8 @@ func TestLogLevelNames(t *testing.T) {
 }
 
 func TestInitLoggerSingleton(t *testing.T) {
-	// Reset the singleton
-	defaultLogger = nil
+	ResetLogger()
+	t.Cleanup(ResetLogger)
 
 	// Initialize multiple times
 	for i := 0; i < 3; i++ {
@@ -113,3 +127,194 @@ func TestInitLoggerSingleton(t *testing.T) {
 	assert.Equal(t, DEBUG, logger1.level)
 	assert.Equal(t, "test", logger1.component)
 }
+
+func TestResetLogger(t *testing.T) {
+	ResetLogger()
+	t.Cleanup(ResetLogger)
+
+	var text bytes.Buffer
+	InitLogger(INFO, "first", WithFormat(TextFormat), WithOutput(&text))
+	first := GetLogger()
+	first.Debug("hidden")
+	first.Info("plain")
+	assert.Contains(t, text.String(), "[INFO][first] plain")
+	assert.NotContains(t, text.String(), "hidden")
+
+	ResetLogger()
+	var jsonBuf bytes.Buffer
+	InitLogger(DEBUG, "second", WithFormat(JSONFormat), WithOutput(&jsonBuf))
+	second := GetLogger()
+	assert.NotSame(t, first, second)
+	second.Debug("shown")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(jsonBuf.Bytes()), &entry), "log line should be valid JSON: %s", jsonBuf.String())
+	assert.Equal(t, "DEBUG", entry["level"])
+	assert.Equal(t, "second", entry["component"])
+	assert.Equal(t, "shown", entry["msg"])
+
+	// Without a reset the configured logger is kept
+	InitLogger(ERROR, "third")
+	assert.Same(t, second, GetLogger())
+	assert.Equal(t, DEBUG, GetLogger().level)
+}
+
+func TestResetLoggerConcurrent(t *testing.T) {
+	ResetLogger()
+	t.Cleanup(ResetLogger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				InitLogger(INFO, "test", WithOutput(io.Discard))
+				ResetLogger()
+				assert.NotNil(t, GetLogger())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLoggerJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{
+		level:     DEBUG,
+		logger:    log.New(&buf, "", 0),
+		component: "test",
+		format:    JSONFormat,
+	}
+
+	l.WithField("request_id", "req-1").WithField("attempt", 2).Warn("retrying %s", "stage")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry), "log line should be valid JSON: %s", buf.String())
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "test", entry["component"])
+	assert.Equal(t, "retrying stage", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, float64(2), entry["attempt"])
+
+	ts, ok := entry["ts"].(string)
+	require.True(t, ok)
+	_, err := time.Parse(time.RFC3339Nano, ts)
+	assert.NoError(t, err)
+}
+
+func TestLoggerJSONFormatOneObjectPerLine(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{
+		level:     INFO,
+		logger:    log.New(&buf, "", 0),
+		component: "test",
+		format:    JSONFormat,
+	}
+
+	l.Info("first\nline")
+	l.WithField("err", assert.AnError).WithField("msg", "ignored").Error("second")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), "invalid JSON line: %s", line)
+	}
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, assert.AnError.Error(), entry["err"])
+	// Fields cannot override the reserved keys
+	assert.Equal(t, "second", entry["msg"])
+}
+
+func TestLoggerTextFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{
+		level:     INFO,
+		logger:    log.New(&buf, "", 0),
+		component: "test",
+	}
+
+	l.WithField("b", 2).WithField("a", "x").Info("message")
+	assert.Equal(t, "[INFO][test] message a=x b=2\n", buf.String())
+
+	// Fields do not leak into the parent logger
+	buf.Reset()
+	l.Info("plain")
+	assert.Equal(t, "[INFO][test] plain\n", buf.String())
+}
+
+func TestWithFormatOption(t *testing.T) {
+	l := &Logger{logger: log.New(&bytes.Buffer{}, "", log.LstdFlags)}
+	WithFormat(JSONFormat)(l)
+	assert.Equal(t, JSONFormat, l.format)
+	assert.Equal(t, 0, l.logger.Flags())
+	assert.Equal(t, JSONFormat, l.WithComponent("child").format)
+}
+
+func TestWithOutputOption(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{level: INFO, logger: log.New(&bytes.Buffer{}, "", 0), component: "test"}
+	WithOutput(&buf)(l)
+
+	l.WithComponent("child").Info("to buffer")
+	assert.Equal(t, "[INFO][child] to buffer\n", buf.String())
+}
+
+func TestLoggerWithContext(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{level: INFO, logger: log.New(&buf, "", 0), component: "test"}
+
+	assert.Same(t, l, l.WithContext(context.Background()), "no request id leaves the logger unchanged")
+
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	assert.Equal(t, "req-42", RequestIDFromContext(ctx))
+
+	l.WithContext(ctx).Info("stage done")
+	assert.Equal(t, "[INFO][test] stage done request_id=req-42\n", buf.String())
+}
+
+func TestLoggerWithContextMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{level: INFO, logger: log.New(&buf, "", 0), component: "test", format: JSONFormat}
+
+	ctx := ContextWithRequestID(context.Background(), "req-42")
+	ctx = ContextWithMetadata(ctx, map[string]string{"tenant": "acme"})
+	assert.Equal(t, map[string]string{"tenant": "acme"}, MetadataFromContext(ctx))
+
+	l.WithContext(ctx).Info("stage done")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "req-42", entry["request_id"])
+	assert.Equal(t, map[string]interface{}{"tenant": "acme"}, entry["metadata"])
+}
+
+func TestParseLevel(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected LogLevel
+		wantErr  bool
+	}{
+		{input: "debug", expected: DEBUG},
+		{input: "INFO", expected: INFO},
+		{input: "Warn", expected: WARN},
+		{input: "error", expected: ERROR},
+		{input: " fatal ", expected: FATAL},
+		{input: "warning", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "verbose", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			level, err := ParseLevel(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, level)
+		})
+	}
+}
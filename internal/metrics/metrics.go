@@ -0,0 +1,226 @@
+// Package metrics collects counters and writes them in the Prometheus text
+// exposition format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// labelName matches valid Prometheus label names
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidLabelName reports whether name can be used as a label
+func ValidLabelName(name string) bool {
+	return labelName.MatchString(name) && !strings.HasPrefix(name, "__")
+}
+
+// OtherValue replaces the values of a limited label once it has seen its
+// maximum number of distinct values
+const OtherValue = "other"
+
+// Registry holds the counters exposed by one server
+type Registry struct {
+	mu sync.Mutex
+	// counters holds the counters of each name, one per label set
+	counters map[string][]*Counter
+	limits   map[string]*labelLimit
+}
+
+// labelLimit tracks the distinct values a limited label has taken
+type labelLimit struct {
+	max  int
+	seen map[string]bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{counters: make(map[string][]*Counter), limits: make(map[string]*labelLimit)}
+}
+
+// LimitValues bounds the distinct values label takes across all counters.
+// The first max non-empty values are kept and any later one is recorded as
+// OtherValue. A label that is already limited keeps its first limit and the
+// values seen so far.
+func (r *Registry) LimitValues(label string, max int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.limits[label]; !ok {
+		r.limits[label] = &labelLimit{max: max, seen: make(map[string]bool)}
+	}
+}
+
+// bound replaces the values of limited labels that are over their limit
+func (r *Registry) bound(labels, values []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, label := range labels {
+		limit, ok := r.limits[label]
+		if !ok || values[i] == "" || values[i] == OtherValue || limit.seen[values[i]] {
+			continue
+		}
+		if len(limit.seen) >= limit.max {
+			values[i] = OtherValue
+			continue
+		}
+		limit.seen[values[i]] = true
+	}
+}
+
+// Counter returns the counter registered under name with the given label
+// names, creating it with the help text on first use. Without label names it
+// returns the counter last registered under name. Counters of one name with
+// different label names, as left by a config reload changing the labels, are
+// written as one metric.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	family := r.counters[name]
+	if len(labels) == 0 && len(family) > 0 {
+		return family[len(family)-1]
+	}
+	for _, c := range family {
+		if equalLabels(c.labels, labels) {
+			return c
+		}
+	}
+	if len(family) > 0 {
+		help = family[0].help
+	}
+	c := &Counter{registry: r, name: name, help: help, labels: labels, values: make(map[string]*sample)}
+	r.counters[name] = append(family, c)
+	return c
+}
+
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo writes every counter in the Prometheus text format, sorted by name
+// and label values
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.counters))
+	families := make(map[string][]*Counter, len(r.counters))
+	for name, family := range r.counters {
+		names = append(names, name)
+		families[name] = append([]*Counter(nil), family...)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		family := families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, escape(family[0].help, false), name)
+		for _, c := range family {
+			c.write(&b)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Counter is a monotonically increasing value partitioned by label values
+type Counter struct {
+	registry *Registry
+	name     string
+	help     string
+	labels   []string
+	mu       sync.Mutex
+	values   map[string]*sample
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// Add increases the counter for the label values, given in the order of the
+// label names. Missing values are empty; negative deltas are ignored.
+// Values of limited labels over their limit are counted as OtherValue.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	values := make([]string, len(c.labels))
+	copy(values, labelValues)
+	c.registry.bound(c.labels, values)
+	key := strings.Join(values, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &sample{labelValues: values}
+		c.values[key] = s
+	}
+	s.value += delta
+}
+
+// Inc increases the counter for the label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value for the label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	values := make([]string, len(c.labels))
+	copy(values, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.values[strings.Join(values, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// write writes the samples of the counter, sorted by label values
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := c.values[key]
+		b.WriteString(c.name)
+		if len(c.labels) > 0 {
+			b.WriteByte('{')
+			for i, label := range c.labels {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(b, `%s="%s"`, label, escape(s.labelValues[i], true))
+			}
+			b.WriteByte('}')
+		}
+		fmt.Fprintf(b, " %g\n", s.value)
+	}
+}
+
+// escape escapes backslashes and newlines, and double quotes in label values
+func escape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
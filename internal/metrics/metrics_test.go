@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("app_requests_total", "Requests handled", "outcome", "tenant")
+	requests.Inc("success", "acme")
+	requests.Inc("success", "acme")
+	requests.Inc("error")
+	requests.Add(-1, "success", "acme")
+	r.Counter("app_tokens_total", "Tokens used").Add(42)
+
+	// Registering again returns the existing counter
+	assert.Same(t, requests, r.Counter("app_requests_total", "ignored"))
+	assert.Equal(t, float64(2), requests.Value("success", "acme"))
+	assert.Equal(t, float64(0), requests.Value("success", "other"))
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP app_requests_total Requests handled
+# TYPE app_requests_total counter
+app_requests_total{outcome="error",tenant=""} 1
+app_requests_total{outcome="success",tenant="acme"} 2
+# HELP app_tokens_total Tokens used
+# TYPE app_tokens_total counter
+app_tokens_total 42
+`, buf.String())
+}
+
+func TestRegistry_LabelSetsOfOneName(t *testing.T) {
+	r := NewRegistry()
+	before := r.Counter("app_requests_total", "Requests handled", "outcome")
+	before.Inc("success")
+	after := r.Counter("app_requests_total", "ignored", "outcome", "tenant")
+	after.Inc("success", "acme")
+
+	assert.NotSame(t, before, after)
+	assert.Same(t, before, r.Counter("app_requests_total", "", "outcome"))
+	assert.Same(t, after, r.Counter("app_requests_total", ""))
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP app_requests_total Requests handled
+# TYPE app_requests_total counter
+app_requests_total{outcome="success"} 1
+app_requests_total{outcome="success",tenant="acme"} 1
+`, buf.String())
+}
+
+func TestRegistry_LimitValues(t *testing.T) {
+	r := NewRegistry()
+	r.LimitValues("tenant", 2)
+	r.LimitValues("tenant", 100) // The first limit is kept
+	requests := r.Counter("app_requests_total", "Requests handled", "outcome", "tenant")
+	tokens := r.Counter("app_tokens_total", "Tokens used", "tenant")
+
+	requests.Inc("success", "acme")
+	requests.Inc("success", "")
+	tokens.Add(5, "globex")
+	requests.Inc("success", "initech")
+	requests.Inc("error", "umbrella")
+	tokens.Add(7, "acme")
+
+	// The limit is shared by the counters; empty values do not count
+	assert.Equal(t, float64(1), requests.Value("success", "acme"))
+	assert.Equal(t, float64(1), requests.Value("success", ""))
+	assert.Equal(t, float64(1), requests.Value("success", OtherValue))
+	assert.Equal(t, float64(1), requests.Value("error", OtherValue))
+	assert.Equal(t, float64(0), requests.Value("success", "initech"))
+	assert.Equal(t, float64(5), tokens.Value("globex"))
+	assert.Equal(t, float64(7), tokens.Value("acme"))
+
+	// Labels without a limit are not bounded
+	for _, outcome := range []string{"a", "b", "c"} {
+		requests.Inc(outcome, "acme")
+		assert.Equal(t, float64(1), requests.Value(outcome, "acme"))
+	}
+}
+
+func TestRegistry_EscapesLabelValues(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("app_total", "Escaping", "name").Inc("a \"quoted\"\\name\nx")
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `app_total{name="a \"quoted\"\\name\nx"} 1`)
+}
+
+func TestValidLabelName(t *testing.T) {
+	assert.True(t, ValidLabelName("tenant"))
+	assert.True(t, ValidLabelName("feature_flag2"))
+	assert.False(t, ValidLabelName("2fa"))
+	assert.False(t, ValidLabelName("team-name"))
+	assert.False(t, ValidLabelName("__reserved"))
+	assert.False(t, ValidLabelName(""))
+}
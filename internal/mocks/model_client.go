@@ -10,6 +10,8 @@ import (
 type MockModelClient struct {
 	CompleteFunc       func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error)
 	CompleteStreamFunc func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error)
+	// Stream answers CompleteStream when CompleteStreamFunc is not set
+	Stream *ScriptedStream
 }
 
 func (m *MockModelClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
@@ -23,6 +25,9 @@ func (m *MockModelClient) CompleteStream(ctx context.Context, req *models.ChatCo
 	if m.CompleteStreamFunc != nil {
 		return m.CompleteStreamFunc(ctx, req)
 	}
+	if m.Stream != nil {
+		return m.Stream.Start(ctx), nil
+	}
 	ch := make(chan *models.ChatCompletionResponse)
 	close(ch)
 	return ch, nil
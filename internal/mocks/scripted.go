@@ -0,0 +1,124 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// ScriptedResponse is one scripted model answer
+type ScriptedResponse struct {
+	Content      string
+	Reasoning    []string
+	FinishReason string // Defaults to "stop"
+	Err          error  // Returned instead of a response when set
+}
+
+// ScriptedModelClient implements ModelClient by replaying scripted responses
+// in call order. Once the script runs out the last response is repeated.
+type ScriptedModelClient struct {
+	mu        sync.Mutex
+	responses []ScriptedResponse
+	requests  []*models.ChatCompletionRequest
+}
+
+// NewScriptedModelClient creates a client answering its calls with responses
+func NewScriptedModelClient(responses ...ScriptedResponse) *ScriptedModelClient {
+	return &ScriptedModelClient{responses: responses}
+}
+
+// next records req and returns the scripted response for this call
+func (m *ScriptedModelClient) next(req *models.ChatCompletionRequest) ScriptedResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	call := len(m.requests)
+	m.requests = append(m.requests, req)
+	if len(m.responses) == 0 {
+		return ScriptedResponse{}
+	}
+	return m.responses[min(call, len(m.responses)-1)]
+}
+
+// Requests returns the requests received so far in call order
+func (m *ScriptedModelClient) Requests() []*models.ChatCompletionRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*models.ChatCompletionRequest(nil), m.requests...)
+}
+
+// Calls returns the number of calls received so far
+func (m *ScriptedModelClient) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.requests)
+}
+
+func (m *ScriptedModelClient) Complete(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	scripted := m.next(req)
+	if scripted.Err != nil {
+		return nil, scripted.Err
+	}
+	return &models.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []models.ChatCompletionChoice{
+			{
+				Message: models.ChatCompletionMessage{
+					Role:             "assistant",
+					Content:          scripted.Content,
+					ReasoningContent: scripted.Reasoning,
+				},
+				FinishReason: finishReason(scripted),
+			},
+		},
+	}, nil
+}
+
+// CompleteStream sends each reasoning step as its own chunk followed by a
+// single chunk carrying the content and finish reason
+func (m *ScriptedModelClient) CompleteStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	scripted := m.next(req)
+	if scripted.Err != nil {
+		return nil, scripted.Err
+	}
+
+	chunks := make([]*models.ChatCompletionResponse, 0, len(scripted.Reasoning)+1)
+	for _, step := range scripted.Reasoning {
+		chunks = append(chunks, &models.ChatCompletionResponse{
+			Model: req.Model,
+			Choices: []models.ChatCompletionChoice{
+				{Message: models.ChatCompletionMessage{Role: "assistant", ReasoningContent: []string{step}}},
+			},
+		})
+	}
+	chunks = append(chunks, &models.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []models.ChatCompletionChoice{
+			{
+				Message:      models.ChatCompletionMessage{Role: "assistant", Content: scripted.Content},
+				FinishReason: finishReason(scripted),
+			},
+		},
+	})
+
+	ch := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(ch)
+		for _, chunk := range chunks {
+			select {
+			case ch <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func finishReason(scripted ScriptedResponse) string {
+	if scripted.FinishReason == "" {
+		return "stop"
+	}
+	return scripted.FinishReason
+}
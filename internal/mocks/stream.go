@@ -0,0 +1,76 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// ScriptedStream replays fixed chunks as a streaming model response. Set it as
+// MockModelClient.Stream to answer every CompleteStream call with it.
+type ScriptedStream struct {
+	Chunks []*models.ChatCompletionResponse
+	// Delay is waited before each chunk is sent
+	Delay time.Duration
+	// CancelDelay is how long the stream takes to notice a cancelled context
+	// before closing, like an upstream slow to hang up; zero closes it right away
+	CancelDelay time.Duration
+	// OnSend, when set, is called with the index of each chunk once the
+	// consumer has taken it, before the next chunk is sent
+	OnSend func(i int)
+}
+
+// NewScriptedStream creates a stream sending chunks without delay. A chunk
+// with Err set ends the stream with that error, as the real clients do.
+func NewScriptedStream(chunks ...*models.ChatCompletionResponse) *ScriptedStream {
+	return &ScriptedStream{Chunks: chunks}
+}
+
+// Start sends the chunks on a new channel, which is closed once they are all
+// sent or ctx is cancelled
+func (s *ScriptedStream) Start(ctx context.Context) <-chan *models.ChatCompletionResponse {
+	ch := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(ch)
+		for i, chunk := range s.Chunks {
+			if !s.wait(ctx) {
+				return
+			}
+			select {
+			case ch <- chunk:
+			case <-ctx.Done():
+				time.Sleep(s.CancelDelay)
+				return
+			}
+			if s.OnSend != nil {
+				s.OnSend(i)
+			}
+			if chunk.Err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// wait sleeps for the delay before a chunk, reporting false when ctx is
+// cancelled first
+func (s *ScriptedStream) wait(ctx context.Context) bool {
+	if s.Delay <= 0 {
+		if ctx.Err() != nil {
+			time.Sleep(s.CancelDelay)
+			return false
+		}
+		return true
+	}
+	timer := time.NewTimer(s.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		time.Sleep(s.CancelDelay)
+		return false
+	}
+}
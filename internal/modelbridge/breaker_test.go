@@ -0,0 +1,153 @@
+package modelbridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUpstream = errors.New("upstream failed")
+
+// newTestBreaker returns a breaker whose clock is advanced by the returned function
+func newTestBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	cb := NewCircuitBreaker(threshold, cooldown)
+	cb.now = func() time.Time { return now }
+	return cb, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cb, advance := newTestBreaker(3, time.Minute)
+
+	// Failures below the threshold keep the breaker closed
+	for i := 0; i < 2; i++ {
+		require.NoError(t, cb.Allow())
+		cb.Record(errUpstream)
+	}
+	assert.Equal(t, BreakerClosed, cb.State())
+
+	// A success resets the failure count
+	require.NoError(t, cb.Allow())
+	cb.Record(nil)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, cb.Allow())
+		cb.Record(errUpstream)
+	}
+	assert.Equal(t, BreakerClosed, cb.State())
+
+	require.NoError(t, cb.Allow())
+	cb.Record(errUpstream)
+	assert.Equal(t, BreakerOpen, cb.State())
+	assert.ErrorIs(t, cb.Allow(), ErrCircuitOpen)
+
+	// After the cooldown a single probe is let through
+	advance(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, cb.State())
+	require.NoError(t, cb.Allow())
+	assert.ErrorIs(t, cb.Allow(), ErrCircuitOpen)
+
+	// A failed probe opens the breaker again
+	cb.Record(errUpstream)
+	assert.Equal(t, BreakerOpen, cb.State())
+	assert.ErrorIs(t, cb.Allow(), ErrCircuitOpen)
+
+	// A successful probe closes it
+	advance(time.Minute)
+	require.NoError(t, cb.Allow())
+	cb.Record(nil)
+	assert.Equal(t, BreakerClosed, cb.State())
+	assert.NoError(t, cb.Allow())
+}
+
+func TestCircuitBreaker_IgnoresCancellation(t *testing.T) {
+	cb, _ := newTestBreaker(1, time.Minute)
+
+	require.NoError(t, cb.Allow())
+	cb.Record(context.Canceled)
+	assert.Equal(t, BreakerClosed, cb.State())
+}
+
+func TestCircuitBreaker_Nil(t *testing.T) {
+	var cb *CircuitBreaker
+	assert.NoError(t, cb.Allow())
+	cb.Record(errUpstream)
+	assert.Equal(t, BreakerClosed, cb.State())
+}
+
+func TestModelBridge_CircuitBreaker(t *testing.T) {
+	calls := 0
+	failing := true
+	client := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			calls++
+			if failing {
+				return nil, errUpstream
+			}
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "recovered"}},
+				},
+			}, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			calls++
+			return nil, errUpstream
+		},
+	}
+
+	normalBreaker, advanceNormal := newTestBreaker(2, time.Minute)
+	reasonerBreaker, _ := newTestBreaker(2, time.Minute)
+	bridge := &ModelBridge{
+		NormalClient:    client,
+		ReasonerClient:  client,
+		Logger:          logger.GetLogger().WithComponent("test_bridge"),
+		NormalBreaker:   normalBreaker,
+		ReasonerBreaker: reasonerBreaker,
+	}
+	req := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{
+			Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		}
+	}
+	ctx := context.Background()
+
+	// Trip the Normal breaker
+	for i := 0; i < 2; i++ {
+		_, err := bridge.CallNormal(ctx, req())
+		assert.ErrorIs(t, err, errUpstream)
+	}
+	assert.Equal(t, 2, calls)
+
+	// Open breaker fails fast without calling the client
+	_, err := bridge.CallNormal(ctx, req())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	_, err = bridge.CallNormalStream(ctx, req())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+
+	// The Reasoner breaker is independent
+	for i := 0; i < 2; i++ {
+		_, err = bridge.CallReasonerStream(ctx, req())
+		assert.ErrorIs(t, err, errUpstream)
+	}
+	_, err = bridge.CallReasoner(ctx, req())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	_, err = bridge.CallReasonerStream(ctx, req())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 4, calls)
+
+	// After the cooldown the Normal model recovers
+	failing = false
+	advanceNormal(time.Minute)
+	resp, err := bridge.CallNormal(ctx, req())
+	require.NoError(t, err)
+	assert.Equal(t, "recovered", resp.Choices[0].Message.Content)
+	assert.Equal(t, BreakerClosed, normalBreaker.State())
+}
@@ -6,8 +6,12 @@ import (
 	"sync"
 
 	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/config"
 	"github.com/sleepstars/deepempower/internal/logger"
 	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ModelBridge handles model-specific logic and provides a unified interface
@@ -15,105 +19,391 @@ type ModelBridge struct {
 	NormalClient   clients.ModelClient
 	ReasonerClient clients.ModelClient
 	Logger         *logger.Logger // Changed to exported field
-	mu             sync.RWMutex
+	// ReasonerFallback answers with the Normal model when the Reasoner stream
+	// fails to start or ends without any reasoning content
+	ReasonerFallback bool
+	// Breakers guarding each client; nil disables circuit breaking
+	NormalBreaker   *CircuitBreaker
+	ReasonerBreaker *CircuitBreaker
+	// Limiters capping the calls in flight to each client; nil disables them
+	NormalLimiter   *ConcurrencyLimiter
+	ReasonerLimiter *ConcurrencyLimiter
+	// LogLatency logs the connect, first byte and total time of every model
+	// call at DEBUG
+	LogLatency bool
+	// EstimateStreamUsage replaces the usage providers report for streamed
+	// calls with an estimate from the streamed text
+	EstimateStreamUsage bool
+	mu                  sync.RWMutex
 }
 
-// NewModelBridge creates a new model bridge instance
-func NewModelBridge(normalCfg, reasonerCfg clients.ModelClientConfig) *ModelBridge {
-	// Initialize logger with default level if not already initialized
-	if logger.GetLogger() == nil {
-		logger.InitLogger(logger.INFO, "model_bridge")
+// NewModelBridge creates a new model bridge instance with clients for the
+// configured providers. The Reasoner side defaults to the reasoner provider.
+func NewModelBridge(normalCfg, reasonerCfg clients.ModelClientConfig) (*ModelBridge, error) {
+	normalClient, err := clients.NewModelClient(normalCfg.Provider, normalCfg)
+	if err != nil {
+		return nil, fmt.Errorf("normal client: %w", err)
+	}
+	reasonerClient, err := clients.NewModelClient(ReasonerProvider(reasonerCfg.Provider), reasonerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("reasoner client: %w", err)
 	}
-	log := logger.GetLogger().WithComponent("model_bridge")
-	log.Info("Creating new model bridge")
 
+	bridge := NewModelBridgeWithClients(normalClient, reasonerClient, nil)
+	bridge.Logger.Info("Creating new model bridge")
+	return bridge, nil
+}
+
+// NewModelBridgeWithClients creates a model bridge around pre-built clients,
+// such as mocks or clients for providers this package does not know. A nil
+// log uses the model_bridge component logger. Breakers, limiters and the
+// Reasoner fallback are off until set on the returned bridge.
+func NewModelBridgeWithClients(normal, reasoner clients.ModelClient, log *logger.Logger) *ModelBridge {
+	if log == nil {
+		// Initialize logger with default level if not already initialized
+		if logger.GetLogger() == nil {
+			logger.InitLogger(logger.INFO, "model_bridge")
+		}
+		log = logger.GetLogger().WithComponent("model_bridge")
+	}
 	return &ModelBridge{
-		NormalClient:   clients.NewNormalClient(normalCfg),
-		ReasonerClient: clients.NewReasonerClient(reasonerCfg),
+		NormalClient:   normal,
+		ReasonerClient: reasoner,
 		Logger:         log,
 	}
 }
 
+// ReasonerProvider returns the provider of a Reasoner side client, which
+// reads reasoning_content unless another provider is configured
+func ReasonerProvider(provider string) string {
+	if provider == "" {
+		return config.ProviderReasoner
+	}
+	return provider
+}
+
 // CallNormal sends a request to the Normal model
 func (b *ModelBridge) CallNormal(ctx context.Context, req *models.ChatCompletionRequest) (resp *models.ChatCompletionResponse, err error) {
+	ctx, span := startCallSpan(ctx, "Normal", req)
+	defer func() { endCallSpan(span, resp, err) }()
+	log := b.Logger.WithContext(ctx)
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
+	if err = b.NormalLimiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.NormalLimiter.Release()
+
+	if err = b.NormalBreaker.Allow(); err != nil {
+		log.Warn("Normal model circuit breaker is open, failing fast")
+		return nil, err
+	}
+	// Registered before panic recovery so it sees the recovered error
+	defer func() { b.NormalBreaker.Record(err) }()
+
 	// Add panic recovery
 	defer func() {
 		if r := recover(); r != nil {
-			b.Logger.Error("Recovered from panic in CallNormal: %v", r)
+			log.WithField("panic", r).Error("Recovered from panic in CallNormal")
 			err = fmt.Errorf("runtime error: %v", r)
 			resp = nil
 		}
 	}()
 
-	b.Logger.Debug("Calling Normal model with %d messages", len(req.Messages))
+	log.Debug("Calling Normal model with %d messages", len(req.Messages))
 
-	resp, err = b.NormalClient.Complete(ctx, req)
+	callCtx, trace := b.traceLatency(ctx)
+	resp, err = b.NormalClient.Complete(callCtx, req)
+	logLatency(log, "Normal", trace)
 	if err != nil {
-		b.Logger.WithError(err).Error("Normal model call failed")
+		log.WithError(err).Error("Normal model call failed")
 		return nil, err
 	}
+	if len(resp.Choices) == 0 {
+		log.Error("Normal model returned no choices")
+		return nil, clients.ErrNoChoices
+	}
 
-	b.Logger.Debug("Normal model call completed successfully")
+	log.Debug("Normal model call completed successfully")
 	return resp, nil
 }
 
 // CallReasoner sends a request to the Reasoner model
 func (b *ModelBridge) CallReasoner(ctx context.Context, req *models.ChatCompletionRequest) (resp *models.ChatCompletionResponse, err error) {
+	ctx, span := startCallSpan(ctx, "Reasoner", req)
+	defer func() { endCallSpan(span, resp, err) }()
+	log := b.Logger.WithContext(ctx)
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
+	if err = b.ReasonerLimiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.ReasonerLimiter.Release()
+
+	if err = b.ReasonerBreaker.Allow(); err != nil {
+		log.Warn("Reasoner model circuit breaker is open, failing fast")
+		return nil, err
+	}
+	// Registered before panic recovery so it sees the recovered error
+	defer func() { b.ReasonerBreaker.Record(err) }()
+
 	// Add panic recovery
 	defer func() {
 		if r := recover(); r != nil {
-			b.Logger.Error("Recovered from panic in CallReasoner: %v", r)
+			log.WithField("panic", r).Error("Recovered from panic in CallReasoner")
 			err = fmt.Errorf("runtime error: %v", r)
 			resp = nil
 		}
 	}()
 
-	b.Logger.Debug("Calling Reasoner model with %d messages", len(req.Messages))
+	log.Debug("Calling Reasoner model with %d messages", len(req.Messages))
 
-	resp, err = b.ReasonerClient.Complete(ctx, req)
+	callCtx, trace := b.traceLatency(ctx)
+	resp, err = b.ReasonerClient.Complete(callCtx, req)
+	logLatency(log, "Reasoner", trace)
 	if err != nil {
-		b.Logger.WithError(err).Error("Reasoner model call failed")
+		log.WithError(err).Error("Reasoner model call failed")
 		return nil, err
 	}
+	if len(resp.Choices) == 0 {
+		log.Error("Reasoner model returned no choices")
+		return nil, clients.ErrNoChoices
+	}
 
-	b.Logger.Debug("Reasoner model call completed successfully")
+	log.Debug("Reasoner model call completed successfully")
 	return resp, nil
 }
 
 // CallReasonerStream sends a streaming request to the Reasoner model
 func (b *ModelBridge) CallReasonerStream(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	ctx, span := startCallSpan(ctx, "Reasoner", req)
+	log := b.Logger.WithContext(ctx)
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	b.Logger.Debug("Starting streaming call to Reasoner model with %d messages", len(req.Messages))
+	log.Debug("Starting streaming call to Reasoner model with %d messages", len(req.Messages))
 
 	// Ensure stream flag is set
 	req.Stream = true
 
-	respChan, err := b.ReasonerClient.CompleteStream(ctx, req)
+	var respChan <-chan *models.ChatCompletionResponse
+	var trace *latencyTrace
+	err := b.ReasonerLimiter.Acquire(ctx)
+	if err == nil {
+		if err = b.ReasonerBreaker.Allow(); err == nil {
+			var callCtx context.Context
+			callCtx, trace = b.traceLatency(ctx)
+			respChan, err = b.ReasonerClient.CompleteStream(callCtx, req)
+			b.ReasonerBreaker.Record(err)
+		}
+		if err != nil {
+			b.ReasonerLimiter.Release()
+		}
+	}
 	if err != nil {
-		b.Logger.WithError(err).Error("Failed to start Reasoner model streaming")
-		return nil, err // Don't wrap the error again
+		log.WithError(err).Error("Failed to start Reasoner model streaming")
+		endCallSpan(span, nil, err)
+		if !b.ReasonerFallback {
+			return nil, err // Don't wrap the error again
+		}
+		resp, fallbackErr := b.normalFallback(ctx, req)
+		if fallbackErr != nil {
+			log.WithError(fallbackErr).Error("Normal fallback failed")
+			return nil, err
+		}
+		ch := make(chan *models.ChatCompletionResponse, 1)
+		ch <- resp
+		close(ch)
+		return ch, nil
 	}
 
+	filtered := b.filterStream(ctx, log, "Reasoner", respChan, b.ReasonerLimiter, span, trace, b.estimateUsage(req))
+	if !b.ReasonerFallback {
+		return filtered, nil
+	}
+	return b.fallbackOnEmptyReasoning(ctx, log, req, filtered), nil
+}
+
+// fallbackOnEmptyReasoning forwards the Reasoner stream and, if it ended
+// without any reasoning content, appends the Normal model's answer
+func (b *ModelBridge) fallbackOnEmptyReasoning(ctx context.Context, log *logger.Logger, req *models.ChatCompletionRequest, respChan <-chan *models.ChatCompletionResponse) <-chan *models.ChatCompletionResponse {
+	out := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(out)
+		reasoned := false
+		// A stream error is held back until it is known whether the
+		// fallback replaces it
+		var failed *models.ChatCompletionResponse
+		for resp := range respChan {
+			if resp.Err != nil {
+				failed = resp
+				continue
+			}
+			if len(resp.Choices) > 0 && len(resp.Choices[0].Message.ReasoningContent) > 0 {
+				reasoned = true
+			}
+			send(ctx, out, resp)
+		}
+		if reasoned || ctx.Err() != nil {
+			if failed != nil {
+				send(ctx, out, failed)
+			}
+			return
+		}
+		log.Warn("Reasoner returned no reasoning content, falling back to Normal model")
+		resp, err := b.normalFallback(ctx, req)
+		if err != nil {
+			log.WithError(err).Error("Normal fallback failed")
+			if failed != nil {
+				send(ctx, out, failed)
+			}
+			return
+		}
+		send(ctx, out, resp)
+	}()
+	return out
+}
+
+// send forwards resp to out unless ctx is done first, in which case the
+// caller that stopped reading out no longer needs it
+func send(ctx context.Context, out chan<- *models.ChatCompletionResponse, resp *models.ChatCompletionResponse) bool {
+	select {
+	case out <- resp:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// normalFallback answers the Reasoner request with the Normal model and marks
+// the response as a fallback
+func (b *ModelBridge) normalFallback(ctx context.Context, req *models.ChatCompletionRequest) (resp *models.ChatCompletionResponse, err error) {
+	fallbackReq := *req
+	fallbackReq.Model = "" // let the Normal client use its configured model
+	fallbackReq.Stream = false
+	ctx, span := startCallSpan(ctx, "Normal", &fallbackReq)
+	span.SetAttributes(attribute.Bool("model.fallback", true))
+	defer func() { endCallSpan(span, resp, err) }()
+	if err := b.NormalLimiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.NormalLimiter.Release()
+	if err := b.NormalBreaker.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err = b.NormalClient.Complete(ctx, &fallbackReq)
+	b.NormalBreaker.Record(err)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, clients.ErrNoChoices
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = &models.ResponseMetadata{}
+	}
+	resp.Metadata.ReasonerFallback = true
+	return resp, nil
+}
+
+// CallNormalStream sends a streaming request to the Normal model
+func (b *ModelBridge) CallNormalStream(ctx context.Context, req *models.ChatCompletionRequest) (respChan <-chan *models.ChatCompletionResponse, err error) {
+	ctx, span := startCallSpan(ctx, "Normal", req)
+	log := b.Logger.WithContext(ctx)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if err = b.NormalLimiter.Acquire(ctx); err != nil {
+		endCallSpan(span, nil, err)
+		return nil, err
+	}
+	// The slot and span are held until the stream ends
+	defer func() {
+		if err != nil {
+			b.NormalLimiter.Release()
+			endCallSpan(span, nil, err)
+		}
+	}()
+
+	if err = b.NormalBreaker.Allow(); err != nil {
+		log.Warn("Normal model circuit breaker is open, failing fast")
+		return nil, err
+	}
+	// Registered before panic recovery so it sees the recovered error
+	defer func() { b.NormalBreaker.Record(err) }()
+
+	// Add panic recovery
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("panic", r).Error("Recovered from panic in CallNormalStream")
+			err = fmt.Errorf("runtime error: %v", r)
+			respChan = nil
+		}
+	}()
+
+	log.Debug("Starting streaming call to Normal model with %d messages", len(req.Messages))
+
+	// Ensure stream flag is set
+	req.Stream = true
+
+	callCtx, trace := b.traceLatency(ctx)
+	upstream, err := b.NormalClient.CompleteStream(callCtx, req)
+	if err != nil {
+		log.WithError(err).Error("Failed to start Normal model streaming")
+		return nil, err
+	}
+
+	return b.filterStream(ctx, log, "Normal", upstream, b.NormalLimiter, span, trace, b.estimateUsage(req)), nil
+}
+
+// filterStream forwards only the responses that carry content or reasoning.
+// Once the upstream is drained it releases the stream's limiter slot and ends
+// its span, and logs the call latency when latency is set. When estimate is set
+// the stream ends with a usage-only response carrying the estimated usage in
+// place of the provider's. After ctx is done it stops forwarding but keeps
+// draining, so neither side of the stream is left blocked.
+func (b *ModelBridge) filterStream(ctx context.Context, log *logger.Logger, model string, respChan <-chan *models.ChatCompletionResponse, limiter *ConcurrencyLimiter, span trace.Span, latency *latencyTrace, estimate *usageEstimate) <-chan *models.ChatCompletionResponse {
 	// Create a new channel for filtered responses
 	filteredChan := make(chan *models.ChatCompletionResponse)
 
 	// Start goroutine to process responses
 	go func() {
 		defer close(filteredChan)
+		defer limiter.Release()
+		defer span.End()
+		defer logLatency(log, model, latency)
+		defer func() {
+			if r := recover(); r != nil {
+				log.WithField("panic", r).Error("Recovered from panic in %s stream", model)
+			}
+		}()
 		responseCount := 0
 		contentCount := 0
 		reasoningCount := 0
+		failed := false
 
 		for resp := range respChan {
 			responseCount++
+			if responseCount == 1 {
+				latency.firstChunk()
+			}
+			// A failed stream ends with its error, which the caller reports
+			if resp != nil && resp.Err != nil {
+				log.WithError(resp.Err).Error("%s stream failed", model)
+				tracing.RecordError(span, resp.Err)
+				send(ctx, filteredChan, resp)
+				failed = true
+				continue
+			}
+			estimate.add(resp)
+			// Usage-only chunks carry no choices but still need to reach the caller
+			if resp != nil && len(resp.Choices) == 0 && resp.Usage != nil {
+				span.SetAttributes(tracing.Usage(resp.Usage)...)
+				send(ctx, filteredChan, resp)
+				continue
+			}
 			// Only forward responses that have content
 			if resp != nil && len(resp.Choices) > 0 {
 				hasContent := len(resp.Choices[0].Message.Content) > 0
@@ -126,15 +416,42 @@ func (b *ModelBridge) CallReasonerStream(ctx context.Context, req *models.ChatCo
 					reasoningCount++
 				}
 
-				if hasContent || hasReasoning {
-					filteredChan <- resp
+				// Keep content-less chunks that carry the finish reason or
+				// tool calls
+				hasFinish := resp.Choices[0].FinishReason != ""
+				hasToolCalls := len(resp.Choices[0].Message.ToolCalls) > 0
+
+				if hasContent || hasReasoning || hasFinish || hasToolCalls {
+					send(ctx, filteredChan, resp)
 				}
 			}
 		}
 
-		b.Logger.Debug("Streaming completed: total=%d, content=%d, reasoning=%d",
-			responseCount, contentCount, reasoningCount)
+		log.Debug("%s streaming completed: total=%d, content=%d, reasoning=%d",
+			model, responseCount, contentCount, reasoningCount)
+		if estimate != nil && !failed {
+			usage := estimate.usage()
+			span.SetAttributes(tracing.Usage(usage)...)
+			send(ctx, filteredChan, &models.ChatCompletionResponse{Usage: usage})
+		}
 	}()
 
-	return filteredChan, nil
+	return filteredChan
+}
+
+// startCallSpan starts the span of a call to the named client
+func startCallSpan(ctx context.Context, client string, req *models.ChatCompletionRequest) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "model.call",
+		attribute.String("model.client", client),
+		attribute.String("model.name", req.Model),
+	)
+}
+
+// endCallSpan records the usage or error of a call and ends its span
+func endCallSpan(span trace.Span, resp *models.ChatCompletionResponse, err error) {
+	tracing.RecordError(span, err)
+	if resp != nil {
+		span.SetAttributes(tracing.Usage(resp.Usage)...)
+	}
+	span.End()
 }
@@ -2,11 +2,14 @@ package modelbridge
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"sync"
 
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/config"
 	"github.com/sleepstars/deepempower/internal/logger"
 	"github.com/sleepstars/deepempower/internal/mocks"
 	"github.com/sleepstars/deepempower/internal/models"
@@ -308,3 +311,342 @@ func TestModelBridge_StreamFilterEmptyResponses(t *testing.T) {
 	assert.Equal(t, 1, len(validResponses))
 	assert.Equal(t, "valid content", validResponses[0].Choices[0].Message.Content)
 }
+
+func TestModelBridge_CallNormalStream(t *testing.T) {
+	responses := []*models.ChatCompletionResponse{
+		{
+			Choices: []models.ChatCompletionChoice{}, // Empty
+		},
+		{
+			Choices: []models.ChatCompletionChoice{
+				{Message: models.ChatCompletionMessage{Content: "part 1"}},
+			},
+		},
+		{
+			Choices: []models.ChatCompletionChoice{
+				{Message: models.ChatCompletionMessage{}, FinishReason: "stop"},
+			},
+		},
+	}
+
+	mockClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			assert.Equal(t, "gpt-3.5-turbo", req.Model)
+			assert.True(t, req.Stream)
+
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for _, resp := range responses {
+					ch <- resp
+				}
+			}()
+			return ch, nil
+		},
+	}
+
+	bridge := &ModelBridge{
+		NormalClient: mockClient,
+		Logger:       logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	respChan, err := bridge.CallNormalStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test"},
+		},
+		Model: "gpt-3.5-turbo",
+	})
+	assert.NoError(t, err)
+
+	var received []*models.ChatCompletionResponse
+	for resp := range respChan {
+		received = append(received, resp)
+	}
+
+	// The empty response is dropped, the finish reason chunk is kept
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, "part 1", received[0].Choices[0].Message.Content)
+	assert.Equal(t, "stop", received[1].Choices[0].FinishReason)
+}
+
+func TestModelBridge_CallNormalStreamPanic(t *testing.T) {
+	bridge := &ModelBridge{
+		NormalClient: &mocks.MockModelClient{
+			CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				panic("unexpected panic")
+			},
+		},
+		Logger: logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	respChan, err := bridge.CallNormalStream(context.Background(), &models.ChatCompletionRequest{Model: "test"})
+	assert.ErrorContains(t, err, "runtime error")
+	assert.Nil(t, respChan)
+}
+
+func TestModelBridge_ConcurrentNormalStreamCalls(t *testing.T) {
+	numCalls := 10
+	mockClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				time.Sleep(10 * time.Millisecond) // Simulate work
+				ch <- &models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{Message: models.ChatCompletionMessage{Content: "stream response"}},
+					},
+				}
+			}()
+			return ch, nil
+		},
+	}
+
+	bridge := &ModelBridge{
+		NormalClient: mockClient,
+		Logger:       logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < numCalls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			respCh, err := bridge.CallNormalStream(context.Background(), &models.ChatCompletionRequest{
+				Model: "test",
+			})
+			assert.NoError(t, err)
+
+			count := 0
+			for range respCh {
+				count++
+			}
+			assert.Equal(t, 1, count)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestModelBridge_CallNormalNoChoices(t *testing.T) {
+	bridge := &ModelBridge{
+		NormalClient: &mocks.MockModelClient{},
+		Logger:       logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	resp, err := bridge.CallNormal(context.Background(), &models.ChatCompletionRequest{Model: "test"})
+	assert.ErrorIs(t, err, clients.ErrNoChoices)
+	assert.Nil(t, resp)
+}
+
+var errReasonerDown = errors.New("reasoner unavailable")
+
+func TestModelBridge_ReasonerFallback(t *testing.T) {
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			assert.Empty(t, req.Model)
+			assert.False(t, req.Stream)
+			assert.Equal(t, "test", req.Messages[0].Content)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "normal answer"}},
+				},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		reasoner clients.ModelClient
+		want     []string
+	}{
+		{
+			name: "reasoner error",
+			reasoner: &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					return nil, errReasonerDown
+				},
+			},
+			want: []string{"normal answer"},
+		},
+		{
+			name: "no reasoning content",
+			reasoner: &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					ch := make(chan *models.ChatCompletionResponse, 1)
+					ch <- &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{Content: "reasoner answer"}},
+						},
+					}
+					close(ch)
+					return ch, nil
+				},
+			},
+			want: []string{"reasoner answer", "normal answer"},
+		},
+		{
+			name: "stalled before reasoning",
+			reasoner: &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					ch := make(chan *models.ChatCompletionResponse, 1)
+					ch <- &models.ChatCompletionResponse{Err: &clients.StreamIdleError{Timeout: time.Second}}
+					close(ch)
+					return ch, nil
+				},
+			},
+			want: []string{"normal answer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &ModelBridge{
+				NormalClient:     normalClient,
+				ReasonerClient:   tt.reasoner,
+				Logger:           logger.GetLogger().WithComponent("test_bridge"),
+				ReasonerFallback: true,
+			}
+
+			respChan, err := bridge.CallReasonerStream(context.Background(), &models.ChatCompletionRequest{
+				Model:    "reasoner-model",
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			})
+			assert.NoError(t, err)
+
+			var contents []string
+			var last *models.ChatCompletionResponse
+			for resp := range respChan {
+				contents = append(contents, resp.Choices[0].Message.Content)
+				last = resp
+			}
+			assert.Equal(t, tt.want, contents)
+			if assert.NotNil(t, last.Metadata) {
+				assert.True(t, last.Metadata.ReasonerFallback)
+			}
+		})
+	}
+}
+
+func TestModelBridge_ReasonerFallbackDisabled(t *testing.T) {
+	bridge := &ModelBridge{
+		NormalClient: &mocks.MockModelClient{},
+		ReasonerClient: &mocks.MockModelClient{
+			CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				return nil, errReasonerDown
+			},
+		},
+		Logger: logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	_, err := bridge.CallReasonerStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	assert.ErrorIs(t, err, errReasonerDown)
+}
+
+func TestModelBridge_ReasonerStreamError(t *testing.T) {
+	idleErr := &clients.StreamIdleError{Timeout: time.Second}
+	bridge := &ModelBridge{
+		NormalClient: &mocks.MockModelClient{},
+		ReasonerClient: &mocks.MockModelClient{
+			CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				ch := make(chan *models.ChatCompletionResponse, 2)
+				ch <- &models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{Message: models.ChatCompletionMessage{ReasoningContent: []string{"step 1"}}},
+					},
+				}
+				ch <- &models.ChatCompletionResponse{Err: idleErr}
+				close(ch)
+				return ch, nil
+			},
+		},
+		Logger: logger.GetLogger().WithComponent("test_bridge"),
+		// The stream already reasoned, so the error is not replaced
+		ReasonerFallback: true,
+	}
+
+	respChan, err := bridge.CallReasonerStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	assert.NoError(t, err)
+
+	var responses []*models.ChatCompletionResponse
+	for resp := range respChan {
+		responses = append(responses, resp)
+	}
+	if assert.Len(t, responses, 2) {
+		assert.Equal(t, []string{"step 1"}, responses[0].Choices[0].Message.ReasoningContent)
+		assert.Same(t, idleErr, responses[1].Err)
+	}
+}
+
+func TestNewModelBridgeWithClients(t *testing.T) {
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "normal answer"}},
+				},
+			}, nil
+		},
+	}
+	reasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{ReasoningContent: []string{"step 1"}}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	bridge := NewModelBridgeWithClients(normalClient, reasonerClient, nil)
+	assert.Same(t, normalClient, bridge.NormalClient)
+	assert.Same(t, reasonerClient, bridge.ReasonerClient)
+	assert.NotNil(t, bridge.Logger)
+
+	resp, err := bridge.CallNormal(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "normal answer", resp.Choices[0].Message.Content)
+
+	respChan, err := bridge.CallReasonerStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	assert.NoError(t, err)
+	var reasoning []string
+	for resp := range respChan {
+		reasoning = append(reasoning, resp.Choices[0].Message.ReasoningContent...)
+	}
+	assert.Equal(t, []string{"step 1"}, reasoning)
+
+	log := logger.GetLogger().WithComponent("custom")
+	assert.Same(t, log, NewModelBridgeWithClients(normalClient, reasonerClient, log).Logger)
+}
+
+func TestNewModelBridge_Providers(t *testing.T) {
+	cfg := clients.ModelClientConfig{APIBase: "http://localhost:8000/v1", Model: "test-model"}
+	anthropic := cfg
+	anthropic.Provider = config.ProviderAnthropic
+
+	bridge, err := NewModelBridge(cfg, cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &clients.NormalClient{}, bridge.NormalClient)
+	assert.IsType(t, &clients.ReasonerClient{}, bridge.ReasonerClient)
+
+	bridge, err = NewModelBridge(anthropic, anthropic)
+	assert.NoError(t, err)
+	assert.IsType(t, &clients.AnthropicClient{}, bridge.NormalClient)
+	assert.IsType(t, &clients.AnthropicClient{}, bridge.ReasonerClient)
+
+	unknown := cfg
+	unknown.Provider = "bedrock"
+	_, err = NewModelBridge(cfg, unknown)
+	assert.EqualError(t, err, `reasoner client: unknown provider "bedrock"`)
+}
@@ -0,0 +1,130 @@
+package modelbridge
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// CallLatency breaks down the wall-clock time of a model call, measured from
+// the moment the request is handed to the client. Phases the client does not
+// go through, such as connecting for clients that do not use HTTP, are zero.
+type CallLatency struct {
+	// Connect is the time until a connection to the upstream was obtained
+	Connect time.Duration
+	// FirstByte is the time until the first response byte, or the first
+	// chunk of a stream
+	FirstByte time.Duration
+	// Total is the time until the response was complete
+	Total time.Duration
+}
+
+// latencyTrace records the phases of one model call
+type latencyTrace struct {
+	mu       sync.Mutex
+	start    time.Time
+	latency  CallLatency
+	streamed bool
+}
+
+type latencyKey struct{}
+
+// withLatency asks the bridge calls made with the returned context to record
+// their latency in trace
+func withLatency(ctx context.Context, trace *latencyTrace) context.Context {
+	return context.WithValue(ctx, latencyKey{}, trace)
+}
+
+// traceLatency starts timing a client call. The call records into the trace
+// of a timed call, or into a new one when the bridge logs latencies;
+// otherwise it is not timed and the returned trace is nil.
+func (b *ModelBridge) traceLatency(ctx context.Context) (context.Context, *latencyTrace) {
+	trace, _ := ctx.Value(latencyKey{}).(*latencyTrace)
+	if trace == nil && !b.LogLatency {
+		return ctx, nil
+	}
+	if trace == nil {
+		trace = &latencyTrace{}
+	}
+	trace.start = time.Now()
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn:              func(httptrace.GotConnInfo) { trace.mark(&trace.latency.Connect) },
+		GotFirstResponseByte: func() { trace.mark(&trace.latency.FirstByte) },
+	}), trace
+}
+
+// mark sets phase to the time elapsed since the call started, unless it was
+// already reached
+func (t *latencyTrace) mark(phase *time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if *phase == 0 {
+		*phase = time.Since(t.start)
+	}
+}
+
+// firstChunk marks the first chunk of a stream as its first byte. Chunks
+// arrive after the response headers, so this replaces the time reported by
+// the HTTP trace.
+func (t *latencyTrace) firstChunk() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.streamed {
+		t.streamed = true
+		t.latency.FirstByte = time.Since(t.start)
+	}
+}
+
+// finish records the total time and returns the latency of the call
+func (t *latencyTrace) finish() CallLatency {
+	if t == nil {
+		return CallLatency{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latency.Total = time.Since(t.start)
+	return t.latency
+}
+
+// result returns the latency recorded so far
+func (t *latencyTrace) result() CallLatency {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latency
+}
+
+// logLatency finishes trace and logs the call latency at DEBUG
+func logLatency(log *logger.Logger, model string, trace *latencyTrace) {
+	if trace == nil {
+		return
+	}
+	latency := trace.finish()
+	log.Debug("%s model call latency: connect=%s first_byte=%s total=%s",
+		model, latency.Connect, latency.FirstByte, latency.Total)
+}
+
+// CallNormalTimed calls the Normal model like CallNormal and returns the
+// latency of the call alongside the response
+func (b *ModelBridge) CallNormalTimed(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, CallLatency, error) {
+	trace := &latencyTrace{}
+	resp, err := b.CallNormal(withLatency(ctx, trace), req)
+	return resp, trace.result(), err
+}
+
+// CallReasonerTimed calls the Reasoner model like CallReasoner and returns
+// the latency of the call alongside the response
+func (b *ModelBridge) CallReasonerTimed(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, CallLatency, error) {
+	trace := &latencyTrace{}
+	resp, err := b.CallReasoner(withLatency(ctx, trace), req)
+	return resp, trace.result(), err
+}
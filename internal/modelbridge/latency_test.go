@@ -0,0 +1,106 @@
+package modelbridge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slowDelay = 20 * time.Millisecond
+
+func TestModelBridge_CallNormalTimed(t *testing.T) {
+	// The upstream is slow to start answering and then slow to finish
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(slowDelay)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(slowDelay)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"slow answer"}}]}`))
+	}))
+	defer server.Close()
+
+	client, err := clients.NewModelClient(config.ProviderOpenAI, clients.ModelClientConfig{APIBase: server.URL, Model: "test-model"})
+	require.NoError(t, err)
+	bridge := NewModelBridgeWithClients(client, nil, logger.GetLogger().WithComponent("test_bridge"))
+
+	resp, latency, err := bridge.CallNormalTimed(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "slow answer", resp.Choices[0].Message.Content)
+
+	assert.Greater(t, latency.Connect, time.Duration(0))
+	assert.GreaterOrEqual(t, latency.FirstByte, latency.Connect+slowDelay)
+	assert.GreaterOrEqual(t, latency.Total, latency.FirstByte+slowDelay)
+}
+
+func TestModelBridge_CallTimedWithoutHTTP(t *testing.T) {
+	reasoner := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			time.Sleep(slowDelay)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "reasoned"}}},
+			}, nil
+		},
+	}
+	bridge := NewModelBridgeWithClients(nil, reasoner, logger.GetLogger().WithComponent("test_bridge"))
+
+	_, latency, err := bridge.CallReasonerTimed(context.Background(), &models.ChatCompletionRequest{})
+	require.NoError(t, err)
+	// A client that does not use HTTP only reports the total
+	assert.Equal(t, time.Duration(0), latency.Connect)
+	assert.Equal(t, time.Duration(0), latency.FirstByte)
+	assert.GreaterOrEqual(t, latency.Total, slowDelay)
+}
+
+func TestModelBridge_StreamLatency(t *testing.T) {
+	normal := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for _, chunk := range []string{"first", "second"} {
+					time.Sleep(slowDelay)
+					ch <- &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: chunk}}},
+					}
+				}
+			}()
+			return ch, nil
+		},
+	}
+	bridge := NewModelBridgeWithClients(normal, nil, logger.GetLogger().WithComponent("test_bridge"))
+
+	trace := &latencyTrace{}
+	stream, err := bridge.CallNormalStream(withLatency(context.Background(), trace), &models.ChatCompletionRequest{})
+	require.NoError(t, err)
+	for range stream {
+	}
+
+	// The stream is timed to its first chunk and until it is drained
+	latency := trace.result()
+	assert.GreaterOrEqual(t, latency.FirstByte, slowDelay)
+	assert.GreaterOrEqual(t, latency.Total, latency.FirstByte+slowDelay)
+}
+
+func TestModelBridge_LatencyNotTracedByDefault(t *testing.T) {
+	bridge := &ModelBridge{}
+	ctx, trace := bridge.traceLatency(context.Background())
+	assert.Nil(t, trace)
+	assert.Equal(t, context.Background(), ctx)
+
+	bridge.LogLatency = true
+	_, trace = bridge.traceLatency(context.Background())
+	assert.NotNil(t, trace)
+}
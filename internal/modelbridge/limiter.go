@@ -0,0 +1,49 @@
+package modelbridge
+
+import "context"
+
+// ConcurrencyLimiter caps the number of calls in flight to a model. Callers
+// over the limit wait for a free slot instead of being rejected. A nil
+// limiter allows every call.
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// NewConcurrencyLimiter creates a limiter allowing max calls at once, or nil
+// when max is not positive
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ConcurrencyLimiter{slots: make(chan struct{}, max)}
+}
+
+// Acquire waits for a free slot, returning the context error if ctx is done
+// first. Every successful Acquire must be followed by Release.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *ConcurrencyLimiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// InFlight returns the number of calls currently holding a slot
+func (l *ConcurrencyLimiter) InFlight() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
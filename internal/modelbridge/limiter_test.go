@@ -0,0 +1,110 @@
+package modelbridge
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiter_Nil(t *testing.T) {
+	assert.Nil(t, NewConcurrencyLimiter(0))
+
+	var l *ConcurrencyLimiter
+	assert.NoError(t, l.Acquire(context.Background()))
+	l.Release()
+	assert.Equal(t, 0, l.InFlight())
+}
+
+func TestConcurrencyLimiter_AcquireCancelled(t *testing.T) {
+	l := NewConcurrencyLimiter(1)
+	require.NoError(t, l.Acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Acquire(ctx), context.DeadlineExceeded)
+
+	l.Release()
+	assert.NoError(t, l.Acquire(context.Background()))
+}
+
+func TestModelBridge_ConcurrencyLimit(t *testing.T) {
+	const limit, calls = 3, 12
+
+	var inFlight, maxInFlight int32
+	client := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "ok"}}},
+			}, nil
+		},
+	}
+	bridge := &ModelBridge{
+		NormalClient:  client,
+		Logger:        logger.GetLogger().WithComponent("test_bridge"),
+		NormalLimiter: NewConcurrencyLimiter(limit),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := bridge.CallNormal(context.Background(), &models.ChatCompletionRequest{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.LessOrEqual(t, int(maxInFlight), limit)
+	assert.Equal(t, 0, bridge.NormalLimiter.InFlight())
+}
+
+func TestModelBridge_ConcurrencyLimitStream(t *testing.T) {
+	upstream := make(chan *models.ChatCompletionResponse)
+	client := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			return upstream, nil
+		},
+	}
+	bridge := &ModelBridge{
+		ReasonerClient:  client,
+		Logger:          logger.GetLogger().WithComponent("test_bridge"),
+		ReasonerLimiter: NewConcurrencyLimiter(1),
+	}
+
+	stream, err := bridge.CallReasonerStream(context.Background(), &models.ChatCompletionRequest{})
+	require.NoError(t, err)
+
+	// The slot is held while the stream is open, so a second call waits
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = bridge.CallReasonerStream(ctx, &models.ChatCompletionRequest{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(upstream)
+	for range stream {
+	}
+	assert.Equal(t, 0, bridge.ReasonerLimiter.InFlight())
+}
@@ -0,0 +1,63 @@
+package modelbridge
+
+import (
+	"strings"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tokens"
+)
+
+// usageEstimate estimates the token usage of a streamed call from its
+// request and the text it streams
+type usageEstimate struct {
+	prompt     int
+	completion int
+	// last is the content of the previous chunk, to count only the new part
+	// of clients that stream cumulative content
+	last string
+}
+
+// estimateUsage starts estimating the usage of a streamed call when the
+// bridge estimates stream usage; otherwise it returns nil
+func (b *ModelBridge) estimateUsage(req *models.ChatCompletionRequest) *usageEstimate {
+	if !b.EstimateStreamUsage {
+		return nil
+	}
+	return &usageEstimate{prompt: tokens.EstimateMessages(req.Messages)}
+}
+
+// add counts the output of resp and drops the usage the provider reported
+func (e *usageEstimate) add(resp *models.ChatCompletionResponse) {
+	if e == nil || resp == nil {
+		return
+	}
+	resp.Usage = nil
+	if len(resp.Choices) == 0 {
+		return
+	}
+	message := resp.Choices[0].Message
+	content := message.Content
+	if e.last != "" && strings.HasPrefix(content, e.last) {
+		e.completion += tokens.Estimate(content[len(e.last):])
+	} else {
+		e.completion += tokens.Estimate(content)
+	}
+	if content != "" {
+		e.last = content
+	}
+	for _, step := range message.ReasoningContent {
+		e.completion += tokens.Estimate(step)
+	}
+	for _, call := range message.ToolCalls {
+		e.completion += tokens.Estimate(call.Function.Name) + tokens.Estimate(call.Function.Arguments)
+	}
+}
+
+// usage returns the estimated usage of the call so far
+func (e *usageEstimate) usage() *models.Usage {
+	return &models.Usage{
+		PromptTokens:     e.prompt,
+		CompletionTokens: e.completion,
+		TotalTokens:      e.prompt + e.completion,
+	}
+}
@@ -0,0 +1,59 @@
+package modelbridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelBridge_EstimateStreamUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+	}{
+		{name: "delta", chunks: []string{"The quick ", "brown fox"}},
+		{name: "cumulative", chunks: []string{"The quick ", "The quick brown fox"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normal := &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					ch := make(chan *models.ChatCompletionResponse, len(tt.chunks)+1)
+					for _, chunk := range tt.chunks {
+						ch <- &models.ChatCompletionResponse{
+							Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: chunk}}},
+						}
+					}
+					ch <- &models.ChatCompletionResponse{Usage: &models.Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}}
+					close(ch)
+					return ch, nil
+				},
+			}
+			bridge := NewModelBridgeWithClients(normal, nil, logger.GetLogger().WithComponent("test_bridge"))
+			bridge.EstimateStreamUsage = true
+
+			req := &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "Tell me about foxes"}}}
+			stream, err := bridge.CallNormalStream(context.Background(), req)
+			require.NoError(t, err)
+			var usages []*models.Usage
+			for resp := range stream {
+				if resp.Usage != nil {
+					usages = append(usages, resp.Usage)
+				}
+			}
+
+			// The provider's usage is replaced by a single estimate
+			require.Len(t, usages, 1)
+			prompt := tokens.EstimateMessages(req.Messages)
+			completion := tokens.Estimate("The quick brown fox")
+			assert.Equal(t, &models.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}, usages[0])
+		})
+	}
+}
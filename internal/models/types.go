@@ -1,33 +1,330 @@
 package models
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 // ChatCompletionRequest represents an incoming chat completion request
 type ChatCompletionRequest struct {
-	Model       string                  `json:"model"`
-	Messages    []ChatCompletionMessage `json:"messages"`
-	Stream      bool                    `json:"stream,omitempty"`
-	RequestID   string                  `json:"request_id"`
-	Temperature float32                 `json:"temperature,omitempty"`
-	MaxTokens   int                     `json:"max_tokens,omitempty"`
+	Model             string                  `json:"model"`
+	Messages          []ChatCompletionMessage `json:"messages"`
+	Stream            bool                    `json:"stream,omitempty"`
+	RequestID         string                  `json:"request_id"`
+	Temperature       float32                 `json:"temperature,omitempty"`
+	MaxTokens         int                     `json:"max_tokens,omitempty"`
+	N                 int                     `json:"n,omitempty"`
+	Stop              StopSequences           `json:"stop,omitempty"`
+	TopP              float32                 `json:"top_p,omitempty"`
+	PresencePenalty   float32                 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty  float32                 `json:"frequency_penalty,omitempty"`
+	Seed              *int                    `json:"seed,omitempty"`
+	IncludeConfidence bool                    `json:"include_confidence,omitempty"`
+	// IncludeReasoning overrides the configured include_reasoning setting
+	IncludeReasoning *bool `json:"include_reasoning,omitempty"`
+	// ExtraParams overrides the model's default parameters for this request
+	// and is forwarded to every stage
+	ExtraParams map[string]interface{} `json:"extra_params,omitempty"`
+	// DryRun returns the rendered stage prompts without calling any model
+	DryRun bool `json:"dry_run,omitempty"`
+	// Mode overrides the configured pipeline mode: hybrid or passthrough
+	Mode string `json:"mode,omitempty"`
+	// Metadata labels the request for logs and metrics; it is not sent to
+	// the models
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ResponseFormat asks for the final answer as JSON
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// Tools the model may call while producing the final answer
+	Tools []Tool `json:"tools,omitempty"`
+	// ToolChoice is the OpenAI tool_choice parameter, either a string such
+	// as "auto" or an object naming a function; it is forwarded as is
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+	// LogProbs asks for the log probabilities of the final answer tokens,
+	// with the TopLogProbs most likely alternatives at each position
+	LogProbs    bool `json:"logprobs,omitempty"`
+	TopLogProbs int  `json:"top_logprobs,omitempty"`
+}
+
+// ToolTypeFunction is the only tool type
+const ToolTypeFunction = "function"
+
+// Tool is a tool the model may call
+type Tool struct {
+	Type     string              `json:"type"`
+	Function *FunctionDefinition `json:"function,omitempty"`
+}
+
+// FunctionDefinition describes a function tool and its JSON schema parameters
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// ToolCall is a call of a tool requested by the model. In stream chunks
+// Index identifies the call a partial call belongs to.
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is the function and JSON encoded arguments of a tool call
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// Response format types
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat is the OpenAI response_format parameter: plain text, any
+// JSON object, or JSON following a schema
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema names the schema a json_schema response must follow
+type JSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// WantsJSON reports whether the answer must be JSON. It is safe to call on
+// a nil format.
+func (f *ResponseFormat) WantsJSON() bool {
+	return f != nil && (f.Type == ResponseFormatJSONObject || f.Type == ResponseFormatJSONSchema)
+}
+
+// Prefill returns the content of a trailing assistant message, which seeds
+// the reply: the model continues it instead of answering from scratch
+func (r *ChatCompletionRequest) Prefill() (string, bool) {
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == RoleAssistant {
+		return r.Messages[n-1].Content, true
+	}
+	return "", false
+}
+
+// StopSequences holds the stop parameter, which may be sent as a single
+// string or a list of strings
+type StopSequences []string
+
+// UnmarshalJSON accepts either a string or an array of strings
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
 }
 
-// ChatCompletionMessage represents a message in the chat
+// ChatCompletionMessage represents a message in the chat. Content may be sent
+// as a plain string or as an array of content parts; for the array form the
+// parts are kept in MultiContent and Content holds their text joined by newlines.
 type ChatCompletionMessage struct {
-	Role             string   `json:"role"`
-	Content          string   `json:"content"`
-	ReasoningContent []string `json:"reasoning_content,omitempty"`
+	Role             string        `json:"role"`
+	Content          string        `json:"content"`
+	MultiContent     []ContentPart `json:"-"`
+	ReasoningContent []string      `json:"reasoning_content,omitempty"`
+	// ToolCalls are the tool calls of an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a tool message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Content part types
+const (
+	ContentPartText     = "text"
+	ContentPartImageURL = "image_url"
+)
+
+// ContentPart is one element of an array-form message content
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image in a content part
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// MarshalJSON writes Content as a string, or as the parts array when MultiContent is set
+func (m ChatCompletionMessage) MarshalJSON() ([]byte, error) {
+	type message ChatCompletionMessage
+	if len(m.MultiContent) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []ContentPart `json:"content"`
+	}{message(m), m.MultiContent})
+}
+
+// UnmarshalJSON accepts content as either a string or an array of parts
+func (m *ChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	type message ChatCompletionMessage
+	aux := struct {
+		*message
+		Content json.RawMessage `json:"content"`
+	}{message: (*message)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	m.Content, m.MultiContent = "", nil
+	if len(aux.Content) == 0 || string(aux.Content) == "null" {
+		return nil
+	}
+	if aux.Content[0] != '[' {
+		return json.Unmarshal(aux.Content, &m.Content)
+	}
+	if err := json.Unmarshal(aux.Content, &m.MultiContent); err != nil {
+		return err
+	}
+	var texts []string
+	for _, part := range m.MultiContent {
+		if part.Type == ContentPartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
 }
 
 // ChatCompletionChoice represents a completion choice
 type ChatCompletionChoice struct {
+	Index        int                   `json:"index"`
 	Message      ChatCompletionMessage `json:"message"`
-	FinishReason string               `json:"finish_reason"`
+	LogProbs     *LogProbs             `json:"logprobs,omitempty"`
+	FinishReason string                `json:"finish_reason"`
+}
+
+// LogProbs are the log probabilities of the tokens of an answer
+type LogProbs struct {
+	Content []LogProb `json:"content"`
+}
+
+// LogProb is the log probability of a token and of the most likely tokens
+// at its position
+type LogProb struct {
+	Token       string       `json:"token"`
+	LogProb     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes,omitempty"`
+	TopLogProbs []TopLogProb `json:"top_logprobs"`
+}
+
+// TopLogProb is one of the most likely tokens at a position
+type TopLogProb struct {
+	Token   string  `json:"token"`
+	LogProb float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes,omitempty"`
 }
 
 // ChatCompletionResponse represents the response from the chat completion API
 type ChatCompletionResponse struct {
-	ID      string                `json:"id"`
-	Object  string                `json:"object"`
-	Created int64                 `json:"created"`
-	Model   string                `json:"model"`
-	Choices []ChatCompletionChoice `json:"choices"`
+	ID       string                 `json:"id"`
+	Object   string                 `json:"object"`
+	Created  int64                  `json:"created"`
+	Model    string                 `json:"model"`
+	Choices  []ChatCompletionChoice `json:"choices"`
+	Usage    *Usage                 `json:"usage,omitempty"`
+	Metadata *ResponseMetadata      `json:"metadata,omitempty"`
+	// Err is set on the last response of a stream that failed after it
+	// started. It is never sent to API callers.
+	Err error `json:"-"`
+}
+
+// Usage reports token consumption for a completion
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add accumulates other into u. A nil other is ignored.
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// ChatCompletionStreamChoice represents a choice in a streamed chunk
+type ChatCompletionStreamChoice struct {
+	Index        int                   `json:"index"`
+	Delta        ChatCompletionMessage `json:"delta"`
+	LogProbs     *LogProbs             `json:"logprobs,omitempty"`
+	FinishReason *string               `json:"finish_reason"`
+}
+
+// ChatCompletionStreamResponse represents a single server-sent chunk of a streamed completion
+type ChatCompletionStreamResponse struct {
+	ID      string                       `json:"id"`
+	Object  string                       `json:"object"`
+	Created int64                        `json:"created"`
+	Model   string                       `json:"model"`
+	Choices []ChatCompletionStreamChoice `json:"choices"`
+}
+
+// ResponseMetadata carries optional pipeline information outside the standard OpenAI fields
+type ResponseMetadata struct {
+	Confidence *float64 `json:"confidence,omitempty"`
+	// ReasonerFallback is set when the Normal model answered in place of the Reasoner
+	ReasonerFallback bool `json:"reasoner_fallback,omitempty"`
+	// ReasoningTruncated is set when the reasoning stopped at a length limit
+	// and the answer is based on incomplete reasoning
+	ReasoningTruncated bool `json:"reasoning_truncated,omitempty"`
+	// Degraded is set when postprocessing failed and the answer is the
+	// reasoner's unprocessed result
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// DryRunResponse lists the requests each pipeline stage would send
+type DryRunResponse struct {
+	Object string        `json:"object"`
+	Stages []DryRunStage `json:"stages"`
+}
+
+// DryRunStage is the model request a single stage would send
+type DryRunStage struct {
+	Stage    string                  `json:"stage"`
+	Model    string                  `json:"model,omitempty"`
+	Messages []ChatCompletionMessage `json:"messages"`
+}
+
+// ModelInfo describes a model in the /v1/models listing
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelList is the response of the /v1/models endpoint
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelInfo `json:"data"`
 }
@@ -155,3 +155,135 @@ func TestChatCompletionMessageValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestUsageSerialization(t *testing.T) {
+	resp := &ChatCompletionResponse{
+		Usage: &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+
+	data, err := json.Marshal(resp)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}`)
+
+	// Usage is omitted when unknown
+	data, err = json.Marshal(&ChatCompletionResponse{})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"usage"`)
+}
+
+func TestUsageAdd(t *testing.T) {
+	total := Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}
+	total.Add(&Usage{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30})
+	total.Add(nil)
+
+	assert.Equal(t, Usage{PromptTokens: 11, CompletionTokens: 22, TotalTokens: 33}, total)
+}
+
+func TestChatCompletionRequestSamplingParams(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want ChatCompletionRequest
+	}{
+		{
+			name: "stop list",
+			body: `{"stop":["\n\n","END"],"top_p":0.9,"presence_penalty":0.5,"frequency_penalty":-0.5}`,
+			want: ChatCompletionRequest{
+				Stop:             StopSequences{"\n\n", "END"},
+				TopP:             0.9,
+				PresencePenalty:  0.5,
+				FrequencyPenalty: -0.5,
+			},
+		},
+		{
+			name: "single stop string",
+			body: `{"stop":"END"}`,
+			want: ChatCompletionRequest{Stop: StopSequences{"END"}},
+		},
+		{
+			name: "seed",
+			body: `{"seed":42}`,
+			want: ChatCompletionRequest{Seed: func() *int { v := 42; return &v }()},
+		},
+		{
+			name: "zero seed",
+			body: `{"seed":0}`,
+			want: ChatCompletionRequest{Seed: func() *int { v := 0; return &v }()},
+		},
+		{
+			name: "null stop",
+			body: `{"stop":null}`,
+			want: ChatCompletionRequest{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatCompletionRequest
+			assert.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			assert.Equal(t, tt.want, req)
+		})
+	}
+
+	var req ChatCompletionRequest
+	assert.Error(t, json.Unmarshal([]byte(`{"stop":1}`), &req))
+
+	data, err := json.Marshal(ChatCompletionRequest{Stop: StopSequences{"END"}, TopP: 0.5})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"stop":["END"]`)
+	assert.Contains(t, string(data), `"top_p":0.5`)
+	assert.NotContains(t, string(data), "presence_penalty")
+	assert.NotContains(t, string(data), "frequency_penalty")
+	assert.NotContains(t, string(data), "seed")
+
+	seed := 0
+	data, err = json.Marshal(ChatCompletionRequest{Seed: &seed})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"seed":0`)
+}
+
+func TestChatCompletionMessageContentForms(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want ChatCompletionMessage
+	}{
+		{
+			name: "string content",
+			json: `{"role":"user","content":"hello"}`,
+			want: ChatCompletionMessage{Role: "user", Content: "hello"},
+		},
+		{
+			name: "array content",
+			json: `{"role":"user","content":[{"type":"text","text":"what is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}},{"type":"text","text":"be brief"}]}`,
+			want: ChatCompletionMessage{
+				Role:    "user",
+				Content: "what is this?\nbe brief",
+				MultiContent: []ContentPart{
+					{Type: ContentPartText, Text: "what is this?"},
+					{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png", Detail: "low"}},
+					{Type: ContentPartText, Text: "be brief"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg ChatCompletionMessage
+			assert.NoError(t, json.Unmarshal([]byte(tt.json), &msg))
+			assert.Equal(t, tt.want, msg)
+
+			// Round trip preserves the original form
+			data, err := json.Marshal(msg)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.json, string(data))
+		})
+	}
+}
+
+func TestChatCompletionMessageInvalidContent(t *testing.T) {
+	var msg ChatCompletionMessage
+	assert.Error(t, json.Unmarshal([]byte(`{"role":"user","content":42}`), &msg))
+	assert.Error(t, json.Unmarshal([]byte(`{"role":"user","content":[1]}`), &msg))
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidRequest matches every error returned by ValidateRequest
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Message roles accepted in chat requests
+const (
+	RoleSystem    = "system"
+	RoleDeveloper = "developer"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// MaxChoices is the largest number of choices a request may ask for
+const MaxChoices = 8
+
+// MaxTopLogProbs is the largest top_logprobs a request may ask for
+const MaxTopLogProbs = 20
+
+// Limits on request metadata
+const (
+	MaxMetadataPairs       = 16
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 512
+)
+
+// extraParams are the extra_params keys some model client sends upstream. A
+// client skips the keys its provider has no equivalent for, such as top_k for
+// OpenAI compatible models. Tools, tool choice and the response format have
+// request fields of their own.
+var extraParams = map[string]bool{
+	"temperature":           true,
+	"max_tokens":            true,
+	"max_completion_tokens": true,
+	"n":                     true,
+	"top_p":                 true,
+	"top_k":                 true,
+	"presence_penalty":      true,
+	"frequency_penalty":     true,
+	"stop":                  true,
+	"seed":                  true,
+	"logit_bias":            true,
+	"logprobs":              true,
+	"top_logprobs":          true,
+	"user":                  true,
+	"parallel_tool_calls":   true,
+	"reasoning_effort":      true,
+	"include_thoughts":      true,
+	"thinking_budget":       true,
+}
+
+var validRoles = map[string]bool{
+	RoleSystem:    true,
+	RoleDeveloper: true,
+	RoleUser:      true,
+	RoleAssistant: true,
+	RoleTool:      true,
+}
+
+// ValidateRequest checks that req has at least one message and that every
+// message has a known role and non-empty content, that at most MaxChoices
+// choices and MaxTopLogProbs top logprobs are asked for, that the response
+// format, tools and extra params are known and that the metadata is within
+// its limits. The error names the offending message or key.
+func ValidateRequest(req *ChatCompletionRequest) error {
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("%w: messages must contain at least one message", ErrInvalidRequest)
+	}
+	for i, msg := range req.Messages {
+		if !validRoles[msg.Role] {
+			return fmt.Errorf("%w: messages[%d].role: unknown role %q", ErrInvalidRequest, i, msg.Role)
+		}
+		// An assistant message calling tools may come without content
+		if strings.TrimSpace(msg.Content) == "" && len(msg.MultiContent) == 0 && len(msg.ToolCalls) == 0 {
+			return fmt.Errorf("%w: messages[%d].content must not be empty", ErrInvalidRequest, i)
+		}
+		if msg.Role == RoleTool && msg.ToolCallID == "" {
+			return fmt.Errorf("%w: messages[%d].tool_call_id is required", ErrInvalidRequest, i)
+		}
+	}
+	for i, tool := range req.Tools {
+		if tool.Type != ToolTypeFunction {
+			return fmt.Errorf("%w: tools[%d].type: unknown type %q", ErrInvalidRequest, i, tool.Type)
+		}
+		if tool.Function == nil || tool.Function.Name == "" {
+			return fmt.Errorf("%w: tools[%d].function.name is required", ErrInvalidRequest, i)
+		}
+	}
+	if req.N < 0 || req.N > MaxChoices {
+		return fmt.Errorf("%w: n must be between 1 and %d", ErrInvalidRequest, MaxChoices)
+	}
+	if req.TopLogProbs < 0 || req.TopLogProbs > MaxTopLogProbs {
+		return fmt.Errorf("%w: top_logprobs must be between 0 and %d", ErrInvalidRequest, MaxTopLogProbs)
+	}
+	if req.TopLogProbs > 0 && !req.LogProbs {
+		return fmt.Errorf("%w: top_logprobs requires logprobs to be true", ErrInvalidRequest)
+	}
+	if _, ok := req.Prefill(); ok && len(req.Messages) == 1 {
+		return fmt.Errorf("%w: messages[0]: an assistant prefill must follow the conversation it continues", ErrInvalidRequest)
+	}
+	if f := req.ResponseFormat; f != nil {
+		switch f.Type {
+		case ResponseFormatText, ResponseFormatJSONObject:
+		case ResponseFormatJSONSchema:
+			if f.JSONSchema == nil || f.JSONSchema.Name == "" {
+				return fmt.Errorf("%w: response_format.json_schema.name is required", ErrInvalidRequest)
+			}
+		default:
+			return fmt.Errorf("%w: response_format.type: unknown type %q", ErrInvalidRequest, f.Type)
+		}
+	}
+	// Sorted so the same request always reports the same key
+	keys := make([]string, 0, len(req.ExtraParams))
+	for key := range req.ExtraParams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !extraParams[key] {
+			return fmt.Errorf("%w: extra_params: unsupported parameter %q", ErrInvalidRequest, key)
+		}
+	}
+	if len(req.Metadata) > MaxMetadataPairs {
+		return fmt.Errorf("%w: metadata must not contain more than %d keys", ErrInvalidRequest, MaxMetadataPairs)
+	}
+	for key, value := range req.Metadata {
+		if key == "" || len(key) > MaxMetadataKeyLength {
+			return fmt.Errorf("%w: metadata key %q must be 1 to %d characters", ErrInvalidRequest, key, MaxMetadataKeyLength)
+		}
+		if len(value) > MaxMetadataValueLength {
+			return fmt.Errorf("%w: metadata[%q] must not be longer than %d characters", ErrInvalidRequest, key, MaxMetadataValueLength)
+		}
+	}
+	return nil
+}
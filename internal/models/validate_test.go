@@ -0,0 +1,323 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []ChatCompletionMessage
+		expected string
+	}{
+		{
+			name: "well formed",
+			messages: []ChatCompletionMessage{
+				{Role: "system", Content: "Be brief"},
+				{Role: "user", Content: "hello"},
+				{Role: "assistant", Content: "hi"},
+				{Role: "user", Content: "how are you?"},
+			},
+		},
+		{
+			name: "image only content",
+			messages: []ChatCompletionMessage{
+				{Role: "user", MultiContent: []ContentPart{{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png"}}}},
+			},
+		},
+		{
+			name: "assistant prefill",
+			messages: []ChatCompletionMessage{
+				{Role: "user", Content: "Write a haiku"},
+				{Role: "assistant", Content: "Autumn moonlight"},
+			},
+		},
+		{
+			name: "tool call and result",
+			messages: []ChatCompletionMessage{
+				{Role: "user", Content: "Weather in Paris?"},
+				{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: ToolTypeFunction, Function: FunctionCall{Name: "get_weather"}}}},
+				{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+			},
+		},
+		{
+			name: "tool result without call id",
+			messages: []ChatCompletionMessage{
+				{Role: "user", Content: "Weather in Paris?"},
+				{Role: "tool", Content: "sunny"},
+			},
+			expected: "invalid request: messages[1].tool_call_id is required",
+		},
+		{
+			name:     "prefill only",
+			messages: []ChatCompletionMessage{{Role: "assistant", Content: "Autumn moonlight"}},
+			expected: "invalid request: messages[0]: an assistant prefill must follow the conversation it continues",
+		},
+		{
+			name:     "no messages",
+			expected: "invalid request: messages must contain at least one message",
+		},
+		{
+			name:     "invalid role",
+			messages: []ChatCompletionMessage{{Role: "user", Content: "hello"}, {Role: "bot", Content: "hi"}},
+			expected: `invalid request: messages[1].role: unknown role "bot"`,
+		},
+		{
+			name:     "missing role",
+			messages: []ChatCompletionMessage{{Content: "hello"}},
+			expected: `invalid request: messages[0].role: unknown role ""`,
+		},
+		{
+			name:     "empty content",
+			messages: []ChatCompletionMessage{{Role: "user", Content: "  "}},
+			expected: "invalid request: messages[0].content must not be empty",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{Messages: tc.messages})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestValidateRequest_Metadata(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxMetadataPairs; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "v"
+	}
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		expected string
+	}{
+		{name: "labels", metadata: map[string]string{"tenant": "acme", "feature": "search"}},
+		{name: "too many keys", metadata: tooMany, expected: "invalid request: metadata must not contain more than 16 keys"},
+		{name: "empty key", metadata: map[string]string{"": "v"}, expected: `invalid request: metadata key "" must be 1 to 64 characters`},
+		{
+			name:     "long value",
+			metadata: map[string]string{"tenant": strings.Repeat("a", MaxMetadataValueLength+1)},
+			expected: `invalid request: metadata["tenant"] must not be longer than 512 characters`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{
+				Messages: []ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				Metadata: tc.metadata,
+			})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestValidateRequest_ResponseFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   *ResponseFormat
+		expected string
+	}{
+		{name: "text", format: &ResponseFormat{Type: ResponseFormatText}},
+		{name: "json object", format: &ResponseFormat{Type: ResponseFormatJSONObject}},
+		{
+			name:   "json schema",
+			format: &ResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchema{Name: "answer", Schema: json.RawMessage(`{"type":"object"}`)}},
+		},
+		{
+			name:     "json schema without name",
+			format:   &ResponseFormat{Type: ResponseFormatJSONSchema},
+			expected: "invalid request: response_format.json_schema.name is required",
+		},
+		{
+			name:     "unknown type",
+			format:   &ResponseFormat{Type: "xml"},
+			expected: `invalid request: response_format.type: unknown type "xml"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{
+				Messages:       []ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				ResponseFormat: tc.format,
+			})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestValidateRequest_Tools(t *testing.T) {
+	tests := []struct {
+		name     string
+		tools    []Tool
+		expected string
+	}{
+		{
+			name:  "function",
+			tools: []Tool{{Type: ToolTypeFunction, Function: &FunctionDefinition{Name: "get_weather"}}},
+		},
+		{
+			name:     "unknown type",
+			tools:    []Tool{{Type: "retrieval"}},
+			expected: `invalid request: tools[0].type: unknown type "retrieval"`,
+		},
+		{
+			name: "function without name",
+			tools: []Tool{
+				{Type: ToolTypeFunction, Function: &FunctionDefinition{Name: "get_weather"}},
+				{Type: ToolTypeFunction, Function: &FunctionDefinition{}},
+			},
+			expected: "invalid request: tools[1].function.name is required",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{
+				Messages: []ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				Tools:    tc.tools,
+			})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestValidateRequest_Choices(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		expected string
+	}{
+		{name: "unset"},
+		{name: "several", n: 2},
+		{name: "limit", n: MaxChoices},
+		{name: "negative", n: -1, expected: "invalid request: n must be between 1 and 8"},
+		{name: "too many", n: MaxChoices + 1, expected: "invalid request: n must be between 1 and 8"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{
+				Messages: []ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				N:        tc.n,
+			})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestValidateRequest_LogProbs(t *testing.T) {
+	tests := []struct {
+		name        string
+		logprobs    bool
+		topLogProbs int
+		expected    string
+	}{
+		{name: "unset"},
+		{name: "logprobs only", logprobs: true},
+		{name: "top logprobs", logprobs: true, topLogProbs: MaxTopLogProbs},
+		{name: "too many top logprobs", logprobs: true, topLogProbs: MaxTopLogProbs + 1, expected: "invalid request: top_logprobs must be between 0 and 20"},
+		{name: "negative top logprobs", logprobs: true, topLogProbs: -1, expected: "invalid request: top_logprobs must be between 0 and 20"},
+		{name: "top logprobs without logprobs", topLogProbs: 2, expected: "invalid request: top_logprobs requires logprobs to be true"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{
+				Messages:    []ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				LogProbs:    tc.logprobs,
+				TopLogProbs: tc.topLogProbs,
+			})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestValidateRequest_ExtraParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		expected string
+	}{
+		{name: "unset"},
+		{name: "known", params: map[string]interface{}{"temperature": 1.2, "logit_bias": map[string]interface{}{"1639": -100}, "top_k": 40}},
+		{name: "unknown", params: map[string]interface{}{"temperature": 1.2, "frobnicate": true}, expected: `invalid request: extra_params: unsupported parameter "frobnicate"`},
+		{name: "first unknown in key order", params: map[string]interface{}{"zeta": 1, "alpha": 1}, expected: `invalid request: extra_params: unsupported parameter "alpha"`},
+		{name: "request field", params: map[string]interface{}{"tools": []interface{}{}}, expected: `invalid request: extra_params: unsupported parameter "tools"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRequest(&ChatCompletionRequest{
+				Messages:    []ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				ExtraParams: tc.params,
+			})
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestResponseFormat_WantsJSON(t *testing.T) {
+	var none *ResponseFormat
+	assert.False(t, none.WantsJSON())
+	assert.False(t, (&ResponseFormat{Type: ResponseFormatText}).WantsJSON())
+	assert.True(t, (&ResponseFormat{Type: ResponseFormatJSONObject}).WantsJSON())
+	assert.True(t, (&ResponseFormat{Type: ResponseFormatJSONSchema}).WantsJSON())
+}
+
+func TestChatCompletionRequest_Prefill(t *testing.T) {
+	req := &ChatCompletionRequest{Messages: []ChatCompletionMessage{
+		{Role: "user", Content: "Write a haiku"},
+		{Role: "assistant", Content: "Autumn moonlight"},
+	}}
+	prefill, ok := req.Prefill()
+	assert.True(t, ok)
+	assert.Equal(t, "Autumn moonlight", prefill)
+
+	req.Messages = req.Messages[:1]
+	_, ok = req.Prefill()
+	assert.False(t, ok)
+}
@@ -0,0 +1,54 @@
+package orchestrator
+
+import (
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tokens"
+)
+
+// checkStageBudget fails a stage before its model call when the tokens used
+// so far, the estimated prompt and the completion limit of the call add up to
+// more than the token budget. Calls without a completion limit are checked
+// with their prompt alone.
+func checkStageBudget(log *logger.Logger, cfg *config.ModelConfig, req *models.ChatCompletionRequest, data *Payload) error {
+	if data.TokenBudget <= 0 {
+		return nil
+	}
+	usage := data.TotalUsage()
+	used := usage.PromptTokens + usage.CompletionTokens
+	next := tokens.EstimateRequest(req) + maxTokens(cfg, req, data)
+	if used+next <= data.TokenBudget {
+		return nil
+	}
+	log.Warn("Stage call of about %d tokens on top of %d used would pass the budget of %d", next, used, data.TokenBudget)
+	return &budgetError{used: used, next: next, budget: data.TokenBudget}
+}
+
+// maxTokens returns the completion limit of a stage call: the request's own,
+// then the stage model's default and the global default
+func maxTokens(cfg *config.ModelConfig, req *models.ChatCompletionRequest, data *Payload) int {
+	if req.MaxTokens > 0 {
+		return req.MaxTokens
+	}
+	if n, ok := intParam(req.ExtraParams["max_tokens"]); ok {
+		return n
+	}
+	if n, ok := intParam(cfg.DefaultParams["max_tokens"]); ok {
+		return n
+	}
+	return data.DefaultMaxTokens
+}
+
+// intParam converts a model parameter decoded from JSON or YAML to an int
+func intParam(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,129 @@
+package orchestrator
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+const defaultCacheSize = 1000
+
+// ResponseCache is an LRU cache of pipeline responses keyed by request
+// content. Entries older than the TTL are treated as misses.
+type ResponseCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	resp    *models.ChatCompletionResponse
+	expires time.Time
+}
+
+// NewResponseCache creates a cache holding up to cfg.Size responses. A zero
+// TTL keeps entries until they are evicted.
+func NewResponseCache(cfg config.CacheConfig) *ResponseCache {
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	return &ResponseCache{
+		size:    size,
+		ttl:     cfg.TTL,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns a copy of the cached response for key
+func (c *ResponseCache) Get(key string) (*models.ChatCompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && !c.now().Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return cloneResponse(entry.resp), true
+}
+
+// Put stores a copy of resp under key, evicting the least recently used
+// entry when the cache is full
+func (c *ResponseCache) Put(key string, resp *models.ChatCompletionResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, resp: cloneResponse(resp), expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of cached responses
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// cacheKey hashes the parts of req that determine the response. The request
+// ID, stream flag and metadata do not affect the answer and are left out.
+func cacheKey(req *models.ChatCompletionRequest) (string, error) {
+	normalized := *req
+	normalized.RequestID = ""
+	normalized.Stream = false
+	normalized.Metadata = nil
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cloneResponse copies resp so cached entries are not changed by callers
+func cloneResponse(resp *models.ChatCompletionResponse) *models.ChatCompletionResponse {
+	clone := *resp
+	clone.Choices = make([]models.ChatCompletionChoice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choice.Message.ReasoningContent = append([]string(nil), choice.Message.ReasoningContent...)
+		clone.Choices[i] = choice
+	}
+	if resp.Usage != nil {
+		usage := *resp.Usage
+		clone.Usage = &usage
+	}
+	if resp.Metadata != nil {
+		metadata := *resp.Metadata
+		clone.Metadata = &metadata
+	}
+	return &clone
+}
@@ -0,0 +1,160 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCache returns a cache whose clock is advanced by the returned function
+func newTestCache(cfg config.CacheConfig) (*ResponseCache, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	cache := NewResponseCache(cfg)
+	cache.now = func() time.Time { return now }
+	return cache, func(d time.Duration) { now = now.Add(d) }
+}
+
+func cachedResponse(content string) *models.ChatCompletionResponse {
+	return &models.ChatCompletionResponse{
+		Choices: []models.ChatCompletionChoice{
+			{Message: models.ChatCompletionMessage{Role: "assistant", Content: content}},
+		},
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	cache, _ := newTestCache(config.CacheConfig{Size: 2})
+
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	cache.Put("a", cachedResponse("answer a"))
+	resp, ok := cache.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "answer a", resp.Choices[0].Message.Content)
+
+	// Callers cannot change the cached entry
+	resp.Choices[0].Message.Content = "changed"
+	resp, _ = cache.Get("a")
+	assert.Equal(t, "answer a", resp.Choices[0].Message.Content)
+}
+
+func TestResponseCache_Eviction(t *testing.T) {
+	cache, _ := newTestCache(config.CacheConfig{Size: 2})
+
+	cache.Put("a", cachedResponse("a"))
+	cache.Put("b", cachedResponse("b"))
+	// Touching a makes b the least recently used entry
+	_, ok := cache.Get("a")
+	require.True(t, ok)
+	cache.Put("c", cachedResponse("c"))
+
+	assert.Equal(t, 2, cache.Len())
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	cache, advance := newTestCache(config.CacheConfig{TTL: time.Minute})
+
+	cache.Put("a", cachedResponse("a"))
+	advance(59 * time.Second)
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	advance(time.Second)
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCacheKey(t *testing.T) {
+	base := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{
+			Model:    "deepempower",
+			Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+		}
+	}
+	key, err := cacheKey(base())
+	require.NoError(t, err)
+
+	sameAnswer := base()
+	sameAnswer.RequestID = "other-id"
+	sameAnswer.Stream = true
+	other, err := cacheKey(sameAnswer)
+	require.NoError(t, err)
+	assert.Equal(t, key, other)
+
+	differentParams := base()
+	differentParams.Temperature = 0.5
+	other, err = cacheKey(differentParams)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	seed := 42
+	seeded := base()
+	seeded.Seed = &seed
+	other, err = cacheKey(seeded)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	otherSeed := 7
+	reseeded := base()
+	reseeded.Seed = &otherSeed
+	again, err := cacheKey(reseeded)
+	require.NoError(t, err)
+	assert.NotEqual(t, other, again)
+
+	differentMessages := base()
+	differentMessages.Messages[0].Content = "goodbye"
+	other, err = cacheKey(differentMessages)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestHybridPipeline_Cache(t *testing.T) {
+	calls := 0
+	normalClient := staticNormalClient("cached answer")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		calls++
+		return complete(ctx, req)
+	}
+	pipeline := newMockPipeline(normalClient, staticReasonerClient("reasoned", "step"))
+	pipeline.SetCache(NewResponseCache(config.CacheConfig{Size: 10}))
+
+	req := func(id string) *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{
+			RequestID: id,
+			Messages:  []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+		}
+	}
+
+	first, err := pipeline.Execute(context.Background(), req("req-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	second, err := pipeline.Execute(context.Background(), req("req-2"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, first.Choices, second.Choices)
+	// The cached answer is identified as a response to the new request
+	assert.Equal(t, "chatcmpl-req-1", first.ID)
+	assert.Equal(t, "chatcmpl-req-2", second.ID)
+
+	// Streaming requests always run the pipeline
+	stream, err := pipeline.ExecuteStream(context.Background(), req("req-3"))
+	require.NoError(t, err)
+	for range stream {
+	}
+	assert.Equal(t, 3, calls)
+}
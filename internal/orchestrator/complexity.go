@@ -0,0 +1,117 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// Complexity strategy names accepted in config
+const (
+	ComplexityHeuristic = "heuristic"
+	ComplexityModel     = "model"
+)
+
+// defaultComplexityThreshold is used when the config leaves the threshold unset
+const defaultComplexityThreshold = 0.3
+
+// complexityWordSaturation is the message length in words at which the
+// heuristic length score reaches its maximum
+const complexityWordSaturation = 60
+
+// complexityKeywords hint that a question needs multi-step reasoning
+var complexityKeywords = []string{
+	"why", "prove", "derive", "explain", "analyze", "analyse", "compare",
+	"step by step", "design", "optimize", "debug", "trade-off", "tradeoff",
+	"evaluate", "plan", "algorithm",
+}
+
+const classifierPrompt = `You are routing questions. Reply with a single number between 0 and 1 ` +
+	`describing how much multi-step reasoning the user's question needs, where 0 is a trivial ` +
+	`lookup or small talk and 1 is a hard problem. Reply with the number only.`
+
+// ComplexityClassifier scores how complex a request is in [0, 1]. Requests
+// scoring below the configured threshold skip the reasoning chain.
+type ComplexityClassifier interface {
+	Classify(ctx context.Context, req *models.ChatCompletionRequest) (float64, error)
+	Name() string
+}
+
+// NewComplexityClassifier returns the built-in classifier for the given strategy name
+func NewComplexityClassifier(strategy string, bridge *modelbridge.ModelBridge) (ComplexityClassifier, error) {
+	switch strategy {
+	case ComplexityHeuristic:
+		return heuristicClassifier{}, nil
+	case ComplexityModel:
+		return &modelClassifier{bridge: bridge}, nil
+	default:
+		return nil, fmt.Errorf("unknown complexity strategy %q", strategy)
+	}
+}
+
+// heuristicClassifier scores the last user message by length, adding 0.5 for
+// reasoning keywords and 0.5 for code blocks, capped at 1.0
+type heuristicClassifier struct{}
+
+func (heuristicClassifier) Name() string {
+	return ComplexityHeuristic
+}
+
+func (heuristicClassifier) Classify(ctx context.Context, req *models.ChatCompletionRequest) (float64, error) {
+	text := strings.ToLower(lastUserContent(req))
+	score := float64(min(len(strings.Fields(text)), complexityWordSaturation)) / complexityWordSaturation
+
+	for _, keyword := range complexityKeywords {
+		if strings.Contains(text, keyword) {
+			score += 0.5
+			break
+		}
+	}
+	if strings.Contains(text, "```") {
+		score += 0.5
+	}
+	return min(1, score), nil
+}
+
+// modelClassifier asks the Normal model to rate the question and parses the
+// number it replies with, clamped to [0, 1]
+type modelClassifier struct {
+	bridge *modelbridge.ModelBridge
+}
+
+func (c *modelClassifier) Name() string {
+	return ComplexityModel
+}
+
+func (c *modelClassifier) Classify(ctx context.Context, req *models.ChatCompletionRequest) (float64, error) {
+	resp, err := c.bridge.CallNormal(ctx, &models.ChatCompletionRequest{
+		Model: req.Model,
+		Messages: []models.ChatCompletionMessage{
+			{Role: "system", Content: classifierPrompt},
+			{Role: "user", Content: lastUserContent(req)},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("classifier call: %w", err)
+	}
+
+	score, err := strconv.ParseFloat(strings.TrimSpace(resp.Choices[0].Message.Content), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse classifier score: %w", err)
+	}
+	return min(1, max(0, score)), nil
+}
+
+// lastUserContent returns the content of the most recent user message
+func lastUserContent(req *models.ChatCompletionRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeuristicClassifier(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		simple  bool
+	}{
+		{name: "trivial arithmetic", content: "What is 2+2?", simple: true},
+		{name: "greeting", content: "hello there", simple: true},
+		{name: "reasoning keyword", content: "Why is the sky blue?", simple: false},
+		{name: "code block", content: "fix this ```go\nfunc main() {}\n```", simple: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			score, err := heuristicClassifier{}.Classify(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: tc.content}},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.simple, score < defaultComplexityThreshold, "score %.2f", score)
+		})
+	}
+}
+
+func TestModelClassifier(t *testing.T) {
+	pipeline := newMockPipeline(staticNormalClient(" 1.7 "), nil)
+	classifier, err := NewComplexityClassifier(ComplexityModel, pipeline.bridge)
+	require.NoError(t, err)
+
+	score, err := classifier.Classify(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, score)
+
+	_, err = NewComplexityClassifier("unknown", nil)
+	assert.Error(t, err)
+}
+
+func TestHybridPipeline_ComplexityRouting(t *testing.T) {
+	testCases := []struct {
+		name           string
+		content        string
+		expectReasoner bool
+		expectCalls    int
+	}{
+		{name: "skip reasoner", content: "What is 2+2?", expectReasoner: false, expectCalls: 1},
+		{name: "engage reasoner", content: "Explain why the proof holds step by step", expectReasoner: true, expectCalls: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var normalCalls []*models.ChatCompletionRequest
+			normalClient := &mocks.MockModelClient{
+				CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+					normalCalls = append(normalCalls, req)
+					return &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{Content: "answer"}},
+						},
+					}, nil
+				},
+			}
+			reasonerCalled := false
+			reasonerClient := staticReasonerClient("reasoned", "step")
+			stream := reasonerClient.CompleteStreamFunc
+			reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				reasonerCalled = true
+				return stream(ctx, req)
+			}
+
+			pipeline := newMockPipeline(normalClient, reasonerClient)
+			pipeline.SetComplexityClassifier(heuristicClassifier{}, defaultComplexityThreshold)
+
+			req := &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: tc.content}},
+			}
+			resp, err := pipeline.Execute(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, "answer", resp.Choices[0].Message.Content)
+			assert.Equal(t, tc.expectReasoner, reasonerCalled)
+			require.Len(t, normalCalls, tc.expectCalls)
+			if !tc.expectReasoner {
+				// The direct answer sees the original conversation unchanged
+				assert.Equal(t, req.Messages, normalCalls[0].Messages)
+			}
+		})
+	}
+}
+
+func TestHybridPipeline_ComplexityFromConfig(t *testing.T) {
+	cfg := &config.PipelineConfig{
+		Complexity: &config.ComplexityConfig{Strategy: ComplexityHeuristic},
+		Prompts:    testPrompts,
+	}
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, pipeline.classifier)
+	assert.Equal(t, defaultComplexityThreshold, pipeline.complexityThreshold)
+
+	cfg.Complexity = &config.ComplexityConfig{Strategy: "bogus", Threshold: 0.5}
+	pipeline, err = NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, pipeline.classifier)
+}
@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// Confidence strategy names accepted in config
+const (
+	ConfidenceFinishReason = "finish_reason"
+	ConfidenceReasoning    = "reasoning"
+	ConfidenceJudge        = "judge"
+)
+
+// reasoningSaturationSteps is the number of reasoning steps at which the
+// reasoning strategy reaches its maximum score
+const reasoningSaturationSteps = 5
+
+const judgePrompt = `You are grading an answer. Reply with a single number between 0 and 1 ` +
+	`describing how confident you are that the answer correctly and completely addresses the question. ` +
+	`Reply with the number only.`
+
+// ConfidenceScorer computes a confidence score in [0, 1] for a finished payload
+type ConfidenceScorer interface {
+	Score(ctx context.Context, data *Payload) (float64, error)
+	Name() string
+}
+
+// NewConfidenceScorer returns the built-in scorer for the given strategy name
+func NewConfidenceScorer(strategy string, bridge *modelbridge.ModelBridge) (ConfidenceScorer, error) {
+	switch strategy {
+	case ConfidenceFinishReason:
+		return finishReasonScorer{}, nil
+	case ConfidenceReasoning:
+		return reasoningScorer{}, nil
+	case ConfidenceJudge:
+		return &judgeScorer{bridge: bridge}, nil
+	default:
+		return nil, fmt.Errorf("unknown confidence strategy %q", strategy)
+	}
+}
+
+// finishReasonScorer scores 1.0 when both the reasoner and the final stage
+// stopped naturally, 0.5 when either was cut off by the length limit and 0.25
+// for any other finish reason (e.g. content_filter). The lower of the two wins.
+type finishReasonScorer struct{}
+
+func (finishReasonScorer) Name() string {
+	return ConfidenceFinishReason
+}
+
+func (finishReasonScorer) Score(ctx context.Context, data *Payload) (float64, error) {
+	reasoning, final := data.FinishReasons()
+	return min(finishReasonScore(reasoning), finishReasonScore(final)), nil
+}
+
+func finishReasonScore(reason string) float64 {
+	switch reason {
+	case "", "stop":
+		return 1.0
+	case "length":
+		return 0.5
+	default:
+		return 0.25
+	}
+}
+
+// reasoningScorer scores from the reasoning chain: an empty chain or empty
+// final content scores 0.2, otherwise the score grows linearly from 0.5 with
+// the number of non-empty steps and saturates at 1.0.
+type reasoningScorer struct{}
+
+func (reasoningScorer) Name() string {
+	return ConfidenceReasoning
+}
+
+func (reasoningScorer) Score(ctx context.Context, data *Payload) (float64, error) {
+	steps := 0
+	for _, step := range data.Reasoning() {
+		if strings.TrimSpace(step) != "" {
+			steps++
+		}
+	}
+	if steps == 0 || strings.TrimSpace(data.Final()) == "" {
+		return 0.2, nil
+	}
+	if steps > reasoningSaturationSteps {
+		steps = reasoningSaturationSteps
+	}
+	return 0.5 + 0.5*float64(steps)/reasoningSaturationSteps, nil
+}
+
+// judgeScorer asks the Normal model to grade the final answer and parses the
+// number it replies with, clamped to [0, 1].
+type judgeScorer struct {
+	bridge *modelbridge.ModelBridge
+}
+
+func (s *judgeScorer) Name() string {
+	return ConfidenceJudge
+}
+
+func (s *judgeScorer) Score(ctx context.Context, data *Payload) (float64, error) {
+	question := ""
+	if msgs := data.OriginalRequest.Messages; len(msgs) > 0 {
+		question = msgs[len(msgs)-1].Content
+	}
+
+	resp, err := s.bridge.CallNormal(ctx, &models.ChatCompletionRequest{
+		Model: data.OriginalRequest.Model,
+		Messages: []models.ChatCompletionMessage{
+			{Role: "system", Content: judgePrompt},
+			{Role: "user", Content: fmt.Sprintf("Question:\n%s\n\nAnswer:\n%s", question, data.Final())},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("judge call: %w", err)
+	}
+
+	score, err := strconv.ParseFloat(strings.TrimSpace(resp.Choices[0].Message.Content), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse judge score: %w", err)
+	}
+	return min(1, max(0, score)), nil
+}
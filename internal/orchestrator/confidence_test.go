@@ -0,0 +1,148 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfidenceScorers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		strategy string
+		payload  *Payload
+		expected float64
+	}{
+		{
+			name:     "finish reason stop",
+			strategy: ConfidenceFinishReason,
+			payload:  &Payload{ReasoningFinishReason: "stop", FinishReason: "stop"},
+			expected: 1.0,
+		},
+		{
+			name:     "finish reason length on reasoner",
+			strategy: ConfidenceFinishReason,
+			payload:  &Payload{ReasoningFinishReason: "length", FinishReason: "stop"},
+			expected: 0.5,
+		},
+		{
+			name:     "finish reason content filter",
+			strategy: ConfidenceFinishReason,
+			payload:  &Payload{FinishReason: "content_filter"},
+			expected: 0.25,
+		},
+		{
+			name:     "reasoning empty chain",
+			strategy: ConfidenceReasoning,
+			payload:  &Payload{FinalContent: "answer"},
+			expected: 0.2,
+		},
+		{
+			name:     "reasoning partial chain",
+			strategy: ConfidenceReasoning,
+			payload:  &Payload{ReasoningChain: []string{"a", " ", "b"}, FinalContent: "answer"},
+			expected: 0.7,
+		},
+		{
+			name:     "reasoning saturated chain",
+			strategy: ConfidenceReasoning,
+			payload:  &Payload{ReasoningChain: []string{"a", "b", "c", "d", "e", "f"}, FinalContent: "answer"},
+			expected: 1.0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scorer, err := NewConfidenceScorer(tc.strategy, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.strategy, scorer.Name())
+
+			score, err := scorer.Score(context.Background(), tc.payload)
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.expected, score, 1e-9)
+		})
+	}
+}
+
+func TestConfidenceScorer_Judge(t *testing.T) {
+	testCases := []struct {
+		name      string
+		reply     string
+		expected  float64
+		expectErr string
+	}{
+		{name: "valid score", reply: " 0.8\n", expected: 0.8},
+		{name: "clamped score", reply: "1.7", expected: 1.0},
+		{name: "unparseable score", reply: "very confident", expectErr: "parse judge score"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bridge := &modelbridge.ModelBridge{
+				NormalClient: staticNormalClient(tc.reply),
+				Logger:       logger.GetLogger().WithComponent("test_bridge"),
+			}
+			scorer, err := NewConfidenceScorer(ConfidenceJudge, bridge)
+			require.NoError(t, err)
+
+			score, err := scorer.Score(context.Background(), &Payload{
+				OriginalRequest: &models.ChatCompletionRequest{
+					Messages: []models.ChatCompletionMessage{{Role: "user", Content: "question"}},
+				},
+				FinalContent: "answer",
+			})
+			if tc.expectErr != "" {
+				assert.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.expected, score, 1e-9)
+		})
+	}
+}
+
+func TestNewConfidenceScorer_Unknown(t *testing.T) {
+	_, err := NewConfidenceScorer("coin_flip", nil)
+	assert.EqualError(t, err, `unknown confidence strategy "coin_flip"`)
+}
+
+func TestHybridPipeline_Confidence(t *testing.T) {
+	pipeline := newMockPipeline(staticNormalClient("test response"), staticReasonerClient("reasoned", "step 1"))
+	scorer, err := NewConfidenceScorer(ConfidenceFinishReason, nil)
+	require.NoError(t, err)
+	pipeline.SetConfidenceScorer(scorer)
+
+	// Not requested: the standard response body carries no metadata
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, resp.Metadata)
+
+	// Requested: the score is attached to the metadata
+	resp, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages:          []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+		IncludeConfidence: true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp.Metadata)
+	require.NotNil(t, resp.Metadata.Confidence)
+	assert.Equal(t, 1.0, *resp.Metadata.Confidence)
+}
+
+func TestNewHybridPipeline_ConfidenceFromConfig(t *testing.T) {
+	cfg := &config.PipelineConfig{
+		Confidence: &config.ConfidenceConfig{Strategy: ConfidenceReasoning},
+		Prompts:    testPrompts,
+	}
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, pipeline.confidence)
+	assert.Equal(t, ConfidenceReasoning, pipeline.confidence.Name())
+}
@@ -0,0 +1,37 @@
+package orchestrator
+
+import (
+	"context"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tokens"
+)
+
+// buildStageRequest renders the model request of a stage and checks it
+// against the token budget of the run and the context window of the stage
+// model. A prompt estimated not to fit the window is logged. When the run
+// rejects such prompts, it fails the stage once the estimate is past the
+// window by more than the estimate's margin of error.
+func buildStageRequest(ctx context.Context, log *logger.Logger, builder requestBuilder, cfg *config.ModelConfig, data *Payload) (*models.ChatCompletionRequest, error) {
+	req, err := builder.buildRequest(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStageBudget(log, cfg, req, data); err != nil {
+		return nil, err
+	}
+	if cfg.ContextWindow <= 0 {
+		return req, nil
+	}
+	estimate := tokens.EstimateRequest(req)
+	if estimate <= cfg.ContextWindow {
+		return req, nil
+	}
+	if data.RejectOverContext && float64(estimate) > float64(cfg.ContextWindow)*(1+tokens.Margin) {
+		return nil, &contextWindowError{model: req.Model, estimate: estimate, window: cfg.ContextWindow}
+	}
+	log.Warn("Prompt of about %d tokens exceeds the %d token context window of %s", estimate, cfg.ContextWindow, req.Model)
+	return req, nil
+}
@@ -0,0 +1,69 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// flightGroup coalesces concurrent runs of identical requests so that only
+// the first one executes and the others wait for its result
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a run shared by the requests with the same key
+type flight struct {
+	done    chan struct{}
+	resp    *models.ChatCompletionResponse
+	err     error
+	waiters int
+}
+
+// do runs fn unless a run for key is already in flight, in which case it
+// waits for that run instead. shared reports whether the result came from
+// another caller's run; shared responses are copies the caller may modify.
+// A waiter whose ctx is still live runs fn itself when the shared run was
+// cancelled by its own caller.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (*models.ChatCompletionResponse, error)) (resp *models.ChatCompletionResponse, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	if f, ok := g.calls[key]; ok {
+		f.waiters++
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+		if f.err == nil {
+			return cloneResponse(f.resp), nil, true
+		}
+		if !errors.Is(f.err, context.Canceled) || ctx.Err() != nil {
+			return nil, f.err, true
+		}
+		resp, err = fn()
+		return resp, err, false
+	}
+	f := &flight{done: make(chan struct{})}
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	resp, err = fn()
+	// Waiters copy the response from a snapshot the caller cannot change
+	if err == nil {
+		f.resp = cloneResponse(resp)
+	}
+	f.err = err
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(f.done)
+	return resp, err, false
+}
@@ -0,0 +1,134 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingReasoner counts the reasoning runs and holds each one until
+// release is closed
+func blockingReasoner(runs *atomic.Int32, release <-chan struct{}) func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+	stream := staticReasonerClient("reasoned", "step").CompleteStreamFunc
+	return func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		runs.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return stream(ctx, req)
+	}
+}
+
+// waiters returns how many callers wait for the run in flight for key
+func (g *flightGroup) waiters(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.calls[key]; ok {
+		return f.waiters
+	}
+	return 0
+}
+
+func dedupRequest(id string) *models.ChatCompletionRequest {
+	return &models.ChatCompletionRequest{
+		RequestID: id,
+		Messages:  []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	}
+}
+
+// dedupKey returns the key Execute coalesces dedupRequest under, which
+// includes the request defaults of pipeline
+func dedupKey(t *testing.T, pipeline *HybridPipeline) string {
+	req := dedupRequest("")
+	pipeline.applyRequestDefaults(req)
+	key, err := cacheKey(req)
+	require.NoError(t, err)
+	return key
+}
+
+func TestHybridPipeline_CoalescesIdenticalRequests(t *testing.T) {
+	const requests = 8
+	var runs atomic.Int32
+	release := make(chan struct{})
+	reasonerClient := staticReasonerClient("reasoned")
+	reasonerClient.CompleteStreamFunc = blockingReasoner(&runs, release)
+	pipeline := newMockPipeline(staticNormalClient("shared answer"), reasonerClient)
+
+	key := dedupKey(t, pipeline)
+
+	responses := make([]*models.ChatCompletionResponse, requests)
+	errs := make([]error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = pipeline.Execute(context.Background(), dedupRequest(fmt.Sprintf("req-%d", i)))
+		}(i)
+	}
+	require.Eventually(t, func() bool { return pipeline.inflight.waiters(key) == requests-1 },
+		time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), runs.Load())
+	for i := 0; i < requests; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "shared answer", responses[i].Choices[0].Message.Content)
+		// Every caller gets its own copy identified as a response to its request
+		assert.Equal(t, fmt.Sprintf("chatcmpl-req-%d", i), responses[i].ID)
+	}
+	responses[0].Choices[0].Message.Content = "changed"
+	assert.Equal(t, "shared answer", responses[1].Choices[0].Message.Content)
+
+	// Once the run is over, the same request runs the pipeline again
+	_, err := pipeline.Execute(context.Background(), dedupRequest("req-again"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), runs.Load())
+}
+
+func TestHybridPipeline_CoalescedWaiterOutlivesCancelledRun(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	reasonerClient := staticReasonerClient("reasoned")
+	reasonerClient.CompleteStreamFunc = blockingReasoner(&runs, release)
+	pipeline := newMockPipeline(staticNormalClient("answer"), reasonerClient)
+
+	key := dedupKey(t, pipeline)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := pipeline.Execute(ctx, dedupRequest("req-leader"))
+		leaderErr <- err
+	}()
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+
+	waiter := make(chan *models.ChatCompletionResponse, 1)
+	go func() {
+		resp, err := pipeline.Execute(context.Background(), dedupRequest("req-waiter"))
+		assert.NoError(t, err)
+		waiter <- resp
+	}()
+	require.Eventually(t, func() bool { return pipeline.inflight.waiters(key) == 1 }, time.Second, time.Millisecond)
+
+	// The leader's caller goes away; the waiter runs the pipeline itself
+	cancel()
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+	require.Eventually(t, func() bool { return runs.Load() == 2 }, time.Second, time.Millisecond)
+	close(release)
+
+	resp := <-waiter
+	require.NotNil(t, resp)
+	assert.Equal(t, "chatcmpl-req-waiter", resp.ID)
+	assert.Equal(t, "answer", resp.Choices[0].Message.Content)
+}
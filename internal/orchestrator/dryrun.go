@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// requestBuilder is implemented by stages that can render their model
+// request without calling the model
+type requestBuilder interface {
+	buildRequest(ctx context.Context, data *Payload) (*models.ChatCompletionRequest, error)
+}
+
+// DryRun renders the model request of every stage of the full pipeline, or
+// of the single passthrough call, without calling any model. The output of a stage is not known in a dry
+// run, so later stages see a placeholder naming the stage it came from.
+// Stages that cannot render a request, such as custom registered ones, are
+// left out, and the stages of parallel groups are listed in group order.
+func (p *HybridPipeline) DryRun(ctx context.Context, req *models.ChatCompletionRequest) (*models.DryRunResponse, error) {
+	payload := p.newPayload(req)
+	ctx = logger.ContextWithRequestID(ctx, req.RequestID)
+
+	mode, err := p.mode(req)
+	if err != nil {
+		return nil, err
+	}
+	stages := p.stages
+	if mode == config.ModePassthrough {
+		stages = []PipelineStage{p.passthroughStage()}
+	}
+
+	resp := &models.DryRunResponse{Object: "pipeline.dry_run", Stages: []models.DryRunStage{}}
+	for _, stage := range flattenStages(stages) {
+		builder, ok := stage.(requestBuilder)
+		if !ok {
+			continue
+		}
+		stageReq, err := builder.buildRequest(ctx, payload)
+		if err != nil {
+			return nil, &StageError{Stage: stage.Name(), Err: err}
+		}
+		resp.Stages = append(resp.Stages, models.DryRunStage{
+			Stage:    stage.Name(),
+			Model:    stageReq.Model,
+			Messages: stageReq.Messages,
+		})
+
+		payload.SetIntermContent(fmt.Sprintf("<%s output>", stage.Name()))
+		if _, ok := stage.(*ReasonerEngine); ok {
+			payload.AppendReasoning(fmt.Sprintf("<%s reasoning>", stage.Name()))
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,101 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHybridPipeline_DryRun(t *testing.T) {
+	called := false
+	client := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			called = true
+			return nil, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			called = true
+			return nil, nil
+		},
+	}
+
+	pipeline, err := NewHybridPipeline(&config.PipelineConfig{
+		Models: config.ModelsConfig{
+			Normal:   config.ModelConfig{APIBase: "mock://normal", Model: "normal-model"},
+			Reasoner: config.ModelConfig{APIBase: "mock://reasoner", Model: "reasoner-model"},
+		},
+		Prompts: config.PromptsConfig{
+			PreProcess:  "Analyse: {{.UserInput}}",
+			Reasoning:   "Reason about: {{.StructuredInput}}",
+			PostProcess: "Summarise {{range .ReasoningChain}}[{{.}}]{{end}} given {{.IntermediateResult}}",
+		},
+	})
+	require.NoError(t, err)
+	pipeline.SetBridge(&modelbridge.ModelBridge{
+		NormalClient:   client,
+		ReasonerClient: client,
+		Logger:         logger.GetLogger().WithComponent("test_bridge"),
+	})
+	// Stages that cannot render a request are left out
+	require.NoError(t, pipeline.RegisterStage(1, retrievalStage{}))
+
+	resp, err := pipeline.DryRun(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "What is 2+2?"}},
+	})
+	require.NoError(t, err)
+	assert.False(t, called)
+
+	assert.Equal(t, &models.DryRunResponse{
+		Object: "pipeline.dry_run",
+		Stages: []models.DryRunStage{
+			{
+				Stage: "normal_preprocessor",
+				Model: "normal-model",
+				Messages: []models.ChatCompletionMessage{
+					{Role: "system", Content: "Analyse: What is 2+2?"},
+					{Role: "user", Content: "What is 2+2?"},
+				},
+			},
+			{
+				Stage: "reasoner_engine",
+				Model: "reasoner-model",
+				Messages: []models.ChatCompletionMessage{
+					{Role: "system", Content: "Reason about: <normal_preprocessor output>"},
+					{Role: "user", Content: "<normal_preprocessor output>"},
+				},
+			},
+			{
+				Stage: "normal_postprocessor",
+				Model: "normal-model",
+				Messages: []models.ChatCompletionMessage{
+					{Role: "system", Content: "Summarise [<reasoner_engine reasoning>] given <reasoner_engine output>"},
+					{Role: "user", Content: "<reasoner_engine output>"},
+				},
+			},
+		},
+	}, resp)
+}
+
+func TestHybridPipeline_DryRunPassthrough(t *testing.T) {
+	pipeline := newMockPipeline(&mocks.MockModelClient{}, &mocks.MockModelClient{})
+	messages := []models.ChatCompletionMessage{
+		{Role: "system", Content: "Be brief"},
+		{Role: "user", Content: "hello"},
+	}
+
+	resp, err := pipeline.DryRun(context.Background(), &models.ChatCompletionRequest{
+		Messages: messages,
+		Mode:     config.ModePassthrough,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.DryRunStage{
+		{Stage: "direct_responder", Model: "gpt-3.5-turbo", Messages: messages},
+	}, resp.Stages)
+}
@@ -0,0 +1,166 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrModelCall matches any error returned by a stage's model call
+var ErrModelCall = errors.New("model call failed")
+
+// ErrStageTimeout matches a stage that ran past the configured stage timeout
+var ErrStageTimeout = errors.New("stage timed out")
+
+// ErrDeadlineExceeded matches a run cut off by max_total_latency. It does not
+// match ErrStageTimeout.
+var ErrDeadlineExceeded = errors.New("pipeline deadline exceeded")
+
+// ErrUnknownMode is returned for a request or config naming an unknown pipeline mode
+var ErrUnknownMode = errors.New("unknown pipeline mode")
+
+// ErrNoMessages is returned by stages that need the user input when the
+// request carries no messages
+var ErrNoMessages = errors.New("request has no messages")
+
+// ErrBudgetExceeded matches a run that used, or was about to use, more tokens
+// than its budget
+var ErrBudgetExceeded = errors.New("token budget exceeded")
+
+// ErrInvalidJSON matches a final answer that is not valid JSON although the
+// request asked for JSON output
+var ErrInvalidJSON = errors.New("answer is not valid JSON")
+
+// ErrContextWindowExceeded matches a stage prompt estimated to be longer than
+// the context window of its model
+var ErrContextWindowExceeded = errors.New("prompt exceeds the model context window")
+
+// ErrReasoningMissing matches a reasoning stage that produced no reasoning
+// steps although require_reasoning is set
+var ErrReasoningMissing = errors.New("reasoner returned no reasoning")
+
+// ErrContentBlocked matches a final answer the safety stage refused to return
+var ErrContentBlocked = errors.New("content blocked")
+
+// ErrMissingPrompt matches a pipeline created without one of the stage
+// prompts it needs, e.g. because its file is missing from the prompts
+// directory
+var ErrMissingPrompt = errors.New("stage prompt is empty")
+
+// StageError reports the pipeline stage that failed together with the cause
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s failed: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// modelCallError marks an error as coming from a model call
+type modelCallError struct {
+	err error
+}
+
+func (e *modelCallError) Error() string {
+	return "model call: " + e.err.Error()
+}
+
+func (e *modelCallError) Unwrap() error {
+	return e.err
+}
+
+func (e *modelCallError) Is(target error) bool {
+	return target == ErrModelCall
+}
+
+// budgetError reports the tokens a run used against its budget. next is set
+// when the check ran before a model call and holds the tokens that call may
+// use.
+type budgetError struct {
+	used   int
+	next   int
+	budget int
+}
+
+func (e *budgetError) Error() string {
+	if e.next > 0 {
+		return fmt.Sprintf("%v: a call of about %d tokens on top of %d used would pass the budget of %d", ErrBudgetExceeded, e.next, e.used, e.budget)
+	}
+	return fmt.Sprintf("%v: used %d of %d tokens", ErrBudgetExceeded, e.used, e.budget)
+}
+
+func (e *budgetError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// contextWindowError reports the estimated prompt tokens of a stage against
+// the context window of its model
+type contextWindowError struct {
+	model    string
+	estimate int
+	window   int
+}
+
+func (e *contextWindowError) Error() string {
+	return fmt.Sprintf("%v: about %d tokens for %s, which accepts %d", ErrContextWindowExceeded, e.estimate, e.model, e.window)
+}
+
+func (e *contextWindowError) Is(target error) bool {
+	return target == ErrContextWindowExceeded
+}
+
+// contentBlockedError gives the reason the safety stage blocked an answer
+type contentBlockedError struct {
+	reason string
+}
+
+func (e *contentBlockedError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrContentBlocked, e.reason)
+}
+
+func (e *contentBlockedError) Is(target error) bool {
+	return target == ErrContentBlocked
+}
+
+// stageTimeoutError marks a stage failure caused by the stage timeout
+type stageTimeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *stageTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s: %v", e.timeout, e.err)
+}
+
+func (e *stageTimeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e *stageTimeoutError) Is(target error) bool {
+	return target == ErrStageTimeout || target == context.DeadlineExceeded
+}
+
+// deadlineError reports how long a run took before max_total_latency cut it off
+type deadlineError struct {
+	limit   time.Duration
+	elapsed time.Duration
+	err     error
+}
+
+func (e *deadlineError) Error() string {
+	return fmt.Sprintf("%v: stopped after %s, limit %s: %v", ErrDeadlineExceeded, e.elapsed.Round(time.Millisecond), e.limit, e.err)
+}
+
+func (e *deadlineError) Unwrap() error {
+	return e.err
+}
+
+func (e *deadlineError) Is(target error) bool {
+	return target == ErrDeadlineExceeded
+}
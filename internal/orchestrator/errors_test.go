@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute_TypedErrors(t *testing.T) {
+	normalErr := errors.New("normal client error")
+
+	testCases := []struct {
+		name        string
+		normal      *mocks.MockModelClient
+		reasoner    *mocks.MockModelClient
+		expectStage string
+		expectIs    error
+	}{
+		{
+			name: "no choices from preprocessor",
+			normal: &mocks.MockModelClient{
+				CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+					return &models.ChatCompletionResponse{}, nil
+				},
+			},
+			reasoner:    &mocks.MockModelClient{},
+			expectStage: "normal_preprocessor",
+			expectIs:    clients.ErrNoChoices,
+		},
+		{
+			name: "upstream error from preprocessor",
+			normal: &mocks.MockModelClient{
+				CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+					return nil, fmt.Errorf("create chat completion: %w", normalErr)
+				},
+			},
+			reasoner:    &mocks.MockModelClient{},
+			expectStage: "normal_preprocessor",
+			expectIs:    normalErr,
+		},
+		{
+			name:        "reasoner stream closed without output",
+			normal:      staticNormalClient("preprocessed"),
+			reasoner:    &mocks.MockModelClient{},
+			expectStage: "reasoner_engine",
+			expectIs:    clients.ErrStreamClosed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline := newMockPipeline(tc.normal, tc.reasoner)
+
+			_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{
+					{Role: "user", Content: "test input"},
+				},
+			})
+			require.Error(t, err)
+
+			var stageErr *StageError
+			require.True(t, errors.As(err, &stageErr))
+			assert.Equal(t, tc.expectStage, stageErr.Stage)
+			assert.ErrorIs(t, err, ErrModelCall)
+			assert.ErrorIs(t, err, tc.expectIs)
+		})
+	}
+}
+
+func TestStageError_Message(t *testing.T) {
+	err := &StageError{Stage: "reasoner_engine", Err: &modelCallError{err: errors.New("boom")}}
+	assert.EqualError(t, err, "stage reasoner_engine failed: model call: boom")
+}
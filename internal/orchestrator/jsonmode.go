@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// jsonRetryPrompt asks the model to repeat an answer that did not parse as JSON
+const jsonRetryPrompt = "Your previous reply was not valid JSON. Reply again with only the JSON, without any other text."
+
+// callAnswer makes the Normal model call for the final answer and records it
+// in data. When the request asks for several choices the model is asked for
+// all of them at once, and once more for those a provider ignoring n did not
+// return. When the request asks for JSON and an answer does not parse, the
+// model is asked once more before failing with ErrInvalidJSON.
+func callAnswer(ctx context.Context, bridge *modelbridge.ModelBridge, log *logger.Logger, req *models.ChatCompletionRequest, data *Payload) error {
+	n := max(data.OriginalRequest.N, 1)
+	choices := make([]models.ChatCompletionChoice, 0, n)
+	for len(choices) < n {
+		call := req
+		if n > 1 {
+			next := *req
+			next.N = n - len(choices)
+			call = &next
+		}
+		resp, err := bridge.CallNormal(ctx, call)
+		if err != nil {
+			log.WithError(err).Error("Failed to call Normal model")
+			return &modelCallError{err: err}
+		}
+		data.AddUsage(resp.Usage)
+		for _, choice := range resp.Choices {
+			if len(choices) == n {
+				break
+			}
+			choice, err := jsonAnswer(ctx, bridge, log, req, data, choice)
+			if err != nil {
+				return err
+			}
+			choice.Index = len(choices)
+			choices = append(choices, choice)
+		}
+	}
+
+	data.SetFinalContent(choices[0].Message.Content)
+	data.SetToolCalls(choices[0].Message.ToolCalls)
+	data.SetFinishReason(choices[0].FinishReason)
+	data.SetLogProbs(choices[0].LogProbs)
+	data.SetAlternatives(choices[1:])
+	return nil
+}
+
+// jsonAnswer returns choice unless the request asks for JSON and its answer
+// does not parse, in which case the model is asked once more. A tool call
+// stands in for the answer, so there is no JSON to check.
+func jsonAnswer(ctx context.Context, bridge *modelbridge.ModelBridge, log *logger.Logger, req *models.ChatCompletionRequest, data *Payload, choice models.ChatCompletionChoice) (models.ChatCompletionChoice, error) {
+	if !req.ResponseFormat.WantsJSON() || len(choice.Message.ToolCalls) > 0 || validJSONAnswer(data, choice.Message.Content) {
+		return choice, nil
+	}
+	log.Warn("Answer is not valid JSON, asking the Normal model again")
+	resp, err := bridge.CallNormal(ctx, jsonRetryRequest(req, data, choice.Message.Content))
+	if err != nil {
+		log.WithError(err).Error("Failed to call Normal model")
+		return choice, &modelCallError{err: err}
+	}
+	data.AddUsage(resp.Usage)
+	if !validJSONAnswer(data, resp.Choices[0].Message.Content) {
+		return choice, ErrInvalidJSON
+	}
+	return resp.Choices[0], nil
+}
+
+// validJSONAnswer reports whether the answer, continuing any assistant
+// prefill, parses as JSON
+func validJSONAnswer(data *Payload, answer string) bool {
+	prefill, _ := data.OriginalRequest.Prefill()
+	return json.Valid([]byte(prefill + answer))
+}
+
+// jsonRetryRequest extends req with the invalid answer and a request to
+// repeat it as JSON. An assistant prefill is moved after the new messages so
+// the retried answer continues it again.
+func jsonRetryRequest(req *models.ChatCompletionRequest, data *Payload, answer string) *models.ChatCompletionRequest {
+	messages := req.Messages
+	prefill, ok := data.OriginalRequest.Prefill()
+	if ok {
+		messages = messages[:len(messages)-1]
+	}
+	next := *req
+	next.Messages = append(append([]models.ChatCompletionMessage(nil), messages...),
+		models.ChatCompletionMessage{Role: models.RoleAssistant, Content: prefill + answer},
+		models.ChatCompletionMessage{Role: models.RoleUser, Content: jsonRetryPrompt},
+	)
+	if ok {
+		next.Messages = append(next.Messages, models.ChatCompletionMessage{Role: models.RoleAssistant, Content: prefill})
+	}
+	return &next
+}
+
+// streamAnswer runs a final answer stage buffered and sends each answer as a
+// single chunk. JSON answers are streamed this way so they can be checked
+// before the client sees them, and several choices so they do not interleave.
+func streamAnswer(ctx context.Context, stage PipelineStage, data *Payload, out chan<- *models.ChatCompletionResponse) error {
+	if err := stage.Execute(ctx, data); err != nil {
+		return err
+	}
+	for _, chunk := range answerChunks(data) {
+		select {
+		case out <- chunk:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		data.AddStreamedBytes(len(chunk.Choices[0].Message.Content))
+	}
+	return nil
+}
+
+// answerChunks returns the recorded answer, and any further choices, as one
+// stream chunk each
+func answerChunks(data *Payload) []*models.ChatCompletionResponse {
+	_, finishReason := data.FinishReasons()
+	chunk := streamChunk(data.Final(), finishReason)
+	chunk.Choices[0].Message.ToolCalls = data.Calls()
+	chunk.Choices[0].LogProbs = data.FinalLogProbs()
+	chunks := []*models.ChatCompletionResponse{chunk}
+	for _, choice := range data.AlternativeChoices() {
+		chunk := streamChunk(choice.Message.Content, choice.FinishReason)
+		chunk.Choices[0].Index = choice.Index
+		chunk.Choices[0].Message.ToolCalls = choice.Message.ToolCalls
+		chunk.Choices[0].LogProbs = choice.LogProbs
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
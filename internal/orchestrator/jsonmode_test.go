@@ -0,0 +1,158 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedAnswers answers the Normal model calls with answers in turn and
+// records the requests it received
+func scriptedAnswers(requests *[]*models.ChatCompletionRequest, answers ...string) *mocks.MockModelClient {
+	return &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			answer := answers[len(*requests)]
+			*requests = append(*requests, req)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: answer}, FinishReason: "stop"},
+				},
+				Usage: &models.Usage{TotalTokens: 10},
+			}, nil
+		},
+	}
+}
+
+func TestNormalPostprocessor_JSONOutput(t *testing.T) {
+	jsonFormat := &models.ResponseFormat{Type: models.ResponseFormatJSONObject}
+	tests := []struct {
+		name     string
+		format   *models.ResponseFormat
+		prefill  string
+		answers  []string
+		final    string
+		calls    int
+		expected error
+	}{
+		{
+			name:    "valid json",
+			format:  jsonFormat,
+			answers: []string{`{"city":"Paris"}`},
+			final:   `{"city":"Paris"}`,
+			calls:   1,
+		},
+		{
+			name:    "retried once",
+			format:  jsonFormat,
+			answers: []string{"Sure! The city is Paris.", `{"city":"Paris"}`},
+			final:   `{"city":"Paris"}`,
+			calls:   2,
+		},
+		{
+			name:     "invalid after retry",
+			format:   jsonFormat,
+			answers:  []string{"Paris", "Still Paris"},
+			calls:    2,
+			expected: ErrInvalidJSON,
+		},
+		{
+			name:    "answer continues the prefill",
+			format:  jsonFormat,
+			prefill: `{"city":`,
+			answers: []string{`"Paris"}`},
+			final:   `"Paris"}`,
+			calls:   1,
+		},
+		{
+			name:    "not checked without json format",
+			answers: []string{"Paris"},
+			final:   "Paris",
+			calls:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []*models.ChatCompletionRequest
+			bridge := modelbridge.NewModelBridgeWithClients(scriptedAnswers(&requests, tt.answers...), nil, nil)
+			processor, err := newNormalPostprocessor("Answer", bridge)
+			require.NoError(t, err)
+
+			messages := []models.ChatCompletionMessage{{Role: "user", Content: "Where is the Louvre?"}}
+			if tt.prefill != "" {
+				messages = append(messages, models.ChatCompletionMessage{Role: "assistant", Content: tt.prefill})
+			}
+			payload := &Payload{
+				OriginalRequest: &models.ChatCompletionRequest{Messages: messages, ResponseFormat: tt.format},
+				IntermContent:   "reasoned",
+			}
+
+			err = processor.Execute(context.Background(), payload)
+			require.Len(t, requests, tt.calls)
+			assert.Equal(t, tt.format, requests[0].ResponseFormat)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.final, payload.Final())
+			assert.Equal(t, 10*tt.calls, payload.TotalUsage().TotalTokens)
+
+			if tt.calls > 1 {
+				retry := requests[1].Messages
+				require.Len(t, retry, len(requests[0].Messages)+2)
+				assert.Equal(t, models.ChatCompletionMessage{Role: "assistant", Content: tt.answers[0]}, retry[len(retry)-2])
+				assert.Equal(t, models.ChatCompletionMessage{Role: "user", Content: jsonRetryPrompt}, retry[len(retry)-1])
+			}
+		})
+	}
+}
+
+func TestJSONRetryRequest_KeepsPrefillLast(t *testing.T) {
+	data := &Payload{OriginalRequest: &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{
+		{Role: "user", Content: "Where is the Louvre?"},
+		{Role: "assistant", Content: `{"city":`},
+	}}}
+	req := &models.ChatCompletionRequest{Messages: data.OriginalRequest.Messages}
+
+	retry := jsonRetryRequest(req, data, ` Paris`)
+	assert.Equal(t, []models.ChatCompletionMessage{
+		{Role: "user", Content: "Where is the Louvre?"},
+		{Role: "assistant", Content: `{"city": Paris`},
+		{Role: "user", Content: jsonRetryPrompt},
+		{Role: "assistant", Content: `{"city":`},
+	}, retry.Messages)
+	assert.Len(t, req.Messages, 2, "the original request is not modified")
+}
+
+func TestDirectResponder_JSONOutputStream(t *testing.T) {
+	var requests []*models.ChatCompletionRequest
+	normalClient := scriptedAnswers(&requests, "Paris", `{"city":"Paris"}`)
+	normalClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		t.Fatal("json answers must not be streamed unchecked")
+		return nil, nil
+	}
+	responder := newDirectResponder(modelbridge.NewModelBridgeWithClients(normalClient, nil, nil))
+
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+		Messages:       []models.ChatCompletionMessage{{Role: "user", Content: "Where is the Louvre?"}},
+		ResponseFormat: &models.ResponseFormat{Type: models.ResponseFormatJSONObject},
+	}}
+	out := make(chan *models.ChatCompletionResponse, 2)
+	require.NoError(t, responder.ExecuteStream(context.Background(), payload, out))
+	close(out)
+
+	var chunks []*models.ChatCompletionResponse
+	for chunk := range out {
+		chunks = append(chunks, chunk)
+	}
+	require.Len(t, chunks, 1)
+	assert.Equal(t, `{"city":"Paris"}`, chunks[0].Choices[0].Message.Content)
+	assert.Equal(t, "stop", chunks[0].Choices[0].FinishReason)
+	assert.Len(t, requests, 2)
+}
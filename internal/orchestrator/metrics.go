@@ -0,0 +1,65 @@
+package orchestrator
+
+import (
+	"github.com/sleepstars/deepempower/internal/metrics"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// Metrics recorded for every pipeline run. Both carry the allowlisted
+// metadata labels after their own label.
+const (
+	metricRequests = "deepempower_requests_total"
+	metricTokens   = "deepempower_tokens_total"
+)
+
+// maxMetadataLabelValues bounds the distinct values of each metadata label.
+// Metadata comes from callers, so later values are counted as "other"
+// rather than growing the metrics without limit.
+const maxMetadataLabelValues = 100
+
+// Metrics returns the registry the pipeline records its metrics in
+func (p *HybridPipeline) Metrics() *metrics.Registry {
+	return p.metrics
+}
+
+// SetMetrics makes the pipeline record its metrics in r instead of its own
+// registry, so counters outlive the pipeline when a reload replaces it. It
+// must be called before the pipeline handles requests.
+func (p *HybridPipeline) SetMetrics(r *metrics.Registry) {
+	p.metrics = r
+	p.limitMetadataLabels()
+}
+
+// limitMetadataLabels bounds the values of the metadata labels in the
+// pipeline's registry
+func (p *HybridPipeline) limitMetadataLabels() {
+	for _, label := range p.metadataLabels {
+		p.metrics.LimitValues(label, maxMetadataLabelValues)
+	}
+}
+
+// recordMetrics counts a finished request and the tokens it used, labelled
+// with the metadata keys allowlisted in metadata_labels. Requests answered
+// without a run, such as cache hits, pass a nil payload and count no tokens.
+func (p *HybridPipeline) recordMetrics(req *models.ChatCompletionRequest, payload *Payload, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	labels := make([]string, len(p.metadataLabels))
+	for i, name := range p.metadataLabels {
+		labels[i] = req.Metadata[name]
+	}
+
+	p.metrics.Counter(metricRequests, "Chat completion requests handled by the pipeline",
+		append([]string{"outcome"}, p.metadataLabels...)...,
+	).Inc(append([]string{outcome}, labels...)...)
+	if payload == nil {
+		return
+	}
+	usage := payload.TotalUsage()
+	tokens := p.metrics.Counter(metricTokens, "Tokens used by the models of the pipeline",
+		append([]string{"type"}, p.metadataLabels...)...)
+	tokens.Add(float64(usage.PromptTokens), append([]string{"prompt"}, labels...)...)
+	tokens.Add(float64(usage.CompletionTokens), append([]string{"completion"}, labels...)...)
+}
@@ -0,0 +1,43 @@
+package orchestrator
+
+import (
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+)
+
+// Answers of unscripted models in mock mode, matching cmd/mockserver
+var (
+	defaultMockNormal   = mocks.ScriptedResponse{Content: "This is a response from the Normal model"}
+	defaultMockReasoner = mocks.ScriptedResponse{
+		Content:   "This is a response from the Reasoner model with reasoning steps",
+		Reasoning: []string{"This is a reasoning step from the Reasoner model"},
+	}
+)
+
+// newMockBridge creates a bridge whose clients replay the scripts in cfg
+func newMockBridge(cfg *config.MockConfig) *modelbridge.ModelBridge {
+	logger.GetLogger().WithComponent("pipeline").Warn("Mock mode enabled, models will not be called")
+	return modelbridge.NewModelBridgeWithClients(
+		mocks.NewScriptedModelClient(mockScript(cfg.Normal, defaultMockNormal)...),
+		mocks.NewScriptedModelClient(mockScript(cfg.Reasoner, defaultMockReasoner)...),
+		nil,
+	)
+}
+
+// mockScript converts configured answers, using fallback when there are none
+func mockScript(responses []config.MockResponse, fallback mocks.ScriptedResponse) []mocks.ScriptedResponse {
+	if len(responses) == 0 {
+		return []mocks.ScriptedResponse{fallback}
+	}
+	script := make([]mocks.ScriptedResponse, len(responses))
+	for i, resp := range responses {
+		script[i] = mocks.ScriptedResponse{
+			Content:      resp.Content,
+			Reasoning:    resp.Reasoning,
+			FinishReason: resp.FinishReason,
+		}
+	}
+	return script
+}
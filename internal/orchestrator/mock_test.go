@@ -0,0 +1,156 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockModeConfig(mock *config.MockConfig) *config.PipelineConfig {
+	return &config.PipelineConfig{
+		Models: config.ModelsConfig{
+			Normal:   config.ModelConfig{APIBase: "http://normal.invalid", Model: "normal-model"},
+			Reasoner: config.ModelConfig{APIBase: "http://reasoner.invalid", Model: "reasoner-model"},
+		},
+		Prompts: config.PromptsConfig{
+			PreProcess:  "Analyse: {{.UserInput}}",
+			Reasoning:   "Reason about: {{.StructuredInput}}",
+			PostProcess: "Summarise: {{.IntermediateResult}}",
+		},
+		IncludeReasoning: true,
+		Mock:             mock,
+	}
+}
+
+func TestHybridPipeline_ScriptedClients(t *testing.T) {
+	normal := mocks.NewScriptedModelClient(
+		mocks.ScriptedResponse{Content: "structured question"},
+		mocks.ScriptedResponse{Content: "The answer is 4."},
+	)
+	reasoner := mocks.NewScriptedModelClient(
+		mocks.ScriptedResponse{Content: "4", Reasoning: []string{"2+2", "equals 4"}},
+	)
+
+	pipeline, err := NewHybridPipeline(mockModeConfig(nil))
+	require.NoError(t, err)
+	pipeline.SetBridge(&modelbridge.ModelBridge{
+		NormalClient:   normal,
+		ReasonerClient: reasoner,
+		Logger:         logger.GetLogger().WithComponent("test_bridge"),
+	})
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "What is 2+2?"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "The answer is 4.", resp.Choices[0].Message.Content)
+	assert.Equal(t, []string{"2+2", "equals 4"}, resp.Choices[0].Message.ReasoningContent)
+
+	// Each stage received the output of the one before it
+	normalReqs := normal.Requests()
+	require.Len(t, normalReqs, 2)
+	assert.Equal(t, "Analyse: What is 2+2?", normalReqs[0].Messages[0].Content)
+	assert.Equal(t, "Summarise: 4", normalReqs[1].Messages[0].Content)
+	require.Equal(t, 1, reasoner.Calls())
+	assert.Equal(t, "Reason about: structured question", reasoner.Requests()[0].Messages[0].Content)
+}
+
+func TestHybridPipeline_ScriptedClientError(t *testing.T) {
+	errScripted := errors.New("scripted failure")
+	pipeline, err := NewHybridPipeline(mockModeConfig(nil))
+	require.NoError(t, err)
+	pipeline.SetBridge(&modelbridge.ModelBridge{
+		NormalClient:   mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "structured"}),
+		ReasonerClient: mocks.NewScriptedModelClient(mocks.ScriptedResponse{Err: errScripted}),
+		Logger:         logger.GetLogger().WithComponent("test_bridge"),
+	})
+
+	_, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	assert.ErrorIs(t, err, errScripted)
+}
+
+func TestNewHybridPipeline_MockMode(t *testing.T) {
+	tests := []struct {
+		name              string
+		mock              *config.MockConfig
+		expectedContent   string
+		expectedReasoning []string
+	}{
+		{
+			name: "scripted",
+			mock: &config.MockConfig{
+				Normal: []config.MockResponse{
+					{Content: "structured question"},
+					{Content: "final answer"},
+				},
+				Reasoner: []config.MockResponse{
+					{Content: "conclusion", Reasoning: []string{"step 1", "step 2"}},
+				},
+			},
+			expectedContent:   "final answer",
+			expectedReasoning: []string{"step 1", "step 2"},
+		},
+		{
+			name:              "defaults",
+			mock:              &config.MockConfig{},
+			expectedContent:   "This is a response from the Normal model",
+			expectedReasoning: []string{"This is a reasoning step from the Reasoner model"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHybridPipeline(mockModeConfig(tc.mock))
+			require.NoError(t, err)
+
+			req := &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+			}
+			resp, err := pipeline.Execute(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedContent, resp.Choices[0].Message.Content)
+			assert.Equal(t, tc.expectedReasoning, resp.Choices[0].Message.ReasoningContent)
+
+			stream, err := pipeline.ExecuteStream(context.Background(), req)
+			require.NoError(t, err)
+			var content string
+			for chunk := range stream {
+				content += chunk.Choices[0].Message.Content
+			}
+			assert.Equal(t, tc.expectedContent, content)
+		})
+	}
+}
+
+func TestNewHybridPipeline_MockModeNamedStageModel(t *testing.T) {
+	cfg := mockModeConfig(&config.MockConfig{
+		Normal: []config.MockResponse{{Content: "mocked"}},
+	})
+	cfg.Models.Named = map[string]config.ModelConfig{
+		"Cheap": {APIBase: "http://cheap.invalid", Model: "cheap-model"},
+	}
+	cfg.Stages.PostProcess = "Cheap"
+
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "mocked", resp.Choices[0].Message.Content)
+
+	normal := pipeline.bridge.NormalClient.(*mocks.ScriptedModelClient)
+	require.Equal(t, 2, normal.Calls())
+	assert.Equal(t, "cheap-model", normal.Requests()[1].Model)
+}
@@ -0,0 +1,117 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sleepstars/deepempower/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ParallelGroup is a pipeline stage made of independent stages that run
+// concurrently. The pipeline moves on to the next stage once all of them have
+// finished. The stages share the payload, so they must only touch it through
+// its accessor methods.
+type ParallelGroup struct {
+	name   string
+	stages []PipelineStage
+	// MaxConcurrent caps the stages running at once; zero runs them all together
+	MaxConcurrent int
+}
+
+// NewParallelGroup creates a group running stages concurrently
+func NewParallelGroup(name string, stages ...PipelineStage) *ParallelGroup {
+	return &ParallelGroup{name: name, stages: stages}
+}
+
+func (g *ParallelGroup) Name() string {
+	return g.name
+}
+
+// Stages returns the stages of the group
+func (g *ParallelGroup) Stages() []PipelineStage {
+	return append([]PipelineStage(nil), g.stages...)
+}
+
+// Execute runs the stages of the group concurrently. Inside a pipeline every
+// stage instead runs with the pipeline's hooks, retries and timeouts.
+func (g *ParallelGroup) Execute(ctx context.Context, data *Payload) error {
+	return g.run(ctx, func(ctx context.Context, stage PipelineStage) error {
+		if err := stage.Execute(ctx, data); err != nil {
+			return &StageError{Stage: stage.Name(), Err: err}
+		}
+		return nil
+	})
+}
+
+// run calls fn for every stage of the group, at most MaxConcurrent at a time.
+// The first failure cancels the stages still running and is returned once
+// all of them have stopped.
+func (g *ParallelGroup) run(ctx context.Context, fn func(ctx context.Context, stage PipelineStage) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := len(g.stages)
+	if g.MaxConcurrent > 0 && g.MaxConcurrent < limit {
+		limit = g.MaxConcurrent
+	}
+	slots := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for _, stage := range g.stages {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(stage PipelineStage) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := fn(ctx, stage); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(stage)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		// Cancelled from outside before every stage started
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// runGroup runs the stages of a group concurrently, each between the stage
+// hooks and with the retry policy like any sequential stage
+func (p *HybridPipeline) runGroup(ctx context.Context, group *ParallelGroup, payload *Payload) error {
+	ctx, span := tracing.Start(ctx, "pipeline.group", attribute.String("stage.name", group.Name()))
+	defer span.End()
+
+	p.Logger.WithContext(ctx).Debug("Running %d stages of group %s in parallel", len(group.stages), group.Name())
+	err := group.run(ctx, func(ctx context.Context, stage PipelineStage) error {
+		return p.runStage(ctx, stage, payload)
+	})
+	tracing.RecordError(span, err)
+	return err
+}
+
+// flattenStages replaces every parallel group with its stages
+func flattenStages(stages []PipelineStage) []PipelineStage {
+	flat := make([]PipelineStage, 0, len(stages))
+	for _, stage := range stages {
+		if group, ok := stage.(*ParallelGroup); ok {
+			flat = append(flat, flattenStages(group.stages)...)
+			continue
+		}
+		flat = append(flat, stage)
+	}
+	return flat
+}
@@ -0,0 +1,180 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcStage is a custom stage running fn
+type funcStage struct {
+	name string
+	fn   func(ctx context.Context, data *Payload) error
+}
+
+func (s funcStage) Name() string {
+	return s.name
+}
+
+func (s funcStage) Execute(ctx context.Context, data *Payload) error {
+	return s.fn(ctx, data)
+}
+
+// rendezvousStage stores result once every stage sharing started has begun,
+// so it only succeeds when those stages run concurrently
+func rendezvousStage(name, result string, started *sync.WaitGroup) funcStage {
+	return funcStage{name: name, fn: func(ctx context.Context, data *Payload) error {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			return fmt.Errorf("%s: other stages did not run concurrently", name)
+		}
+		data.SetValue(name, result)
+		return nil
+	}}
+}
+
+func TestHybridPipeline_ParallelGroup(t *testing.T) {
+	var reasonerInput string
+	reasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			reasonerInput = req.Messages[len(req.Messages)-1].Content
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "reasoned", ReasoningContent: []string{"step"}}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+	pipeline := newMockPipeline(staticNormalClient("preprocessed"), reasonerClient)
+
+	var started sync.WaitGroup
+	started.Add(2)
+	group := NewParallelGroup("prepare",
+		rendezvousStage("retrieval", "retrieved context", &started),
+		rendezvousStage("classification", "topic: autumn", &started),
+	)
+	// The joining stage consumes the results of both parallel stages
+	join := funcStage{name: "join", fn: func(ctx context.Context, data *Payload) error {
+		retrieved, _ := data.Value("retrieval")
+		topic, _ := data.Value("classification")
+		data.SetIntermContent(fmt.Sprintf("%s\n%s\n%s", data.Interm(), retrieved, topic))
+		return nil
+	}}
+	require.NoError(t, pipeline.RegisterStage(1, group))
+	require.NoError(t, pipeline.RegisterStage(2, join))
+
+	var mu sync.Mutex
+	var ended []string
+	pipeline.OnStageEnd(func(stage string, payload *Payload, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ended = append(ended, stage)
+	})
+
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "preprocessed\nretrieved context\ntopic: autumn", reasonerInput)
+
+	// Every stage of the group runs between the hooks, before the join
+	require.Len(t, ended, 6)
+	assert.ElementsMatch(t, []string{"retrieval", "classification"}, ended[1:3])
+	assert.Equal(t, []string{"normal_preprocessor", "join", "reasoner_engine", "normal_postprocessor"},
+		[]string{ended[0], ended[3], ended[4], ended[5]})
+}
+
+func TestParallelGroup_FailureCancelsOthers(t *testing.T) {
+	errRetrieval := errors.New("retrieval failed")
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	group := NewParallelGroup("prepare",
+		// Fails once the other stage is running
+		funcStage{name: "retrieval", fn: func(ctx context.Context, data *Payload) error {
+			<-started
+			return errRetrieval
+		}},
+		funcStage{name: "classification", fn: func(ctx context.Context, data *Payload) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+				close(cancelled)
+				return ctx.Err()
+			case <-time.After(2 * time.Second):
+				return nil
+			}
+		}},
+	)
+
+	pipeline := newMockPipeline(staticNormalClient("test"), staticReasonerClient("test"))
+	pipeline.stages = []PipelineStage{group}
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+
+	var stageErr *StageError
+	require.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, "retrieval", stageErr.Stage)
+	assert.ErrorIs(t, err, errRetrieval)
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("running stage was not cancelled")
+	}
+}
+
+func TestParallelGroup_MaxConcurrent(t *testing.T) {
+	var running, peak int32
+	stage := func(name string) funcStage {
+		return funcStage{name: name, fn: func(ctx context.Context, data *Payload) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			data.SetValue(name, true)
+			return nil
+		}}
+	}
+	group := NewParallelGroup("prepare", stage("a"), stage("b"), stage("c"), stage("d"))
+	group.MaxConcurrent = 2
+
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{}}
+	require.NoError(t, group.Execute(context.Background(), payload))
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		_, ok := payload.Value(name)
+		assert.True(t, ok, name)
+	}
+}
+
+func TestFlattenStages(t *testing.T) {
+	a := funcStage{name: "a"}
+	b := funcStage{name: "b"}
+	c := funcStage{name: "c"}
+	flat := flattenStages([]PipelineStage{a, NewParallelGroup("group", b, NewParallelGroup("inner", c))})
+	assert.Equal(t, []PipelineStage{a, b, c}, flat)
+}
@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -9,18 +10,242 @@ import (
 	"github.com/sleepstars/deepempower/internal/clients"
 	"github.com/sleepstars/deepempower/internal/config"
 	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/metrics"
 	"github.com/sleepstars/deepempower/internal/modelbridge"
 	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Payload represents the data passed between pipeline stages
+// Payload represents the data passed between pipeline stages. Stages should
+// go through the accessor methods, which hold mux, so that concurrently
+// running stages can share a payload.
 type Payload struct {
 	OriginalRequest *models.ChatCompletionRequest
 	ReasoningChain  []string
 	IntermContent   string
 	FinalContent    string
-	Error           error
-	mux             sync.RWMutex
+	// StreamedBytes counts the final content forwarded by a streaming final
+	// stage, which is not kept in FinalContent
+	StreamedBytes int
+	// Finish reasons reported by the reasoner and the final stage
+	ReasoningFinishReason string
+	FinishReason          string
+	// ToolCalls are the tool calls the final stage answered with
+	ToolCalls []models.ToolCall
+	// Alternatives are the answers after the first when the request asked
+	// for several choices
+	Alternatives []models.ChatCompletionChoice
+	// LogProbs are the log probabilities of the final answer tokens, when
+	// the request asked for them
+	LogProbs *models.LogProbs
+	// ReasonerFallback is set when the Normal model answered the reasoning stage
+	ReasonerFallback bool
+	// Degraded is set when the final content is the reasoner's result because
+	// postprocessing failed
+	Degraded bool
+	// Usage accumulates token usage across all stages
+	Usage models.Usage
+	// SystemPrompt is prepended as a system message to every stage request
+	SystemPrompt string
+	// RejectOverContext fails stages whose prompt is estimated to exceed the
+	// context window of their model
+	RejectOverContext bool
+	// TokenBudget caps the tokens of the run; zero disables it
+	TokenBudget int
+	// DefaultMaxTokens is the max_tokens default of every model call, used
+	// when a stage model sets none of its own
+	DefaultMaxTokens int
+	// Created is the unix time the run started, reported in responses
+	Created int64
+	Error   error
+	// Values holds results custom stages pass on to later stages, keyed by
+	// name so stages of a parallel group do not overwrite each other
+	Values map[string]interface{}
+	mux    sync.RWMutex
+}
+
+// SetValue stores a result under key for later stages
+func (d *Payload) SetValue(key string, value interface{}) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.Values == nil {
+		d.Values = make(map[string]interface{})
+	}
+	d.Values[key] = value
+}
+
+// Value returns the result stored under key
+func (d *Payload) Value(key string) (interface{}, bool) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	value, ok := d.Values[key]
+	return value, ok
+}
+
+// AppendReasoning adds steps to the reasoning chain
+func (d *Payload) AppendReasoning(steps ...string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.ReasoningChain = append(d.ReasoningChain, steps...)
+}
+
+// Reasoning returns a copy of the reasoning chain
+func (d *Payload) Reasoning() []string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	if d.ReasoningChain == nil {
+		return nil
+	}
+	return append([]string(nil), d.ReasoningChain...)
+}
+
+// SetIntermContent replaces the intermediate content
+func (d *Payload) SetIntermContent(content string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.IntermContent = content
+}
+
+// Interm returns the intermediate content
+func (d *Payload) Interm() string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.IntermContent
+}
+
+// SetFinalContent replaces the final content
+func (d *Payload) SetFinalContent(content string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.FinalContent = content
+}
+
+// Final returns the final content
+func (d *Payload) Final() string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.FinalContent
+}
+
+// AddStreamedBytes counts final content forwarded to the client
+func (d *Payload) AddStreamedBytes(n int) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.StreamedBytes += n
+}
+
+// Streamed returns the length of the final content forwarded so far
+func (d *Payload) Streamed() int {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.StreamedBytes
+}
+
+// SetReasoningFinishReason records the finish reason of the reasoning stage
+func (d *Payload) SetReasoningFinishReason(reason string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.ReasoningFinishReason = reason
+}
+
+// SetFinishReason records the finish reason of the final stage
+func (d *Payload) SetFinishReason(reason string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.FinishReason = reason
+}
+
+// SetToolCalls records the tool calls of the final answer
+func (d *Payload) SetToolCalls(calls []models.ToolCall) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.ToolCalls = calls
+}
+
+// Calls returns the tool calls of the final answer
+func (d *Payload) Calls() []models.ToolCall {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.ToolCalls
+}
+
+// SetAlternatives records the answers after the first
+func (d *Payload) SetAlternatives(choices []models.ChatCompletionChoice) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.Alternatives = choices
+}
+
+// AlternativeChoices returns the answers after the first
+func (d *Payload) AlternativeChoices() []models.ChatCompletionChoice {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.Alternatives
+}
+
+// SetLogProbs records the log probabilities of the final answer
+func (d *Payload) SetLogProbs(logprobs *models.LogProbs) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.LogProbs = logprobs
+}
+
+// FinalLogProbs returns the log probabilities of the final answer
+func (d *Payload) FinalLogProbs() *models.LogProbs {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.LogProbs
+}
+
+// FinishReasons returns the finish reasons of the reasoning and final stages
+func (d *Payload) FinishReasons() (reasoning, final string) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.ReasoningFinishReason, d.FinishReason
+}
+
+// AddUsage accumulates the token usage of a stage. A nil usage is ignored.
+func (d *Payload) AddUsage(usage *models.Usage) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.Usage.Add(usage)
+}
+
+// TotalUsage returns the usage accumulated so far
+func (d *Payload) TotalUsage() models.Usage {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.Usage
+}
+
+// MarkReasonerFallback records that the Normal model answered the reasoning stage
+func (d *Payload) MarkReasonerFallback() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.ReasonerFallback = true
+}
+
+// UsedReasonerFallback reports whether the reasoning stage fell back to the Normal model
+func (d *Payload) UsedReasonerFallback() bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.ReasonerFallback
+}
+
+// MarkDegraded records that the final content is the unprocessed reasoner result
+func (d *Payload) MarkDegraded() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.Degraded = true
+}
+
+// IsDegraded reports whether the final content is the unprocessed reasoner result
+func (d *Payload) IsDegraded() bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.Degraded
 }
 
 // PipelineStage defines the interface for a stage in the processing pipeline
@@ -29,16 +254,65 @@ type PipelineStage interface {
 	Name() string
 }
 
+// StreamingStage is a pipeline stage that can forward its output incrementally.
+// Final stages forward the answer without buffering it, so after a streamed
+// run the payload records only its length (Streamed), not FinalContent.
+type StreamingStage interface {
+	PipelineStage
+	ExecuteStream(ctx context.Context, data *Payload, out chan<- *models.ChatCompletionResponse) error
+}
+
 // HybridPipeline implements a pipeline that combines Normal and Reasoner models
 type HybridPipeline struct {
 	stages []PipelineStage
 	config *config.PipelineConfig
 	bridge *modelbridge.ModelBridge
-	Logger *logger.Logger
+	shadow *ShadowRunner
+	cache  *ResponseCache
+	retry  retryPolicy
+
+	// inflight coalesces concurrent identical non-streaming requests
+	inflight flightGroup
+	Logger   *logger.Logger
+
+	// passthrough answers passthrough requests when a dedicated model is configured
+	passthrough *DirectResponder
+	// safety checks the final answer of every run when configured
+	safety *SafetyFilter
+
+	// stageTimeout bounds each stage attempt; zero disables it
+	stageTimeout time.Duration
+	// requestTimeout bounds runs whose context has no deadline; zero disables it
+	requestTimeout time.Duration
+	// maxTotalLatency bounds every run as a whole; zero disables it
+	maxTotalLatency time.Duration
+	// tokenBudget caps the tokens used by a run; zero disables it
+	tokenBudget int
+
+	confidence ConfidenceScorer
+
+	classifier          ComplexityClassifier
+	complexityThreshold float64
+
+	startHooks []StageHook
+	endHooks   []StageHook
+
+	// prompts supplies the stage prompt templates; the config by default
+	prompts PromptProvider
+
+	metrics *metrics.Registry
+	// metadataLabels are the request metadata keys recorded as metric labels
+	metadataLabels []string
 }
 
-// NewHybridPipeline creates a new hybrid pipeline with the specified configuration
-func NewHybridPipeline(cfg *config.PipelineConfig) *HybridPipeline {
+// StageHook is called around every stage run. err is always nil for start
+// hooks; end hooks receive the error the stage finally failed with, after
+// any retries.
+type StageHook func(stageName string, payload *Payload, err error)
+
+// NewHybridPipeline creates a new hybrid pipeline with the specified configuration.
+// It fails if any stage prompt cannot be loaded or does not parse.
+func NewHybridPipeline(cfg *config.PipelineConfig, opts ...PipelineOption) (*HybridPipeline, error) {
 	// Initialize logger with default level
 	logger.InitLogger(logger.INFO, "pipeline")
 	log := logger.GetLogger().WithComponent("pipeline")
@@ -46,43 +320,341 @@ func NewHybridPipeline(cfg *config.PipelineConfig) *HybridPipeline {
 
 	// Create pipeline instance
 	p := &HybridPipeline{
-		config: cfg,
-		Logger: log,
+		config:  cfg,
+		retry:   newRetryPolicy(config.RetryConfig{}),
+		Logger:  log,
+		metrics: metrics.NewRegistry(),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 
 	// Create model bridge if config is provided
 	if cfg != nil {
-		p.bridge = modelbridge.NewModelBridge(
-			clients.ModelClientConfig{
-				APIBase:       cfg.Models.Normal.APIBase,
-				Model:         cfg.Models.Normal.Model,
-				DefaultParams: cfg.Models.Normal.DefaultParams,
-			},
-			clients.ModelClientConfig{
-				APIBase:        cfg.Models.Reasoner.APIBase,
-				Model:          cfg.Models.Reasoner.Model,
-				DisabledParams: cfg.Models.Reasoner.DisabledParams,
-			},
-		)
+		if p.prompts == nil {
+			p.prompts = NewConfigPromptProvider(cfg.Prompts)
+		}
+		prompts := make(map[string]string)
+		for _, name := range []string{PromptPreProcess, PromptReasoning, PromptPostProcess, PromptPostProcessNoReasoning} {
+			text, err := loadPrompt(p.prompts, name)
+			if err != nil {
+				return nil, err
+			}
+			prompts[name] = text
+		}
+		// Only post_process_no_reasoning has a built-in fallback
+		for _, name := range []string{PromptPreProcess, PromptReasoning, PromptPostProcess} {
+			if prompts[name] == "" {
+				return nil, fmt.Errorf("%w: %s", ErrMissingPrompt, name)
+			}
+		}
+
+		p.retry = newRetryPolicy(cfg.Retry)
+		p.stageTimeout = cfg.StageTimeout
+		p.requestTimeout = cfg.DefaultRequestTimeout
+		p.maxTotalLatency = cfg.MaxTotalLatency
+		p.tokenBudget = cfg.TokenBudget
+		p.metadataLabels = cfg.MetadataLabels
+		p.limitMetadataLabels()
+		if cfg.Mock != nil {
+			p.bridge = newMockBridge(cfg.Mock)
+		} else {
+			bridge, err := modelbridge.NewModelBridge(
+				clientConfig(cfg.Models.Normal, cfg.DefaultParams),
+				clientConfig(cfg.Models.Reasoner, cfg.DefaultParams),
+			)
+			if err != nil {
+				return nil, err
+			}
+			p.bridge = bridge
+		}
+		p.bridge.ReasonerFallback = cfg.ReasonerFallback
+		p.bridge.LogLatency = cfg.LogLatency
+		p.bridge.EstimateStreamUsage = cfg.StreamUsage == config.StreamUsageEstimate
+		p.bridge.NormalBreaker = newCircuitBreaker(cfg.CircuitBreaker)
+		p.bridge.ReasonerBreaker = newCircuitBreaker(cfg.CircuitBreaker)
+		p.bridge.NormalLimiter = modelbridge.NewConcurrencyLimiter(cfg.Models.Normal.MaxConcurrent)
+		p.bridge.ReasonerLimiter = modelbridge.NewConcurrencyLimiter(cfg.Models.Reasoner.MaxConcurrent)
+		if cfg.Cache != nil {
+			p.cache = NewResponseCache(*cfg.Cache)
+		}
 
 		// Initialize pipeline stages with proper configuration
-		normalPreprocessor := newNormalPreprocessor(cfg.Prompts.PreProcess, p.bridge)
-		normalPreprocessor.config.Model = cfg.Models.Normal.Model
+		stageModels := newStageModels(cfg, p.bridge, log)
+		preModel, preBridge := stageModels.normal(cfg.Stages.PreProcess)
+		reasonModel, reasonBridge := stageModels.reasoner(cfg.Stages.Reasoning)
+		postModel, postBridge := stageModels.normal(cfg.Stages.PostProcess)
 
-		reasonerEngine := newReasonerEngine(cfg.Prompts.Reasoning, p.bridge)
-		reasonerEngine.config.Model = cfg.Models.Reasoner.Model
+		normalPreprocessor, err := newNormalPreprocessor(prompts[PromptPreProcess], preBridge)
+		if err != nil {
+			return nil, err
+		}
+		normalPreprocessor.config.Model = preModel.Model
+		normalPreprocessor.config.ContextWindow = preModel.ContextWindow
+		normalPreprocessor.config.DefaultParams = preModel.DefaultParams
+		normalPreprocessor.examples = exampleMessages(cfg.Examples.PreProcess)
 
-		normalPostprocessor := newNormalPostprocessor(cfg.Prompts.PostProcess, p.bridge)
-		normalPostprocessor.config.Model = cfg.Models.Normal.Model
+		reasonerEngine, err := newReasonerEngine(prompts[PromptReasoning], reasonBridge)
+		if err != nil {
+			return nil, err
+		}
+		reasonerEngine.config.Model = reasonModel.Model
+		reasonerEngine.config.ContextWindow = reasonModel.ContextWindow
+		reasonerEngine.config.DefaultParams = reasonModel.DefaultParams
+		reasonerEngine.config.StreamMode = reasonModel.StreamMode
+		reasonerEngine.maxSteps = cfg.MaxReasoningSteps
+		reasonerEngine.continuations = cfg.ReasoningContinuations
+		reasonerEngine.examples = exampleMessages(cfg.Examples.Reasoning)
+		reasonerEngine.requireReasoning = cfg.RequireReasoning
+
+		normalPostprocessor, err := newNormalPostprocessor(prompts[PromptPostProcess], postBridge)
+		if err != nil {
+			return nil, err
+		}
+		normalPostprocessor.config.Model = postModel.Model
+		normalPostprocessor.config.ContextWindow = postModel.ContextWindow
+		normalPostprocessor.config.DefaultParams = postModel.DefaultParams
+		normalPostprocessor.config.StreamMode = postModel.StreamMode
+		normalPostprocessor.examples = exampleMessages(cfg.Examples.PostProcess)
+		normalPostprocessor.reasoningFormat = cfg.ReasoningFormat
+		if text := prompts[PromptPostProcessNoReasoning]; text != "" {
+			normalPostprocessor.noReasoning, err = parsePrompt("normal_postprocessor_no_reasoning", text)
+			if err != nil {
+				return nil, err
+			}
+		}
 
 		p.stages = []PipelineStage{
 			normalPreprocessor,
 			reasonerEngine,
 			normalPostprocessor,
 		}
+		if cfg.DisablePreprocessing {
+			p.stages = p.stages[1:]
+		}
+		if cfg.Safety != nil {
+			p.safety, err = NewSafetyFilter(*cfg.Safety)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, p.safety)
+		}
+
+		if cfg.PassthroughModel != "" && cfg.PassthroughModel != config.ModelNormal {
+			passthroughModel, passthroughBridge := stageModels.normal(cfg.PassthroughModel)
+			p.passthrough = newDirectResponder(passthroughBridge)
+			p.passthrough.config.Model = passthroughModel.Model
+			p.passthrough.config.ContextWindow = passthroughModel.ContextWindow
+			p.passthrough.config.DefaultParams = passthroughModel.DefaultParams
+			p.passthrough.config.StreamMode = passthroughModel.StreamMode
+		}
+
+		if cfg.Confidence != nil {
+			scorer, err := NewConfidenceScorer(cfg.Confidence.Strategy, p.bridge)
+			if err != nil {
+				log.WithError(err).Error("Confidence scoring disabled")
+			} else {
+				p.confidence = scorer
+			}
+		}
+
+		if cfg.Complexity != nil {
+			classifier, err := NewComplexityClassifier(cfg.Complexity.Strategy, p.bridge)
+			if err != nil {
+				log.WithError(err).Error("Complexity classification disabled")
+			} else {
+				threshold := cfg.Complexity.Threshold
+				if threshold <= 0 {
+					threshold = defaultComplexityThreshold
+				}
+				p.SetComplexityClassifier(classifier, threshold)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// clientConfig converts a model config into the client config. The model's
+// default params override the pipeline-wide defaults.
+func clientConfig(m config.ModelConfig, defaults map[string]interface{}) clients.ModelClientConfig {
+	cfg := clients.ModelClientConfig{
+		APIBase:           m.APIBase,
+		Model:             m.Model,
+		DisabledParams:    m.DisabledParams,
+		DefaultParams:     mergeParams(defaults, m.DefaultParams),
+		StreamMode:        m.StreamMode,
+		ExtraHeaders:      m.ExtraHeaders,
+		ProxyURL:          m.ProxyURL,
+		Provider:          m.Provider,
+		DebugRaw:          m.DebugRaw,
+		StreamIdleTimeout: m.StreamIdleTimeout,
+		LoadBalancing:     m.LoadBalancing,
+	}
+	for _, endpoint := range m.Endpoints {
+		cfg.Endpoints = append(cfg.Endpoints, clients.Endpoint{APIBase: endpoint.APIBase, Weight: endpoint.Weight})
+	}
+	if m.Retry != nil {
+		cfg.Retry = clients.RetryConfig{
+			MaxRetries:    m.Retry.MaxRetries,
+			BaseDelay:     m.Retry.BaseDelay,
+			MaxDelay:      m.Retry.MaxDelay,
+			Jitter:        m.Retry.Jitter,
+			MaxRetryAfter: m.Retry.MaxRetryAfter,
+		}
+	}
+	return cfg
+}
+
+// exampleMessages converts configured few-shot examples into messages
+func exampleMessages(examples []config.ExampleMessage) []models.ChatCompletionMessage {
+	if len(examples) == 0 {
+		return nil
+	}
+	messages := make([]models.ChatCompletionMessage, len(examples))
+	for i, example := range examples {
+		messages[i] = models.ChatCompletionMessage{Role: example.Role, Content: example.Content}
+	}
+	return messages
+}
+
+// mergeParams returns defaults overridden by params, reusing either map
+// when the other is empty
+func mergeParams(defaults, params map[string]interface{}) map[string]interface{} {
+	if len(defaults) == 0 {
+		return params
+	}
+	if len(params) == 0 {
+		return defaults
+	}
+	merged := make(map[string]interface{}, len(defaults)+len(params))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return merged
+}
+
+// newModelClient creates the client for a model on its provider's API
+func newModelClient(m config.ModelConfig, defaults map[string]interface{}, reasoning bool) (clients.ModelClient, error) {
+	provider := m.Provider
+	if reasoning {
+		provider = modelbridge.ReasonerProvider(provider)
+	}
+	return clients.NewModelClient(provider, clientConfig(m, defaults))
+}
+
+// newCircuitBreaker creates a breaker from cfg, or nil when circuit breaking is disabled
+func newCircuitBreaker(cfg *config.CircuitBreakerConfig) *modelbridge.CircuitBreaker {
+	if cfg == nil {
+		return nil
+	}
+	return modelbridge.NewCircuitBreaker(cfg.FailureThreshold, cfg.Cooldown)
+}
+
+// stageModels resolves the model referenced by each stage to a bridge. Stages
+// on the default models share the pipeline bridge; stages on named models get
+// a bridge whose Normal or Reasoner client is swapped for the named one.
+// Bridges are shared between stages that reference the same model, and
+// every use of a named model shares its concurrency limiter.
+type stageModels struct {
+	models   config.ModelsConfig
+	defaults map[string]interface{}
+	mock     bool
+	breaker  *config.CircuitBreakerConfig
+	bridge   *modelbridge.ModelBridge
+	bridges  map[string]*modelbridge.ModelBridge
+	limiters map[string]*modelbridge.ConcurrencyLimiter
+	Logger   *logger.Logger
+}
+
+func newStageModels(cfg *config.PipelineConfig, bridge *modelbridge.ModelBridge, log *logger.Logger) *stageModels {
+	return &stageModels{
+		models:   cfg.Models,
+		defaults: cfg.DefaultParams,
+		mock:     cfg.Mock != nil,
+		breaker:  cfg.CircuitBreaker,
+		bridge:   bridge,
+		bridges:  make(map[string]*modelbridge.ModelBridge),
+		limiters: make(map[string]*modelbridge.ConcurrencyLimiter),
+		Logger:   log,
+	}
+}
+
+// normal resolves a stage that calls the Normal side of the bridge
+func (s *stageModels) normal(name string) (config.ModelConfig, *modelbridge.ModelBridge) {
+	return s.resolve(name, config.ModelNormal, false)
+}
+
+// reasoner resolves a stage that calls the Reasoner side of the bridge
+func (s *stageModels) reasoner(name string) (config.ModelConfig, *modelbridge.ModelBridge) {
+	return s.resolve(name, config.ModelReasoner, true)
+}
+
+func (s *stageModels) resolve(name, fallback string, reasoning bool) (config.ModelConfig, *modelbridge.ModelBridge) {
+	if name == "" {
+		name = fallback
+	}
+	model, ok := s.models.Lookup(name)
+	if !ok {
+		s.Logger.Error("Unknown stage model %q, falling back to %s", name, fallback)
+		name = fallback
+		model, _ = s.models.Lookup(name)
+	}
+	// Mock mode scripts every model through the shared bridge
+	if name == fallback || s.mock {
+		return model, s.bridge
 	}
 
-	return p
+	key := config.ModelNormal + "/" + name
+	if reasoning {
+		key = config.ModelReasoner + "/" + name
+	}
+	if bridge, ok := s.bridges[key]; ok {
+		return model, bridge
+	}
+	client, err := newModelClient(model, s.defaults, reasoning)
+	if err != nil {
+		s.Logger.Error("Stage model %q: %v, falling back to %s", name, err, fallback)
+		model, _ = s.models.Lookup(fallback)
+		return model, s.bridge
+	}
+
+	bridge := &modelbridge.ModelBridge{
+		NormalClient:        s.bridge.NormalClient,
+		ReasonerClient:      s.bridge.ReasonerClient,
+		Logger:              s.bridge.Logger,
+		ReasonerFallback:    s.bridge.ReasonerFallback,
+		NormalBreaker:       s.bridge.NormalBreaker,
+		ReasonerBreaker:     s.bridge.ReasonerBreaker,
+		NormalLimiter:       s.bridge.NormalLimiter,
+		ReasonerLimiter:     s.bridge.ReasonerLimiter,
+		LogLatency:          s.bridge.LogLatency,
+		EstimateStreamUsage: s.bridge.EstimateStreamUsage,
+	}
+	if reasoning {
+		bridge.ReasonerClient = client
+		bridge.ReasonerBreaker = newCircuitBreaker(s.breaker)
+		bridge.ReasonerLimiter = s.limiter(name, model)
+	} else {
+		bridge.NormalClient = client
+		bridge.NormalBreaker = newCircuitBreaker(s.breaker)
+		bridge.NormalLimiter = s.limiter(name, model)
+	}
+	s.bridges[key] = bridge
+	return model, bridge
+}
+
+// limiter returns the concurrency limiter shared by all uses of a named model
+func (s *stageModels) limiter(name string, model config.ModelConfig) *modelbridge.ConcurrencyLimiter {
+	if limiter, ok := s.limiters[name]; ok {
+		return limiter
+	}
+	limiter := modelbridge.NewConcurrencyLimiter(model.MaxConcurrent)
+	s.limiters[name] = limiter
+	return limiter
 }
 
 // SetBridge replaces the current model bridge with a new one (mainly for testing)
@@ -90,9 +662,10 @@ func (p *HybridPipeline) SetBridge(bridge *modelbridge.ModelBridge) {
 	p.bridge = bridge
 	if p.stages == nil {
 		// Initialize stages for testing if they don't exist
-		normalPreprocessor := newNormalPreprocessor("test_pre_process", bridge)
-		reasonerEngine := newReasonerEngine("test_reasoning", bridge)
-		normalPostprocessor := newNormalPostprocessor("test_post_process", bridge)
+		// The placeholder prompts contain no actions, so parsing cannot fail
+		normalPreprocessor, _ := newNormalPreprocessor("test_pre_process", bridge)
+		reasonerEngine, _ := newReasonerEngine("test_reasoning", bridge)
+		normalPostprocessor, _ := newNormalPostprocessor("test_post_process", bridge)
 
 		// Set model configurations from pipeline config
 		if p.config != nil {
@@ -129,10 +702,297 @@ func (p *HybridPipeline) SetBridge(bridge *modelbridge.ModelBridge) {
 			}
 		}
 	}
+
+	if judge, ok := p.confidence.(*judgeScorer); ok {
+		judge.bridge = bridge
+	}
+	if classifier, ok := p.classifier.(*modelClassifier); ok {
+		classifier.bridge = bridge
+	}
+}
+
+// SetConfidenceScorer replaces the strategy used to score answers on request
+func (p *HybridPipeline) SetConfidenceScorer(scorer ConfidenceScorer) {
+	p.confidence = scorer
+}
+
+// SetComplexityClassifier enables skipping the reasoning chain for requests
+// the classifier scores below threshold
+func (p *HybridPipeline) SetComplexityClassifier(classifier ComplexityClassifier, threshold float64) {
+	p.classifier = classifier
+	p.complexityThreshold = threshold
+}
+
+// OnStageStart registers a hook called before each stage runs. Hooks run in
+// registration order and must be registered before the pipeline starts
+// serving requests.
+func (p *HybridPipeline) OnStageStart(hook StageHook) {
+	p.startHooks = append(p.startHooks, hook)
+}
+
+// OnStageEnd registers a hook called after each stage finishes
+func (p *HybridPipeline) OnStageEnd(hook StageHook) {
+	p.endHooks = append(p.endHooks, hook)
+}
+
+// runHooks calls each hook with the stage outcome
+func runHooks(hooks []StageHook, stageName string, payload *Payload, err error) {
+	for _, hook := range hooks {
+		hook(stageName, payload, err)
+	}
+}
+
+// RegisterStage inserts a custom stage before the stage currently at position.
+// Position 0 runs it first and len(Stages()) runs it last. Stages must be
+// registered before the pipeline starts serving requests.
+func (p *HybridPipeline) RegisterStage(position int, stage PipelineStage) error {
+	if stage == nil {
+		return fmt.Errorf("register stage: nil stage")
+	}
+	if position < 0 || position > len(p.stages) {
+		return fmt.Errorf("register stage %s: position %d out of range [0, %d]", stage.Name(), position, len(p.stages))
+	}
+	stages := make([]PipelineStage, 0, len(p.stages)+1)
+	stages = append(stages, p.stages[:position]...)
+	stages = append(stages, stage)
+	p.stages = append(stages, p.stages[position:]...)
+	p.Logger.Info("Registered stage %s at position %d", stage.Name(), position)
+	return nil
 }
 
-// Execute runs the pipeline stages in sequence
-func (p *HybridPipeline) Execute(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+// Stages returns the stages of the full pipeline in execution order
+func (p *HybridPipeline) Stages() []PipelineStage {
+	return append([]PipelineStage(nil), p.stages...)
+}
+
+// SetShadow attaches a shadow runner that mirrors successful requests to a secondary pipeline
+func (p *HybridPipeline) SetShadow(shadow *ShadowRunner) {
+	p.shadow = shadow
+}
+
+// SetCache attaches a response cache consulted by Execute; nil disables caching
+func (p *HybridPipeline) SetCache(cache *ResponseCache) {
+	p.cache = cache
+}
+
+// Execute runs the pipeline stages in sequence. When a cache is attached,
+// identical requests are answered from it without running the stages.
+// Identical requests arriving while one is running share its execution.
+func (p *HybridPipeline) Execute(ctx context.Context, req *models.ChatCompletionRequest) (resp *models.ChatCompletionResponse, err error) {
+	// Assign the request ID before anything logs it; the cache key leaves it out
+	p.applyRequestDefaults(req)
+	ctx = logger.ContextWithRequestID(ctx, req.RequestID)
+	ctx = logger.ContextWithMetadata(ctx, req.Metadata)
+	ctx, cancel := p.requestContext(ctx)
+	defer cancel()
+	ctx, span := startPipelineSpan(ctx, "pipeline.execute", req)
+	defer func() {
+		tracing.RecordError(span, err)
+		if resp != nil {
+			span.SetAttributes(tracing.Usage(resp.Usage)...)
+		}
+		span.End()
+	}()
+
+	log := p.Logger.WithContext(ctx)
+	key, err := cacheKey(req)
+	if err != nil {
+		log.WithError(err).Warn("Skipping response cache and request coalescing")
+		return p.execute(ctx, req)
+	}
+	if p.cache != nil {
+		if resp, ok := p.cache.Get(key); ok {
+			log.Debug("Response cache hit for request id: %s", req.RequestID)
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			// Identify the cached answer as a response to this request
+			stampResponse(resp, req, objectCompletion, time.Now().Unix())
+			p.recordMetrics(req, nil, nil)
+			return resp, nil
+		}
+	}
+
+	resp, err, shared := p.inflight.do(ctx, key, func() (*models.ChatCompletionResponse, error) {
+		return p.execute(ctx, req)
+	})
+	if shared {
+		log.Debug("Shared the run of an identical in-flight request for request id: %s", req.RequestID)
+		span.SetAttributes(attribute.Bool("coalesced", true))
+		p.recordMetrics(req, nil, err)
+		if err != nil {
+			return nil, err
+		}
+		stampResponse(resp, req, objectCompletion, time.Now().Unix())
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.cache != nil {
+		p.cache.Put(key, resp)
+	}
+	return resp, nil
+}
+
+// execute runs the pipeline stages for req
+func (p *HybridPipeline) execute(ctx context.Context, req *models.ChatCompletionRequest) (_ *models.ChatCompletionResponse, err error) {
+	payload := p.newPayload(req)
+	defer func() { p.recordMetrics(req, payload, err) }()
+	start := time.Now()
+	ctx, cancel := p.latencyContext(ctx)
+	defer cancel()
+	defer func() { err = p.deadlineExceeded(ctx, start, err) }()
+
+	stages, err := p.stagesFor(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, stage := range stages {
+		if err := p.runStage(ctx, stage, payload); err != nil {
+			// A degraded answer still goes through the stages after the
+			// answer stage, such as the safety stage. Past
+			// max_total_latency the run is cut off without degrading.
+			if latencyExceeded(ctx) || !p.degrade(ctx, stage, payload, err) {
+				return nil, err
+			}
+		}
+	}
+
+	p.Logger.WithContext(ctx).Info("Pipeline execution completed successfully for request id: %s", req.RequestID)
+	resp := p.buildResponse(payload)
+	if req.IncludeConfidence && p.confidence != nil {
+		p.attachConfidence(ctx, payload, resp)
+	}
+	if p.shadow != nil {
+		p.shadow.Mirror(req, resp)
+	}
+	return resp, nil
+}
+
+// ExecuteStream runs the pipeline and streams reasoning steps and final content
+// as they are produced. Reasoning chunks carry only ReasoningContent and always
+// precede the chunks of the final answer. Errors from the buffered stages
+// before the first streaming stage are returned directly; later errors are
+// logged and end the stream early.
+func (p *HybridPipeline) ExecuteStream(ctx context.Context, req *models.ChatCompletionRequest) (_ <-chan *models.ChatCompletionResponse, err error) {
+	payload := p.newPayload(req)
+	ctx = logger.ContextWithRequestID(ctx, req.RequestID)
+	ctx = logger.ContextWithMetadata(ctx, req.Metadata)
+	ctx, cancelRequest := p.requestContext(ctx)
+	start := time.Now()
+	ctx, cancelLatency := p.latencyContext(ctx)
+	cancel := func() {
+		cancelLatency()
+		cancelRequest()
+	}
+	// The span ends, metrics are recorded and the timeout is released here on
+	// early errors, otherwise when the stream finishes
+	ctx, span := startPipelineSpan(ctx, "pipeline.execute_stream", req)
+	defer func() {
+		if err != nil {
+			err = p.deadlineExceeded(ctx, start, err)
+			p.recordMetrics(req, payload, err)
+			tracing.RecordError(span, err)
+			span.End()
+			cancel()
+		}
+	}()
+	stages, err := p.stagesFor(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run leading buffered stages up front so their errors reach the caller.
+	// The final stage always runs in the streaming goroutine.
+	// Without reasoning in the output, intermediate stages have nothing to
+	// forward and run buffered. An answer stage followed by another stage,
+	// such as the safety stage, runs buffered so its answer is not streamed
+	// before the later stage has seen it.
+	includeReasoning := p.includeReasoning(req)
+	first := 0
+	for ; first < len(stages)-1; first++ {
+		if _, ok := stages[first].(StreamingStage); ok && includeReasoning && !answerStage(stages[first]) {
+			break
+		}
+		if err := p.runStage(ctx, stages[first], payload); err != nil {
+			if latencyExceeded(ctx) || !p.degrade(ctx, stages[first], payload, err) {
+				return nil, err
+			}
+		}
+	}
+
+	chunks := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(chunks)
+		defer span.End()
+
+		for i := first; i < len(stages); i++ {
+			last := i == len(stages)-1
+			forward := last || includeReasoning && !answerStage(stages[i])
+			err := p.streamStage(ctx, stages[i], payload, chunks, last, forward)
+			if err != nil && !latencyExceeded(ctx) && p.degrade(ctx, stages[i], payload, err) {
+				if last {
+					p.send(ctx, chunks, degradedChunk(payload))
+				}
+				err = nil
+			}
+			if err != nil {
+				err = p.deadlineExceeded(ctx, start, err)
+				p.Logger.WithContext(ctx).WithError(err).Error("Streaming failed for request id: %s", req.RequestID)
+				p.recordMetrics(req, payload, err)
+				tracing.RecordError(span, err)
+				return
+			}
+		}
+		p.recordMetrics(req, payload, nil)
+		usage := payload.TotalUsage()
+		span.SetAttributes(tracing.Usage(&usage)...)
+
+		// Make sure the client always sees a finish reason
+		if _, finishReason := payload.FinishReasons(); finishReason == "" {
+			p.send(ctx, chunks, streamChunk("", "stop"))
+		}
+		p.Logger.WithContext(ctx).Info("Pipeline streaming completed successfully for request id: %s", req.RequestID)
+	}()
+
+	// Stamp every chunk, whichever stage produced it, with the stream identity
+	out := make(chan *models.ChatCompletionResponse)
+	go func() {
+		defer close(out)
+		defer cancel()
+		for chunk := range chunks {
+			stampResponse(chunk, req, objectCompletionChunk, payload.Created)
+			// Once the request is cancelled keep draining so the stages can exit
+			p.send(ctx, out, chunk)
+		}
+	}()
+
+	return out, nil
+}
+
+// newPayload fills in request defaults and creates the payload for a run
+func (p *HybridPipeline) newPayload(req *models.ChatCompletionRequest) *Payload {
+	p.applyRequestDefaults(req)
+
+	log := p.Logger.WithField("request_id", req.RequestID)
+	log.Info("Starting pipeline execution for request id: %s", req.RequestID)
+	log.Debug("Request details: model=%s, stream=%v", req.Model, req.Stream)
+
+	payload := &Payload{
+		OriginalRequest: req,
+		ReasoningChain:  make([]string, 0),
+		Created:         time.Now().Unix(),
+	}
+	if p.config != nil {
+		payload.SystemPrompt = p.config.SystemPrompt
+		payload.RejectOverContext = p.config.RejectOverContext
+		payload.DefaultMaxTokens, _ = intParam(p.config.DefaultParams["max_tokens"])
+	}
+	payload.TokenBudget = p.tokenBudget
+	return payload
+}
+
+// applyRequestDefaults generates a missing request ID and sets the default model
+func (p *HybridPipeline) applyRequestDefaults(req *models.ChatCompletionRequest) {
 	// Generate request ID if not provided
 	if req.RequestID == "" {
 		req.RequestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
@@ -144,58 +1004,420 @@ func (p *HybridPipeline) Execute(ctx context.Context, req *models.ChatCompletion
 			req.Model = p.config.Models.Normal.Model
 		}
 	}
+}
 
-	p.Logger.Info("Starting pipeline execution for request id: %s", req.RequestID)
-	p.Logger.Debug("Request details: model=%s, stream=%v", req.Model, req.Stream)
+// Response object types
+const (
+	objectCompletion      = "chat.completion"
+	objectCompletionChunk = "chat.completion.chunk"
+)
 
-	payload := &Payload{
-		OriginalRequest: req,
-		ReasoningChain:  make([]string, 0),
+// stampResponse fills in the OpenAI identification fields of resp. The ID is
+// derived from the request ID so every chunk of a stream shares it.
+func stampResponse(resp *models.ChatCompletionResponse, req *models.ChatCompletionRequest, object string, created int64) {
+	resp.ID = "chatcmpl-" + req.RequestID
+	resp.Object = object
+	resp.Created = created
+	resp.Model = req.Model
+}
+
+// stagesFor picks the stages to run for a request. Passthrough requests are
+// answered by a single model call. Hybrid requests the complexity classifier
+// scores below the threshold are answered directly by the Normal model;
+// classification failures fall back to the full chain.
+func (p *HybridPipeline) stagesFor(ctx context.Context, req *models.ChatCompletionRequest) ([]PipelineStage, error) {
+	log := p.Logger.WithContext(ctx)
+	mode, err := p.mode(req)
+	if err != nil {
+		return nil, err
+	}
+	if mode == config.ModePassthrough {
+		log.Debug("Request id: %s uses passthrough mode", req.RequestID)
+		return p.answerStages(p.passthroughStage()), nil
+	}
+	if p.classifier == nil {
+		return p.stages, nil
+	}
+
+	score, err := p.classifier.Classify(ctx, req)
+	if err != nil {
+		log.WithError(err).Warn("Complexity classification with %s failed for request id: %s", p.classifier.Name(), req.RequestID)
+		return p.stages, nil
+	}
+	if score >= p.complexityThreshold {
+		log.Debug("Request id: %s scored complexity %.2f, engaging reasoner", req.RequestID, score)
+		return p.stages, nil
+	}
+
+	log.Info("Request id: %s scored complexity %.2f, skipping reasoner", req.RequestID, score)
+	return p.answerStages(p.normalResponder()), nil
+}
+
+// answerStages returns the stages of a run answered by stage alone, followed
+// by the safety stage when configured
+func (p *HybridPipeline) answerStages(stage PipelineStage) []PipelineStage {
+	if p.safety == nil {
+		return []PipelineStage{stage}
+	}
+	return []PipelineStage{stage, p.safety}
+}
+
+// mode returns the pipeline mode of req, falling back to the configured mode
+func (p *HybridPipeline) mode(req *models.ChatCompletionRequest) (string, error) {
+	mode := req.Mode
+	if mode == "" && p.config != nil {
+		mode = p.config.Mode
+	}
+	switch mode {
+	case "":
+		return config.ModeHybrid, nil
+	case config.ModeHybrid, config.ModePassthrough:
+		return mode, nil
 	}
+	return "", fmt.Errorf("%w %q", ErrUnknownMode, mode)
+}
 
-	for _, stage := range p.stages {
-		stageName := stage.Name()
-		p.Logger.Debug("Executing stage: %s", stageName)
+// passthroughStage returns the stage answering passthrough requests, which
+// calls the configured passthrough model or the Normal model
+func (p *HybridPipeline) passthroughStage() PipelineStage {
+	if p.passthrough != nil {
+		return p.passthrough
+	}
+	return p.normalResponder()
+}
+
+// normalResponder returns a stage answering with the Normal model
+func (p *HybridPipeline) normalResponder() *DirectResponder {
+	responder := newDirectResponder(p.bridge)
+	if p.config != nil {
+		responder.config.Model = p.config.Models.Normal.Model
+		responder.config.ContextWindow = p.config.Models.Normal.ContextWindow
+		responder.config.StreamMode = p.config.Models.Normal.StreamMode
+	}
+	return responder
+}
 
+// startPipelineSpan starts the root span of a pipeline run
+func startPipelineSpan(ctx context.Context, name string, req *models.ChatCompletionRequest) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name,
+		attribute.String("request.id", req.RequestID),
+		attribute.String("model.name", req.Model),
+	)
+}
+
+// runStage executes a single stage between the stage hooks. The stages of a
+// parallel group run concurrently, each as a stage of its own.
+func (p *HybridPipeline) runStage(ctx context.Context, stage PipelineStage, payload *Payload) error {
+	if group, ok := stage.(*ParallelGroup); ok {
+		return p.runGroup(ctx, group, payload)
+	}
+	ctx, span := tracing.Start(ctx, "pipeline.stage", attribute.String("stage.name", stage.Name()))
+	defer span.End()
+
+	runHooks(p.startHooks, stage.Name(), payload, nil)
+	err := p.retryStage(ctx, stage, payload)
+	if err == nil {
+		err = p.checkBudget(stage.Name(), payload)
+	}
+	runHooks(p.endHooks, stage.Name(), payload, err)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// retryStage executes a stage, honouring cancellation and the retry policy
+func (p *HybridPipeline) retryStage(ctx context.Context, stage PipelineStage, payload *Payload) error {
+	log := p.Logger.WithContext(ctx)
+	stageName := stage.Name()
+	requestID := payload.OriginalRequest.RequestID
+
+	for attempt := 1; ; attempt++ {
 		select {
 		case <-ctx.Done():
-			p.Logger.Warn("Pipeline execution cancelled for request id: %s", req.RequestID)
-			return nil, ctx.Err()
+			log.Warn("Pipeline execution cancelled for request id: %s", requestID)
+			return ctx.Err()
 		default:
-			if err := stage.Execute(ctx, payload); err != nil {
-				p.Logger.WithError(err).Error("Stage %s failed for request id: %s", stageName, req.RequestID)
-				if stage.Name() == "normal_preprocessor" && err.Error() == "model call: temporary error" {
-					// Retry the stage once for temporary errors
-					p.Logger.Info("Retrying stage %s after temporary error", stageName)
-					if err := stage.Execute(ctx, payload); err != nil {
-						return nil, fmt.Errorf("stage %s failed: %w", stageName, err)
-					}
-				} else {
-					return nil, fmt.Errorf("stage %s failed: %w", stageName, err)
-				}
-			}
-			p.Logger.Debug("Stage %s completed successfully", stageName)
 		}
+
+		log.Debug("Executing stage: %s (attempt %d)", stageName, attempt)
+		stageCtx, cancel := p.stageContext(ctx)
+		err := p.stageTimedOut(ctx, stageCtx, stage.Execute(stageCtx, payload))
+		cancel()
+		if err == nil {
+			log.Debug("Stage %s completed successfully", stageName)
+			return nil
+		}
+
+		log.WithError(err).Error("Stage %s failed for request id: %s", stageName, requestID)
+		if attempt >= p.retry.maxAttempts || !p.retry.retryable(err) || ctx.Err() != nil {
+			return &StageError{Stage: stageName, Err: err}
+		}
+
+		delay := p.retry.delay(attempt)
+		log.Info("Retrying stage %s in %s (attempt %d/%d)", stageName, delay, attempt+1, p.retry.maxAttempts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return &StageError{Stage: stageName, Err: err}
+		}
+	}
+}
+
+// checkBudget fails the stage that pushed the run past the token budget. It
+// catches calls the check before each stage cannot foresee, such as retries
+// and reasoning continuations.
+func (p *HybridPipeline) checkBudget(stageName string, payload *Payload) error {
+	if p.tokenBudget <= 0 {
+		return nil
+	}
+	usage := payload.TotalUsage()
+	used := usage.PromptTokens + usage.CompletionTokens
+	if used <= p.tokenBudget {
+		return nil
+	}
+	p.Logger.WithField("request_id", payload.OriginalRequest.RequestID).Warn("Stage %s used %d tokens, over the budget of %d", stageName, used, p.tokenBudget)
+	return &StageError{Stage: stageName, Err: &budgetError{used: used, budget: p.tokenBudget}}
+}
+
+// streamStage runs a stage from the streaming goroutine. Streaming stages
+// forward their output directly; a buffered final stage emits its result as a
+// single chunk.
+func (p *HybridPipeline) streamStage(ctx context.Context, stage PipelineStage, payload *Payload, out chan<- *models.ChatCompletionResponse, last, forward bool) error {
+	log := p.Logger.WithContext(ctx)
+	if streaming, ok := stage.(StreamingStage); ok && forward {
+		log.Debug("Streaming stage: %s", stage.Name())
+		ctx, span := tracing.Start(ctx, "pipeline.stage", attribute.String("stage.name", stage.Name()))
+		defer span.End()
+		runHooks(p.startHooks, stage.Name(), payload, nil)
+		stageCtx, cancel := p.stageContext(ctx)
+		var stageErr error
+		if err := p.stageTimedOut(ctx, stageCtx, streaming.ExecuteStream(stageCtx, payload, out)); err != nil {
+			stageErr = &StageError{Stage: stage.Name(), Err: err}
+		} else {
+			stageErr = p.checkBudget(stage.Name(), payload)
+		}
+		cancel()
+		runHooks(p.endHooks, stage.Name(), payload, stageErr)
+		tracing.RecordError(span, stageErr)
+		return stageErr
+	}
+
+	if err := p.runStage(ctx, stage, payload); err != nil {
+		return err
+	}
+	if !last {
+		return nil
+	}
+	if _, finishReason := payload.FinishReasons(); finishReason == "" {
+		payload.SetFinishReason("stop")
+	}
+	chunks := answerChunks(payload)
+	if payload.IsDegraded() {
+		chunks[0] = degradedChunk(payload)
 	}
+	for _, chunk := range chunks {
+		if !p.send(ctx, out, chunk) {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
 
-	p.Logger.Info("Pipeline execution completed successfully for request id: %s", req.RequestID)
-	return p.buildResponse(payload), nil
+// degradedChunk returns the stream chunk of a degraded answer
+func degradedChunk(payload *Payload) *models.ChatCompletionResponse {
+	_, finishReason := payload.FinishReasons()
+	chunk := streamChunk(payload.Final(), finishReason)
+	chunk.Metadata = &models.ResponseMetadata{Degraded: true}
+	return chunk
+}
+
+// answerStage reports whether stage produces the final answer
+func answerStage(stage PipelineStage) bool {
+	switch stage.(type) {
+	case *NormalPostprocessor, *DirectResponder:
+		return true
+	}
+	return false
+}
+
+// degrade answers with the reasoner's result when the postprocessor failed
+// and degraded output is enabled, reporting whether err was handled. Cancelled
+// requests, budget overruns, JSON answers and answers that already started
+// streaming still fail.
+func (p *HybridPipeline) degrade(ctx context.Context, stage PipelineStage, payload *Payload, err error) bool {
+	if p.config == nil || !p.config.DegradedOutput {
+		return false
+	}
+	if _, ok := stage.(*NormalPostprocessor); !ok {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrBudgetExceeded) ||
+		payload.OriginalRequest.ResponseFormat.WantsJSON() || payload.Streamed() > 0 {
+		return false
+	}
+	interm := payload.Interm()
+	if interm == "" {
+		return false
+	}
+	p.Logger.WithContext(ctx).WithError(err).Warn("Postprocessing failed for request id: %s, returning the reasoner result", payload.OriginalRequest.RequestID)
+	payload.SetFinalContent(interm)
+	payload.SetFinishReason("stop")
+	payload.MarkDegraded()
+	return true
+}
+
+// requestContext applies the default request timeout to a context without
+// a deadline; callers' own deadlines are left as they are
+func (p *HybridPipeline) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || p.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.requestTimeout)
+}
+
+// latencyContext bounds a whole run by max_total_latency. An earlier caller
+// deadline still applies.
+func (p *HybridPipeline) latencyContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.maxTotalLatency <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, p.maxTotalLatency, ErrDeadlineExceeded)
+}
+
+// latencyExceeded reports whether ctx expired because of max_total_latency
+func latencyExceeded(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrDeadlineExceeded)
+}
+
+// deadlineExceeded marks err as a max_total_latency cut off when the run
+// context expired on that deadline, giving the time the run took
+func (p *HybridPipeline) deadlineExceeded(ctx context.Context, start time.Time, err error) error {
+	if err == nil || !latencyExceeded(ctx) {
+		return err
+	}
+	return &deadlineError{limit: p.maxTotalLatency, elapsed: time.Since(start), err: err}
+}
+
+// stageContext bounds a single stage attempt by the configured stage timeout
+func (p *HybridPipeline) stageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.stageTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.stageTimeout)
+}
+
+// stageTimedOut marks err as a stage timeout when the stage context expired
+// while the request context is still live
+func (p *HybridPipeline) stageTimedOut(ctx, stageCtx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &stageTimeoutError{timeout: p.stageTimeout, err: err}
+}
+
+// send delivers a chunk unless the context is cancelled first
+func (p *HybridPipeline) send(ctx context.Context, out chan<- *models.ChatCompletionResponse, chunk *models.ChatCompletionResponse) bool {
+	select {
+	case out <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// streamChunk builds a single streamed assistant chunk
+func streamChunk(content, finishReason string) *models.ChatCompletionResponse {
+	return &models.ChatCompletionResponse{
+		Choices: []models.ChatCompletionChoice{
+			{
+				Message: models.ChatCompletionMessage{
+					Role:    "assistant",
+					Content: content,
+				},
+				FinishReason: finishReason,
+			},
+		},
+	}
+}
+
+// includeReasoning reports whether the reasoning chain is returned for req
+func (p *HybridPipeline) includeReasoning(req *models.ChatCompletionRequest) bool {
+	if req.IncludeReasoning != nil {
+		return *req.IncludeReasoning
+	}
+	return p.config != nil && p.config.IncludeReasoning
 }
 
 // buildResponse creates the final API response
 func (p *HybridPipeline) buildResponse(payload *Payload) *models.ChatCompletionResponse {
-	p.Logger.Debug("Building final response with content length: %d", len(payload.FinalContent))
+	p.Logger.WithField("request_id", payload.OriginalRequest.RequestID).Debug("Building final response with content length: %d", len(payload.Final()))
 
-	return &models.ChatCompletionResponse{
+	usage := payload.TotalUsage()
+	resp := &models.ChatCompletionResponse{
+		Usage: &usage,
 		Choices: []models.ChatCompletionChoice{
 			{
 				Message: models.ChatCompletionMessage{
-					Role:             "assistant",
-					Content:          payload.FinalContent,
-					ReasoningContent: payload.ReasoningChain,
+					Role:    "assistant",
+					Content: payload.Final(),
 				},
 				FinishReason: "stop",
 			},
 		},
 	}
+	if calls := payload.Calls(); len(calls) > 0 {
+		resp.Choices[0].Message.ToolCalls = calls
+		resp.Choices[0].FinishReason = "tool_calls"
+	}
+	if _, finishReason := payload.FinishReasons(); finishReason == "content_filter" {
+		resp.Choices[0].FinishReason = finishReason
+	}
+	resp.Choices[0].LogProbs = payload.FinalLogProbs()
+	// Further choices answer from the same reasoning
+	for _, choice := range payload.AlternativeChoices() {
+		choice.Message.Role = "assistant"
+		if choice.FinishReason == "" {
+			choice.FinishReason = "stop"
+		}
+		if len(choice.Message.ToolCalls) > 0 {
+			choice.FinishReason = "tool_calls"
+		}
+		resp.Choices = append(resp.Choices, choice)
+	}
+	if p.includeReasoning(payload.OriginalRequest) {
+		for i := range resp.Choices {
+			resp.Choices[i].Message.ReasoningContent = payload.Reasoning()
+		}
+	}
+	if payload.UsedReasonerFallback() {
+		resp.Metadata = &models.ResponseMetadata{ReasonerFallback: true}
+	}
+	if reasoning, _ := payload.FinishReasons(); reasoning == "length" {
+		if resp.Metadata == nil {
+			resp.Metadata = &models.ResponseMetadata{}
+		}
+		resp.Metadata.ReasoningTruncated = true
+	}
+	if payload.IsDegraded() {
+		if resp.Metadata == nil {
+			resp.Metadata = &models.ResponseMetadata{}
+		}
+		resp.Metadata.Degraded = true
+	}
+	stampResponse(resp, payload.OriginalRequest, objectCompletion, payload.Created)
+	return resp
+}
+
+// attachConfidence scores the payload and stores the result in the response metadata.
+// Scoring failures are logged and leave the response without a confidence value.
+func (p *HybridPipeline) attachConfidence(ctx context.Context, payload *Payload, resp *models.ChatCompletionResponse) {
+	log := p.Logger.WithContext(ctx)
+	score, err := p.confidence.Score(ctx, payload)
+	if err != nil {
+		log.WithError(err).Warn("Confidence scoring with %s failed", p.confidence.Name())
+		return
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = &models.ResponseMetadata{}
+	}
+	resp.Metadata.Confidence = &score
 }
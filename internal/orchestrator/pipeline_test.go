@@ -1,8 +1,18 @@
 package orchestrator
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,7 +21,15 @@ import (
 	"github.com/sleepstars/deepempower/internal/mocks"
 	"github.com/sleepstars/deepempower/internal/modelbridge"
 	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/tokens"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func init() {
@@ -74,7 +92,8 @@ func TestHybridPipeline_Execute(t *testing.T) {
 		Logger:         logger.GetLogger().WithComponent("test_bridge"),
 	}
 
-	pipeline := NewHybridPipeline(cfg)
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
 	pipeline.SetBridge(bridge)
 
 	// Test pipeline execution
@@ -166,7 +185,8 @@ func TestHybridPipeline_ExecuteErrors(t *testing.T) {
 				Logger:         logger.GetLogger().WithComponent("test_bridge"),
 			}
 
-			pipeline := NewHybridPipeline(cfg)
+			pipeline, err := NewHybridPipeline(cfg)
+			require.NoError(t, err)
 			pipeline.SetBridge(bridge)
 
 			// Test pipeline execution with timeout context
@@ -179,7 +199,7 @@ func TestHybridPipeline_ExecuteErrors(t *testing.T) {
 				},
 			}
 
-			_, err := pipeline.Execute(ctx, req)
+			_, err = pipeline.Execute(ctx, req)
 			if tc.expectErr != "" {
 				assert.ErrorContains(t, err, tc.expectErr)
 			} else {
@@ -188,3 +208,2165 @@ func TestHybridPipeline_ExecuteErrors(t *testing.T) {
 		})
 	}
 }
+
+// testPrompts fills in the prompts every pipeline needs
+var testPrompts = config.PromptsConfig{
+	PreProcess:  "test prompt",
+	Reasoning:   "test prompt",
+	PostProcess: "test prompt",
+}
+
+// newMockPipeline builds a pipeline with the default test config wired to the given clients
+func newMockPipeline(normalClient, reasonerClient *mocks.MockModelClient) *HybridPipeline {
+	cfg := &config.PipelineConfig{
+		Models: config.ModelsConfig{
+			Normal: config.ModelConfig{
+				APIBase: "mock://normal",
+				Model:   "gpt-3.5-turbo",
+			},
+			Reasoner: config.ModelConfig{
+				APIBase: "mock://reasoner",
+				Model:   "gpt-4",
+			},
+		},
+		Prompts: testPrompts,
+	}
+
+	pipeline, err := NewHybridPipeline(cfg)
+	if err != nil {
+		panic(err)
+	}
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normalClient, reasonerClient,
+		logger.GetLogger().WithComponent("test_bridge")))
+	return pipeline
+}
+
+// staticNormalClient returns a Normal mock that always answers with content
+func staticNormalClient(content string) *mocks.MockModelClient {
+	return &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: content}},
+				},
+			}, nil
+		},
+	}
+}
+
+func TestHybridPipeline_ExecuteStream(t *testing.T) {
+	reasoningSteps := []string{"step 1", "step 2", "step 3"}
+	finalChunks := []string{"final ", "answer"}
+
+	mockNormalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "preprocessed"}},
+				},
+			}, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for i, chunk := range finalChunks {
+					resp := &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{Content: chunk}},
+						},
+					}
+					if i == len(finalChunks)-1 {
+						resp.Choices[0].FinishReason = "stop"
+					}
+					ch <- resp
+				}
+			}()
+			return ch, nil
+		},
+	}
+
+	mockReasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for _, step := range reasoningSteps {
+					ch <- &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{
+								Content:          "reasoned",
+								ReasoningContent: []string{step},
+							}},
+						},
+					}
+				}
+			}()
+			return ch, nil
+		},
+	}
+
+	pipeline := newMockPipeline(mockNormalClient, mockReasonerClient)
+	pipeline.config.IncludeReasoning = true
+
+	respChan, err := pipeline.ExecuteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test input"},
+		},
+	})
+	assert.NoError(t, err)
+
+	var reasoning, content []string
+	var finishReason string
+	for resp := range respChan {
+		msg := resp.Choices[0].Message
+		if len(msg.ReasoningContent) > 0 {
+			// Reasoning must never follow final content
+			assert.Empty(t, content, "reasoning chunk after final content")
+			assert.Empty(t, msg.Content, "reasoning chunk leaks intermediate content")
+			reasoning = append(reasoning, msg.ReasoningContent...)
+		}
+		if msg.Content != "" {
+			content = append(content, msg.Content)
+		}
+		finishReason = resp.Choices[0].FinishReason
+	}
+
+	assert.Equal(t, reasoningSteps, reasoning)
+	assert.Equal(t, finalChunks, content)
+	assert.Equal(t, "stop", finishReason)
+}
+
+func TestHybridPipeline_ExecuteStreamPreprocessError(t *testing.T) {
+	pipeline := newMockPipeline(&mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return nil, fmt.Errorf("normal client error")
+		},
+	}, &mocks.MockModelClient{})
+
+	respChan, err := pipeline.ExecuteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test input"},
+		},
+	})
+	assert.ErrorContains(t, err, "stage normal_preprocessor failed: model call: normal client error")
+	assert.Nil(t, respChan)
+}
+
+func TestHybridPipeline_RetryReasonerStage(t *testing.T) {
+	attempts := 0
+	mockReasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, fmt.Errorf("transient reasoner error")
+			}
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{
+						Content:          "reasoned",
+						ReasoningContent: []string{"step 1"},
+					}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	pipeline := newMockPipeline(staticNormalClient("test response"), mockReasonerClient)
+	pipeline.retry = newRetryPolicy(config.RetryConfig{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		RetryOn:     []string{RetryModelCall},
+	})
+
+	includeReasoning := true
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test input"},
+		},
+		IncludeReasoning: &includeReasoning,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []string{"step 1"}, resp.Choices[0].Message.ReasoningContent)
+}
+
+func TestHybridPipeline_RetryPolicy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		retry       config.RetryConfig
+		expectCalls int
+	}{
+		{
+			name:        "no retry by default",
+			retry:       config.RetryConfig{},
+			expectCalls: 1,
+		},
+		{
+			name:        "category not retryable",
+			retry:       config.RetryConfig{MaxAttempts: 3, RetryOn: []string{RetryRateLimit}},
+			expectCalls: 1,
+		},
+		{
+			name:        "attempts exhausted",
+			retry:       config.RetryConfig{MaxAttempts: 3, RetryOn: []string{RetryModelCall}},
+			expectCalls: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			pipeline := newMockPipeline(&mocks.MockModelClient{
+				CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+					calls++
+					return nil, fmt.Errorf("normal client error")
+				},
+			}, &mocks.MockModelClient{})
+			pipeline.retry = newRetryPolicy(tc.retry)
+
+			_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{
+					{Role: "user", Content: "test input"},
+				},
+			})
+			assert.ErrorIs(t, err, ErrModelCall)
+			assert.Equal(t, tc.expectCalls, calls)
+		})
+	}
+}
+
+func TestHybridPipeline_ReasonerFallback(t *testing.T) {
+	mockReasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			return nil, fmt.Errorf("reasoner unavailable")
+		},
+	}
+
+	pipeline := newMockPipeline(staticNormalClient("test response"), mockReasonerClient)
+	pipeline.bridge.ReasonerFallback = true
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test input"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test response", resp.Choices[0].Message.Content)
+	require.NotNil(t, resp.Metadata)
+	assert.True(t, resp.Metadata.ReasonerFallback)
+}
+
+// staticReasonerClient returns a Reasoner mock that streams content with the given reasoning steps
+func staticReasonerClient(content string, steps ...string) *mocks.MockModelClient {
+	return &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{
+						Content:          content,
+						ReasoningContent: steps,
+					}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+}
+
+func TestHybridPipeline_ReasoningTruncated(t *testing.T) {
+	var requests []*models.ChatCompletionRequest
+	reasonerClient := lengthLimitedReasoner(&requests, models.ChatCompletionChoice{
+		Message:      models.ChatCompletionMessage{Content: "partial", ReasoningContent: []string{"cut off"}},
+		FinishReason: "length",
+	})
+	pipeline := newMockPipeline(staticNormalClient("answer"), reasonerClient)
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+
+	// The answer is still produced, flagged as based on truncated reasoning
+	assert.Equal(t, "answer", resp.Choices[0].Message.Content)
+	require.NotNil(t, resp.Metadata)
+	assert.True(t, resp.Metadata.ReasoningTruncated)
+}
+
+// failingPostprocessClient returns a Normal mock that preprocesses and then
+// fails every postprocessing call, buffered or streamed
+func failingPostprocessClient() *mocks.MockModelClient {
+	var calls atomic.Int32
+	return &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			if calls.Add(1) > 1 {
+				return nil, fmt.Errorf("normal unavailable")
+			}
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "preprocessed"}}},
+			}, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			return nil, fmt.Errorf("normal unavailable")
+		},
+	}
+}
+
+func TestHybridPipeline_DegradedOutput(t *testing.T) {
+	request := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}}}
+	}
+
+	// Without the option the postprocessing failure fails the request
+	pipeline := newMockPipeline(failingPostprocessClient(), staticReasonerClient("reasoned answer", "step"))
+	_, err := pipeline.Execute(context.Background(), request())
+	require.Error(t, err)
+
+	pipeline = newMockPipeline(failingPostprocessClient(), staticReasonerClient("reasoned answer", "step"))
+	pipeline.config.DegradedOutput = true
+	resp, err := pipeline.Execute(context.Background(), request())
+	require.NoError(t, err)
+	assert.Equal(t, "reasoned answer", resp.Choices[0].Message.Content)
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+	require.NotNil(t, resp.Metadata)
+	assert.True(t, resp.Metadata.Degraded)
+
+	// A streamed answer arrives as one chunk flagged as degraded
+	pipeline = newMockPipeline(failingPostprocessClient(), staticReasonerClient("reasoned answer", "step"))
+	pipeline.config.DegradedOutput = true
+	stream, err := pipeline.ExecuteStream(context.Background(), request())
+	require.NoError(t, err)
+	var chunks []*models.ChatCompletionResponse
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "reasoned answer", chunks[0].Choices[0].Message.Content)
+	assert.Equal(t, "stop", chunks[0].Choices[0].FinishReason)
+	require.NotNil(t, chunks[0].Metadata)
+	assert.True(t, chunks[0].Metadata.Degraded)
+
+	// JSON answers are not degraded since the reasoner result is not checked
+	pipeline = newMockPipeline(failingPostprocessClient(), staticReasonerClient("reasoned answer", "step"))
+	pipeline.config.DegradedOutput = true
+	jsonRequest := request()
+	jsonRequest.ResponseFormat = &models.ResponseFormat{Type: models.ResponseFormatJSONObject}
+	_, err = pipeline.Execute(context.Background(), jsonRequest)
+	require.Error(t, err)
+}
+
+func TestHybridPipeline_UsageAggregation(t *testing.T) {
+	normalCalls := 0
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			normalCalls++
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "normal response"}},
+				},
+				Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+	}
+	reasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse, 2)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "reasoned", ReasoningContent: []string{"step"}}},
+				},
+			}
+			// Trailing usage-only chunk
+			ch <- &models.ChatCompletionResponse{
+				Usage: &models.Usage{PromptTokens: 20, CompletionTokens: 40, TotalTokens: 60},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	resp, err := newMockPipeline(normalClient, reasonerClient).Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, normalCalls)
+	require.NotNil(t, resp.Usage)
+	assert.Equal(t, models.Usage{PromptTokens: 40, CompletionTokens: 50, TotalTokens: 90}, *resp.Usage)
+}
+
+func TestNewHybridPipeline_StageModels(t *testing.T) {
+	cfg := &config.PipelineConfig{
+		Models: config.ModelsConfig{
+			Normal:   config.ModelConfig{APIBase: "http://normal", Model: "normal-model"},
+			Reasoner: config.ModelConfig{APIBase: "http://reasoner", Model: "reasoner-model"},
+			Named: map[string]config.ModelConfig{
+				"Cheap": {APIBase: "http://cheap", Model: "cheap-model"},
+			},
+		},
+		Stages: config.StagesConfig{
+			PreProcess:  "Cheap",
+			PostProcess: "Cheap",
+		},
+		Prompts: testPrompts,
+	}
+
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	require.Len(t, pipeline.stages, 3)
+	pre := pipeline.stages[0].(*NormalPreprocessor)
+	engine := pipeline.stages[1].(*ReasonerEngine)
+	post := pipeline.stages[2].(*NormalPostprocessor)
+
+	assert.Equal(t, "cheap-model", pre.config.Model)
+	assert.Equal(t, "reasoner-model", engine.config.Model)
+	assert.Equal(t, "cheap-model", post.config.Model)
+
+	// Stages on the same named model share a bridge; defaults use the pipeline bridge
+	assert.Same(t, pre.bridge, post.bridge)
+	assert.NotSame(t, pipeline.bridge, pre.bridge)
+	assert.Same(t, pipeline.bridge, engine.bridge)
+	assert.Same(t, pipeline.bridge.ReasonerClient, pre.bridge.ReasonerClient)
+	assert.NotSame(t, pipeline.bridge.NormalClient, pre.bridge.NormalClient)
+}
+
+func TestNewHybridPipeline_UnknownStageModel(t *testing.T) {
+	cfg := &config.PipelineConfig{
+		Models: config.ModelsConfig{
+			Normal:   config.ModelConfig{Model: "normal-model"},
+			Reasoner: config.ModelConfig{Model: "reasoner-model"},
+		},
+		Stages:  config.StagesConfig{Reasoning: "Missing"},
+		Prompts: testPrompts,
+	}
+
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	engine := pipeline.stages[1].(*ReasonerEngine)
+	assert.Equal(t, "reasoner-model", engine.config.Model)
+	assert.Same(t, pipeline.bridge, engine.bridge)
+}
+
+func TestHybridPipeline_StageModelInRequest(t *testing.T) {
+	var requested []string
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			requested = append(requested, req.Model)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "ok"}},
+				},
+			}, nil
+		},
+	}
+	pipeline := newMockPipeline(normalClient, staticReasonerClient("reasoned", "step"))
+
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Model:    "hybrid_v1",
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-3.5-turbo", "gpt-3.5-turbo"}, requested)
+}
+
+func TestNewHybridPipeline_MalformedTemplate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prompts  config.PromptsConfig
+		expected string
+	}{
+		{
+			name:     "pre_process",
+			prompts:  config.PromptsConfig{PreProcess: "Analyze {{", Reasoning: "ok", PostProcess: "ok"},
+			expected: "parse normal_preprocessor prompt template",
+		},
+		{
+			name:     "reasoning",
+			prompts:  config.PromptsConfig{PreProcess: "ok", Reasoning: "Think {{.StructuredInput", PostProcess: "ok"},
+			expected: "parse reasoner_engine prompt template",
+		},
+		{
+			name:     "post_process",
+			prompts:  config.PromptsConfig{PreProcess: "ok", Reasoning: "ok", PostProcess: "{{end}}"},
+			expected: "parse normal_postprocessor prompt template",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline, err := NewHybridPipeline(&config.PipelineConfig{Prompts: tc.prompts})
+			assert.Nil(t, pipeline)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+func TestHybridPipeline_GeneratedRequestID(t *testing.T) {
+	// A request without an ID gets one before any stage runs, and every
+	// model call sees the ID the response carries
+	var mu sync.Mutex
+	var seen []string
+	record := func(ctx context.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, logger.RequestIDFromContext(ctx))
+	}
+	normalClient := staticNormalClient("answer")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		record(ctx)
+		return complete(ctx, req)
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(ctx)
+		return stream(ctx, req)
+	}
+
+	resp, err := newMockPipeline(normalClient, reasonerClient).Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "question"}},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.ID)
+	require.Len(t, seen, 3)
+	for _, id := range seen {
+		assert.NotEmpty(t, id)
+		assert.Contains(t, resp.ID, id)
+	}
+}
+
+func TestHybridPipeline_RequestScopedLogging(t *testing.T) {
+	var buf bytes.Buffer
+	base := logger.GetLogger()
+	base.SetLevel(logger.DEBUG)
+	logger.WithOutput(&buf)(base)
+	defer func() {
+		base.SetLevel(logger.INFO)
+		logger.WithOutput(os.Stdout)(base)
+	}()
+
+	// Every model call must see the request ID of the request it serves. The
+	// mocks echo the user content, which starts with the request ID.
+	checkContext := func(ctx context.Context, req *models.ChatCompletionRequest) string {
+		content := req.Messages[len(req.Messages)-1].Content
+		assert.True(t, strings.HasPrefix(content, logger.RequestIDFromContext(ctx)+":"),
+			"request id %q does not match content %q", logger.RequestIDFromContext(ctx), content)
+		return content
+	}
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			content := checkContext(ctx, req)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: content}}},
+			}, nil
+		},
+	}
+	reasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			content := checkContext(ctx, req)
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: content, ReasoningContent: []string{"step"}}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+	pipeline := newMockPipeline(normalClient, reasonerClient)
+
+	const requests = 20
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				RequestID: id,
+				Messages:  []models.ChatCompletionMessage{{Role: "user", Content: id + ": question"}},
+			})
+			assert.NoError(t, err)
+		}(fmt.Sprintf("req-%d", i))
+	}
+	wg.Wait()
+
+	// Every stage line carries exactly one request ID and each request logs the same lines
+	perRequest := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, "[normal_preprocessor]") &&
+			!strings.Contains(line, "[reasoner_engine]") &&
+			!strings.Contains(line, "[normal_postprocessor]") &&
+			!strings.Contains(line, "[test_bridge]") {
+			continue
+		}
+		require.Equal(t, 1, strings.Count(line, "request_id="), "line without request id: %s", line)
+		id := line[strings.Index(line, "request_id=")+len("request_id="):]
+		perRequest[strings.Fields(id)[0]]++
+	}
+	require.Len(t, perRequest, requests)
+	for id, count := range perRequest {
+		assert.Equal(t, perRequest["req-0"], count, "request %s logged a different number of lines", id)
+	}
+}
+
+func TestPayload_ConcurrentAccess(t *testing.T) {
+	payload := &Payload{}
+
+	const workers, steps = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < steps; i++ {
+				payload.AppendReasoning(fmt.Sprintf("worker %d step %d", w, i))
+				payload.AddUsage(&models.Usage{TotalTokens: 1})
+				payload.SetIntermContent(fmt.Sprintf("worker %d", w))
+				_ = payload.Reasoning()
+				_ = payload.Interm()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Len(t, payload.Reasoning(), workers*steps)
+	assert.Equal(t, workers*steps, payload.TotalUsage().TotalTokens)
+	assert.Contains(t, payload.Interm(), "worker ")
+}
+
+// retrievalStage is a custom stage that appends context to the intermediate content
+type retrievalStage struct{}
+
+func (retrievalStage) Name() string {
+	return "retrieval"
+}
+
+func (retrievalStage) Execute(ctx context.Context, data *Payload) error {
+	data.SetIntermContent(data.Interm() + "\nretrieved context")
+	return nil
+}
+
+func TestHybridPipeline_RegisterStage(t *testing.T) {
+	var reasonerInput string
+	reasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			reasonerInput = req.Messages[len(req.Messages)-1].Content
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "reasoned", ReasoningContent: []string{"step"}}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+	pipeline := newMockPipeline(staticNormalClient("preprocessed"), reasonerClient)
+
+	require.NoError(t, pipeline.RegisterStage(1, retrievalStage{}))
+
+	var names []string
+	for _, stage := range pipeline.Stages() {
+		names = append(names, stage.Name())
+	}
+	assert.Equal(t, []string{"normal_preprocessor", "retrieval", "reasoner_engine", "normal_postprocessor"}, names)
+
+	req := &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	}
+	_, err := pipeline.Execute(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "preprocessed\nretrieved context", reasonerInput)
+
+	reasonerInput = ""
+	stream, err := pipeline.ExecuteStream(context.Background(), req)
+	require.NoError(t, err)
+	for range stream {
+	}
+	assert.Equal(t, "preprocessed\nretrieved context", reasonerInput)
+}
+
+func TestHybridPipeline_RegisterStageOutOfRange(t *testing.T) {
+	pipeline := newMockPipeline(staticNormalClient("test"), staticReasonerClient("test"))
+
+	assert.Error(t, pipeline.RegisterStage(-1, retrievalStage{}))
+	assert.Error(t, pipeline.RegisterStage(4, retrievalStage{}))
+	assert.Error(t, pipeline.RegisterStage(0, nil))
+	assert.Len(t, pipeline.Stages(), 3)
+
+	require.NoError(t, pipeline.RegisterStage(3, retrievalStage{}))
+	assert.Equal(t, "retrieval", pipeline.Stages()[3].Name())
+}
+
+func TestHybridPipeline_StageHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		reasoner *mocks.MockModelClient
+		stream   bool
+		events   []string
+	}{
+		{
+			name:     "success",
+			reasoner: staticReasonerClient("reasoned", "step"),
+			events: []string{
+				"start normal_preprocessor", "end normal_preprocessor <nil>",
+				"start reasoner_engine", "end reasoner_engine <nil>",
+				"start normal_postprocessor", "end normal_postprocessor <nil>",
+			},
+		},
+		{
+			name:     "stream",
+			reasoner: staticReasonerClient("reasoned", "step"),
+			stream:   true,
+			events: []string{
+				"start normal_preprocessor", "end normal_preprocessor <nil>",
+				"start reasoner_engine", "end reasoner_engine <nil>",
+				"start normal_postprocessor", "end normal_postprocessor <nil>",
+			},
+		},
+		{
+			name: "failure",
+			reasoner: &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					return nil, fmt.Errorf("reasoner down")
+				},
+			},
+			events: []string{
+				"start normal_preprocessor", "end normal_preprocessor <nil>",
+				"start reasoner_engine", "end reasoner_engine stage reasoner_engine failed: model call: reasoner down",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalClient := staticNormalClient("test response")
+			normalClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				ch := make(chan *models.ChatCompletionResponse, 1)
+				ch <- &models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{Message: models.ChatCompletionMessage{Content: "test response"}, FinishReason: "stop"},
+					},
+				}
+				close(ch)
+				return ch, nil
+			}
+			pipeline := newMockPipeline(normalClient, tt.reasoner)
+
+			var mu sync.Mutex
+			var events []string
+			pipeline.OnStageStart(func(stageName string, payload *Payload, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				assert.NoError(t, err)
+				events = append(events, "start "+stageName)
+			})
+			pipeline.OnStageEnd(func(stageName string, payload *Payload, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, fmt.Sprintf("end %s %v", stageName, err))
+			})
+
+			req := &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+			}
+			if tt.stream {
+				stream, err := pipeline.ExecuteStream(context.Background(), req)
+				require.NoError(t, err)
+				for range stream {
+				}
+			} else {
+				_, _ = pipeline.Execute(context.Background(), req)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.events, events)
+		})
+	}
+}
+
+func TestHybridPipeline_StageTimeout(t *testing.T) {
+	blockingReasoner := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	pipeline := newMockPipeline(staticNormalClient("test response"), blockingReasoner)
+	pipeline.stageTimeout = 20 * time.Millisecond
+
+	start := time.Now()
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, err, ErrStageTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var stageErr *StageError
+	require.ErrorAs(t, err, &stageErr)
+	assert.Equal(t, "reasoner_engine", stageErr.Stage)
+	assert.Contains(t, err.Error(), "stage reasoner_engine failed: timed out after 20ms")
+}
+
+func TestHybridPipeline_StageTimeoutRequestCancelled(t *testing.T) {
+	blockingReasoner := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	pipeline := newMockPipeline(staticNormalClient("test response"), blockingReasoner)
+	pipeline.stageTimeout = time.Minute
+
+	// The request deadline expires first, so the error is not a stage timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pipeline.Execute(ctx, &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrStageTimeout)
+}
+
+func TestHybridPipeline_DefaultRequestTimeout(t *testing.T) {
+	deadlines := make(chan time.Time, 1)
+	blockingReasoner := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			deadline, _ := ctx.Deadline()
+			deadlines <- deadline
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	pipeline := newMockPipeline(staticNormalClient("test response"), blockingReasoner)
+	pipeline.requestTimeout = 20 * time.Millisecond
+	request := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}}}
+	}
+
+	// A background context gets the default timeout
+	start := time.Now()
+	_, err := pipeline.Execute(context.Background(), request())
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrStageTimeout)
+	assert.WithinDuration(t, start.Add(20*time.Millisecond), <-deadlines, 10*time.Millisecond)
+
+	// The caller's own deadline is kept, even when it is longer
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	callerDeadline, _ := ctx.Deadline()
+	_, err = pipeline.Execute(ctx, request())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, callerDeadline, <-deadlines)
+
+	// Streaming runs are bounded too
+	pipeline.config.IncludeReasoning = true
+	stream, err := pipeline.ExecuteStream(context.Background(), request())
+	require.NoError(t, err)
+	for range stream {
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	<-deadlines
+}
+
+func TestHybridPipeline_MaxTotalLatency(t *testing.T) {
+	// Every model call takes 30ms, well within the stage timeout, but the
+	// three stages together run past the 50ms ceiling
+	delay := func(ctx context.Context) error {
+		select {
+		case <-time.After(30 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	normal := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			if err := delay(ctx); err != nil {
+				return nil, err
+			}
+			return &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "answer"}}}}, nil
+		},
+	}
+	reasoner := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			if err := delay(ctx); err != nil {
+				return nil, err
+			}
+			return staticReasonerClient("reasoned", "step").CompleteStream(ctx, req)
+		},
+	}
+	pipeline := newMockPipeline(normal, reasoner)
+	pipeline.stageTimeout = time.Second
+	pipeline.maxTotalLatency = 50 * time.Millisecond
+	pipeline.config.DegradedOutput = true
+	request := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}}}
+	}
+
+	start := time.Now()
+	_, err := pipeline.Execute(context.Background(), request())
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, err, ErrDeadlineExceeded)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrStageTimeout)
+	var deadlineErr *deadlineError
+	require.ErrorAs(t, err, &deadlineErr)
+	assert.Equal(t, 50*time.Millisecond, deadlineErr.limit)
+	assert.GreaterOrEqual(t, deadlineErr.elapsed, 50*time.Millisecond)
+	assert.Contains(t, err.Error(), "pipeline deadline exceeded: stopped after")
+
+	// A run finishing within the ceiling is unaffected
+	pipeline.maxTotalLatency = time.Second
+	resp, err := pipeline.Execute(context.Background(), request())
+	require.NoError(t, err)
+	assert.Equal(t, "answer", resp.Choices[0].Message.Content)
+}
+
+func TestHybridPipeline_IncludeReasoning(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name      string
+		configure bool
+		request   *bool
+		want      bool
+	}{
+		{name: "off by default"},
+		{name: "enabled in config", configure: true, want: true},
+		{name: "requested", request: &on, want: true},
+		{name: "request overrides config", configure: true, request: &off},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var postprocessInput string
+			normalClient := staticNormalClient("final answer")
+			complete := normalClient.CompleteFunc
+			normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+				postprocessInput = req.Messages[0].Content
+				return complete(ctx, req)
+			}
+			normalClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				ch := make(chan *models.ChatCompletionResponse, 1)
+				ch <- &models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{Message: models.ChatCompletionMessage{Content: "final answer"}, FinishReason: "stop"},
+					},
+				}
+				close(ch)
+				return ch, nil
+			}
+
+			pipeline := newMockPipeline(normalClient, staticReasonerClient("reasoned", "step 1", "step 2"))
+			postprocessor, err := newNormalPostprocessor("{{range .ReasoningChain}}{{.}};{{end}}", pipeline.bridge)
+			require.NoError(t, err)
+			pipeline.stages[2] = postprocessor
+			pipeline.config.IncludeReasoning = tt.configure
+			req := &models.ChatCompletionRequest{
+				Messages:         []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+				IncludeReasoning: tt.request,
+			}
+
+			resp, err := pipeline.Execute(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, "final answer", resp.Choices[0].Message.Content)
+			// The postprocessor always sees the reasoning chain
+			assert.Equal(t, "step 1;step 2;", postprocessInput)
+			if tt.want {
+				assert.Equal(t, []string{"step 1", "step 2"}, resp.Choices[0].Message.ReasoningContent)
+			} else {
+				assert.Empty(t, resp.Choices[0].Message.ReasoningContent)
+			}
+
+			stream, err := pipeline.ExecuteStream(context.Background(), req)
+			require.NoError(t, err)
+			var reasoning []string
+			for chunk := range stream {
+				reasoning = append(reasoning, chunk.Choices[0].Message.ReasoningContent...)
+			}
+			if tt.want {
+				assert.Equal(t, []string{"step 1", "step 2"}, reasoning)
+			} else {
+				assert.Empty(t, reasoning)
+			}
+		})
+	}
+}
+
+func TestHybridPipeline_ExtraParams(t *testing.T) {
+	extra := map[string]interface{}{"temperature": 1.2}
+	var forwarded []map[string]interface{}
+	var mu sync.Mutex
+	record := func(req *models.ChatCompletionRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		forwarded = append(forwarded, req.ExtraParams)
+	}
+
+	normalClient := staticNormalClient("test response")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		record(req)
+		return complete(ctx, req)
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(req)
+		return stream(ctx, req)
+	}
+
+	pipeline := newMockPipeline(normalClient, reasonerClient)
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages:    []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+		ExtraParams: extra,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{extra, extra, extra}, forwarded)
+}
+
+func TestHybridPipeline_Mode(t *testing.T) {
+	tests := []struct {
+		name          string
+		configMode    string
+		requestMode   string
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "hybrid by default", expectedCalls: 3},
+		{name: "hybrid request", requestMode: config.ModeHybrid, expectedCalls: 3},
+		{name: "passthrough request", requestMode: config.ModePassthrough, expectedCalls: 1},
+		{name: "passthrough config", configMode: config.ModePassthrough, expectedCalls: 1},
+		{name: "request overrides config", configMode: config.ModePassthrough, requestMode: config.ModeHybrid, expectedCalls: 3},
+		{name: "unknown mode", requestMode: "direct", expectedErr: ErrUnknownMode},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			normal := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "normal answer"})
+			reasoner := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "reasoned", Reasoning: []string{"step"}})
+			pipeline := newMockPipeline(nil, nil)
+			pipeline.config.Mode = tc.configMode
+			pipeline.SetBridge(&modelbridge.ModelBridge{
+				NormalClient:   normal,
+				ReasonerClient: reasoner,
+				Logger:         logger.GetLogger().WithComponent("test_bridge"),
+			})
+
+			req := &models.ChatCompletionRequest{
+				Model:    "deepempower",
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				Mode:     tc.requestMode,
+			}
+			resp, err := pipeline.Execute(context.Background(), req)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				_, err = pipeline.ExecuteStream(context.Background(), req)
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "normal answer", resp.Choices[0].Message.Content)
+			assert.Equal(t, tc.expectedCalls, normal.Calls()+reasoner.Calls())
+
+			if tc.expectedCalls == 1 {
+				// The conversation reaches the Normal model unchanged
+				assert.Equal(t, 0, reasoner.Calls())
+				sent := normal.Requests()[0]
+				assert.Equal(t, req.Messages, sent.Messages)
+				assert.Equal(t, "gpt-3.5-turbo", sent.Model)
+			}
+		})
+	}
+}
+
+func TestHybridPipeline_AnswerSamplingParams(t *testing.T) {
+	normal := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "normal answer"})
+	reasoner := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "reasoned", Reasoning: []string{"step"}})
+	pipeline := newMockPipeline(nil, nil)
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normal, reasoner, nil))
+
+	req := &models.ChatCompletionRequest{
+		Messages:         []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+		Stop:             models.StopSequences{"END"},
+		TopP:             0.9,
+		PresencePenalty:  0.5,
+		FrequencyPenalty: 0.25,
+	}
+	_, err := pipeline.Execute(context.Background(), req)
+	require.NoError(t, err)
+
+	// The answer call carries them, the preprocessing call does not
+	sent := normal.Requests()
+	require.Len(t, sent, 2)
+	assert.Empty(t, sent[0].Stop)
+	answer := sent[1]
+	assert.Equal(t, req.Stop, answer.Stop)
+	assert.Equal(t, req.TopP, answer.TopP)
+	assert.Equal(t, req.PresencePenalty, answer.PresencePenalty)
+	assert.Equal(t, req.FrequencyPenalty, answer.FrequencyPenalty)
+}
+
+func TestHybridPipeline_PassthroughSamplingParams(t *testing.T) {
+	normal := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "normal answer"})
+	pipeline := newMockPipeline(nil, nil)
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normal, mocks.NewScriptedModelClient(), nil))
+
+	req := &models.ChatCompletionRequest{
+		Messages:         []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+		Mode:             config.ModePassthrough,
+		Temperature:      0.3,
+		MaxTokens:        64,
+		Stop:             models.StopSequences{"END"},
+		TopP:             0.9,
+		PresencePenalty:  0.5,
+		FrequencyPenalty: 0.25,
+	}
+	_, err := pipeline.Execute(context.Background(), req)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, normal.Calls())
+	sent := normal.Requests()[0]
+	assert.Equal(t, req.Temperature, sent.Temperature)
+	assert.Equal(t, req.MaxTokens, sent.MaxTokens)
+	assert.Equal(t, req.Stop, sent.Stop)
+	assert.Equal(t, req.TopP, sent.TopP)
+	assert.Equal(t, req.PresencePenalty, sent.PresencePenalty)
+	assert.Equal(t, req.FrequencyPenalty, sent.FrequencyPenalty)
+}
+
+func TestNewHybridPipeline_PassthroughModel(t *testing.T) {
+	var received *models.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+			Choices: []models.ChatCompletionChoice{
+				{Message: models.ChatCompletionMessage{Role: "assistant", Content: "cheap answer"}, FinishReason: "stop"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	cfg := newMockPipeline(nil, nil).config
+	cfg.Mode = config.ModePassthrough
+	cfg.PassthroughModel = "Cheap"
+	cfg.Models.Named = map[string]config.ModelConfig{
+		"Cheap": {APIBase: server.URL, Model: "cheap-model"},
+	}
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cheap answer", resp.Choices[0].Message.Content)
+	assert.Equal(t, "cheap-model", received.Model)
+	assert.Equal(t, "hello", received.Messages[0].Content)
+}
+
+func TestNewHybridPipeline_DefaultParamsPrecedence(t *testing.T) {
+	tests := []struct {
+		name          string
+		modelParams   map[string]interface{}
+		request       models.ChatCompletionRequest
+		expectedTemp  float64
+		expectedLimit float64
+	}{
+		{
+			name:          "pipeline defaults",
+			expectedTemp:  0.1,
+			expectedLimit: 50,
+		},
+		{
+			name:          "model defaults override pipeline defaults",
+			modelParams:   map[string]interface{}{"temperature": 0.5},
+			expectedTemp:  0.5,
+			expectedLimit: 50,
+		},
+		{
+			name:        "request overrides both",
+			modelParams: map[string]interface{}{"temperature": 0.5, "max_tokens": 80},
+			request: models.ChatCompletionRequest{
+				ExtraParams: map[string]interface{}{"temperature": 0.9, "max_tokens": 200},
+			},
+			expectedTemp:  0.9,
+			expectedLimit: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{
+						{Message: models.ChatCompletionMessage{Role: "assistant", Content: "answer"}, FinishReason: "stop"},
+					},
+				})
+			}))
+			defer server.Close()
+
+			cfg := newMockPipeline(nil, nil).config
+			cfg.Mode = config.ModePassthrough
+			cfg.PassthroughModel = "Cheap"
+			cfg.DefaultParams = map[string]interface{}{"temperature": 0.1, "max_tokens": 50}
+			cfg.Models.Named = map[string]config.ModelConfig{
+				"Cheap": {APIBase: server.URL, Model: "cheap-model", DefaultParams: tt.modelParams},
+			}
+			pipeline, err := NewHybridPipeline(cfg)
+			require.NoError(t, err)
+
+			req := tt.request
+			req.Messages = []models.ChatCompletionMessage{{Role: "user", Content: "hello"}}
+			_, err = pipeline.Execute(context.Background(), &req)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expectedTemp, received["temperature"], 1e-6)
+			assert.Equal(t, tt.expectedLimit, received["max_tokens"])
+		})
+	}
+}
+
+func TestHybridPipeline_ResponseIdentity(t *testing.T) {
+	pipeline := newMockPipeline(streamingPostprocessClient("final ", "answer"), staticReasonerClient("reasoned", "step"))
+	start := time.Now().Unix()
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		RequestID: "req-42",
+		Messages:  []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "chatcmpl-req-42", resp.ID)
+	assert.Equal(t, "chat.completion", resp.Object)
+	assert.GreaterOrEqual(t, resp.Created, start)
+	assert.Equal(t, "gpt-3.5-turbo", resp.Model)
+
+	// An explicit model is reported back
+	resp, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Model:    "deepempower",
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "deepempower", resp.Model)
+	assert.Regexp(t, `^chatcmpl-req_\d+$`, resp.ID)
+
+	// Every chunk of a stream shares the same identity
+	stream, err := pipeline.ExecuteStream(context.Background(), &models.ChatCompletionRequest{
+		RequestID: "req-43",
+		Messages:  []models.ChatCompletionMessage{{Role: "user", Content: "test input"}},
+	})
+	require.NoError(t, err)
+	var chunks []*models.ChatCompletionResponse
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	require.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		assert.Equal(t, "chatcmpl-req-43", chunk.ID)
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Equal(t, chunks[0].Created, chunk.Created)
+		assert.GreaterOrEqual(t, chunk.Created, start)
+		assert.Equal(t, "gpt-3.5-turbo", chunk.Model)
+	}
+}
+
+// streamingPostprocessClient answers Complete with a fixed preprocessing
+// result and streams chunks as the postprocessing output
+func streamingPostprocessClient(chunks ...string) *mocks.MockModelClient {
+	client := staticNormalClient("preprocessed")
+	client.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		ch := make(chan *models.ChatCompletionResponse, len(chunks))
+		for i, chunk := range chunks {
+			resp := &models.ChatCompletionResponse{
+				ID:      "upstream-id",
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: chunk}}},
+			}
+			if i == len(chunks)-1 {
+				resp.Choices[0].FinishReason = "stop"
+			}
+			ch <- resp
+		}
+		close(ch)
+		return ch, nil
+	}
+	return client
+}
+
+// recordSpans installs a tracer provider recording every span until the
+// test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return rec
+}
+
+// spanAttr returns the value of the named span attribute
+func spanAttr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHybridPipeline_Tracing(t *testing.T) {
+	rec := recordSpans(t)
+
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "normal response"}},
+				},
+				Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+	}
+	pipeline := newMockPipeline(normalClient, staticReasonerClient("reasoned", "step"))
+
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Model:     "deepempower",
+		RequestID: "req-trace",
+		Messages:  []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+
+	spans := rec.Started()
+	require.Len(t, spans, 7)
+	root := spans[0]
+	assert.Equal(t, "pipeline.execute", root.Name())
+	assert.False(t, root.Parent().IsValid())
+	assert.Equal(t, "req-trace", spanAttr(root, "request.id").AsString())
+	assert.Equal(t, "deepempower", spanAttr(root, "model.name").AsString())
+	assert.Equal(t, int64(30), spanAttr(root, "usage.total_tokens").AsInt64())
+
+	// Each stage span is a child of the root with one model call below it
+	stages := []struct{ name, client string }{
+		{"normal_preprocessor", "Normal"},
+		{"reasoner_engine", "Reasoner"},
+		{"normal_postprocessor", "Normal"},
+	}
+	for i, stage := range stages {
+		stageSpan, call := spans[1+2*i], spans[2+2*i]
+		assert.Equal(t, "pipeline.stage", stageSpan.Name())
+		assert.Equal(t, stage.name, spanAttr(stageSpan, "stage.name").AsString())
+		assert.Equal(t, root.SpanContext().SpanID(), stageSpan.Parent().SpanID())
+
+		assert.Equal(t, "model.call", call.Name())
+		assert.Equal(t, stage.client, spanAttr(call, "model.client").AsString())
+		assert.Equal(t, stageSpan.SpanContext().SpanID(), call.Parent().SpanID())
+		assert.Equal(t, root.SpanContext().TraceID(), call.SpanContext().TraceID())
+	}
+	assert.Equal(t, int64(15), spanAttr(spans[2], "usage.total_tokens").AsInt64())
+	assert.Len(t, rec.Ended(), 7)
+	for _, span := range spans {
+		assert.NotEqual(t, codes.Error, span.Status().Code, span.Name())
+	}
+}
+
+func TestHybridPipeline_TracingError(t *testing.T) {
+	rec := recordSpans(t)
+
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return nil, errors.New("upstream down")
+		},
+	}
+	_, err := newMockPipeline(normalClient, staticReasonerClient("reasoned")).Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.Error(t, err)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.Equal(t, codes.Error, span.Status().Code, span.Name())
+		assert.Contains(t, span.Status().Description, "upstream down", span.Name())
+	}
+}
+
+func TestHybridPipeline_SystemPrompt(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*models.ChatCompletionRequest
+	record := func(req *models.ChatCompletionRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}
+
+	normalClient := staticNormalClient("normal response")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		record(req)
+		return complete(ctx, req)
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(req)
+		return stream(ctx, req)
+	}
+
+	pipeline := newMockPipeline(normalClient, reasonerClient)
+	pipeline.config.SystemPrompt = "You are a careful assistant."
+
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+
+	// Preprocessor, reasoner and postprocessor each lead with the global prompt
+	require.Len(t, requests, 3)
+	for _, req := range requests {
+		require.Len(t, req.Messages, 3)
+		assert.Equal(t, models.ChatCompletionMessage{Role: "system", Content: "You are a careful assistant."}, req.Messages[0])
+		assert.Equal(t, "system", req.Messages[1].Role)
+		assert.Equal(t, "test prompt", req.Messages[1].Content)
+	}
+
+	// Passthrough requests lead with it too, ahead of the caller's messages
+	requests = nil
+	_, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Mode:     config.ModePassthrough,
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, []models.ChatCompletionMessage{
+		{Role: "system", Content: "You are a careful assistant."},
+		{Role: "user", Content: "test"},
+	}, requests[0].Messages)
+}
+
+func TestNewHybridPipeline_Examples(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*models.ChatCompletionRequest
+	record := func(req *models.ChatCompletionRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}
+
+	normalClient := staticNormalClient("normal response")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		record(req)
+		return complete(ctx, req)
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(req)
+		return stream(ctx, req)
+	}
+
+	cfg := newMockPipeline(nil, nil).config
+	cfg.SystemPrompt = "Be careful."
+	cfg.Examples = config.ExamplesConfig{
+		PreProcess: []config.ExampleMessage{
+			{Role: "user", Content: "what's 2+2"},
+			{Role: "assistant", Content: "Task: add 2 and 2"},
+			{Role: "user", Content: "capital of france?"},
+			{Role: "assistant", Content: "Task: name the capital of France"},
+		},
+		Reasoning: []config.ExampleMessage{
+			{Role: "user", Content: "Task: add 2 and 2"},
+			{Role: "assistant", Content: "2 plus 2 is 4"},
+		},
+	}
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normalClient, reasonerClient, nil))
+
+	_, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+
+	system := models.ChatCompletionMessage{Role: "system", Content: "Be careful."}
+	prompt := models.ChatCompletionMessage{Role: "system", Content: "test prompt"}
+	// The examples sit between the stage prompt and the user turn, in order
+	assert.Equal(t, []models.ChatCompletionMessage{
+		system, prompt,
+		{Role: "user", Content: "what's 2+2"},
+		{Role: "assistant", Content: "Task: add 2 and 2"},
+		{Role: "user", Content: "capital of france?"},
+		{Role: "assistant", Content: "Task: name the capital of France"},
+		{Role: "user", Content: "test"},
+	}, requests[0].Messages)
+	assert.Equal(t, []models.ChatCompletionMessage{
+		system, prompt,
+		{Role: "user", Content: "Task: add 2 and 2"},
+		{Role: "assistant", Content: "2 plus 2 is 4"},
+		{Role: "user", Content: "normal response"},
+	}, requests[1].Messages)
+	// Stages without examples are unchanged
+	assert.Equal(t, []models.ChatCompletionMessage{
+		system, prompt,
+		{Role: "user", Content: "reasoned"},
+	}, requests[2].Messages)
+}
+
+func TestNewHybridPipeline_DisablePreprocessing(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*models.ChatCompletionRequest
+	record := func(req *models.ChatCompletionRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}
+
+	normalClient := staticNormalClient("final answer")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		record(req)
+		return complete(ctx, req)
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(req)
+		return stream(ctx, req)
+	}
+
+	cfg := newMockPipeline(nil, nil).config
+	cfg.DisablePreprocessing = true
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normalClient, reasonerClient, nil))
+	require.Len(t, pipeline.Stages(), 2)
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "what's 2+2"},
+			{Role: "assistant", Content: "The answer is"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "final answer", resp.Choices[0].Message.Content)
+
+	// The reasoner is called first, on the user input without the prefill
+	require.Len(t, requests, 2)
+	assert.True(t, requests[0].Stream)
+	assert.Equal(t, models.ChatCompletionMessage{Role: "user", Content: "what's 2+2"},
+		requests[0].Messages[len(requests[0].Messages)-1])
+	// The postprocessor answers from the reasoner's result
+	assert.Contains(t, requests[1].Messages, models.ChatCompletionMessage{Role: "user", Content: "reasoned"})
+}
+
+func TestNewHybridPipeline_ContextWindow(t *testing.T) {
+	request := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{
+			Messages: []models.ChatCompletionMessage{{Role: "user", Content: strings.Repeat("a long question ", 20)}},
+		}
+	}
+	newPipeline := func(reject bool, calls *atomic.Int32) *HybridPipeline {
+		normalClient := staticNormalClient("normal response")
+		complete := normalClient.CompleteFunc
+		normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			calls.Add(1)
+			return complete(ctx, req)
+		}
+		cfg := newMockPipeline(nil, nil).config
+		cfg.Models.Normal.ContextWindow = 20
+		cfg.RejectOverContext = reject
+		pipeline, err := NewHybridPipeline(cfg)
+		require.NoError(t, err)
+		pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normalClient, staticReasonerClient("reasoned", "step"), nil))
+		return pipeline
+	}
+
+	// By default an oversized prompt is only reported
+	var calls atomic.Int32
+	_, err := newPipeline(false, &calls).Execute(context.Background(), request())
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	calls.Store(0)
+	_, err = newPipeline(true, &calls).Execute(context.Background(), request())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrContextWindowExceeded)
+	var stageErr *StageError
+	require.ErrorAs(t, err, &stageErr)
+	assert.Equal(t, "normal_preprocessor", stageErr.Stage)
+	assert.Equal(t, int32(0), calls.Load())
+
+	// Prompts within the window pass
+	_, err = newPipeline(true, &calls).Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+}
+
+func TestBuildStageRequest_ContextWindowMargin(t *testing.T) {
+	cfg := newMockPipeline(nil, nil).config
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	stage := pipeline.stages[0].(*NormalPreprocessor)
+	data := &Payload{
+		OriginalRequest: &models.ChatCompletionRequest{
+			Messages: []models.ChatCompletionMessage{{Role: "user", Content: strings.Repeat("a long question ", 20)}},
+		},
+		RejectOverContext: true,
+	}
+	req, err := stage.buildRequest(context.Background(), data)
+	require.NoError(t, err)
+	estimate := tokens.EstimateRequest(req)
+	log := logger.GetLogger()
+
+	// An estimate past the window by less than the margin may be an
+	// overestimate, so the call goes ahead
+	stage.config.ContextWindow = int(math.Ceil(float64(estimate) / (1 + tokens.Margin)))
+	require.Less(t, stage.config.ContextWindow, estimate)
+	_, err = buildStageRequest(context.Background(), log, stage, stage.config, data)
+	require.NoError(t, err)
+
+	stage.config.ContextWindow = int(float64(estimate)/(1+tokens.Margin)) - 1
+	_, err = buildStageRequest(context.Background(), log, stage, stage.config, data)
+	assert.ErrorIs(t, err, ErrContextWindowExceeded)
+}
+
+func TestHybridPipeline_TokenBudget(t *testing.T) {
+	normalCalls := 0
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			normalCalls++
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "normal response"}},
+				},
+				Usage: &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+	}
+	reasonerClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse, 2)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "reasoned", ReasoningContent: []string{"step"}}},
+				},
+			}
+			ch <- &models.ChatCompletionResponse{
+				Usage: &models.Usage{PromptTokens: 20, CompletionTokens: 40, TotalTokens: 60},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	testCases := []struct {
+		name   string
+		budget int
+		stage  string
+	}{
+		{name: "unlimited"},
+		{name: "within budget", budget: 90},
+		{name: "trips on reasoner", budget: 50, stage: "reasoner_engine"},
+		{name: "trips on preprocessor", budget: 10, stage: "normal_preprocessor"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			normalCalls = 0
+			pipeline := newMockPipeline(normalClient, reasonerClient)
+			pipeline.tokenBudget = tc.budget
+
+			resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			})
+			if tc.stage == "" {
+				require.NoError(t, err)
+				assert.Equal(t, 90, resp.Usage.TotalTokens)
+				return
+			}
+			assert.ErrorIs(t, err, ErrBudgetExceeded)
+			var stageErr *StageError
+			require.ErrorAs(t, err, &stageErr)
+			assert.Equal(t, tc.stage, stageErr.Stage)
+			// The postprocessor never runs
+			assert.LessOrEqual(t, normalCalls, 1)
+		})
+	}
+}
+
+func TestHybridPipeline_TokenBudgetBeforeCall(t *testing.T) {
+	testCases := []struct {
+		name          string
+		configure     func(cfg *config.PipelineConfig)
+		request       models.ChatCompletionRequest
+		expectedStage string
+		expectedCalls int
+	}{
+		{
+			name: "model default max tokens",
+			configure: func(cfg *config.PipelineConfig) {
+				cfg.Models.Normal.DefaultParams = map[string]interface{}{"max_tokens": 1000}
+			},
+			expectedStage: "normal_preprocessor",
+		},
+		{
+			name:          "global default max tokens",
+			configure:     func(cfg *config.PipelineConfig) { cfg.DefaultParams = map[string]interface{}{"max_tokens": 1000} },
+			expectedStage: "normal_preprocessor",
+		},
+		{
+			// JSON numbers decode as float64
+			name:          "request max tokens",
+			request:       models.ChatCompletionRequest{ExtraParams: map[string]interface{}{"max_tokens": float64(1000)}},
+			expectedStage: "normal_preprocessor",
+		},
+		{
+			name: "fits",
+			configure: func(cfg *config.PipelineConfig) {
+				cfg.Models.Normal.DefaultParams = map[string]interface{}{"max_tokens": 20}
+			},
+			expectedCalls: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			normal := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "normal answer"})
+			reasoner := mocks.NewScriptedModelClient(mocks.ScriptedResponse{Content: "reasoned", Reasoning: []string{"step"}})
+			cfg := newMockPipeline(nil, nil).config
+			cfg.TokenBudget = 500
+			if tc.configure != nil {
+				tc.configure(cfg)
+			}
+			pipeline, err := NewHybridPipeline(cfg)
+			require.NoError(t, err)
+			pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normal, reasoner, nil))
+
+			req := tc.request
+			req.Messages = []models.ChatCompletionMessage{{Role: "user", Content: "test"}}
+			_, err = pipeline.Execute(context.Background(), &req)
+			if tc.expectedStage == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedCalls, normal.Calls()+reasoner.Calls())
+				return
+			}
+			assert.ErrorIs(t, err, ErrBudgetExceeded)
+			assert.ErrorContains(t, err, "would pass the budget of 500")
+			var stageErr *StageError
+			require.ErrorAs(t, err, &stageErr)
+			assert.Equal(t, tc.expectedStage, stageErr.Stage)
+			// The check runs before the model is called
+			assert.Equal(t, 0, normal.Calls()+reasoner.Calls())
+		})
+	}
+}
+
+func TestHybridPipeline_Metadata(t *testing.T) {
+	var mu sync.Mutex
+	var seen []map[string]string
+	normalClient := streamingPostprocessClient("final")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		mu.Lock()
+		seen = append(seen, logger.MetadataFromContext(ctx))
+		mu.Unlock()
+		if req.Messages[len(req.Messages)-1].Content == "fail" {
+			return nil, errors.New("upstream failure")
+		}
+		resp, err := complete(ctx, req)
+		if resp != nil {
+			resp.Usage = &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+		}
+		return resp, err
+	}
+	pipeline := newMockPipeline(normalClient, staticReasonerClient("reasoned", "step"))
+	pipeline.metadataLabels = []string{"tenant", "feature"}
+
+	metadata := map[string]string{"tenant": "acme", "feature": "search", "user": "u-123"}
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		Metadata: metadata,
+	})
+	require.NoError(t, err)
+
+	// The metadata reaches every model call through the context
+	require.Len(t, seen, 2)
+	for _, md := range seen {
+		assert.Equal(t, metadata, md)
+	}
+
+	_, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "fail"}},
+		Metadata: map[string]string{"tenant": "globex"},
+	})
+	require.Error(t, err)
+
+	stream, err := pipeline.ExecuteStream(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+		Metadata: metadata,
+	})
+	require.NoError(t, err)
+	for range stream {
+	}
+
+	requests := pipeline.Metrics().Counter(metricRequests, "")
+	assert.Equal(t, float64(2), requests.Value("success", "acme", "search"))
+	assert.Equal(t, float64(1), requests.Value("error", "globex", ""))
+	tokens := pipeline.Metrics().Counter(metricTokens, "")
+	// Two buffered calls for the first run, the preprocessor call for the stream
+	assert.Equal(t, float64(30), tokens.Value("prompt", "acme", "search"))
+	assert.Equal(t, float64(15), tokens.Value("completion", "acme", "search"))
+
+	// Keys outside the allowlist stay out of the metrics
+	var buf bytes.Buffer
+	_, err = pipeline.Metrics().WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `deepempower_requests_total{outcome="success",tenant="acme",feature="search"} 2`)
+	assert.NotContains(t, buf.String(), "u-123")
+}
+
+// usageStreamClients return mocks whose streams end with a usage-only chunk,
+// as providers send it, and record the streamed requests
+func usageStreamClients(streamed *[]*models.ChatCompletionRequest) (normal, reasoner *mocks.MockModelClient) {
+	var mu sync.Mutex
+	stream := func(req *models.ChatCompletionRequest, usage models.Usage, chunks ...models.ChatCompletionMessage) <-chan *models.ChatCompletionResponse {
+		mu.Lock()
+		*streamed = append(*streamed, req)
+		mu.Unlock()
+		ch := make(chan *models.ChatCompletionResponse, len(chunks)+1)
+		for _, chunk := range chunks {
+			ch <- &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{{Message: chunk}}}
+		}
+		ch <- &models.ChatCompletionResponse{Usage: &usage}
+		close(ch)
+		return ch
+	}
+	normal = &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "preprocessed"}}},
+				Usage:   &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			return stream(req, models.Usage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10},
+				models.ChatCompletionMessage{Content: "final "}, models.ChatCompletionMessage{Content: "answer"}), nil
+		},
+	}
+	reasoner = &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			return stream(req, models.Usage{PromptTokens: 20, CompletionTokens: 8, TotalTokens: 28},
+				models.ChatCompletionMessage{Content: "reasoned", ReasoningContent: []string{"step"}}), nil
+		},
+	}
+	return normal, reasoner
+}
+
+func TestHybridPipeline_StreamUsageMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		estimate bool
+	}{
+		{name: "provider"},
+		{name: "estimate", estimate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var streamed []*models.ChatCompletionRequest
+			pipeline := newMockPipeline(usageStreamClients(&streamed))
+			pipeline.bridge.EstimateStreamUsage = tt.estimate
+
+			stream, err := pipeline.ExecuteStream(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			})
+			require.NoError(t, err)
+			var content strings.Builder
+			for chunk := range stream {
+				// Usage-only chunks are not forwarded to the client
+				require.NotEmpty(t, chunk.Choices)
+				content.WriteString(chunk.Choices[0].Message.Content)
+			}
+			assert.Equal(t, "final answer", content.String())
+
+			// The buffered preprocessor reports its usage either way
+			prompt, completion := 10, 5
+			if tt.estimate {
+				require.Len(t, streamed, 2)
+				prompt += tokens.EstimateMessages(streamed[0].Messages) + tokens.EstimateMessages(streamed[1].Messages)
+				for _, text := range []string{"reasoned", "step", "final ", "answer"} {
+					completion += tokens.Estimate(text)
+				}
+			} else {
+				prompt, completion = prompt+20+7, completion+8+3
+			}
+			counter := pipeline.Metrics().Counter(metricTokens, "")
+			assert.Equal(t, float64(prompt), counter.Value("prompt"))
+			assert.Equal(t, float64(completion), counter.Value("completion"))
+		})
+	}
+}
+
+func TestHybridPipeline_ToolCalls(t *testing.T) {
+	weather := models.ToolCall{
+		ID:       "call_1",
+		Type:     models.ToolTypeFunction,
+		Function: models.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+	}
+	tools := []models.Tool{{Type: models.ToolTypeFunction, Function: &models.FunctionDefinition{Name: "get_weather"}}}
+	toolChoice := json.RawMessage(`"auto"`)
+
+	var requests []*models.ChatCompletionRequest
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			requests = append(requests, req)
+			message := models.ChatCompletionMessage{Role: "assistant", Content: "preprocessed"}
+			finishReason := "stop"
+			if len(req.Tools) > 0 {
+				message = models.ChatCompletionMessage{Role: "assistant", ToolCalls: []models.ToolCall{weather}}
+				finishReason = "tool_calls"
+			}
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: message, FinishReason: finishReason}},
+			}, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			requests = append(requests, req)
+			index := 0
+			call := weather
+			call.Index = &index
+			ch := make(chan *models.ChatCompletionResponse, 2)
+			ch <- &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{
+				{Message: models.ChatCompletionMessage{ToolCalls: []models.ToolCall{call}}},
+			}}
+			ch <- &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{{FinishReason: "tool_calls"}}}
+			close(ch)
+			return ch, nil
+		},
+	}
+	pipeline := newMockPipeline(normalClient, staticReasonerClient("reasoned", "step"))
+	newRequest := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{
+			Messages:   []models.ChatCompletionMessage{{Role: "user", Content: "Weather in Paris?"}},
+			Tools:      tools,
+			ToolChoice: toolChoice,
+		}
+	}
+
+	resp, err := pipeline.Execute(context.Background(), newRequest())
+	require.NoError(t, err)
+	// Only the final Normal call is offered the tools
+	require.Len(t, requests, 2)
+	assert.Nil(t, requests[0].Tools)
+	assert.Equal(t, tools, requests[1].Tools)
+	assert.Equal(t, toolChoice, requests[1].ToolChoice)
+	assert.Equal(t, []models.ToolCall{weather}, resp.Choices[0].Message.ToolCalls)
+	assert.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+
+	// Streamed tool call deltas reach the client
+	requests = nil
+	stream, err := pipeline.ExecuteStream(context.Background(), newRequest())
+	require.NoError(t, err)
+	var calls []models.ToolCall
+	var finishReason string
+	for chunk := range stream {
+		require.NoError(t, chunk.Err)
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		calls = append(calls, chunk.Choices[0].Message.ToolCalls...)
+		if chunk.Choices[0].FinishReason != "" {
+			finishReason = chunk.Choices[0].FinishReason
+		}
+	}
+	require.Len(t, calls, 1)
+	assert.Equal(t, "get_weather", calls[0].Function.Name)
+	assert.Equal(t, "tool_calls", finishReason)
+	assert.Equal(t, tools, requests[len(requests)-1].Tools)
+}
+
+func TestHybridPipeline_MultipleChoices(t *testing.T) {
+	tests := []struct {
+		name string
+		// perCall is the most choices the provider returns for one call
+		perCall       int
+		expectedCalls int
+	}{
+		{name: "provider honours n", perCall: 2, expectedCalls: 1},
+		{name: "provider ignores n", perCall: 1, expectedCalls: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var answers []*models.ChatCompletionRequest
+			answered := 0
+			normalClient := &mocks.MockModelClient{
+				CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+					if req.N == 0 {
+						return &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{Content: "preprocessed"}},
+						}}, nil
+					}
+					answers = append(answers, req)
+					var choices []models.ChatCompletionChoice
+					for i := 0; i < min(req.N, tc.perCall); i++ {
+						answered++
+						choices = append(choices, models.ChatCompletionChoice{
+							Index:        i,
+							Message:      models.ChatCompletionMessage{Content: fmt.Sprintf("answer %d", answered)},
+							FinishReason: "stop",
+						})
+					}
+					return &models.ChatCompletionResponse{Choices: choices}, nil
+				},
+			}
+			reasonerCalls := 0
+			reasonerClient := staticReasonerClient("reasoned", "step")
+			stream := reasonerClient.CompleteStreamFunc
+			reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+				reasonerCalls++
+				return stream(ctx, req)
+			}
+			pipeline := newMockPipeline(normalClient, reasonerClient)
+
+			resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				N:        2,
+			})
+			require.NoError(t, err)
+			require.Len(t, resp.Choices, 2)
+			assert.Equal(t, 0, resp.Choices[0].Index)
+			assert.Equal(t, 1, resp.Choices[1].Index)
+			assert.Equal(t, "answer 1", resp.Choices[0].Message.Content)
+			assert.Equal(t, "answer 2", resp.Choices[1].Message.Content)
+			for _, choice := range resp.Choices {
+				assert.Equal(t, "assistant", choice.Message.Role)
+				assert.Equal(t, "stop", choice.FinishReason)
+			}
+			// Both answers come from one reasoning run
+			assert.Equal(t, 1, reasonerCalls)
+			require.Len(t, answers, tc.expectedCalls)
+			assert.Equal(t, 2, answers[0].N)
+
+			// Streaming sends each answer whole under its own index
+			answers, answered = nil, 0
+			chunks, err := pipeline.ExecuteStream(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+				N:        2,
+				Stream:   true,
+			})
+			require.NoError(t, err)
+			contents := map[int]string{}
+			for chunk := range chunks {
+				require.NoError(t, chunk.Err)
+				for _, choice := range chunk.Choices {
+					contents[choice.Index] += choice.Message.Content
+				}
+			}
+			assert.Equal(t, map[int]string{0: "answer 1", 1: "answer 2"}, contents)
+		})
+	}
+}
+
+func TestHybridPipeline_RequireReasoning(t *testing.T) {
+	tests := []struct {
+		name     string
+		require  bool
+		steps    []string
+		expected error
+	}{
+		{name: "required and present", require: true, steps: []string{"step 1", "step 2"}},
+		{name: "required and absent", require: true, expected: ErrReasoningMissing},
+		{name: "not required and absent"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newMockPipeline(nil, nil).config
+			cfg.RequireReasoning = tc.require
+			pipeline, err := NewHybridPipeline(cfg)
+			require.NoError(t, err)
+			pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(
+				staticNormalClient("final answer"), staticReasonerClient("reasoned", tc.steps...), nil))
+
+			resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+			})
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+				var stageErr *StageError
+				require.ErrorAs(t, err, &stageErr)
+				assert.Equal(t, "reasoner_engine", stageErr.Stage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "final answer", resp.Choices[0].Message.Content)
+		})
+	}
+}
+
+func TestHybridPipeline_LogProbs(t *testing.T) {
+	logprobs := &models.LogProbs{Content: []models.LogProb{{
+		Token:       "final",
+		LogProb:     -0.1,
+		TopLogProbs: []models.TopLogProb{{Token: "final", LogProb: -0.1}, {Token: "last", LogProb: -2.3}},
+	}}}
+
+	var mu sync.Mutex
+	var requests []*models.ChatCompletionRequest
+	record := func(req *models.ChatCompletionRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			record(req)
+			choice := models.ChatCompletionChoice{Message: models.ChatCompletionMessage{Content: "final"}}
+			if req.LogProbs {
+				choice.LogProbs = logprobs
+			}
+			return &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{choice}}, nil
+		},
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(req)
+		return stream(ctx, req)
+	}
+	pipeline := newMockPipeline(normalClient, reasonerClient)
+
+	resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages:    []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+		LogProbs:    true,
+		TopLogProbs: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, logprobs, resp.Choices[0].LogProbs)
+
+	// Only the final answer call asks for logprobs
+	require.Len(t, requests, 3)
+	for _, req := range requests[:2] {
+		assert.False(t, req.LogProbs)
+		assert.Zero(t, req.TopLogProbs)
+	}
+	assert.True(t, requests[2].LogProbs)
+	assert.Equal(t, 2, requests[2].TopLogProbs)
+}
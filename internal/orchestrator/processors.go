@@ -4,29 +4,38 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
 	"text/template"
 
+	"github.com/sleepstars/deepempower/internal/clients"
 	"github.com/sleepstars/deepempower/internal/config" // 导入 config 包
 	"github.com/sleepstars/deepempower/internal/logger"
 	"github.com/sleepstars/deepempower/internal/modelbridge"
 	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/prompt"
 )
 
 // NormalPreprocessor implements the preprocessing stage using Normal model
 type NormalPreprocessor struct {
-	promptTemplate string
+	promptTemplate *template.Template
 	bridge         *modelbridge.ModelBridge
 	Logger         *logger.Logger
 	config         *config.ModelConfig // 添加 config 字段
+	// examples are few-shot messages placed before the user turn
+	examples []models.ChatCompletionMessage
 }
 
-func newNormalPreprocessor(prompt string, bridge *modelbridge.ModelBridge) *NormalPreprocessor {
+func newNormalPreprocessor(prompt string, bridge *modelbridge.ModelBridge) (*NormalPreprocessor, error) {
+	tmpl, err := parsePrompt("normal_preprocessor", prompt)
+	if err != nil {
+		return nil, err
+	}
 	return &NormalPreprocessor{
-		promptTemplate: prompt,
+		promptTemplate: tmpl,
 		bridge:         bridge,
 		Logger:         logger.GetLogger().WithComponent("normal_preprocessor"),
 		config:         &config.ModelConfig{}, // 初始化 config 字段
-	}
+	}, nil
 }
 
 func (p *NormalPreprocessor) Name() string {
@@ -34,59 +43,147 @@ func (p *NormalPreprocessor) Name() string {
 }
 
 func (p *NormalPreprocessor) Execute(ctx context.Context, data *Payload) error {
-	// Parse prompt template
-	tmpl, err := template.New("prompt").Parse(p.promptTemplate)
+	log := p.Logger.WithContext(ctx)
+	req, err := buildStageRequest(ctx, log, p, p.config, data)
 	if err != nil {
-		p.Logger.WithError(err).Error("Failed to parse prompt template")
-		return fmt.Errorf("parse template: %w", err)
-	}
-
-	// Execute template
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, map[string]interface{}{
-		"UserInput": data.OriginalRequest.Messages[len(data.OriginalRequest.Messages)-1].Content,
-	}); err != nil {
-		p.Logger.WithError(err).Error("Failed to execute prompt template")
-		return fmt.Errorf("execute template: %w", err)
-	}
-
-	// Create model request with the same model as the original request
-	req := &models.ChatCompletionRequest{
-		Model: data.OriginalRequest.Model,
-		Messages: []models.ChatCompletionMessage{
-			{Role: "system", Content: buf.String()},
-			{Role: "user", Content: data.OriginalRequest.Messages[len(data.OriginalRequest.Messages)-1].Content},
-		},
+		return err
 	}
 
 	// Call model through bridge
 	resp, err := p.bridge.CallNormal(ctx, req)
 	if err != nil {
-		p.Logger.WithError(err).Error("Failed to call Normal model")
-		return fmt.Errorf("model call: %w", err)
+		log.WithError(err).Error("Failed to call Normal model")
+		return &modelCallError{err: err}
 	}
 
 	// Store structured input for next stage
-	data.IntermContent = resp.Choices[0].Message.Content
-	p.Logger.Debug("Preprocessing completed successfully")
+	data.SetIntermContent(resp.Choices[0].Message.Content)
+	data.AddUsage(resp.Usage)
+	log.Debug("Preprocessing completed successfully")
 	return nil
 }
 
+// buildRequest renders the prompt template into the Normal model request
+func (p *NormalPreprocessor) buildRequest(ctx context.Context, data *Payload) (*models.ChatCompletionRequest, error) {
+	userInput, err := userInput(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute template
+	var buf bytes.Buffer
+	if err := p.promptTemplate.Execute(&buf, templateData(data, map[string]interface{}{
+		"UserInput": userInput,
+	})); err != nil {
+		p.Logger.WithContext(ctx).WithError(err).Error("Failed to execute prompt template")
+		return nil, fmt.Errorf("execute template: %w", err)
+	}
+
+	// Create model request with the stage model
+	return &models.ChatCompletionRequest{
+		Model:       stageModel(p.config, data),
+		Messages:    stageMessages(data, fewShot(buf.String(), p.examples, userInput)...),
+		ExtraParams: data.OriginalRequest.ExtraParams,
+		Seed:        data.OriginalRequest.Seed,
+	}, nil
+}
+
+// userInput returns the content of the message the request asks to answer
+func userInput(data *Payload) (string, error) {
+	messages := data.OriginalRequest.Messages
+	// The prefill is kept for the final answer; the input is what it replies to
+	if _, ok := data.OriginalRequest.Prefill(); ok {
+		messages = messages[:len(messages)-1]
+	}
+	if len(messages) == 0 {
+		return "", ErrNoMessages
+	}
+	return messages[len(messages)-1].Content, nil
+}
+
+// parsePrompt compiles a stage prompt template once at construction
+func parsePrompt(stage, text string) (*template.Template, error) {
+	tmpl, err := prompt.Parse(stage, text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s prompt template: %w", stage, err)
+	}
+	return tmpl, nil
+}
+
+// templateData adds the original request's model, ID, message history and
+// assistant prefill to the stage fields a prompt template is rendered with
+func templateData(data *Payload, fields map[string]interface{}) map[string]interface{} {
+	fields["Model"] = data.OriginalRequest.Model
+	fields["RequestID"] = data.OriginalRequest.RequestID
+	fields["Messages"] = data.OriginalRequest.Messages
+	fields["Prefill"], _ = data.OriginalRequest.Prefill()
+	return fields
+}
+
+// withPrefill appends the original request's assistant prefill, if any, so
+// that the model producing the final answer continues it
+func withPrefill(data *Payload, messages []models.ChatCompletionMessage) []models.ChatCompletionMessage {
+	if prefill, ok := data.OriginalRequest.Prefill(); ok {
+		messages = append(messages, models.ChatCompletionMessage{Role: models.RoleAssistant, Content: prefill})
+	}
+	return messages
+}
+
+// stageMessages prepends the configured system prompt to the messages of a
+// stage request
+func stageMessages(data *Payload, messages ...models.ChatCompletionMessage) []models.ChatCompletionMessage {
+	if data.SystemPrompt == "" {
+		return messages
+	}
+	return append([]models.ChatCompletionMessage{{Role: "system", Content: data.SystemPrompt}}, messages...)
+}
+
+// fewShot returns the messages of a stage request: its prompt, the few-shot
+// examples and then the user turn
+func fewShot(prompt string, examples []models.ChatCompletionMessage, input string) []models.ChatCompletionMessage {
+	messages := make([]models.ChatCompletionMessage, 0, len(examples)+2)
+	messages = append(messages, models.ChatCompletionMessage{Role: "system", Content: prompt})
+	messages = append(messages, examples...)
+	return append(messages, models.ChatCompletionMessage{Role: "user", Content: input})
+}
+
+// stageModel returns the model configured for a stage, falling back to the
+// model of the original request
+func stageModel(cfg *config.ModelConfig, data *Payload) string {
+	if cfg != nil && cfg.Model != "" {
+		return cfg.Model
+	}
+	return data.OriginalRequest.Model
+}
+
 // ReasonerEngine implements the reasoning stage using Reasoner model
 type ReasonerEngine struct {
-	promptTemplate string
+	promptTemplate *template.Template
 	bridge         *modelbridge.ModelBridge
 	Logger         *logger.Logger
 	config         *config.ModelConfig // 添加 config 字段
+	// maxSteps caps the collected reasoning steps; zero means unlimited
+	maxSteps int
+	// continuations is how many times a reasoner cut off by its length limit
+	// is asked to continue
+	continuations int
+	// examples are few-shot messages placed before the user turn
+	examples []models.ChatCompletionMessage
+	// requireReasoning fails the stage when no reasoning steps were produced
+	requireReasoning bool
 }
 
-func newReasonerEngine(prompt string, bridge *modelbridge.ModelBridge) *ReasonerEngine {
+func newReasonerEngine(prompt string, bridge *modelbridge.ModelBridge) (*ReasonerEngine, error) {
+	tmpl, err := parsePrompt("reasoner_engine", prompt)
+	if err != nil {
+		return nil, err
+	}
 	return &ReasonerEngine{
-		promptTemplate: prompt,
+		promptTemplate: tmpl,
 		bridge:         bridge,
 		Logger:         logger.GetLogger().WithComponent("reasoner_engine"),
 		config:         &config.ModelConfig{}, // 初始化 config 字段
-	}
+	}, nil
 }
 
 func (p *ReasonerEngine) Name() string {
@@ -94,76 +191,278 @@ func (p *ReasonerEngine) Name() string {
 }
 
 func (p *ReasonerEngine) Execute(ctx context.Context, data *Payload) error {
-	// Parse prompt template
-	tmpl, err := template.New("prompt").Parse(p.promptTemplate)
+	return p.run(ctx, data, nil)
+}
+
+// ExecuteStream runs the reasoning stage and forwards each reasoning step to
+// out as soon as it arrives
+func (p *ReasonerEngine) ExecuteStream(ctx context.Context, data *Payload, out chan<- *models.ChatCompletionResponse) error {
+	return p.run(ctx, data, out)
+}
+
+// run calls the Reasoner model and collects its output, forwarding reasoning
+// steps to out when it is not nil
+func (p *ReasonerEngine) run(ctx context.Context, data *Payload, out chan<- *models.ChatCompletionResponse) error {
+	log := p.Logger.WithContext(ctx)
+	req, err := buildStageRequest(ctx, log, p, p.config, data)
 	if err != nil {
-		p.Logger.WithError(err).Error("Failed to parse prompt template")
-		return fmt.Errorf("parse template: %w", err)
+		return err
 	}
 
-	// Execute template
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, map[string]interface{}{
-		"StructuredInput": data.IntermContent,
-	}); err != nil {
-		p.Logger.WithError(err).Error("Failed to execute prompt template")
-		return fmt.Errorf("execute template: %w", err)
+	state := &reasoningState{}
+	finishReason, err := p.stream(ctx, req, data, out, state)
+	// A reasoner cut off by its output limit is asked to carry on
+	for i := 0; err == nil && finishReason == "length" && !state.capped && i < p.continuations; i++ {
+		log.Warn("Reasoner stopped at its length limit, continuing (%d/%d)", i+1, p.continuations)
+		finishReason, err = p.stream(ctx, continuationRequest(req, data, state), data, out, state)
+	}
+	if err != nil {
+		return err
+	}
+	if finishReason != "" && finishReason != "stop" && !state.capped {
+		log.Warn("Reasoning ended with finish reason %q and may be incomplete", finishReason)
 	}
 
-	// Create model request using the model from config
-	req := &models.ChatCompletionRequest{
-		Model: p.config.Model, // 使用配置中的模型
-		Messages: []models.ChatCompletionMessage{
-			{Role: "system", Content: buf.String()},
-			{Role: "user", Content: data.IntermContent},
-		},
-		Stream: true,
+	// Store final content
+	data.SetIntermContent(state.content.String())
+	log.Debug("Reasoning completed with %d steps", state.stepCount)
+	if p.requireReasoning && len(data.Reasoning()) == 0 {
+		log.Warn("Reasoner returned no reasoning steps")
+		return ErrReasoningMissing
+	}
+	return nil
+}
+
+// reasoningState is the output collected across the Reasoner calls of a run
+type reasoningState struct {
+	content   strings.Builder
+	stepCount int
+	// capped is set once the step cap cut the reasoning short
+	capped bool
+}
+
+// reasoningContinuePrompt asks the Reasoner to resume output it was cut off in
+const reasoningContinuePrompt = "Your previous reply was cut off. Continue exactly where it stopped, without repeating anything."
+
+// continuationRequest extends req with the output so far, so that the
+// Reasoner can continue it
+func continuationRequest(req *models.ChatCompletionRequest, data *Payload, state *reasoningState) *models.ChatCompletionRequest {
+	partial := reasoningText(data.Reasoning())
+	if content := state.content.String(); content != "" {
+		partial += "\n\n" + content
 	}
+	next := *req
+	next.Messages = append(append([]models.ChatCompletionMessage(nil), req.Messages...),
+		models.ChatCompletionMessage{Role: models.RoleAssistant, Content: partial},
+		models.ChatCompletionMessage{Role: models.RoleUser, Content: reasoningContinuePrompt},
+	)
+	return &next
+}
+
+// stream makes one streaming Reasoner call, adding its output to data and
+// state, and returns the finish reason it ended with
+func (p *ReasonerEngine) stream(ctx context.Context, req *models.ChatCompletionRequest, data *Payload, out chan<- *models.ChatCompletionResponse, state *reasoningState) (string, error) {
+	log := p.Logger.WithContext(ctx)
+
+	// Cancelled early when the step cap is reached
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Call model with streaming through bridge
-	respChan, err := p.bridge.CallReasonerStream(ctx, req)
+	respChan, err := p.bridge.CallReasonerStream(streamCtx, req)
 	if err != nil {
-		p.Logger.WithError(err).Error("Failed to start streaming from Reasoner model")
-		return fmt.Errorf("model call: %w", err) // Removed "start stream:" prefix
+		log.WithError(err).Error("Failed to start streaming from Reasoner model")
+		return "", &modelCallError{err: err}
 	}
 
 	// Process streaming response
-	var lastContent string
-	reasoningCount := 0
-	for resp := range respChan {
+	content := streamContent{mode: p.config.StreamMode}
+	finishReason := ""
+	received := 0
+	for {
+		var resp *models.ChatCompletionResponse
+		var ok bool
+		// The producer may be slow to notice a cancellation, so stop waiting
+		// on it right away; the deferred cancel tells it to shut down
+		select {
+		case resp, ok = <-respChan:
+		case <-ctx.Done():
+			log.Debug("Reasoning cancelled after %d steps", state.stepCount)
+			return "", ctx.Err()
+		}
+		if !ok {
+			break
+		}
+		if resp.Err != nil {
+			log.WithError(resp.Err).Error("Reasoner stream failed")
+			return "", &modelCallError{err: resp.Err}
+		}
+		received++
+		data.AddUsage(resp.Usage)
+		if resp.Metadata != nil && resp.Metadata.ReasonerFallback {
+			data.MarkReasonerFallback()
+		}
 		if len(resp.Choices) > 0 {
 			// Collect reasoning chain
-			if len(resp.Choices[0].Message.ReasoningContent) > 0 {
-				data.ReasoningChain = append(data.ReasoningChain, resp.Choices[0].Message.ReasoningContent...)
-				reasoningCount++
-				p.Logger.Debug("Received reasoning step %d", reasoningCount)
+			if reasoning := resp.Choices[0].Message.ReasoningContent; len(reasoning) > 0 {
+				truncated := p.maxSteps > 0 && state.stepCount+len(reasoning) > p.maxSteps
+				if truncated {
+					reasoning = reasoning[:p.maxSteps-state.stepCount]
+				}
+				if len(reasoning) > 0 {
+					state.stepCount += len(reasoning)
+					data.AppendReasoning(reasoning...)
+					log.Debug("Received reasoning step %d", state.stepCount)
+
+					if out != nil {
+						select {
+						case out <- reasoningChunk(reasoning):
+						case <-ctx.Done():
+							return "", ctx.Err()
+						}
+					}
+				}
+				if truncated {
+					log.Warn("Reasoning truncated at %d steps", p.maxSteps)
+					data.SetReasoningFinishReason("length")
+					state.capped = true
+					finishReason = "length"
+					cancel()
+					// Drain so the upstream stream can shut down
+					for range respChan {
+					}
+					break
+				}
 			}
 			// Update content
-			lastContent = resp.Choices[0].Message.Content
+			content.add(resp.Choices[0].Message.Content)
+			if resp.Choices[0].FinishReason != "" {
+				finishReason = resp.Choices[0].FinishReason
+				data.SetReasoningFinishReason(finishReason)
+			}
 		}
 	}
 
-	// Store final content
-	data.IntermContent = lastContent
-	p.Logger.Debug("Reasoning completed with %d steps", reasoningCount)
-	return nil
+	if received == 0 {
+		return "", streamClosedError(ctx)
+	}
+	state.content.WriteString(content.String())
+	return finishReason, nil
+}
+
+// streamContent rebuilds the full content of a stream whose chunks carry
+// either deltas or the content accumulated so far. Unless the mode says
+// which, a chunk that extends everything received so far is taken to be
+// cumulative and any other chunk a delta.
+type streamContent struct {
+	mode string // clients.StreamModeDelta, clients.StreamModeAggregate or "" to detect
+	buf  strings.Builder
+}
+
+func (s *streamContent) add(chunk string) {
+	if chunk == "" {
+		return
+	}
+	cumulative := s.mode == clients.StreamModeAggregate ||
+		s.mode != clients.StreamModeDelta && s.buf.Len() > 0 && strings.HasPrefix(chunk, s.buf.String())
+	if cumulative {
+		s.buf.Reset()
+	}
+	s.buf.WriteString(chunk)
+}
+
+func (s *streamContent) String() string {
+	return s.buf.String()
+}
+
+// buildRequest renders the prompt template into the Reasoner model request
+func (p *ReasonerEngine) buildRequest(ctx context.Context, data *Payload) (*models.ChatCompletionRequest, error) {
+	// Without a preprocessing stage the reasoner works on the user input
+	input := data.Interm()
+	if input == "" {
+		if text, err := userInput(data); err == nil {
+			input = text
+		}
+	}
+
+	// Execute template
+	var buf bytes.Buffer
+	if err := p.promptTemplate.Execute(&buf, templateData(data, map[string]interface{}{
+		"StructuredInput": input,
+	})); err != nil {
+		p.Logger.WithContext(ctx).WithError(err).Error("Failed to execute prompt template")
+		return nil, fmt.Errorf("execute template: %w", err)
+	}
+
+	// Create model request using the model from config
+	return &models.ChatCompletionRequest{
+		Model:       p.config.Model, // 使用配置中的模型
+		Messages:    stageMessages(data, fewShot(buf.String(), p.examples, input)...),
+		Stream:      true,
+		ExtraParams: data.OriginalRequest.ExtraParams,
+		Seed:        data.OriginalRequest.Seed,
+	}, nil
+}
+
+// streamClosedError reports a stream that ended without any response, preferring
+// the context error when the stream was cut short by cancellation
+func streamClosedError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return &modelCallError{err: clients.ErrStreamClosed}
+}
+
+// reasoningChunk wraps reasoning steps in a streamed response without final content
+func reasoningChunk(reasoning []string) *models.ChatCompletionResponse {
+	return &models.ChatCompletionResponse{
+		Choices: []models.ChatCompletionChoice{
+			{
+				Message: models.ChatCompletionMessage{
+					Role:             "assistant",
+					ReasoningContent: append([]string(nil), reasoning...),
+				},
+			},
+		},
+	}
 }
 
 // NormalPostprocessor implements the postprocessing stage using Normal model
 type NormalPostprocessor struct {
-	promptTemplate string
+	promptTemplate *template.Template
 	bridge         *modelbridge.ModelBridge
 	Logger         *logger.Logger
 	config         *config.ModelConfig // 添加 config 字段
+	// examples are few-shot messages placed before the user turn
+	examples []models.ChatCompletionMessage
+	// noReasoning replaces promptTemplate when no reasoning was produced
+	noReasoning *template.Template
+	// reasoningFormat joins the steps rendered as ReasoningText
+	reasoningFormat config.ReasoningFormatConfig
 }
 
-func newNormalPostprocessor(prompt string, bridge *modelbridge.ModelBridge) *NormalPostprocessor {
+// defaultNoReasoningPrompt answers from the intermediate result alone when
+// the reasoning stage produced no reasoning steps
+const defaultNoReasoningPrompt = `No reasoning steps are available for this request. ` +
+	`Answer it directly and clearly, based on this result:
+{{.IntermediateResult}}`
+
+func newNormalPostprocessor(prompt string, bridge *modelbridge.ModelBridge) (*NormalPostprocessor, error) {
+	tmpl, err := parsePrompt("normal_postprocessor", prompt)
+	if err != nil {
+		return nil, err
+	}
+	noReasoning, err := parsePrompt("normal_postprocessor_no_reasoning", defaultNoReasoningPrompt)
+	if err != nil {
+		return nil, err
+	}
 	return &NormalPostprocessor{
-		promptTemplate: prompt,
+		promptTemplate: tmpl,
+		noReasoning:    noReasoning,
 		bridge:         bridge,
 		Logger:         logger.GetLogger().WithComponent("normal_postprocessor"),
 		config:         &config.ModelConfig{}, // 初始化 config 字段
-	}
+	}, nil
 }
 
 func (p *NormalPostprocessor) Name() string {
@@ -171,41 +470,262 @@ func (p *NormalPostprocessor) Name() string {
 }
 
 func (p *NormalPostprocessor) Execute(ctx context.Context, data *Payload) error {
-	// Parse prompt template
-	tmpl, err := template.New("prompt").Parse(p.promptTemplate)
+	log := p.Logger.WithContext(ctx)
+	req, err := buildStageRequest(ctx, log, p, p.config, data)
 	if err != nil {
-		p.Logger.WithError(err).Error("Failed to parse prompt template")
-		return fmt.Errorf("parse template: %w", err)
+		return err
+	}
+
+	// Call model through bridge and store the final content
+	if err := callAnswer(ctx, p.bridge, log, req, data); err != nil {
+		return err
+	}
+	log.Debug("Postprocessing completed successfully")
+	return nil
+}
+
+// ExecuteStream runs the postprocessing stage and forwards the Normal model
+// output to out as it arrives
+func (p *NormalPostprocessor) ExecuteStream(ctx context.Context, data *Payload, out chan<- *models.ChatCompletionResponse) error {
+	if data.OriginalRequest.ResponseFormat.WantsJSON() || data.OriginalRequest.N > 1 {
+		return streamAnswer(ctx, p, data, out)
+	}
+	log := p.Logger.WithContext(ctx)
+	req, err := buildStageRequest(ctx, log, p, p.config, data)
+	if err != nil {
+		return err
+	}
+
+	// Call model with streaming through bridge
+	respChan, err := p.bridge.CallNormalStream(ctx, req)
+	if err != nil {
+		log.WithError(err).Error("Failed to start streaming from Normal model")
+		return &modelCallError{err: err}
+	}
+
+	if err := forwardStream(ctx, respChan, data, p.config.StreamMode, out); err != nil {
+		return err
+	}
+	log.Debug("Streaming postprocessing completed successfully, %d bytes", data.Streamed())
+	return nil
+}
+
+// buildRequest renders the prompt template into the Normal model request.
+// Without reasoning steps the no-reasoning prompt is rendered instead, so
+// the model is not shown an empty reasoning chain.
+func (p *NormalPostprocessor) buildRequest(ctx context.Context, data *Payload) (*models.ChatCompletionRequest, error) {
+	chain := data.Reasoning()
+	tmpl := p.promptTemplate
+	if len(chain) == 0 && p.noReasoning != nil {
+		p.Logger.WithContext(ctx).Debug("No reasoning steps, using the no-reasoning prompt")
+		tmpl = p.noReasoning
 	}
 
 	// Execute template
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, map[string]interface{}{
-		"ReasoningChain":     data.ReasoningChain,
-		"IntermediateResult": data.IntermContent,
-	}); err != nil {
-		p.Logger.WithError(err).Error("Failed to execute prompt template")
-		return fmt.Errorf("execute template: %w", err)
-	}
-
-	// Create model request with the same model as the original request
-	req := &models.ChatCompletionRequest{
-		Model: data.OriginalRequest.Model,
-		Messages: []models.ChatCompletionMessage{
-			{Role: "system", Content: buf.String()},
-			{Role: "user", Content: data.IntermContent},
-		},
+	if err := tmpl.Execute(&buf, templateData(data, map[string]interface{}{
+		"ReasoningChain":     chain,
+		"ReasoningText":      formatReasoning(chain, p.reasoningFormat),
+		"IntermediateResult": data.Interm(),
+	})); err != nil {
+		p.Logger.WithContext(ctx).WithError(err).Error("Failed to execute prompt template")
+		return nil, fmt.Errorf("execute template: %w", err)
 	}
 
-	// Call model through bridge
-	resp, err := p.bridge.CallNormal(ctx, req)
+	// Create model request with the stage model. The answer is the caller's,
+	// so their stop sequences and sampling penalties apply to it
+	return &models.ChatCompletionRequest{
+		Model:            stageModel(p.config, data),
+		Messages:         withPrefill(data, stageMessages(data, fewShot(buf.String(), p.examples, data.Interm())...)),
+		Stop:             data.OriginalRequest.Stop,
+		TopP:             data.OriginalRequest.TopP,
+		PresencePenalty:  data.OriginalRequest.PresencePenalty,
+		FrequencyPenalty: data.OriginalRequest.FrequencyPenalty,
+		ExtraParams:      data.OriginalRequest.ExtraParams,
+		Seed:             data.OriginalRequest.Seed,
+		ResponseFormat:   data.OriginalRequest.ResponseFormat,
+		Tools:            data.OriginalRequest.Tools,
+		ToolChoice:       data.OriginalRequest.ToolChoice,
+		LogProbs:         data.OriginalRequest.LogProbs,
+		TopLogProbs:      data.OriginalRequest.TopLogProbs,
+	}, nil
+}
+
+// reasoningText returns the reasoning as the Reasoner wrote it. The chain
+// holds the pieces it streamed, which split the text anywhere, so they are
+// joined without a separator.
+func reasoningText(chain []string) string {
+	return strings.Join(chain, "")
+}
+
+// formatReasoning renders the reasoning for ReasoningText. Without a
+// separator or numbering it is the text as written. Otherwise the text is
+// split into steps at line breaks, skipping blank lines, and the steps are
+// joined with the separator, a newline by default, and numbered from 1 when
+// asked to.
+func formatReasoning(chain []string, format config.ReasoningFormatConfig) string {
+	text := reasoningText(chain)
+	if format.Separator == "" && !format.Numbered {
+		return text
+	}
+	separator := format.Separator
+	if separator == "" {
+		separator = "\n"
+	}
+	var b strings.Builder
+	n := 0
+	for _, line := range strings.Split(text, "\n") {
+		step := strings.TrimSpace(line)
+		if step == "" {
+			continue
+		}
+		if n > 0 {
+			b.WriteString(separator)
+		}
+		n++
+		if format.Numbered {
+			fmt.Fprintf(&b, "%d. ", n)
+		}
+		b.WriteString(step)
+	}
+	return b.String()
+}
+
+// forwardStream forwards a streamed answer to out chunk by chunk. The answer
+// is not collected: the payload only records its length, usage and finish
+// reason, so a long completion is never held in memory as a whole. Chunks of
+// a model streaming in aggregate mode are cut down to the new text, so the
+// client always receives deltas.
+func forwardStream(ctx context.Context, respChan <-chan *models.ChatCompletionResponse, data *Payload, mode string, out chan<- *models.ChatCompletionResponse) error {
+	received := 0
+	sent := 0
+	for {
+		var resp *models.ChatCompletionResponse
+		var ok bool
+		select {
+		case resp, ok = <-respChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			break
+		}
+		received++
+		data.AddUsage(resp.Usage)
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		if mode == clients.StreamModeAggregate {
+			resp = aggregateDelta(resp, sent)
+		}
+		sent += len(resp.Choices[0].Message.Content)
+		data.AddStreamedBytes(len(resp.Choices[0].Message.Content))
+		if resp.Choices[0].FinishReason != "" {
+			data.SetFinishReason(resp.Choices[0].FinishReason)
+		}
+
+		select {
+		case out <- resp:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if received == 0 {
+		return streamClosedError(ctx)
+	}
+	return nil
+}
+
+// aggregateDelta returns a copy of resp, whose content is the answer
+// accumulated so far, holding only the text after the first sent bytes
+func aggregateDelta(resp *models.ChatCompletionResponse, sent int) *models.ChatCompletionResponse {
+	content := resp.Choices[0].Message.Content
+	if sent > len(content) {
+		sent = len(content)
+	}
+	delta := *resp
+	delta.Choices = append([]models.ChatCompletionChoice(nil), resp.Choices...)
+	delta.Choices[0].Message.Content = content[sent:]
+	return &delta
+}
+
+// DirectResponder answers the original conversation with a single Normal model
+// call. It replaces the full chain for passthrough requests and for requests
+// the complexity classifier judges simple enough to skip reasoning.
+type DirectResponder struct {
+	bridge *modelbridge.ModelBridge
+	Logger *logger.Logger
+	config *config.ModelConfig
+}
+
+func newDirectResponder(bridge *modelbridge.ModelBridge) *DirectResponder {
+	return &DirectResponder{
+		bridge: bridge,
+		Logger: logger.GetLogger().WithComponent("direct_responder"),
+		config: &config.ModelConfig{},
+	}
+}
+
+func (p *DirectResponder) Name() string {
+	return "direct_responder"
+}
+
+func (p *DirectResponder) Execute(ctx context.Context, data *Payload) error {
+	log := p.Logger.WithContext(ctx)
+	req, err := buildStageRequest(ctx, log, p, p.config, data)
 	if err != nil {
-		p.Logger.WithError(err).Error("Failed to call Normal model")
-		return fmt.Errorf("model call: %w", err)
+		return err
+	}
+	if err := callAnswer(ctx, p.bridge, log, req, data); err != nil {
+		return err
 	}
+	log.Debug("Direct response completed successfully")
+	return nil
+}
 
-	// Store final content
-	data.FinalContent = resp.Choices[0].Message.Content
-	p.Logger.Debug("Postprocessing completed successfully")
+// ExecuteStream answers directly and forwards the Normal model output to out
+// as it arrives
+func (p *DirectResponder) ExecuteStream(ctx context.Context, data *Payload, out chan<- *models.ChatCompletionResponse) error {
+	if data.OriginalRequest.ResponseFormat.WantsJSON() || data.OriginalRequest.N > 1 {
+		return streamAnswer(ctx, p, data, out)
+	}
+	log := p.Logger.WithContext(ctx)
+	req, err := buildStageRequest(ctx, log, p, p.config, data)
+	if err != nil {
+		return err
+	}
+	respChan, err := p.bridge.CallNormalStream(ctx, req)
+	if err != nil {
+		log.WithError(err).Error("Failed to start streaming from Normal model")
+		return &modelCallError{err: err}
+	}
+
+	if err := forwardStream(ctx, respChan, data, p.config.StreamMode, out); err != nil {
+		return err
+	}
+	log.Debug("Streaming direct response completed successfully, %d bytes", data.Streamed())
 	return nil
 }
+
+// buildRequest forwards the original conversation and its sampling
+// parameters unchanged, including any assistant prefill
+func (p *DirectResponder) buildRequest(ctx context.Context, data *Payload) (*models.ChatCompletionRequest, error) {
+	return &models.ChatCompletionRequest{
+		Model:            stageModel(p.config, data),
+		Messages:         stageMessages(data, data.OriginalRequest.Messages...),
+		Temperature:      data.OriginalRequest.Temperature,
+		MaxTokens:        data.OriginalRequest.MaxTokens,
+		Stop:             data.OriginalRequest.Stop,
+		TopP:             data.OriginalRequest.TopP,
+		PresencePenalty:  data.OriginalRequest.PresencePenalty,
+		FrequencyPenalty: data.OriginalRequest.FrequencyPenalty,
+		ExtraParams:      data.OriginalRequest.ExtraParams,
+		Seed:             data.OriginalRequest.Seed,
+		ResponseFormat:   data.OriginalRequest.ResponseFormat,
+		Tools:            data.OriginalRequest.Tools,
+		ToolChoice:       data.OriginalRequest.ToolChoice,
+		LogProbs:         data.OriginalRequest.LogProbs,
+		TopLogProbs:      data.OriginalRequest.TopLogProbs,
+	}, nil
+}
@@ -2,13 +2,20 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/config"
 	"github.com/sleepstars/deepempower/internal/logger"
 	"github.com/sleepstars/deepempower/internal/mocks"
 	"github.com/sleepstars/deepempower/internal/modelbridge"
 	"github.com/sleepstars/deepempower/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -32,7 +39,8 @@ func TestNormalPreprocessor_Execute(t *testing.T) {
 		Logger:       logger.GetLogger().WithComponent("test_bridge"),
 	}
 
-	processor := newNormalPreprocessor("template ${input}", bridge)
+	processor, err := newNormalPreprocessor("template ${input}", bridge)
+	assert.NoError(t, err)
 	payload := &Payload{
 		OriginalRequest: &models.ChatCompletionRequest{
 			Model: "gpt-3.5-turbo",
@@ -42,11 +50,36 @@ func TestNormalPreprocessor_Execute(t *testing.T) {
 		},
 	}
 
-	err := processor.Execute(context.Background(), payload)
+	err = processor.Execute(context.Background(), payload)
 	assert.NoError(t, err)
 	assert.Equal(t, "preprocessed", payload.IntermContent)
 }
 
+func TestNormalPreprocessor_NoMessages(t *testing.T) {
+	called := false
+	bridge := &modelbridge.ModelBridge{
+		NormalClient: &mocks.MockModelClient{
+			CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+				called = true
+				return nil, nil
+			},
+		},
+		Logger: logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	processor, err := newNormalPreprocessor("Analyse: {{.UserInput}}", bridge)
+	assert.NoError(t, err)
+
+	for _, messages := range [][]models.ChatCompletionMessage{nil, {}} {
+		payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{Messages: messages}}
+		assert.NotPanics(t, func() {
+			err = processor.Execute(context.Background(), payload)
+		})
+		assert.ErrorIs(t, err, ErrNoMessages)
+		assert.False(t, called)
+	}
+}
+
 func TestReasonerEngine_Execute(t *testing.T) {
 	responses := []*models.ChatCompletionResponse{
 		{
@@ -60,7 +93,7 @@ func TestReasonerEngine_Execute(t *testing.T) {
 		{
 			Choices: []models.ChatCompletionChoice{
 				{Message: models.ChatCompletionMessage{
-					Content:          "step 2",
+					Content:          ", step 2",
 					ReasoningContent: []string{"reasoning 2"},
 				}},
 			},
@@ -88,7 +121,8 @@ func TestReasonerEngine_Execute(t *testing.T) {
 		Logger:         logger.GetLogger().WithComponent("test_bridge"),
 	}
 
-	processor := newReasonerEngine("template ${input}", bridge)
+	processor, err := newReasonerEngine("template ${input}", bridge)
+	assert.NoError(t, err)
 	// Set the model configuration for testing
 	processor.config.Model = "gpt-4"
 
@@ -102,12 +136,376 @@ func TestReasonerEngine_Execute(t *testing.T) {
 		IntermContent: "preprocessed",
 	}
 
-	err := processor.Execute(context.Background(), payload)
+	err = processor.Execute(context.Background(), payload)
 	assert.NoError(t, err)
-	assert.Equal(t, "step 2", payload.IntermContent)
+	assert.Equal(t, "step 1, step 2", payload.IntermContent)
 	assert.Equal(t, []string{"reasoning 1", "reasoning 2"}, payload.ReasoningChain)
 }
 
+// scriptedReasoning is a streamed Reasoner chunk carrying one reasoning step
+func scriptedReasoning(step, content string) *models.ChatCompletionResponse {
+	return &models.ChatCompletionResponse{
+		Choices: []models.ChatCompletionChoice{
+			{Message: models.ChatCompletionMessage{Content: content, ReasoningContent: []string{step}}},
+		},
+	}
+}
+
+func TestReasonerEngine_ScriptedStream(t *testing.T) {
+	upstreamErr := errors.New("connection reset")
+	testCases := []struct {
+		name        string
+		stream      *mocks.ScriptedStream
+		cancelFirst bool // Cancel the run once the first chunk is processed
+		expectedErr error
+		reasoning   []string
+		content     string
+	}{
+		{
+			name: "paced chunks",
+			stream: &mocks.ScriptedStream{
+				Chunks: []*models.ChatCompletionResponse{scriptedReasoning("one", "The answer"), scriptedReasoning("two", " is 42.")},
+				Delay:  5 * time.Millisecond,
+			},
+			reasoning: []string{"one", "two"},
+			content:   "The answer is 42.",
+		},
+		{
+			name: "error mid stream",
+			stream: mocks.NewScriptedStream(
+				scriptedReasoning("one", "The answer"),
+				&models.ChatCompletionResponse{Err: upstreamErr},
+				scriptedReasoning("never", " sent"),
+			),
+			expectedErr: upstreamErr,
+			reasoning:   []string{"one"},
+		},
+		{
+			// The engine returns as soon as the run is cancelled, without
+			// waiting for the slow stream to close
+			name: "cancelled while the stream is slow to close",
+			stream: &mocks.ScriptedStream{
+				Chunks:      []*models.ChatCompletionResponse{scriptedReasoning("one", "The answer"), scriptedReasoning("two", " is 42.")},
+				CancelDelay: time.Second,
+			},
+			cancelFirst: true,
+			expectedErr: context.Canceled,
+			reasoning:   []string{"one"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bridge := &modelbridge.ModelBridge{
+				ReasonerClient: &mocks.MockModelClient{Stream: tc.stream},
+				Logger:         logger.GetLogger().WithComponent("test_bridge"),
+			}
+			processor, err := newReasonerEngine("reason", bridge)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{}}
+			if tc.cancelFirst {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				defer cancel()
+				tc.stream.OnSend = func(i int) {
+					if i > 0 {
+						return
+					}
+					// The bridge relays the chunk, so wait for the engine to
+					// record it before cancelling
+					assert.Eventually(t, func() bool { return len(payload.Reasoning()) == 1 }, time.Second, time.Millisecond)
+					cancel()
+				}
+			}
+			start := time.Now()
+			err = processor.Execute(ctx, payload)
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+			assert.Equal(t, tc.reasoning, payload.Reasoning())
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.content, payload.Interm())
+		})
+	}
+}
+
+func TestReasonerEngine_StreamContent(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		chunks   []string
+		expected string
+	}{
+		{
+			name:     "deltas",
+			chunks:   []string{"The answer", " is", "", " 42."},
+			expected: "The answer is 42.",
+		},
+		{
+			name:     "cumulative",
+			chunks:   []string{"The answer", "The answer is", "The answer is 42."},
+			expected: "The answer is 42.",
+		},
+		{
+			name:     "cumulative with repeated chunk",
+			chunks:   []string{"The answer", "The answer", "The answer is 42."},
+			expected: "The answer is 42.",
+		},
+		{
+			name:     "aggregate mode",
+			mode:     clients.StreamModeAggregate,
+			chunks:   []string{"The answer", "Revised answer"},
+			expected: "Revised answer",
+		},
+		{
+			// A delta that happens to repeat everything so far
+			name:     "delta mode",
+			mode:     clients.StreamModeDelta,
+			chunks:   []string{"ha", "ha"},
+			expected: "haha",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					ch := make(chan *models.ChatCompletionResponse, len(tc.chunks))
+					for _, chunk := range tc.chunks {
+						ch <- &models.ChatCompletionResponse{
+							Choices: []models.ChatCompletionChoice{
+								{Message: models.ChatCompletionMessage{Content: chunk, ReasoningContent: []string{"thinking"}}},
+							},
+						}
+					}
+					close(ch)
+					return ch, nil
+				},
+			}
+			bridge := &modelbridge.ModelBridge{
+				ReasonerClient: mockClient,
+				Logger:         logger.GetLogger().WithComponent("test_bridge"),
+			}
+			processor, err := newReasonerEngine("reason", bridge)
+			require.NoError(t, err)
+			processor.config.StreamMode = tc.mode
+
+			payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{}}
+			require.NoError(t, processor.Execute(context.Background(), payload))
+			assert.Equal(t, tc.expected, payload.Interm())
+		})
+	}
+}
+
+func TestReasonerEngine_MaxSteps(t *testing.T) {
+	cancelled := make(chan struct{})
+	mockClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for i := 1; i <= 100; i++ {
+					select {
+					case ch <- &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{ReasoningContent: []string{fmt.Sprintf("step %d", i), "more"}}},
+						},
+					}:
+					case <-ctx.Done():
+						close(cancelled)
+						return
+					}
+				}
+			}()
+			return ch, nil
+		},
+	}
+	bridge := &modelbridge.ModelBridge{
+		ReasonerClient: mockClient,
+		Logger:         logger.GetLogger().WithComponent("test_bridge"),
+	}
+
+	processor, err := newReasonerEngine("reason", bridge)
+	require.NoError(t, err)
+	processor.maxSteps = 5
+
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	}}
+	require.NoError(t, processor.Execute(context.Background(), payload))
+
+	assert.Equal(t, []string{"step 1", "more", "step 2", "more", "step 3"}, payload.Reasoning())
+	reasoningFinish, _ := payload.FinishReasons()
+	assert.Equal(t, "length", reasoningFinish)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("reasoner stream was not cancelled")
+	}
+
+	// The partial chain still reaches the postprocessor
+	post, err := newNormalPostprocessor("{{range .ReasoningChain}}{{.}};{{end}}", bridge)
+	require.NoError(t, err)
+	req, err := post.buildRequest(context.Background(), payload)
+	require.NoError(t, err)
+	assert.Equal(t, "step 1;more;step 2;more;step 3;", req.Messages[0].Content)
+}
+
+func TestReasonerEngine_CancelMidStream(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	stopped := make(chan struct{})
+	mockClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{ReasoningContent: []string{"step 1"}}},
+				},
+			}
+			// A producer that only closes its stream long after cancellation
+			go func() {
+				<-ctx.Done()
+				close(stopped)
+				<-release
+				close(ch)
+			}()
+			return ch, nil
+		},
+	}
+	bridge := &modelbridge.ModelBridge{
+		ReasonerClient: mockClient,
+		Logger:         logger.GetLogger().WithComponent("test_bridge"),
+	}
+	processor, err := newReasonerEngine("reason", bridge)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	}}
+	out := make(chan *models.ChatCompletionResponse, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- processor.ExecuteStream(ctx, payload, out)
+	}()
+
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("first reasoning step was not forwarded")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("reasoner engine did not return after cancellation")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("reasoner stream was not told to stop")
+	}
+	assert.Equal(t, []string{"step 1"}, payload.Reasoning())
+}
+
+// lengthLimitedReasoner streams one scripted call per request, each ending
+// with the given finish reason, and records the requests it received
+func lengthLimitedReasoner(requests *[]*models.ChatCompletionRequest, calls ...models.ChatCompletionChoice) *mocks.MockModelClient {
+	return &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			call := calls[len(*requests)]
+			*requests = append(*requests, req)
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{call}}
+			close(ch)
+			return ch, nil
+		},
+	}
+}
+
+func TestReasonerEngine_LengthFinishReason(t *testing.T) {
+	truncated := models.ChatCompletionChoice{
+		Message:      models.ChatCompletionMessage{Content: "partial", ReasoningContent: []string{"first half"}},
+		FinishReason: "length",
+	}
+	completed := models.ChatCompletionChoice{
+		Message:      models.ChatCompletionMessage{Content: " conclusion", ReasoningContent: []string{" second half"}},
+		FinishReason: "stop",
+	}
+
+	tests := []struct {
+		name          string
+		continuations int
+		calls         []models.ChatCompletionChoice
+		reasoning     []string
+		interm        string
+		finishReason  string
+	}{
+		{
+			name:         "truncated without continuation",
+			calls:        []models.ChatCompletionChoice{truncated},
+			reasoning:    []string{"first half"},
+			interm:       "partial",
+			finishReason: "length",
+		},
+		{
+			name:          "continued to completion",
+			continuations: 2,
+			calls:         []models.ChatCompletionChoice{truncated, completed},
+			reasoning:     []string{"first half", " second half"},
+			interm:        "partial conclusion",
+			finishReason:  "stop",
+		},
+		{
+			name:          "continuations exhausted",
+			continuations: 1,
+			calls:         []models.ChatCompletionChoice{truncated, truncated},
+			reasoning:     []string{"first half", "first half"},
+			interm:        "partialpartial",
+			finishReason:  "length",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []*models.ChatCompletionRequest
+			bridge := modelbridge.NewModelBridgeWithClients(nil, lengthLimitedReasoner(&requests, tt.calls...),
+				logger.GetLogger().WithComponent("test_bridge"))
+			processor, err := newReasonerEngine("reason", bridge)
+			require.NoError(t, err)
+			processor.continuations = tt.continuations
+
+			payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			}}
+			require.NoError(t, processor.Execute(context.Background(), payload))
+
+			require.Len(t, requests, len(tt.calls))
+			assert.Equal(t, tt.reasoning, payload.Reasoning())
+			assert.Equal(t, tt.interm, payload.Interm())
+			reasoningFinish, _ := payload.FinishReasons()
+			assert.Equal(t, tt.finishReason, reasoningFinish)
+
+			if len(requests) > 1 {
+				// The continuation carries the output so far and asks to resume it
+				first, next := requests[0].Messages, requests[1].Messages
+				require.Len(t, next, len(first)+2)
+				assert.Equal(t, first, next[:len(first)])
+				assert.Equal(t, models.ChatCompletionMessage{Role: "assistant", Content: "first half\n\npartial"}, next[len(first)])
+				assert.Equal(t, models.ChatCompletionMessage{Role: "user", Content: reasoningContinuePrompt}, next[len(first)+1])
+			}
+		})
+	}
+}
+
 func TestNormalPostprocessor_Execute(t *testing.T) {
 	mockClient := &mocks.MockModelClient{
 		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
@@ -125,7 +523,8 @@ func TestNormalPostprocessor_Execute(t *testing.T) {
 		Logger:       logger.GetLogger().WithComponent("test_bridge"),
 	}
 
-	processor := newNormalPostprocessor("template ${input}", bridge)
+	processor, err := newNormalPostprocessor("template ${input}", bridge)
+	assert.NoError(t, err)
 	payload := &Payload{
 		OriginalRequest: &models.ChatCompletionRequest{
 			Model: "gpt-3.5-turbo",
@@ -137,7 +536,344 @@ func TestNormalPostprocessor_Execute(t *testing.T) {
 		ReasoningChain: []string{"step 1", "step 2"},
 	}
 
-	err := processor.Execute(context.Background(), payload)
+	err = processor.Execute(context.Background(), payload)
 	assert.NoError(t, err)
 	assert.Equal(t, "final response", payload.FinalContent)
 }
+
+func TestNormalPostprocessor_ExecuteStream(t *testing.T) {
+	chunks := []string{"first ", "second ", "third"}
+	var produced int32
+	ack := make(chan struct{})
+	mockClient := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for i, content := range chunks {
+					finishReason := ""
+					if i == len(chunks)-1 {
+						finishReason = "stop"
+					}
+					atomic.AddInt32(&produced, 1)
+					ch <- &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{
+						{Message: models.ChatCompletionMessage{Content: content}, FinishReason: finishReason},
+					}}
+					// Produce the next chunk only after this one reached the client
+					select {
+					case <-ack:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return ch, nil
+		},
+	}
+	bridge := &modelbridge.ModelBridge{
+		NormalClient: mockClient,
+		Logger:       logger.GetLogger().WithComponent("test_bridge"),
+	}
+	processor, err := newNormalPostprocessor("template", bridge)
+	require.NoError(t, err)
+
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+	}}
+	out := make(chan *models.ChatCompletionResponse)
+	done := make(chan error, 1)
+	go func() { done <- processor.ExecuteStream(context.Background(), payload, out) }()
+
+	for i, content := range chunks {
+		select {
+		case chunk := <-out:
+			assert.Equal(t, content, chunk.Choices[0].Message.Content)
+			assert.Equal(t, int32(i+1), atomic.LoadInt32(&produced), "chunk %d was not forwarded before the next was produced", i)
+			ack <- struct{}{}
+		case <-time.After(time.Second):
+			t.Fatalf("chunk %d was not forwarded", i)
+		}
+	}
+	require.NoError(t, <-done)
+
+	// The answer reached the client without being collected in the payload
+	assert.Empty(t, payload.Final())
+	assert.Equal(t, len("first second third"), payload.Streamed())
+	_, finishReason := payload.FinishReasons()
+	assert.Equal(t, "stop", finishReason)
+}
+
+func TestNormalPostprocessor_ExecuteStreamAggregate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		chunks   []string
+		expected []string
+	}{
+		{
+			name:     "delta mode",
+			mode:     clients.StreamModeDelta,
+			chunks:   []string{"The answer", " is", " 42."},
+			expected: []string{"The answer", " is", " 42."},
+		},
+		{
+			name:     "aggregate mode",
+			mode:     clients.StreamModeAggregate,
+			chunks:   []string{"The answer", "The answer is", "The answer is 42.", "The answer is 42."},
+			expected: []string{"The answer", " is", " 42.", ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := &mocks.MockModelClient{
+				CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+					ch := make(chan *models.ChatCompletionResponse, len(tc.chunks))
+					for i, chunk := range tc.chunks {
+						finishReason := ""
+						if i == len(tc.chunks)-1 {
+							finishReason = "stop"
+						}
+						ch <- &models.ChatCompletionResponse{Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{Content: chunk}, FinishReason: finishReason},
+						}}
+					}
+					close(ch)
+					return ch, nil
+				},
+			}
+			bridge := &modelbridge.ModelBridge{
+				NormalClient: mockClient,
+				Logger:       logger.GetLogger().WithComponent("test_bridge"),
+			}
+			processor, err := newNormalPostprocessor("template", bridge)
+			require.NoError(t, err)
+			processor.config.StreamMode = tc.mode
+
+			payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "test"}},
+			}}
+			out := make(chan *models.ChatCompletionResponse, len(tc.chunks))
+			require.NoError(t, processor.ExecuteStream(context.Background(), payload, out))
+			close(out)
+
+			var forwarded []string
+			for chunk := range out {
+				forwarded = append(forwarded, chunk.Choices[0].Message.Content)
+			}
+			assert.Equal(t, tc.expected, forwarded)
+			assert.Equal(t, len("The answer is 42."), payload.Streamed())
+			assert.Equal(t, "stop", payload.FinishReason)
+		})
+	}
+}
+
+func TestProcessors_TemplateRequestFields(t *testing.T) {
+	const tmpl = `{{if eq .Model "gpt-4"}}detailed{{else}}brief{{end}} {{.RequestID}} {{len .Messages}}`
+	seed := 42
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+		Model:     "gpt-4",
+		RequestID: "req-42",
+		Seed:      &seed,
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello"},
+			{Role: "user", Content: "why?"},
+		},
+	}, ReasoningChain: []string{"step"}}
+
+	type requestBuilder interface {
+		buildRequest(ctx context.Context, data *Payload) (*models.ChatCompletionRequest, error)
+	}
+	tests := []struct {
+		name     string
+		newStage func() (requestBuilder, error)
+	}{
+		{"preprocessor", func() (requestBuilder, error) { return newNormalPreprocessor(tmpl, nil) }},
+		{"reasoner", func() (requestBuilder, error) { return newReasonerEngine(tmpl, nil) }},
+		{"postprocessor", func() (requestBuilder, error) { return newNormalPostprocessor(tmpl, nil) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage, err := tt.newStage()
+			require.NoError(t, err)
+			req, err := stage.buildRequest(context.Background(), payload)
+			require.NoError(t, err)
+			assert.Equal(t, "detailed req-42 3", req.Messages[0].Content)
+			// Every stage samples with the request's seed
+			assert.Equal(t, &seed, req.Seed)
+		})
+	}
+}
+
+func TestProcessors_Prefill(t *testing.T) {
+	payload := &Payload{OriginalRequest: &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "Write a haiku about autumn"},
+			{Role: "assistant", Content: "Crimson leaves drift down"},
+		},
+	}}
+	payload.SetIntermContent("structured input")
+
+	// The preprocessor answers the user message and sees the prefill only
+	// through its template
+	pre, err := newNormalPreprocessor("Continue: {{.Prefill}}", nil)
+	require.NoError(t, err)
+	req, err := pre.buildRequest(context.Background(), payload)
+	require.NoError(t, err)
+	require.Len(t, req.Messages, 2)
+	assert.Equal(t, "Continue: Crimson leaves drift down", req.Messages[0].Content)
+	assert.Equal(t, models.ChatCompletionMessage{Role: "user", Content: "Write a haiku about autumn"}, req.Messages[1])
+
+	// The final answer continues the prefill
+	post, err := newNormalPostprocessor("Answer", nil)
+	require.NoError(t, err)
+	req, err = post.buildRequest(context.Background(), payload)
+	require.NoError(t, err)
+	require.Len(t, req.Messages, 3)
+	assert.Equal(t, models.ChatCompletionMessage{Role: "assistant", Content: "Crimson leaves drift down"}, req.Messages[2])
+
+	direct := newDirectResponder(nil)
+	req, err = direct.buildRequest(context.Background(), payload)
+	require.NoError(t, err)
+	assert.Equal(t, payload.OriginalRequest.Messages, req.Messages)
+}
+
+func TestNormalPreprocessor_MalformedTemplate(t *testing.T) {
+	processor, err := newNormalPreprocessor("Analyze {{", nil)
+	assert.Nil(t, processor)
+	assert.Error(t, err)
+}
+
+func TestNormalPostprocessor_NoReasoningPrompt(t *testing.T) {
+	const mainPrompt = "Reasoning: {{.ReasoningChain}} Result: {{.IntermediateResult}}"
+	tests := []struct {
+		name     string
+		fallback string
+		chain    []string
+		expected string
+	}{
+		{
+			name:     "reasoning produced",
+			chain:    []string{"step"},
+			expected: "Reasoning: [step] Result: interim",
+		},
+		{
+			name:     "built-in fallback",
+			expected: "No reasoning steps are available for this request. Answer it directly and clearly, based on this result:\ninterim",
+		},
+		{
+			name:     "configured fallback",
+			fallback: "Answer from: {{.IntermediateResult}}",
+			expected: "Answer from: interim",
+		},
+		{
+			name:     "configured fallback unused with reasoning",
+			fallback: "Answer from: {{.IntermediateResult}}",
+			chain:    []string{"step"},
+			expected: "Reasoning: [step] Result: interim",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newMockPipeline(nil, nil).config
+			cfg.Prompts.PostProcess = mainPrompt
+			cfg.Prompts.PostProcessNoReasoning = tt.fallback
+			pipeline, err := NewHybridPipeline(cfg)
+			require.NoError(t, err)
+			processor := pipeline.stages[2].(*NormalPostprocessor)
+
+			payload := &Payload{
+				OriginalRequest: &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "q"}}},
+				IntermContent:   "interim",
+				ReasoningChain:  tt.chain,
+			}
+			req, err := processor.buildRequest(context.Background(), payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, req.Messages[0].Content)
+			assert.NotContains(t, req.Messages[0].Content, "[]")
+		})
+	}
+}
+
+func TestFormatReasoning(t *testing.T) {
+	// Streamed pieces split the reasoning anywhere, not only between steps
+	chain := []string{"read the ques", "tion\ncheck ", "the facts\n", "\nconclude"}
+	tests := []struct {
+		name     string
+		chain    []string
+		format   config.ReasoningFormatConfig
+		expected string
+	}{
+		{
+			name:     "plain",
+			chain:    chain,
+			expected: "read the question\ncheck the facts\n\nconclude",
+		},
+		{
+			name:     "numbered",
+			chain:    chain,
+			format:   config.ReasoningFormatConfig{Numbered: true},
+			expected: "1. read the question\n2. check the facts\n3. conclude",
+		},
+		{
+			name:     "custom separator",
+			chain:    chain,
+			format:   config.ReasoningFormatConfig{Separator: " -> "},
+			expected: "read the question -> check the facts -> conclude",
+		},
+		{
+			name:     "numbered with separator",
+			chain:    chain,
+			format:   config.ReasoningFormatConfig{Separator: "\n\n", Numbered: true},
+			expected: "1. read the question\n\n2. check the facts\n\n3. conclude",
+		},
+		{
+			name:     "single line",
+			chain:    []string{"one ", "thought"},
+			format:   config.ReasoningFormatConfig{Numbered: true},
+			expected: "1. one thought",
+		},
+		{
+			name:   "empty",
+			format: config.ReasoningFormatConfig{Numbered: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatReasoning(tt.chain, tt.format))
+		})
+	}
+}
+
+func TestNormalPostprocessor_ReasoningText(t *testing.T) {
+	payload := &Payload{
+		OriginalRequest: &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "q"}}},
+		ReasoningChain:  []string{"step ", "one\nstep", " two"},
+	}
+	tests := []struct {
+		name     string
+		format   config.ReasoningFormatConfig
+		expected string
+	}{
+		{"plain", config.ReasoningFormatConfig{}, "Reasoning:\nstep one\nstep two"},
+		{"numbered", config.ReasoningFormatConfig{Numbered: true}, "Reasoning:\n1. step one\n2. step two"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newMockPipeline(nil, nil).config
+			cfg.Prompts.PostProcess = "Reasoning:\n{{.ReasoningText}}"
+			cfg.ReasoningFormat = tt.format
+			pipeline, err := NewHybridPipeline(cfg)
+			require.NoError(t, err)
+
+			req, err := pipeline.stages[2].(*NormalPostprocessor).buildRequest(context.Background(), payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, req.Messages[0].Content)
+		})
+	}
+}
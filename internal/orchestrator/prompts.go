@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sleepstars/deepempower/internal/config"
+)
+
+// Names of the stage prompts asked of a PromptProvider
+const (
+	PromptPreProcess             = "pre_process"
+	PromptReasoning              = "reasoning"
+	PromptPostProcess            = "post_process"
+	PromptPostProcessNoReasoning = "post_process_no_reasoning"
+)
+
+// PromptProvider supplies the stage prompt templates by name, so prompts can
+// come from files, a database or a versioned prompt registry instead of the
+// config. The pipeline asks for its prompts once, when it is created.
+type PromptProvider interface {
+	// Prompt returns the template text of the named prompt, or "" when the
+	// prompt is not set
+	Prompt(name string) (string, error)
+}
+
+// PipelineOption customizes a pipeline created by NewHybridPipeline
+type PipelineOption func(*HybridPipeline)
+
+// WithPromptProvider makes the pipeline take its stage prompts from provider
+// instead of the config
+func WithPromptProvider(provider PromptProvider) PipelineOption {
+	return func(p *HybridPipeline) {
+		p.prompts = provider
+	}
+}
+
+// configPrompts serves the prompts set in the config. Prompts not set inline
+// are read from <dir>/<name>.md when a prompts directory is configured.
+type configPrompts struct {
+	cfg config.PromptsConfig
+}
+
+// NewConfigPromptProvider returns the default PromptProvider, backed by the
+// prompts config and its prompts directory
+func NewConfigPromptProvider(cfg config.PromptsConfig) PromptProvider {
+	return &configPrompts{cfg: cfg}
+}
+
+// Prompt implements PromptProvider
+func (c *configPrompts) Prompt(name string) (string, error) {
+	var text string
+	switch name {
+	case PromptPreProcess:
+		text = c.cfg.PreProcess
+	case PromptReasoning:
+		text = c.cfg.Reasoning
+	case PromptPostProcess:
+		text = c.cfg.PostProcess
+	case PromptPostProcessNoReasoning:
+		text = c.cfg.PostProcessNoReasoning
+	default:
+		return "", fmt.Errorf("unknown prompt %q", name)
+	}
+	if text != "" || c.cfg.Dir == "" {
+		return text, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.cfg.Dir, name+".md"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// loadPrompt asks provider for the named prompt
+func loadPrompt(provider PromptProvider, name string) (string, error) {
+	text, err := provider.Prompt(name)
+	if err != nil {
+		return "", fmt.Errorf("load %s prompt: %w", name, err)
+	}
+	return text, nil
+}
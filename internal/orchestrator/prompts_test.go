@@ -0,0 +1,156 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryPrompts is an in-memory PromptProvider
+type memoryPrompts map[string]string
+
+func (m memoryPrompts) Prompt(name string) (string, error) {
+	return m[name], nil
+}
+
+type failingPrompts struct{}
+
+func (failingPrompts) Prompt(name string) (string, error) {
+	return "", errors.New("registry unavailable")
+}
+
+func TestNewHybridPipeline_PromptProvider(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*models.ChatCompletionRequest
+	record := func(req *models.ChatCompletionRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}
+	normalClient := staticNormalClient("answer")
+	complete := normalClient.CompleteFunc
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		record(req)
+		return complete(ctx, req)
+	}
+	reasonerClient := staticReasonerClient("reasoned", "step")
+	stream := reasonerClient.CompleteStreamFunc
+	reasonerClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		record(req)
+		return stream(ctx, req)
+	}
+
+	provider := memoryPrompts{
+		PromptPreProcess:  "v2 analyze: {{.UserInput}}",
+		PromptReasoning:   "v2 reason: {{.StructuredInput}}",
+		PromptPostProcess: "v2 answer: {{.IntermediateResult}}",
+	}
+	pipeline, err := NewHybridPipeline(newMockPipeline(nil, nil).config, WithPromptProvider(provider))
+	require.NoError(t, err)
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normalClient, reasonerClient, nil))
+
+	_, err = pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+
+	// Each stage renders the prompt the provider gave for it
+	require.Len(t, requests, 3)
+	expected := []string{"v2 analyze: hello", "v2 reason: answer", "v2 answer: reasoned"}
+	for i, req := range requests {
+		assert.True(t, hasContent(req.Messages, expected[i]), "stage %d prompt", i)
+	}
+}
+
+func TestNewHybridPipeline_PromptProviderError(t *testing.T) {
+	_, err := NewHybridPipeline(newMockPipeline(nil, nil).config, WithPromptProvider(failingPrompts{}))
+	assert.EqualError(t, err, "load pre_process prompt: registry unavailable")
+}
+
+func TestNewHybridPipeline_MissingPrompt(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pre_process.md"), []byte("analyze"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "post_process.md"), []byte("answer"), 0o600))
+	fromDir := newMockPipeline(nil, nil).config
+	fromDir.Prompts = config.PromptsConfig{Dir: dir}
+
+	tests := []struct {
+		name string
+		cfg  *config.PipelineConfig
+		opts []PipelineOption
+		err  string
+	}{
+		{
+			// reasoning.md is missing from the directory
+			name: "prompts directory",
+			cfg:  fromDir,
+			err:  "stage prompt is empty: reasoning",
+		},
+		{
+			name: "provider",
+			cfg:  newMockPipeline(nil, nil).config,
+			opts: []PipelineOption{WithPromptProvider(memoryPrompts{PromptPreProcess: "analyze", PromptReasoning: "reason"})},
+			err:  "stage prompt is empty: post_process",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewHybridPipeline(tc.cfg, tc.opts...)
+			assert.ErrorIs(t, err, ErrMissingPrompt)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestConfigPromptProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "reasoning.md"), []byte("from file"), 0o600))
+	provider := NewConfigPromptProvider(config.PromptsConfig{
+		PreProcess: "inline",
+		Reasoning:  "",
+		Dir:        dir,
+	})
+
+	tests := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{name: PromptPreProcess, expected: "inline"},
+		{name: PromptReasoning, expected: "from file"},
+		{name: PromptPostProcessNoReasoning},
+		{name: "summary", err: `unknown prompt "summary"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			text, err := provider.Prompt(tc.name)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, text)
+		})
+	}
+}
+
+func hasContent(messages []models.ChatCompletionMessage, content string) bool {
+	for _, m := range messages {
+		if strings.Contains(m.Content, content) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/config"
+)
+
+// Retryable error categories accepted in config
+const (
+	RetryModelCall   = "model_call"
+	RetryRateLimit   = "rate_limit"
+	RetryServerError = "server_error"
+	RetryTimeout     = "timeout"
+)
+
+// retryPolicy decides whether and when a failed stage is retried
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	retryOn     map[string]bool
+}
+
+func newRetryPolicy(cfg config.RetryConfig) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+		retryOn:     make(map[string]bool, len(cfg.RetryOn)),
+	}
+	if policy.maxAttempts < 1 {
+		policy.maxAttempts = 1
+	}
+	for _, category := range cfg.RetryOn {
+		policy.retryOn[category] = true
+	}
+	return policy
+}
+
+// retryable reports whether err falls into one of the configured categories
+func (r retryPolicy) retryable(err error) bool {
+	status := clients.HTTPStatus(err)
+	switch {
+	case r.retryOn[RetryModelCall] && errors.Is(err, ErrModelCall):
+		return true
+	case r.retryOn[RetryRateLimit] && status == http.StatusTooManyRequests:
+		return true
+	case r.retryOn[RetryServerError] && status >= http.StatusInternalServerError:
+		return true
+	case r.retryOn[RetryTimeout] && errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	return false
+}
+
+// delay returns the wait before the attempt following the given one
+func (r retryPolicy) delay(attempt int) time.Duration {
+	return r.backoff << (attempt - 1)
+}
@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	rateLimited := &modelCallError{err: &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}}
+	badGateway := &modelCallError{err: &openai.RequestError{HTTPStatusCode: http.StatusBadGateway}}
+	timeout := fmt.Errorf("stream: %w", context.DeadlineExceeded)
+	plain := errors.New("parse template: bad")
+
+	testCases := []struct {
+		name     string
+		retryOn  []string
+		err      error
+		expected bool
+	}{
+		{name: "model call", retryOn: []string{RetryModelCall}, err: badGateway, expected: true},
+		{name: "rate limit", retryOn: []string{RetryRateLimit}, err: rateLimited, expected: true},
+		{name: "rate limit not matching 502", retryOn: []string{RetryRateLimit}, err: badGateway, expected: false},
+		{name: "server error", retryOn: []string{RetryServerError}, err: badGateway, expected: true},
+		{name: "timeout", retryOn: []string{RetryTimeout}, err: timeout, expected: true},
+		{name: "non model error", retryOn: []string{RetryModelCall, RetryTimeout}, err: plain, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := newRetryPolicy(config.RetryConfig{MaxAttempts: 2, RetryOn: tc.retryOn})
+			assert.Equal(t, tc.expected, policy.retryable(tc.err))
+		})
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := newRetryPolicy(config.RetryConfig{Backoff: 10 * time.Millisecond})
+	assert.Equal(t, 1, policy.maxAttempts)
+	assert.Equal(t, 10*time.Millisecond, policy.delay(1))
+	assert.Equal(t, 20*time.Millisecond, policy.delay(2))
+	assert.Equal(t, 40*time.Millisecond, policy.delay(3))
+}
@@ -0,0 +1,230 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// defaultModerationTimeout bounds a moderation endpoint call when the config
+// leaves the timeout unset
+const defaultModerationTimeout = 10 * time.Second
+
+// contentModerator checks an answer for content that must not be returned,
+// giving the reason when it is flagged
+type contentModerator interface {
+	Moderate(ctx context.Context, text string) (reason string, flagged bool, err error)
+}
+
+// SafetyFilter is the stage that checks the final answer, and every further
+// choice, with its moderators. Flagged answers fail the run with
+// ErrContentBlocked or are rewritten to a fixed replacement.
+type SafetyFilter struct {
+	moderators  []contentModerator
+	rewrite     bool
+	replacement string
+	Logger      *logger.Logger
+}
+
+// NewSafetyFilter creates the safety stage for cfg, checking the denylist
+// before calling the moderation endpoint
+func NewSafetyFilter(cfg config.SafetyConfig) (*SafetyFilter, error) {
+	f := &SafetyFilter{
+		rewrite:     cfg.Action == config.SafetyActionRewrite,
+		replacement: cfg.Replacement,
+		Logger:      logger.GetLogger().WithComponent("safety_filter"),
+	}
+	if len(cfg.Denylist) > 0 {
+		denylist, err := newDenylistModerator(cfg.Denylist)
+		if err != nil {
+			return nil, err
+		}
+		f.moderators = append(f.moderators, denylist)
+	}
+	if cfg.ModerationURL != "" {
+		f.moderators = append(f.moderators, newEndpointModerator(cfg))
+	}
+	return f, nil
+}
+
+func (f *SafetyFilter) Name() string {
+	return "safety_filter"
+}
+
+func (f *SafetyFilter) Execute(ctx context.Context, data *Payload) error {
+	log := f.Logger.WithContext(ctx)
+	reason, err := f.check(ctx, data.Final())
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		if !f.rewrite {
+			log.Warn("Answer blocked: %s", reason)
+			return &contentBlockedError{reason: reason}
+		}
+		log.Warn("Answer rewritten: %s", reason)
+		data.SetFinalContent(f.replacement)
+		data.SetToolCalls(nil)
+		data.SetLogProbs(nil)
+		data.SetFinishReason("content_filter")
+	}
+
+	alternatives := data.AlternativeChoices()
+	if len(alternatives) == 0 {
+		return nil
+	}
+	checked := make([]models.ChatCompletionChoice, len(alternatives))
+	for i, choice := range alternatives {
+		reason, err := f.check(ctx, choice.Message.Content)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			if !f.rewrite {
+				log.Warn("Choice %d blocked: %s", choice.Index, reason)
+				return &contentBlockedError{reason: fmt.Sprintf("choice %d: %s", choice.Index, reason)}
+			}
+			log.Warn("Choice %d rewritten: %s", choice.Index, reason)
+			choice.Message = models.ChatCompletionMessage{Role: choice.Message.Role, Content: f.replacement}
+			choice.LogProbs = nil
+			choice.FinishReason = "content_filter"
+		}
+		checked[i] = choice
+	}
+	data.SetAlternatives(checked)
+	return nil
+}
+
+// check runs the moderators in order and returns the reason of the first one
+// flagging text, or "" when text passes
+func (f *SafetyFilter) check(ctx context.Context, text string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+	for _, m := range f.moderators {
+		reason, flagged, err := m.Moderate(ctx, text)
+		if err != nil {
+			return "", fmt.Errorf("moderate answer: %w", err)
+		}
+		if flagged {
+			return reason, nil
+		}
+	}
+	return "", nil
+}
+
+// denylistModerator flags text matching any of its regular expressions
+type denylistModerator struct {
+	patterns []*regexp.Regexp
+}
+
+func newDenylistModerator(patterns []string) (*denylistModerator, error) {
+	m := &denylistModerator{patterns: make([]*regexp.Regexp, len(patterns))}
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile denylist pattern %q: %w", pattern, err)
+		}
+		m.patterns[i] = re
+	}
+	return m, nil
+}
+
+func (m *denylistModerator) Moderate(ctx context.Context, text string) (string, bool, error) {
+	for _, re := range m.patterns {
+		if re.MatchString(text) {
+			return fmt.Sprintf("matches denylist pattern %q", re.String()), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// endpointModerator asks an OpenAI compatible moderations endpoint
+type endpointModerator struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+func newEndpointModerator(cfg config.SafetyConfig) *endpointModerator {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultModerationTimeout
+	}
+	return &endpointModerator{
+		url:    cfg.ModerationURL,
+		model:  cfg.ModerationModel,
+		apiKey: cfg.APIKey,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type moderationRequest struct {
+	Input string `json:"input"`
+	Model string `json:"model,omitempty"`
+}
+
+// moderationResponse is the part of a moderations response the filter reads
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+func (m *endpointModerator) Moderate(ctx context.Context, text string) (string, bool, error) {
+	body, err := json.Marshal(moderationRequest{Input: text, Model: m.model})
+	if err != nil {
+		return "", false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("moderation endpoint returned %s", resp.Status)
+	}
+	var result moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", false, fmt.Errorf("decode moderation response: %w", err)
+	}
+
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		var categories []string
+		for name, flagged := range r.Categories {
+			if flagged {
+				categories = append(categories, name)
+			}
+		}
+		if len(categories) == 0 {
+			return "flagged by moderation", true, nil
+		}
+		sort.Strings(categories)
+		return "flagged by moderation: " + strings.Join(categories, ", "), true, nil
+	}
+	return "", false, nil
+}
@@ -0,0 +1,215 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSafetyPipeline returns a pipeline answering with answer and checking it
+// with the given safety config
+func newSafetyPipeline(t *testing.T, answer string, safety config.SafetyConfig) *HybridPipeline {
+	cfg := newMockPipeline(nil, nil).config
+	cfg.Safety = &safety
+	pipeline, err := NewHybridPipeline(cfg)
+	require.NoError(t, err)
+	pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(
+		staticNormalClient(answer), staticReasonerClient("reasoned", "step"), nil))
+	return pipeline
+}
+
+func TestSafetyFilter_Denylist(t *testing.T) {
+	denylist := []string{`(?i)launch codes?`, `\b\d{3}-\d{2}-\d{4}\b`}
+	tests := []struct {
+		name     string
+		answer   string
+		action   string
+		expected string
+		reason   string
+	}{
+		{name: "pass", answer: "The weather is sunny.", expected: "The weather is sunny."},
+		{name: "block keyword", answer: "Here are the Launch Codes.", reason: `content blocked: matches denylist pattern "(?i)launch codes?"`},
+		{name: "block pattern", answer: "Her SSN is 123-45-6789.", reason: `content blocked: matches denylist pattern "\\b\\d{3}-\\d{2}-\\d{4}\\b"`},
+		{name: "rewrite", answer: "Here are the launch codes.", action: config.SafetyActionRewrite, expected: "[removed]"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pipeline := newSafetyPipeline(t, tc.answer, config.SafetyConfig{
+				Denylist:    denylist,
+				Action:      tc.action,
+				Replacement: "[removed]",
+			})
+			require.Equal(t, "safety_filter", pipeline.Stages()[len(pipeline.Stages())-1].Name())
+
+			resp, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+				Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+			})
+			if tc.reason != "" {
+				assert.ErrorIs(t, err, ErrContentBlocked)
+				assert.EqualError(t, err, "stage safety_filter failed: "+tc.reason)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resp.Choices[0].Message.Content)
+			if tc.action == config.SafetyActionRewrite {
+				assert.Equal(t, "content_filter", resp.Choices[0].FinishReason)
+			}
+		})
+	}
+}
+
+func TestSafetyFilter_ModerationEndpoint(t *testing.T) {
+	var received moderationRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer moderation-key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		flagged := strings.Contains(received.Input, "hurt")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{
+				"flagged":    flagged,
+				"categories": map[string]bool{"violence": flagged, "self-harm": flagged, "hate": false},
+			}},
+		})
+	}))
+	defer server.Close()
+	safety := config.SafetyConfig{ModerationURL: server.URL, ModerationModel: "omni-moderation-latest", APIKey: "moderation-key"}
+
+	request := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}}}
+	}
+	resp, err := newSafetyPipeline(t, "Be kind to each other.", safety).Execute(context.Background(), request())
+	require.NoError(t, err)
+	assert.Equal(t, "Be kind to each other.", resp.Choices[0].Message.Content)
+	assert.Equal(t, moderationRequest{Input: "Be kind to each other.", Model: "omni-moderation-latest"}, received)
+
+	_, err = newSafetyPipeline(t, "How to hurt someone.", safety).Execute(context.Background(), request())
+	assert.ErrorIs(t, err, ErrContentBlocked)
+	assert.ErrorContains(t, err, "flagged by moderation: self-harm, violence")
+}
+
+func TestSafetyFilter_Stream(t *testing.T) {
+	// Streamed answers are held back until the safety stage has checked them,
+	// even while reasoning is streamed
+	includeReasoning := true
+	newRequest := func() *models.ChatCompletionRequest {
+		return &models.ChatCompletionRequest{
+			Messages:         []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+			Stream:           true,
+			IncludeReasoning: &includeReasoning,
+		}
+	}
+	collect := func(pipeline *HybridPipeline) (string, []string) {
+		stream, err := pipeline.ExecuteStream(context.Background(), newRequest())
+		require.NoError(t, err)
+		var content strings.Builder
+		var reasoning []string
+		for chunk := range stream {
+			require.NoError(t, chunk.Err)
+			for _, choice := range chunk.Choices {
+				content.WriteString(choice.Message.Content)
+				reasoning = append(reasoning, choice.Message.ReasoningContent...)
+			}
+		}
+		return content.String(), reasoning
+	}
+
+	content, reasoning := collect(newSafetyPipeline(t, "The weather is sunny.", config.SafetyConfig{Denylist: []string{"secret"}}))
+	assert.Equal(t, "The weather is sunny.", content)
+	assert.Equal(t, []string{"step"}, reasoning)
+
+	content, _ = collect(newSafetyPipeline(t, "The secret is out.", config.SafetyConfig{Denylist: []string{"secret"}}))
+	assert.NotContains(t, content, "secret")
+}
+
+func TestSafetyFilter_Passthrough(t *testing.T) {
+	pipeline := newSafetyPipeline(t, "The secret is out.", config.SafetyConfig{Denylist: []string{"secret"}})
+	_, err := pipeline.Execute(context.Background(), &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+		Mode:     config.ModePassthrough,
+	})
+	assert.ErrorIs(t, err, ErrContentBlocked)
+}
+
+func TestSafetyFilter_DegradedOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		interm   string
+		action   string
+		expected string
+		finish   string
+		blocked  bool
+	}{
+		{name: "pass", interm: "reasoned answer", expected: "reasoned answer", finish: "stop"},
+		{name: "rewrite", interm: "The secret answer", action: config.SafetyActionRewrite, expected: "[removed]", finish: "content_filter"},
+		{name: "block", interm: "The secret answer", blocked: true},
+	}
+
+	for _, tc := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s stream=%v", tc.name, stream), func(t *testing.T) {
+				// The postprocessor fails, so the reasoner result is the
+				// answer and the safety stage checks it
+				cfg := newMockPipeline(nil, nil).config
+				cfg.DegradedOutput = true
+				cfg.Safety = &config.SafetyConfig{Denylist: []string{"secret"}, Action: tc.action, Replacement: "[removed]"}
+				pipeline, err := NewHybridPipeline(cfg)
+				require.NoError(t, err)
+				pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(
+					failingPostprocessClient(), staticReasonerClient(tc.interm, "step"), nil))
+				req := &models.ChatCompletionRequest{
+					Messages: []models.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+					Stream:   stream,
+				}
+
+				if !stream {
+					resp, err := pipeline.Execute(context.Background(), req)
+					if tc.blocked {
+						assert.ErrorIs(t, err, ErrContentBlocked)
+						return
+					}
+					require.NoError(t, err)
+					assert.Equal(t, tc.expected, resp.Choices[0].Message.Content)
+					assert.Equal(t, tc.finish, resp.Choices[0].FinishReason)
+					require.NotNil(t, resp.Metadata)
+					assert.True(t, resp.Metadata.Degraded)
+					return
+				}
+
+				chunks, err := pipeline.ExecuteStream(context.Background(), req)
+				require.NoError(t, err)
+				var content strings.Builder
+				var finish string
+				degraded := false
+				for chunk := range chunks {
+					for _, choice := range chunk.Choices {
+						content.WriteString(choice.Message.Content)
+						if choice.FinishReason != "" {
+							finish = choice.FinishReason
+						}
+					}
+					if chunk.Metadata != nil && chunk.Metadata.Degraded {
+						degraded = true
+					}
+				}
+				if tc.blocked {
+					assert.Empty(t, content.String())
+					return
+				}
+				assert.Equal(t, tc.expected, content.String())
+				assert.Equal(t, tc.finish, finish)
+				assert.True(t, degraded)
+			})
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package orchestrator
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+const (
+	defaultShadowMaxConcurrent = 4
+	defaultShadowTimeout       = 2 * time.Minute
+)
+
+// ShadowRunner mirrors a sample of requests to a secondary pipeline. Shadow
+// results are only logged so they can be diffed against the primary output.
+type ShadowRunner struct {
+	rate     float64
+	timeout  time.Duration
+	pipeline *HybridPipeline
+	slots    chan struct{}
+	sample   func() float64
+	wg       sync.WaitGroup
+	Logger   *logger.Logger
+}
+
+// NewShadowRunner creates a shadow runner for the given pipeline
+func NewShadowRunner(cfg config.ShadowConfig, pipeline *HybridPipeline) *ShadowRunner {
+	maxConcurrent := cfg.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultShadowMaxConcurrent
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	return &ShadowRunner{
+		rate:     cfg.Rate,
+		timeout:  timeout,
+		pipeline: pipeline,
+		slots:    make(chan struct{}, maxConcurrent),
+		sample:   rand.Float64,
+		Logger:   logger.GetLogger().WithComponent("shadow"),
+	}
+}
+
+// Mirror runs the request through the shadow pipeline in the background and
+// logs the shadow output next to the primary one. It never blocks the caller:
+// requests outside the sample rate or beyond the concurrency budget are dropped.
+func (s *ShadowRunner) Mirror(req *models.ChatCompletionRequest, primary *models.ChatCompletionResponse) {
+	if s.rate <= 0 || s.sample() >= s.rate {
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.Logger.WithField("request_id", req.RequestID).Debug("Shadow budget exhausted, skipping request id: %s", req.RequestID)
+		return
+	}
+
+	shadowReq := cloneRequest(req)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.slots }()
+
+		// Detached from the client context so cancellation of the primary
+		// request does not cut the shadow run short
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+
+		resp, err := s.pipeline.Execute(ctx, shadowReq)
+		if err != nil {
+			s.Logger.WithField("request_id", shadowReq.RequestID).WithError(err).Warn("Shadow execution failed for request id: %s", shadowReq.RequestID)
+			return
+		}
+
+		s.Logger.WithField("request_id", shadowReq.RequestID).Info("Shadow comparison for request id: %s primary=%q shadow=%q",
+			shadowReq.RequestID, firstContent(primary), firstContent(resp))
+	}()
+}
+
+// Wait blocks until all in-flight shadow runs have finished
+func (s *ShadowRunner) Wait() {
+	s.wg.Wait()
+}
+
+// cloneRequest copies a request so the shadow pipeline cannot mutate the primary one
+func cloneRequest(req *models.ChatCompletionRequest) *models.ChatCompletionRequest {
+	clone := *req
+	clone.Messages = append([]models.ChatCompletionMessage(nil), req.Messages...)
+	return &clone
+}
+
+// firstContent returns the content of the first choice, if any
+func firstContent(resp *models.ChatCompletionResponse) string {
+	if resp == nil || len(resp.Choices) == 0 {
+		return ""
+	}
+	return resp.Choices[0].Message.Content
+}
@@ -0,0 +1,101 @@
+package orchestrator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowRunner_Mirror(t *testing.T) {
+	var shadowCalls int32
+	shadowNormal := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			atomic.AddInt32(&shadowCalls, 1)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "shadow response"}},
+				},
+			}, nil
+		},
+	}
+
+	primary := newMockPipeline(staticNormalClient("primary response"), staticReasonerClient("reasoned", "step 1"))
+	shadow := NewShadowRunner(config.ShadowConfig{Rate: 1}, newMockPipeline(shadowNormal, staticReasonerClient("reasoned", "step 1")))
+	primary.SetShadow(shadow)
+
+	req := &models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test input"},
+		},
+	}
+
+	resp, err := primary.Execute(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "primary response", resp.Choices[0].Message.Content)
+
+	shadow.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&shadowCalls))
+}
+
+func TestShadowRunner_DoesNotBlockPrimary(t *testing.T) {
+	release := make(chan struct{})
+	slowNormal := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			<-release
+			return nil, context.Canceled
+		},
+	}
+
+	primary := newMockPipeline(staticNormalClient("primary response"), staticReasonerClient("reasoned", "step 1"))
+	shadow := NewShadowRunner(config.ShadowConfig{Rate: 1, MaxConcurrent: 1}, newMockPipeline(slowNormal, staticReasonerClient("reasoned", "step 1")))
+	primary.SetShadow(shadow)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := primary.Execute(context.Background(), &models.ChatCompletionRequest{
+			Messages: []models.ChatCompletionMessage{
+				{Role: "user", Content: "test input"},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "primary response", resp.Choices[0].Message.Content)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Only one shadow run fits in the budget, the rest are dropped
+	assert.Len(t, shadow.slots, 1)
+	close(release)
+	shadow.Wait()
+	assert.Len(t, shadow.slots, 0)
+}
+
+func TestShadowRunner_SampleRate(t *testing.T) {
+	var shadowCalls int32
+	shadowNormal := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			atomic.AddInt32(&shadowCalls, 1)
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "shadow response"}},
+				},
+			}, nil
+		},
+	}
+
+	shadow := NewShadowRunner(config.ShadowConfig{Rate: 0.5}, newMockPipeline(shadowNormal, staticReasonerClient("reasoned", "step 1")))
+	shadow.sample = func() float64 { return 0.9 }
+
+	shadow.Mirror(&models.ChatCompletionRequest{
+		Messages: []models.ChatCompletionMessage{
+			{Role: "user", Content: "test input"},
+		},
+	}, nil)
+	shadow.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&shadowCalls))
+}
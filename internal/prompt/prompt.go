@@ -0,0 +1,44 @@
+// Package prompt parses the stage prompt templates with the helper functions
+// available to prompt authors
+package prompt
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// Funcs are the functions available in prompt templates
+var Funcs = template.FuncMap{
+	// join concatenates a list, e.g. {{join .ReasoningChain "\n"}}
+	"join": func(items []string, sep string) string {
+		return strings.Join(items, sep)
+	},
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// toJSON encodes a value, e.g. {{toJSON .ReasoningChain}}
+	"toJSON": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	},
+	// truncate keeps the first n characters of s
+	"truncate": func(s string, n int) string {
+		if n < 0 {
+			n = 0
+		}
+		runes := []rune(s)
+		if len(runes) <= n {
+			return s
+		}
+		return string(runes[:n])
+	},
+}
+
+// Parse compiles a prompt template with Funcs
+func Parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(Funcs).Parse(text)
+}
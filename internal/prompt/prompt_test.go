@@ -0,0 +1,45 @@
+package prompt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Funcs(t *testing.T) {
+	data := map[string]interface{}{
+		"ReasoningChain":     []string{"step 1", "step 2"},
+		"IntermediateResult": "  Hello, 世界  ",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"join", `{{join .ReasoningChain "\n"}}`, "step 1\nstep 2"},
+		{"trim", `[{{trim .IntermediateResult}}]`, "[Hello, 世界]"},
+		{"upper", `{{upper "Hello"}}`, "HELLO"},
+		{"lower", `{{.IntermediateResult | trim | lower}}`, "hello, 世界"},
+		{"toJSON", `{{toJSON .ReasoningChain}}`, `["step 1","step 2"]`},
+		{"truncate", `{{truncate (trim .IntermediateResult) 8}}`, "Hello, 世"},
+		{"truncate shorter than limit", `{{truncate "abc" 10}}`, "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.name, tt.template)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, tmpl.Execute(&buf, data))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestParse_UnknownFunc(t *testing.T) {
+	_, err := Parse("prompt", `{{shout .IntermediateResult}}`)
+	assert.ErrorContains(t, err, `function "shout" not defined`)
+}
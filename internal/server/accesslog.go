@@ -0,0 +1,39 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// Context keys the chat completion handler fills in for the access log
+const (
+	accessLogRequestKey = "access_log_request"
+	accessLogUsageKey   = "access_log_usage"
+)
+
+// accessLog logs one line per request with its method, path, status and
+// duration. Chat completions add the pipeline request ID, the model and the
+// token usage.
+func (s *Server) accessLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	log := s.Logger.WithComponent("access").
+		WithField("method", c.Request.Method).
+		WithField("path", c.Request.URL.Path).
+		WithField("status", c.Writer.Status()).
+		WithField("duration_ms", time.Since(start).Milliseconds())
+	if v, ok := c.Get(accessLogRequestKey); ok {
+		req := v.(*models.ChatCompletionRequest)
+		log = log.WithField("request_id", req.RequestID).WithField("model", req.Model)
+	}
+	if v, ok := c.Get(accessLogUsageKey); ok {
+		usage := v.(*models.Usage)
+		log = log.WithField("prompt_tokens", usage.PromptTokens).
+			WithField("completion_tokens", usage.CompletionTokens).
+			WithField("total_tokens", usage.TotalTokens)
+	}
+	log.Info("%s %s %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	base := logger.GetLogger()
+	logger.WithOutput(&buf)(base)
+	defer logger.WithOutput(os.Stdout)(base)
+
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "answer"}}},
+				Usage:   &models.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			}, nil
+		},
+	}
+	router := newTestServer(normalClient, staticReasonerClient()).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"deepempower","request_id":"req-access","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var line string
+	for _, l := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(l, "[access]") {
+			line = l
+		}
+	}
+	require.NotEmpty(t, line, "no access log line in %q", buf.String())
+	assert.Contains(t, line, "POST /v1/chat/completions 200")
+	assert.Contains(t, line, "method=POST")
+	assert.Contains(t, line, "path=/v1/chat/completions")
+	assert.Contains(t, line, "status=200")
+	assert.Regexp(t, `duration_ms=\d+`, line)
+	assert.Contains(t, line, "request_id=req-access")
+	assert.Contains(t, line, "model=deepempower")
+	// Both Normal model calls are counted
+	assert.Contains(t, line, "prompt_tokens=20")
+	assert.Contains(t, line, "completion_tokens=10")
+	assert.Contains(t, line, "total_tokens=30")
+
+	// Requests outside the pipeline are logged without its fields
+	buf.Reset()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Contains(t, buf.String(), "GET /healthz 200")
+	assert.NotContains(t, buf.String(), "request_id=")
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyContextKey stores the authenticated API key in the gin context
+const apiKeyContextKey = "api_key"
+
+// apiKeys returns every configured API key
+func (s *Server) apiKeys() []string {
+	keys := make([]string, 0, len(s.config.APIKeys)+1)
+	if s.config.APIKey != "" {
+		keys = append(keys, s.config.APIKey)
+	}
+	for _, key := range s.config.APIKeys {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// authenticate rejects requests whose Authorization header does not carry one
+// of the configured API keys. Both "Bearer <key>" and the raw key are accepted.
+// Authentication is disabled when no keys are configured.
+func (s *Server) authenticate(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			c.Next()
+			return
+		}
+
+		provided := strings.TrimSpace(c.GetHeader("Authorization"))
+		if len(provided) > len("Bearer ") && strings.EqualFold(provided[:len("Bearer ")], "Bearer ") {
+			provided = strings.TrimSpace(provided[len("Bearer "):])
+		}
+
+		// Compare against every key so timing does not reveal which one matched
+		match := 0
+		for _, key := range keys {
+			match |= subtle.ConstantTimeCompare([]byte(provided), []byte(key))
+		}
+		if match != 1 {
+			abortWithError(c, http.StatusUnauthorized, "Incorrect API key provided.", "invalid_request_error", "invalid_api_key")
+			return
+		}
+		c.Set(apiKeyContextKey, provided)
+		c.Next()
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthentication(t *testing.T) {
+	testCases := []struct {
+		name          string
+		authorization string
+		expectCode    int
+	}{
+		{name: "bearer key", authorization: "Bearer test-key", expectCode: http.StatusOK},
+		{name: "lowercase bearer", authorization: "bearer test-key", expectCode: http.StatusOK},
+		{name: "raw key", authorization: "test-key", expectCode: http.StatusOK},
+		{name: "second key", authorization: "Bearer second-key", expectCode: http.StatusOK},
+		{name: "invalid key", authorization: "Bearer wrong-key", expectCode: http.StatusUnauthorized},
+		{name: "key prefix", authorization: "Bearer test", expectCode: http.StatusUnauthorized},
+		{name: "bearer only", authorization: "Bearer ", expectCode: http.StatusUnauthorized},
+		{name: "missing header", expectCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(streamingNormalClient("final answer"), staticReasonerClient())
+			s.config.APIKeys = []string{"second-key"}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+				strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			s.Router().ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectCode, w.Code)
+			if tc.expectCode != http.StatusUnauthorized {
+				return
+			}
+
+			var body struct {
+				Error struct {
+					Message string  `json:"message"`
+					Type    string  `json:"type"`
+					Param   *string `json:"param"`
+					Code    string  `json:"code"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "invalid_request_error", body.Error.Type)
+			assert.Equal(t, "invalid_api_key", body.Error.Code)
+			assert.NotEmpty(t, body.Error.Message)
+		})
+	}
+}
+
+func TestAuthenticationDisabledWithoutKeys(t *testing.T) {
+	s := newTestServer(streamingNormalClient("final answer"), staticReasonerClient())
+	s.config.APIKey = ""
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer anything")
+	s.Router().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/config"
+)
+
+// Defaults applied when the CORS config leaves methods or headers empty
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type"}
+)
+
+// corsPolicy answers CORS requests for the configured origins
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      string
+}
+
+func newCORSPolicy(cfg config.CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     strings.Join(defaultCORSMethods, ", "),
+		headers:     strings.Join(defaultCORSHeaders, ", "),
+		credentials: cfg.AllowCredentials,
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+		}
+		p.origins[strings.ToLower(origin)] = true
+	}
+	if len(cfg.AllowedMethods) > 0 {
+		p.methods = strings.ToUpper(strings.Join(cfg.AllowedMethods, ", "))
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		p.headers = strings.Join(cfg.AllowedHeaders, ", ")
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return p
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	return p.anyOrigin || p.origins[strings.ToLower(origin)]
+}
+
+// cors adds CORS headers for allowed origins and answers preflight requests
+// before authentication, since browsers send them without credentials.
+// Preflights from other origins are rejected with 403; simple requests from
+// them proceed without CORS headers so the browser blocks the response.
+func cors(policy *corsPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !policy.allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if policy.anyOrigin && !policy.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Methods", policy.methods)
+		c.Header("Access-Control-Allow-Headers", policy.headers)
+		if policy.maxAge != "" {
+			c.Header("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
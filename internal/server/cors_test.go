@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    *config.CORSConfig
+		method  string
+		origin  string
+		headers map[string]string
+		status  int
+		allowed string
+	}{
+		{
+			name:   "disabled by default",
+			method: http.MethodOptions,
+			origin: "https://app.example.com",
+			headers: map[string]string{
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			// Without CORS the preflight reaches authentication and fails there
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "preflight from allowed origin",
+			cors:   &config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: 10 * time.Minute},
+			method: http.MethodOptions,
+			origin: "https://app.example.com",
+			headers: map[string]string{
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "Authorization, Content-Type",
+			},
+			status:  http.StatusNoContent,
+			allowed: "https://app.example.com",
+		},
+		{
+			name:   "preflight from denied origin",
+			cors:   &config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method: http.MethodOptions,
+			origin: "https://evil.example.com",
+			headers: map[string]string{
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "request from allowed origin",
+			cors:    &config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method:  http.MethodPost,
+			origin:  "https://app.example.com",
+			status:  http.StatusOK,
+			allowed: "https://app.example.com",
+		},
+		{
+			name:   "request from denied origin",
+			cors:   &config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			method: http.MethodPost,
+			origin: "https://evil.example.com",
+			status: http.StatusOK,
+		},
+		{
+			name:    "any origin",
+			cors:    &config.CORSConfig{AllowedOrigins: []string{"*"}},
+			method:  http.MethodPost,
+			origin:  "https://other.example.com",
+			status:  http.StatusOK,
+			allowed: "*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(streamingNormalClient("final answer"), staticReasonerClient())
+			s.config.CORS = tt.cors
+			router := s.Router()
+
+			w := httptest.NewRecorder()
+			var req *http.Request
+			if tt.method == http.MethodPost {
+				req = httptest.NewRequest(tt.method, "/v1/chat/completions",
+					strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+				req.Header.Set("Authorization", "test-key")
+			} else {
+				req = httptest.NewRequest(tt.method, "/v1/chat/completions", nil)
+			}
+			req.Header.Set("Origin", tt.origin)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.allowed, w.Header().Get("Access-Control-Allow-Origin"))
+			if tt.status == http.StatusNoContent {
+				assert.Equal(t, "GET, POST, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+				assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+				assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	s := newTestServer(streamingNormalClient("final answer"), staticReasonerClient())
+	s.config.CORS = &config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"post"},
+		AllowedHeaders:   []string{"Authorization", "X-Request-Id"},
+		AllowCredentials: true,
+	}
+	router := s.Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/v1/chat/completions", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, X-Request-Id", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/orchestrator"
+)
+
+// statusClientClosedRequest is the conventional status for requests the
+// client abandoned before a response was written
+const statusClientClosedRequest = 499
+
+// apiError is an error rendered as an OpenAI error envelope
+type apiError struct {
+	status  int
+	errType string
+	code    string
+}
+
+// classifyError maps an internal error to the status, type and code of the
+// OpenAI error it is reported as
+func classifyError(err error) apiError {
+	switch {
+	case errors.Is(err, orchestrator.ErrUnknownMode):
+		return apiError{http.StatusBadRequest, "invalid_request_error", "invalid_mode"}
+	case errors.Is(err, orchestrator.ErrNoMessages):
+		return apiError{http.StatusBadRequest, "invalid_request_error", "invalid_request"}
+	case errors.Is(err, orchestrator.ErrBudgetExceeded):
+		return apiError{http.StatusPaymentRequired, "insufficient_quota", "token_budget_exceeded"}
+	case errors.Is(err, orchestrator.ErrContextWindowExceeded):
+		return apiError{http.StatusBadRequest, "invalid_request_error", "context_length_exceeded"}
+	case errors.Is(err, orchestrator.ErrContentBlocked):
+		return apiError{http.StatusUnprocessableEntity, "invalid_request_error", "content_blocked"}
+	case errors.Is(err, modelbridge.ErrCircuitOpen):
+		return apiError{http.StatusServiceUnavailable, "server_error", "service_unavailable"}
+	case errors.Is(err, context.Canceled):
+		return apiError{statusClientClosedRequest, "server_error", "request_cancelled"}
+	case errors.Is(err, orchestrator.ErrDeadlineExceeded):
+		return apiError{http.StatusGatewayTimeout, "server_error", "deadline_exceeded"}
+	case errors.Is(err, orchestrator.ErrStageTimeout), errors.Is(err, context.DeadlineExceeded):
+		return apiError{http.StatusGatewayTimeout, "server_error", "timeout"}
+	case clients.HTTPStatus(err) == http.StatusTooManyRequests:
+		return apiError{http.StatusTooManyRequests, "requests", "rate_limit_exceeded"}
+	case errors.Is(err, orchestrator.ErrInvalidJSON):
+		return apiError{http.StatusBadGateway, "server_error", "invalid_json_output"}
+	case errors.Is(err, orchestrator.ErrReasoningMissing):
+		return apiError{http.StatusBadGateway, "server_error", "reasoning_missing"}
+	case errors.Is(err, orchestrator.ErrModelCall):
+		return apiError{http.StatusBadGateway, "server_error", "upstream_error"}
+	}
+	return apiError{http.StatusInternalServerError, "server_error", "internal_error"}
+}
+
+// writeError stops the request with the OpenAI error envelope for err
+func writeError(c *gin.Context, err error) {
+	e := classifyError(err)
+	abortWithError(c, e.status, err.Error(), e.errType, e.code)
+}
+
+// writeBadRequest stops the request with an invalid request error, or with
+// 413 when the body was cut off by the size limit
+func writeBadRequest(c *gin.Context, err error) {
+	if limit, ok := isBodyTooLarge(err); ok {
+		writeTooLarge(c, limit)
+		return
+	}
+	abortWithError(c, http.StatusBadRequest, err.Error(), "invalid_request_error", "invalid_request")
+}
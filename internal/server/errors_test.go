@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/orchestrator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorBody is the OpenAI error envelope
+type errorBody struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    string  `json:"code"`
+	} `json:"error"`
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected apiError
+	}{
+		{
+			name:     "unknown mode",
+			err:      fmt.Errorf("%w %q", orchestrator.ErrUnknownMode, "direct"),
+			expected: apiError{http.StatusBadRequest, "invalid_request_error", "invalid_mode"},
+		},
+		{
+			name:     "token budget exceeded",
+			err:      &orchestrator.StageError{Stage: "reasoner_engine", Err: fmt.Errorf("%w: used 90 of 50 tokens", orchestrator.ErrBudgetExceeded)},
+			expected: apiError{http.StatusPaymentRequired, "insufficient_quota", "token_budget_exceeded"},
+		},
+		{
+			name:     "context window exceeded",
+			err:      &orchestrator.StageError{Stage: "normal_postprocessor", Err: fmt.Errorf("%w: about 9000 tokens", orchestrator.ErrContextWindowExceeded)},
+			expected: apiError{http.StatusBadRequest, "invalid_request_error", "context_length_exceeded"},
+		},
+		{
+			name:     "no messages",
+			err:      &orchestrator.StageError{Stage: "normal_preprocessor", Err: orchestrator.ErrNoMessages},
+			expected: apiError{http.StatusBadRequest, "invalid_request_error", "invalid_request"},
+		},
+		{
+			name:     "upstream failure",
+			err:      &orchestrator.StageError{Stage: "reasoner_engine", Err: fmt.Errorf("%w: boom", orchestrator.ErrModelCall)},
+			expected: apiError{http.StatusBadGateway, "server_error", "upstream_error"},
+		},
+		{
+			name:     "invalid json answer",
+			err:      &orchestrator.StageError{Stage: "normal_postprocessor", Err: orchestrator.ErrInvalidJSON},
+			expected: apiError{http.StatusBadGateway, "server_error", "invalid_json_output"},
+		},
+		{
+			name:     "blocked content",
+			err:      &orchestrator.StageError{Stage: "safety_filter", Err: orchestrator.ErrContentBlocked},
+			expected: apiError{http.StatusUnprocessableEntity, "invalid_request_error", "content_blocked"},
+		},
+		{
+			name:     "missing reasoning",
+			err:      &orchestrator.StageError{Stage: "reasoner_engine", Err: orchestrator.ErrReasoningMissing},
+			expected: apiError{http.StatusBadGateway, "server_error", "reasoning_missing"},
+		},
+		{
+			name:     "upstream rate limit",
+			err:      fmt.Errorf("model call: %w", &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}),
+			expected: apiError{http.StatusTooManyRequests, "requests", "rate_limit_exceeded"},
+		},
+		{
+			name:     "stage timeout",
+			err:      &orchestrator.StageError{Stage: "reasoner_engine", Err: fmt.Errorf("%w", orchestrator.ErrStageTimeout)},
+			expected: apiError{http.StatusGatewayTimeout, "server_error", "timeout"},
+		},
+		{
+			name:     "request deadline",
+			err:      fmt.Errorf("stage failed: %w", context.DeadlineExceeded),
+			expected: apiError{http.StatusGatewayTimeout, "server_error", "timeout"},
+		},
+		{
+			name:     "max total latency",
+			err:      fmt.Errorf("%w: %w", orchestrator.ErrDeadlineExceeded, context.DeadlineExceeded),
+			expected: apiError{http.StatusGatewayTimeout, "server_error", "deadline_exceeded"},
+		},
+		{
+			name:     "circuit open",
+			err:      fmt.Errorf("model call: %w", modelbridge.ErrCircuitOpen),
+			expected: apiError{http.StatusServiceUnavailable, "server_error", "service_unavailable"},
+		},
+		{
+			name:     "client cancelled",
+			err:      context.Canceled,
+			expected: apiError{statusClientClosedRequest, "server_error", "request_cancelled"},
+		},
+		{
+			name:     "unexpected",
+			err:      errors.New("boom"),
+			expected: apiError{http.StatusInternalServerError, "server_error", "internal_error"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, classifyError(tc.err))
+		})
+	}
+}
+
+func TestChatCompletionsErrorEnvelope(t *testing.T) {
+	failingReasoner := &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			return nil, errors.New("reasoner down")
+		},
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedType string
+		expectedErr  string
+		expectedMsg  string
+	}{
+		{
+			name:         "malformed body",
+			body:         `{"messages":`,
+			expectedCode: http.StatusBadRequest,
+			expectedType: "invalid_request_error",
+			expectedErr:  "invalid_request",
+		},
+		{
+			name:         "empty messages",
+			body:         `{"messages":[]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedType: "invalid_request_error",
+			expectedErr:  "invalid_request",
+			expectedMsg:  "invalid request: messages must contain at least one message",
+		},
+		{
+			name:         "invalid role",
+			body:         `{"messages":[{"role":"bot","content":"hi"}],"stream":true}`,
+			expectedCode: http.StatusBadRequest,
+			expectedType: "invalid_request_error",
+			expectedErr:  "invalid_request",
+			expectedMsg:  `invalid request: messages[0].role: unknown role "bot"`,
+		},
+		{
+			name:         "unknown mode",
+			body:         `{"messages":[{"role":"user","content":"hi"}],"mode":"direct"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedType: "invalid_request_error",
+			expectedErr:  "invalid_mode",
+			expectedMsg:  `unknown pipeline mode "direct"`,
+		},
+		{
+			name:         "upstream failure",
+			body:         `{"messages":[{"role":"user","content":"hi"}]}`,
+			expectedCode: http.StatusBadGateway,
+			expectedType: "server_error",
+			expectedErr:  "upstream_error",
+			expectedMsg:  "stage reasoner_engine failed: model call: reasoner down",
+		},
+		{
+			name:         "upstream failure while streaming",
+			body:         `{"messages":[{"role":"user","content":"hi"}],"stream":true}`,
+			expectedCode: http.StatusBadGateway,
+			expectedType: "server_error",
+			expectedErr:  "upstream_error",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newTestServer(streamingNormalClient("preprocessed"), failingReasoner).Router()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "test-key")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			var body errorBody
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tc.expectedType, body.Error.Type)
+			assert.Equal(t, tc.expectedErr, body.Error.Code)
+			assert.Nil(t, body.Error.Param)
+			assert.NotEmpty(t, body.Error.Message)
+			if tc.expectedMsg != "" {
+				assert.Equal(t, tc.expectedMsg, body.Error.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/clients"
+	"github.com/sleepstars/deepempower/internal/config"
+)
+
+// readinessTimeout bounds each upstream connectivity check
+const readinessTimeout = 3 * time.Second
+
+// handleHealthz reports that the process is alive
+func (s *Server) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz checks that every configured model can be reached on at least
+// one of its API bases. It returns 503 listing the upstreams that failed.
+func (s *Server) handleReadyz(c *gin.Context) {
+	upstreams := s.upstreams()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make(map[string]string)
+	for name, apiBases := range upstreams {
+		wg.Add(1)
+		go func(name string, apiBases []string) {
+			defer wg.Done()
+			if err := s.checkUpstreams(c.Request.Context(), apiBases); err != nil {
+				s.Logger.WithError(err).Warn("Readiness check failed for %s", name)
+				mu.Lock()
+				failed[name] = err.Error()
+				mu.Unlock()
+			}
+		}(name, apiBases)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "failed": failed})
+		return
+	}
+
+	names := make([]string, 0, len(upstreams))
+	for name := range upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "upstreams": names})
+}
+
+// upstreams returns the API bases of every configured model keyed by model name
+func (s *Server) upstreams() map[string][]string {
+	cfg, _ := s.current()
+	upstreams := map[string][]string{
+		config.ModelNormal:   cfg.Models.Normal.APIBases(),
+		config.ModelReasoner: cfg.Models.Reasoner.APIBases(),
+	}
+	for name, model := range cfg.Models.Named {
+		upstreams[name] = model.APIBases()
+	}
+	return upstreams
+}
+
+// checkUpstreams succeeds once one of apiBases is reachable, since calls
+// fail over between the endpoints of a model
+func (s *Server) checkUpstreams(ctx context.Context, apiBases []string) error {
+	var err error
+	for _, apiBase := range apiBases {
+		if err = s.checkUpstream(ctx, apiBase); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkUpstream sends a HEAD request to the API base. Any response below 500
+// counts as reachable since most APIs reject unauthenticated requests.
+func (s *Server) checkUpstream(ctx context.Context, apiBase string) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	// Clients call a base without a scheme over plain HTTP
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, clients.BaseURL(apiBase), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthz(t *testing.T) {
+	s := newTestServer(nil, nil)
+
+	// No Authorization header: probes bypass the API key check
+	w := httptest.NewRecorder()
+	s.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Unauthenticated requests are rejected but the upstream is reachable
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer up.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	testCases := []struct {
+		name         string
+		normalBase   string
+		reasonerBase string
+		// normalEndpoints replaces normalBase when set
+		normalEndpoints []config.EndpointConfig
+		expectCode      int
+		expectFailed    []string
+	}{
+		{name: "all reachable", normalBase: up.URL, reasonerBase: up.URL, expectCode: http.StatusOK},
+		{name: "base without scheme", normalBase: strings.TrimPrefix(up.URL, "http://"), reasonerBase: up.URL, expectCode: http.StatusOK},
+		{name: "reasoner down", normalBase: up.URL, reasonerBase: down.URL, expectCode: http.StatusServiceUnavailable, expectFailed: []string{"Reasoner"}},
+		{name: "normal server error", normalBase: broken.URL, reasonerBase: up.URL, expectCode: http.StatusServiceUnavailable, expectFailed: []string{"Normal"}},
+		{name: "both down", normalBase: down.URL, reasonerBase: broken.URL, expectCode: http.StatusServiceUnavailable, expectFailed: []string{"Normal", "Reasoner"}},
+		{
+			name:            "one normal endpoint reachable",
+			normalEndpoints: []config.EndpointConfig{{APIBase: down.URL}, {APIBase: up.URL}},
+			reasonerBase:    up.URL,
+			expectCode:      http.StatusOK,
+		},
+		{
+			name:            "every normal endpoint down",
+			normalEndpoints: []config.EndpointConfig{{APIBase: down.URL}, {APIBase: broken.URL}},
+			reasonerBase:    up.URL,
+			expectCode:      http.StatusServiceUnavailable,
+			expectFailed:    []string{"Normal"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := New(&config.PipelineConfig{
+				Models: config.ModelsConfig{
+					Normal:   config.ModelConfig{APIBase: tc.normalBase, Endpoints: tc.normalEndpoints},
+					Reasoner: config.ModelConfig{APIBase: tc.reasonerBase},
+				},
+				APIKey: "test-key",
+			}, nil)
+
+			w := httptest.NewRecorder()
+			s.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tc.expectCode, w.Code)
+
+			var body struct {
+				Status string            `json:"status"`
+				Failed map[string]string `json:"failed"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			if tc.expectFailed == nil {
+				assert.Equal(t, "ready", body.Status)
+				assert.Empty(t, body.Failed)
+				return
+			}
+			assert.Equal(t, "unavailable", body.Status)
+			assert.Len(t, body.Failed, len(tc.expectFailed))
+			for _, name := range tc.expectFailed {
+				assert.Contains(t, body.Failed, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxRequestBytes is the request body limit used when none is configured
+const DefaultMaxRequestBytes = 10 << 20
+
+// maxRequestBytes returns the configured request body limit
+func (s *Server) maxRequestBytes() int64 {
+	if s.config.MaxRequestBytes > 0 {
+		return s.config.MaxRequestBytes
+	}
+	return DefaultMaxRequestBytes
+}
+
+// limitRequestBody rejects bodies larger than maxBytes with 413. Bodies that
+// declare their length are rejected up front; others fail while being read.
+func limitRequestBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			writeTooLarge(c, maxBytes)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// writeTooLarge stops the request with a 413 error
+func writeTooLarge(c *gin.Context, maxBytes int64) {
+	abortWithError(c, http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("request body exceeds the limit of %d bytes", maxBytes),
+		"invalid_request_error", "request_too_large")
+}
+
+// isBodyTooLarge reports whether err came from reading past the body limit
+func isBodyTooLarge(err error) (int64, bool) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return tooLarge.Limit, true
+	}
+	return 0, false
+}
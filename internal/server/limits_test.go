@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletionsBodyLimit(t *testing.T) {
+	oversized := `{"messages":[{"role":"user","content":"` + strings.Repeat("a", 2048) + `"}]}`
+
+	tests := []struct {
+		name     string
+		body     io.Reader
+		length   int64
+		expected int
+		code     string
+	}{
+		{
+			name:     "within limit",
+			body:     strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`),
+			expected: http.StatusOK,
+		},
+		{
+			name:     "declared length over limit",
+			body:     strings.NewReader(oversized),
+			expected: http.StatusRequestEntityTooLarge,
+			code:     "request_too_large",
+		},
+		{
+			// Chunked bodies have no declared length and fail while being read
+			name:     "undeclared length over limit",
+			body:     io.MultiReader(strings.NewReader(oversized)),
+			length:   -1,
+			expected: http.StatusRequestEntityTooLarge,
+			code:     "request_too_large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(streamingNormalClient("final answer"), staticReasonerClient())
+			s.config.MaxRequestBytes = 1024
+			router := s.Router()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", tt.body)
+			if tt.length != 0 {
+				req.ContentLength = tt.length
+			}
+			req.Header.Set("Authorization", "test-key")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.code == "" {
+				return
+			}
+			var body errorBody
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "invalid_request_error", body.Error.Type)
+			assert.Equal(t, tt.code, body.Error.Code)
+			assert.Equal(t, "request body exceeds the limit of 1024 bytes", body.Error.Message)
+		})
+	}
+}
+
+func TestChatCompletionsMaxMessages(t *testing.T) {
+	s := newTestServer(streamingNormalClient("final answer"), staticReasonerClient())
+	s.config.MaxMessages = 2
+	router := s.Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(
+		`{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var body errorBody
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "invalid_request", body.Error.Code)
+	assert.Contains(t, body.Error.Message, "more than 2 messages")
+}
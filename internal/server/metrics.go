@@ -0,0 +1,16 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleMetrics serves the pipeline metrics in the Prometheus text format
+func (s *Server) handleMetrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := s.metrics.WriteTo(c.Writer); err != nil {
+		s.Logger.WithError(err).Warn("Failed to write metrics")
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// modelOwner is reported as owned_by for every listed model
+const modelOwner = "deepempower"
+
+// handleListModels lists the configured model identifiers in the OpenAI list format
+func (s *Server) handleListModels(c *gin.Context) {
+	c.JSON(http.StatusOK, models.ModelList{
+		Object: "list",
+		Data:   s.modelInfos(),
+	})
+}
+
+// modelInfos returns Normal, Reasoner and then the named models sorted by
+// name, skipping empty and duplicate identifiers
+func (s *Server) modelInfos() []models.ModelInfo {
+	cfg, _ := s.current()
+	ids := []string{cfg.Models.Normal.Model, cfg.Models.Reasoner.Model}
+	names := make([]string, 0, len(cfg.Models.Named))
+	for name := range cfg.Models.Named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ids = append(ids, cfg.Models.Named[name].Model)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	infos := make([]models.ModelInfo, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		infos = append(infos, models.ModelInfo{
+			ID:      id,
+			Object:  "model",
+			OwnedBy: modelOwner,
+		})
+	}
+	return infos
+}
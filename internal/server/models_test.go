@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListModels(t *testing.T) {
+	s := newTestServer(nil, nil)
+	s.config.Models.Named = map[string]config.ModelConfig{
+		"Cheap":     {Model: "cheap-model"},
+		"Duplicate": {Model: "gpt-4"},
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer test-key")
+	s.Router().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "list", body["object"])
+
+	data, ok := body["data"].([]interface{})
+	require.True(t, ok)
+	var ids []string
+	for _, item := range data {
+		model := item.(map[string]interface{})
+		assert.Equal(t, "model", model["object"])
+		assert.Equal(t, "deepempower", model["owned_by"])
+		assert.Contains(t, model, "created")
+		ids = append(ids, model["id"].(string))
+	}
+	assert.Equal(t, []string{"gpt-3.5-turbo", "gpt-4", "cheap-model"}, ids)
+}
+
+func TestListModelsRequiresAPIKey(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestServer(nil, nil).Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
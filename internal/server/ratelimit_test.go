@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(config.RateLimitConfig{RequestsPerSecond: 2, Burst: 3})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.allow("a")
+		assert.True(t, ok, "request %d should fit in the burst", i+1)
+	}
+	ok, wait := limiter.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys have their own bucket
+	ok, _ = limiter.allow("b")
+	assert.True(t, ok)
+
+	// Tokens refill at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.allow("a")
+	assert.False(t, ok)
+}
+
+func TestRateLimiter_DefaultBurst(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimitConfig{RequestsPerSecond: 2.5})
+	assert.Equal(t, float64(3), limiter.burst)
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(config.RateLimitConfig{RequestsPerSecond: 1})
+	limiter.now = func() time.Time { return now }
+
+	limiter.allow("a")
+	now = now.Add(rateLimitIdleTTL)
+	limiter.allow("b")
+	assert.NotContains(t, limiter.buckets, "a")
+	assert.Contains(t, limiter.buckets, "b")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	const burst = 3
+	s := newTestServer(nil, nil)
+	s.config.APIKeys = []string{"other-key"}
+	s.config.RateLimit = &config.RateLimitConfig{RequestsPerSecond: 0.5, Burst: burst}
+	router := s.Router()
+
+	send := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < burst; i++ {
+		assert.Equal(t, http.StatusOK, send("test-key").Code, "request %d", i+1)
+	}
+
+	w := send("test-key")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "rate_limit_exceeded", body.Error.Code)
+
+	// A different API key is limited separately
+	assert.Equal(t, http.StatusOK, send("other-key").Code)
+}
+
+func TestRateLimitMiddleware_ByRemoteIP(t *testing.T) {
+	s := newTestServer(nil, nil)
+	s.config.APIKey = ""
+	s.config.RateLimit = &config.RateLimitConfig{RequestsPerSecond: 1, Burst: 1}
+	router := s.Router()
+
+	send := func(remoteAddr string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1:5678"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1234"))
+}
+
+func TestRateLimitSkipsProbes(t *testing.T) {
+	s := newTestServer(nil, nil)
+	s.config.RateLimit = &config.RateLimitConfig{RequestsPerSecond: 1, Burst: 1}
+	router := s.Router()
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
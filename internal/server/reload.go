@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/orchestrator"
+)
+
+// Reloader reads the configuration again and builds the pipeline serving it
+type Reloader func() (*config.PipelineConfig, *orchestrator.HybridPipeline, error)
+
+// SetReloader enables POST /admin/reload, which replaces the configuration
+// and pipeline with the ones built by reload. It must be called before Router.
+func (s *Server) SetReloader(reload Reloader) {
+	s.reload = reload
+}
+
+// reloadSummary describes the configuration in effect after a reload
+type reloadSummary struct {
+	Status string                  `json:"status"`
+	Mode   string                  `json:"mode"`
+	Models map[string]modelSummary `json:"models"`
+}
+
+type modelSummary struct {
+	Model    string   `json:"model"`
+	APIBases []string `json:"api_bases"`
+}
+
+// handleReload builds a pipeline from the reloaded configuration and swaps
+// it in. Requests already running finish on the old pipeline. A config that
+// fails to load or build leaves the current one in place.
+func (s *Server) handleReload(c *gin.Context) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, pipeline, err := s.reload()
+	if err != nil {
+		s.Logger.WithError(err).Error("Config reload failed")
+		abortWithError(c, http.StatusInternalServerError, err.Error(), "server_error", "reload_failed")
+		return
+	}
+	pipeline.SetMetrics(s.metrics)
+
+	s.mu.Lock()
+	s.config = cfg
+	s.pipeline = pipeline
+	s.mu.Unlock()
+	s.Logger.Info("Config reloaded")
+
+	c.JSON(http.StatusOK, summarizeConfig(cfg))
+}
+
+// summarizeConfig lists the mode and the models of cfg
+func summarizeConfig(cfg *config.PipelineConfig) reloadSummary {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = config.ModeHybrid
+	}
+	summary := reloadSummary{Status: "reloaded", Mode: mode, Models: map[string]modelSummary{
+		config.ModelNormal:   {Model: cfg.Models.Normal.Model, APIBases: cfg.Models.Normal.APIBases()},
+		config.ModelReasoner: {Model: cfg.Models.Reasoner.Model, APIBases: cfg.Models.Reasoner.APIBases()},
+	}}
+	for name, model := range cfg.Models.Named {
+		summary.Models[name] = modelSummary{Model: model.Model, APIBases: model.APIBases()}
+	}
+	return summary
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/orchestrator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reloadConfig is a config file whose pre_process prompt is filled in
+const reloadConfig = `api_key: test-key
+models:
+  Normal:
+    api_base: http://normal
+    model: normal-model
+  Reasoner:
+    api_base: http://reasoner
+    model: reasoner-model
+prompts:
+  pre_process: %q
+  reasoning: "Think: {{.StructuredInput}}"
+  post_process: "Answer: {{.ReasoningChain}}"
+`
+
+func TestAdminReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	writeConfig(fmt.Sprintf(reloadConfig, "Old: {{.UserInput}}"))
+
+	// The Normal model records the system prompts it is sent
+	var prompts []string
+	normalClient := streamingNormalClient("answer")
+	normalClient.CompleteFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+		prompts = append(prompts, req.Messages[0].Content)
+		return &models.ChatCompletionResponse{
+			Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "answer"}}},
+		}, nil
+	}
+	load := func() (*config.PipelineConfig, *orchestrator.HybridPipeline, error) {
+		cfg, err := config.LoadConfig(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		pipeline, err := orchestrator.NewHybridPipeline(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		pipeline.SetBridge(modelbridge.NewModelBridgeWithClients(normalClient, staticReasonerClient("step"), nil))
+		return cfg, pipeline, nil
+	}
+
+	cfg, pipeline, err := load()
+	require.NoError(t, err)
+	s := New(cfg, pipeline)
+	s.SetReloader(load)
+	router := s.Router()
+
+	// complete sends a request and returns the system prompts it used
+	complete := func() []string {
+		prompts = nil
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+			strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Authorization", "test-key")
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return prompts
+	}
+	reload := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		req.Header.Set("Authorization", "test-key")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Contains(t, complete(), "Old: hi")
+
+	// The next request after a reload uses the new prompt
+	writeConfig(fmt.Sprintf(reloadConfig, "New: {{.UserInput}}"))
+	w := reload()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var summary reloadSummary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, reloadSummary{
+		Status: "reloaded",
+		Mode:   config.ModeHybrid,
+		Models: map[string]modelSummary{
+			config.ModelNormal:   {Model: "normal-model", APIBases: []string{"http://normal"}},
+			config.ModelReasoner: {Model: "reasoner-model", APIBases: []string{"http://reasoner"}},
+		},
+	}, summary)
+
+	assert.Contains(t, complete(), "New: hi")
+
+	// An invalid config is rejected and the current one stays in effect
+	writeConfig("models: {}")
+	w = reload()
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "reload_failed")
+
+	assert.Contains(t, complete(), "New: hi")
+
+	// Metrics count the requests of every pipeline the server has run
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `deepempower_requests_total{outcome="success"} 3`)
+}
+
+func TestAdminReloadRequiresAuthentication(t *testing.T) {
+	reloaded := false
+	s := New(&config.PipelineConfig{}, nil)
+	s.SetReloader(func() (*config.PipelineConfig, *orchestrator.HybridPipeline, error) {
+		reloaded = true
+		return nil, nil, errors.New("unexpected reload")
+	})
+	router := s.Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, reloaded)
+}
+
+func TestAdminReloadNotConfigured(t *testing.T) {
+	router := newTestServer(&mocks.MockModelClient{}, &mocks.MockModelClient{}).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/metrics"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/orchestrator"
+	"github.com/sleepstars/deepempower/internal/tracing"
+)
+
+// Server exposes the hybrid pipeline through an OpenAI compatible HTTP API
+type Server struct {
+	// mu guards config and pipeline, which a reload replaces together
+	mu         sync.RWMutex
+	config     *config.PipelineConfig
+	pipeline   *orchestrator.HybridPipeline
+	reload     Reloader
+	reloadMu   sync.Mutex // Serializes reloads
+	metrics    *metrics.Registry
+	httpClient *http.Client
+	Logger     *logger.Logger
+}
+
+// New creates a new server for the given configuration and pipeline. The
+// pipeline records its metrics in the server's registry, which every
+// pipeline swapped in by a reload keeps using.
+func New(cfg *config.PipelineConfig, pipeline *orchestrator.HybridPipeline) *Server {
+	s := &Server{
+		config:     cfg,
+		pipeline:   pipeline,
+		metrics:    metrics.NewRegistry(),
+		httpClient: http.DefaultClient,
+		Logger:     logger.GetLogger().WithComponent("server"),
+	}
+	if pipeline != nil {
+		pipeline.SetMetrics(s.metrics)
+	}
+	return s
+}
+
+// current returns the configuration and pipeline that new requests run on.
+// Requests keep the pipeline they started with across a reload.
+func (s *Server) current() (*config.PipelineConfig, *orchestrator.HybridPipeline) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config, s.pipeline
+}
+
+// Router builds the gin engine with all routes and middleware registered
+func (s *Server) Router() *gin.Engine {
+	r := gin.New()
+	r.Use(s.accessLog, gin.Recovery())
+	r.Use(extractTraceContext)
+	r.Use(limitRequestBody(s.maxRequestBytes()))
+	if s.config.CORS != nil {
+		r.Use(cors(newCORSPolicy(*s.config.CORS)))
+	}
+
+	// Probes are registered before the API key middleware so they stay public
+	r.GET("/healthz", s.handleHealthz)
+	r.GET("/readyz", s.handleReadyz)
+
+	// Middleware to check API key
+	keys := s.apiKeys()
+	if len(keys) == 0 {
+		s.Logger.Warn("No API keys configured, authentication is disabled")
+	}
+	r.Use(s.authenticate(keys))
+	if rl := s.config.RateLimit; rl != nil && rl.RequestsPerSecond > 0 {
+		r.Use(s.rateLimit(newRateLimiter(*rl)))
+	}
+
+	// Chat completions endpoint
+	r.POST("/v1/chat/completions", s.handleChatCompletions)
+	r.GET("/v1/models", s.handleListModels)
+	r.GET("/metrics", s.handleMetrics)
+	if s.reload != nil {
+		if len(keys) == 0 {
+			s.Logger.Warn("POST /admin/reload is disabled: it is only served when API keys are configured")
+		} else {
+			r.POST("/admin/reload", s.handleReload)
+		}
+	}
+
+	return r
+}
+
+// extractTraceContext continues the caller's trace from its traceparent header
+func extractTraceContext(c *gin.Context) {
+	c.Request = c.Request.WithContext(tracing.Extract(c.Request.Context(), c.Request.Header))
+	c.Next()
+}
+
+// handleChatCompletions serves both buffered and streamed chat completions
+func (s *Server) handleChatCompletions(c *gin.Context) {
+	cfg, pipeline := s.current()
+	var req models.ChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	if err := models.ValidateRequest(&req); err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	if limit := cfg.MaxMessages; limit > 0 && len(req.Messages) > limit {
+		writeBadRequest(c, fmt.Errorf("%w: messages must not contain more than %d messages", models.ErrInvalidRequest, limit))
+		return
+	}
+	c.Set(accessLogRequestKey, &req)
+
+	if req.DryRun {
+		resp, err := pipeline.DryRun(c.Request.Context(), &req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	if req.Stream {
+		s.streamChatCompletion(c, pipeline, &req)
+		return
+	}
+
+	resp, err := pipeline.Execute(c.Request.Context(), &req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if resp.Usage != nil {
+		c.Set(accessLogUsageKey, resp.Usage)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// streamChatCompletion writes the pipeline output as OpenAI compatible server-sent events
+func (s *Server) streamChatCompletion(c *gin.Context, pipeline *orchestrator.HybridPipeline, req *models.ChatCompletionRequest) {
+	respChan, err := pipeline.ExecuteStream(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	// A client that disconnects cancels the request context, which stops
+	// the pipeline; there is nobody left to write to
+	ctx := c.Request.Context()
+	for {
+		var resp *models.ChatCompletionResponse
+		var ok bool
+		select {
+		case resp, ok = <-respChan:
+		case <-ctx.Done():
+			s.Logger.Info("Client disconnected, stopping stream for request id: %s", req.RequestID)
+			return
+		}
+		if !ok {
+			break
+		}
+		if resp.Usage != nil {
+			c.Set(accessLogUsageKey, resp.Usage)
+		}
+		data, err := json.Marshal(toStreamChunk(req, resp))
+		if err != nil {
+			s.Logger.WithError(err).Error("Failed to encode stream chunk")
+			continue
+		}
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// abortWithError stops the request with an OpenAI style error body
+func abortWithError(c *gin.Context, status int, message, errType, code string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    code,
+		},
+	})
+}
+
+// toStreamChunk converts a pipeline response into an OpenAI chat.completion.chunk
+func toStreamChunk(req *models.ChatCompletionRequest, resp *models.ChatCompletionResponse) *models.ChatCompletionStreamResponse {
+	chunk := &models.ChatCompletionStreamResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion.chunk",
+		Created: resp.Created,
+		Model:   resp.Model,
+		Choices: make([]models.ChatCompletionStreamChoice, len(resp.Choices)),
+	}
+	if chunk.Model == "" {
+		chunk.Model = req.Model
+	}
+
+	for i, choice := range resp.Choices {
+		delta := choice.Message
+		if delta.Role == "" {
+			delta.Role = "assistant"
+		}
+		chunk.Choices[i] = models.ChatCompletionStreamChoice{
+			Index:    choice.Index,
+			Delta:    delta,
+			LogProbs: choice.LogProbs,
+		}
+		if choice.FinishReason != "" {
+			finishReason := choice.FinishReason
+			chunk.Choices[i].FinishReason = &finishReason
+		}
+	}
+
+	return chunk
+}
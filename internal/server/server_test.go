@@ -0,0 +1,356 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sleepstars/deepempower/internal/config"
+	"github.com/sleepstars/deepempower/internal/logger"
+	"github.com/sleepstars/deepempower/internal/mocks"
+	"github.com/sleepstars/deepempower/internal/modelbridge"
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/sleepstars/deepempower/internal/orchestrator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	logger.InitLogger(logger.INFO, "test")
+}
+
+// newTestServer builds a server whose pipeline talks to the given mock clients
+func newTestServer(normalClient, reasonerClient *mocks.MockModelClient) *Server {
+	cfg := &config.PipelineConfig{
+		Models: config.ModelsConfig{
+			Normal: config.ModelConfig{
+				APIBase: "mock://normal",
+				Model:   "gpt-3.5-turbo",
+			},
+			Reasoner: config.ModelConfig{
+				APIBase: "mock://reasoner",
+				Model:   "gpt-4",
+			},
+		},
+		Prompts: config.PromptsConfig{
+			PreProcess:  "test prompt",
+			Reasoning:   "test prompt",
+			PostProcess: "test prompt",
+		},
+		APIKey: "test-key",
+	}
+
+	pipeline, err := orchestrator.NewHybridPipeline(cfg)
+	if err != nil {
+		panic(err)
+	}
+	pipeline.SetBridge(&modelbridge.ModelBridge{
+		NormalClient:   normalClient,
+		ReasonerClient: reasonerClient,
+		Logger:         logger.GetLogger().WithComponent("test_bridge"),
+	})
+	return New(cfg, pipeline)
+}
+
+// streamingNormalClient answers Complete with content and streams the given chunks
+func streamingNormalClient(content string, chunks ...string) *mocks.MockModelClient {
+	return &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			return &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: content}},
+				},
+			}, nil
+		},
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse)
+			go func() {
+				defer close(ch)
+				for i, chunk := range chunks {
+					resp := &models.ChatCompletionResponse{
+						Choices: []models.ChatCompletionChoice{
+							{Message: models.ChatCompletionMessage{Content: chunk}},
+						},
+					}
+					if i == len(chunks)-1 {
+						resp.Choices[0].FinishReason = "stop"
+					}
+					ch <- resp
+				}
+			}()
+			return ch, nil
+		},
+	}
+}
+
+// staticReasonerClient returns a Reasoner mock that streams one chunk with the given reasoning steps
+func staticReasonerClient(steps ...string) *mocks.MockModelClient {
+	return &mocks.MockModelClient{
+		CompleteStreamFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+			ch := make(chan *models.ChatCompletionResponse, 1)
+			ch <- &models.ChatCompletionResponse{
+				Choices: []models.ChatCompletionChoice{
+					{Message: models.ChatCompletionMessage{Content: "reasoned", ReasoningContent: steps}},
+				},
+			}
+			close(ch)
+			return ch, nil
+		},
+	}
+}
+
+// readEvents parses the data payloads of a server-sent event stream
+func readEvents(t *testing.T, body string) []string {
+	var events []string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestChatCompletions(t *testing.T) {
+	router := newTestServer(streamingNormalClient("final answer"), staticReasonerClient()).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp models.ChatCompletionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "final answer", resp.Choices[0].Message.Content)
+	assert.Regexp(t, `^chatcmpl-`, resp.ID)
+	assert.Equal(t, "chat.completion", resp.Object)
+	assert.NotZero(t, resp.Created)
+	assert.Equal(t, "gpt-3.5-turbo", resp.Model)
+}
+
+func TestChatCompletionsTraceContext(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	router := newTestServer(streamingNormalClient("final answer"), staticReasonerClient()).Router()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "test-key")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	spans := rec.Started()
+	require.NotEmpty(t, spans)
+	assert.Equal(t, "pipeline.execute", spans[0].Name())
+	assert.True(t, spans[0].Parent().IsRemote())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	for _, span := range spans {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String(), span.Name())
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	router := newTestServer(streamingNormalClient("preprocessed", "Hello", ", world"), staticReasonerClient()).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}],"stream":true}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	events := readEvents(t, w.Body.String())
+	require.Len(t, events, 3)
+	assert.Equal(t, "[DONE]", events[len(events)-1])
+
+	var content strings.Builder
+	var finishReason *string
+	var id string
+	for _, event := range events[:len(events)-1] {
+		var chunk models.ChatCompletionStreamResponse
+		require.NoError(t, json.Unmarshal([]byte(event), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Regexp(t, `^chatcmpl-`, chunk.ID)
+		if id != "" {
+			assert.Equal(t, id, chunk.ID)
+		}
+		id = chunk.ID
+		assert.NotZero(t, chunk.Created)
+		assert.Equal(t, "gpt-3.5-turbo", chunk.Model)
+		assert.Equal(t, "assistant", chunk.Choices[0].Delta.Role)
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		finishReason = chunk.Choices[0].FinishReason
+	}
+	assert.Equal(t, "Hello, world", content.String())
+	require.NotNil(t, finishReason)
+	assert.Equal(t, "stop", *finishReason)
+}
+
+func TestChatCompletionsStreamChoices(t *testing.T) {
+	normalClient := &mocks.MockModelClient{
+		CompleteFunc: func(ctx context.Context, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+			resp := &models.ChatCompletionResponse{}
+			for i := 0; i < max(req.N, 1); i++ {
+				resp.Choices = append(resp.Choices, models.ChatCompletionChoice{
+					Index:   i,
+					Message: models.ChatCompletionMessage{Content: fmt.Sprintf("answer %d", i)},
+				})
+			}
+			return resp, nil
+		},
+	}
+	router := newTestServer(normalClient, staticReasonerClient()).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}],"stream":true,"n":2}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Each answer keeps its own choice index
+	contents := map[int]string{}
+	for _, event := range readEvents(t, w.Body.String()) {
+		if event == "[DONE]" {
+			continue
+		}
+		var chunk models.ChatCompletionStreamResponse
+		require.NoError(t, json.Unmarshal([]byte(event), &chunk))
+		for _, choice := range chunk.Choices {
+			contents[choice.Index] += choice.Delta.Content
+		}
+	}
+	assert.Equal(t, map[int]string{0: "answer 0", 1: "answer 1"}, contents)
+}
+
+func TestChatCompletionsStreamClientDisconnect(t *testing.T) {
+	stopped := make(chan struct{})
+	normalClient := streamingNormalClient("preprocessed")
+	// An answer that never ends unless the request is cancelled
+	normalClient.CompleteStreamFunc = func(ctx context.Context, req *models.ChatCompletionRequest) (<-chan *models.ChatCompletionResponse, error) {
+		ch := make(chan *models.ChatCompletionResponse)
+		go func() {
+			defer close(ch)
+			defer close(stopped)
+			for {
+				select {
+				case ch <- &models.ChatCompletionResponse{
+					Choices: []models.ChatCompletionChoice{{Message: models.ChatCompletionMessage{Content: "more"}}},
+				}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return ch, nil
+	}
+	srv := httptest.NewServer(newTestServer(normalClient, staticReasonerClient()).Router())
+	defer srv.Close()
+	client := srv.Client()
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}],"stream":true}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "test-key")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "data: "), line)
+
+	// Disconnect mid-stream
+	cancel()
+	resp.Body.Close()
+	client.CloseIdleConnections()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream stream was not cancelled")
+	}
+	// Every goroutine of the stream exits once the client is gone
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines leaked:\n%s", n-baseline, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestChatCompletionsStreamReasoning(t *testing.T) {
+	router := newTestServer(streamingNormalClient("preprocessed", "The answer"), staticReasonerClient("step 1", "step 2")).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}],"stream":true,"include_reasoning":true}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	events := readEvents(t, w.Body.String())
+	require.Len(t, events, 3)
+	assert.Equal(t, "[DONE]", events[2])
+
+	// Reasoning is tagged with reasoning_content and precedes the answer
+	var reasoning, answer models.ChatCompletionStreamResponse
+	require.NoError(t, json.Unmarshal([]byte(events[0]), &reasoning))
+	require.NoError(t, json.Unmarshal([]byte(events[1]), &answer))
+	assert.Equal(t, []string{"step 1", "step 2"}, reasoning.Choices[0].Delta.ReasoningContent)
+	assert.Empty(t, reasoning.Choices[0].Delta.Content)
+	assert.Nil(t, reasoning.Choices[0].FinishReason)
+	assert.Empty(t, answer.Choices[0].Delta.ReasoningContent)
+	assert.Equal(t, "The answer", answer.Choices[0].Delta.Content)
+}
+
+func TestChatCompletionsDryRun(t *testing.T) {
+	router := newTestServer(&mocks.MockModelClient{}, &mocks.MockModelClient{}).Router()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"messages":[{"role":"user","content":"hi"}],"dry_run":true}`))
+	req.Header.Set("Authorization", "test-key")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp models.DryRunResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "pipeline.dry_run", resp.Object)
+	require.Len(t, resp.Stages, 3)
+	assert.Equal(t, "normal_preprocessor", resp.Stages[0].Stage)
+	assert.Equal(t, "test prompt", resp.Stages[0].Messages[0].Content)
+	assert.Equal(t, "hi", resp.Stages[0].Messages[1].Content)
+}
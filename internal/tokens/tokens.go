@@ -0,0 +1,99 @@
+// Package tokens gives rough estimates of the token counts of model input
+// and output. It does not tokenize with any model's vocabulary, so counts
+// can differ from the ones a provider reports; see Margin.
+package tokens
+
+import (
+	"encoding/json"
+	"unicode"
+
+	"github.com/sleepstars/deepempower/internal/models"
+)
+
+// Overheads of the chat format, as counted by OpenAI models
+const (
+	// perMessage covers the role and separators of every message
+	perMessage = 3
+	// perReply primes the assistant reply
+	perReply = 3
+	// perImage is the cost of a low detail image
+	perImage = 85
+)
+
+// Margin is the relative error expected of the estimates on ordinary text
+// against BPE vocabularies such as cl100k and o200k. Checks that fail a
+// request on an estimate should allow this much past their limit.
+const Margin = 0.2
+
+// Estimate roughly estimates the tokens of text, following how BPE
+// vocabularies such as cl100k split it: a word with its leading space is a
+// token per up to six letters, numbers are split into groups of three digits
+// and every other symbol, including each CJK character, is a token of its
+// own. Code, unusual scripts and rare words can be off by more than Margin.
+func Estimate(text string) int {
+	count := 0
+	letters, digits := 0, 0
+	flush := func() {
+		count += (letters+5)/6 + (digits+2)/3
+		letters, digits = 0, 0
+	}
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			count++
+		}
+	}
+	flush()
+	return count
+}
+
+// EstimateMessages roughly estimates the prompt tokens of a conversation,
+// including the chat format overhead of each message and of the reply
+func EstimateMessages(messages []models.ChatCompletionMessage) int {
+	count := perReply
+	for _, m := range messages {
+		count += perMessage + Estimate(m.Role) + Estimate(m.Content)
+		for _, part := range m.MultiContent {
+			if part.Type == models.ContentPartImageURL {
+				count += perImage
+				continue
+			}
+			count += Estimate(part.Text)
+		}
+		for _, call := range m.ToolCalls {
+			count += Estimate(call.Function.Name) + Estimate(call.Function.Arguments)
+		}
+	}
+	return count
+}
+
+// EstimateRequest roughly estimates the prompt tokens a model is sent for
+// req: its messages, the definitions of its tools and its JSON schema, if any
+func EstimateRequest(req *models.ChatCompletionRequest) int {
+	count := EstimateMessages(req.Messages)
+	for _, tool := range req.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		count += Estimate(tool.Function.Name) + Estimate(tool.Function.Description) + Estimate(string(tool.Function.Parameters))
+	}
+	if f := req.ResponseFormat; f != nil && f.JSONSchema != nil {
+		if schema, err := json.Marshal(f.JSONSchema); err == nil {
+			count += Estimate(string(schema))
+		}
+	}
+	return count
+}
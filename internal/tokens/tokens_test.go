@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	// Expected counts are those of the cl100k vocabulary; estimates may be
+	// off by Margin, or by one token for short texts
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{name: "empty", text: "", want: 0},
+		{name: "words", text: "hello world", want: 2},
+		{name: "punctuation", text: "Hello, world!", want: 4},
+		{name: "sentence", text: "The quick brown fox jumps over the lazy dog.", want: 10},
+		{name: "long word", text: "tiktoken is great!", want: 6},
+		{name: "digits", text: "1234567", want: 3},
+		{name: "cjk", text: "你好", want: 2},
+		{name: "paragraph", text: strings.Repeat("The quick brown fox jumps over the lazy dog. ", 10), want: 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, Estimate(tt.text), math.Max(1, float64(tt.want)*Margin))
+		})
+	}
+}
+
+func TestEstimateMessages(t *testing.T) {
+	assert.Equal(t, perReply, EstimateMessages(nil))
+
+	messages := []models.ChatCompletionMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", MultiContent: []models.ContentPart{
+			{Type: models.ContentPartText, Text: "hello world"},
+			{Type: models.ContentPartImageURL, ImageURL: &models.ImageURL{URL: "https://example.com/cat.png"}},
+		}},
+	}
+	// system: 1 + "Be brief." 3; user: 1 + text 2 + image
+	assert.Equal(t, perReply+2*perMessage+4+3+perImage, EstimateMessages(messages))
+}
+
+func TestEstimateRequest(t *testing.T) {
+	messages := []models.ChatCompletionMessage{{Role: "user", Content: "Weather in Paris?"}}
+	base := EstimateRequest(&models.ChatCompletionRequest{Messages: messages})
+	assert.Equal(t, EstimateMessages(messages), base)
+
+	// Tool definitions and JSON schemas are part of the prompt
+	parameters := `{"type":"object","properties":{"city":{"type":"string"}}}`
+	withTools := EstimateRequest(&models.ChatCompletionRequest{
+		Messages: messages,
+		Tools: []models.Tool{{Type: models.ToolTypeFunction, Function: &models.FunctionDefinition{
+			Name:        "get_weather",
+			Description: "Current weather of a city",
+			Parameters:  json.RawMessage(parameters),
+		}}},
+	})
+	assert.Equal(t, base+Estimate("get_weather")+Estimate("Current weather of a city")+Estimate(parameters), withTools)
+
+	withSchema := EstimateRequest(&models.ChatCompletionRequest{
+		Messages: messages,
+		ResponseFormat: &models.ResponseFormat{
+			Type:       models.ResponseFormatJSONSchema,
+			JSONSchema: &models.JSONSchema{Name: "answer", Schema: json.RawMessage(parameters)},
+		},
+	})
+	assert.Greater(t, withSchema, base+Estimate(parameters))
+}
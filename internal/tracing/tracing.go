@@ -0,0 +1,52 @@
+// Package tracing starts the OpenTelemetry spans of the pipeline and model
+// calls. Spans go to the global tracer provider, which is a no-op until the
+// application installs one with otel.SetTracerProvider.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer the spans are started with
+const instrumentationName = "github.com/sleepstars/deepempower"
+
+// Start starts a span as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RecordError records err on span and marks the span as failed. A nil err is
+// ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Usage returns the token usage attributes of a call, or none for nil usage
+func Usage(usage *models.Usage) []attribute.KeyValue {
+	if usage == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.Int("usage.prompt_tokens", usage.PromptTokens),
+		attribute.Int("usage.completion_tokens", usage.CompletionTokens),
+		attribute.Int("usage.total_tokens", usage.TotalTokens),
+	}
+}
+
+// Extract returns ctx carrying the trace context of the incoming request
+// headers, read with the global propagator
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
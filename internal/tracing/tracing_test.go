@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sleepstars/deepempower/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestStart_NoProvider(t *testing.T) {
+	// The default global provider records nothing
+	ctx, span := Start(context.Background(), "noop", attribute.String("key", "value"))
+	assert.False(t, span.IsRecording())
+	assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+	RecordError(span, errors.New("ignored"))
+	span.End()
+}
+
+func TestStart_SpanTree(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, root := Start(context.Background(), "root", attribute.String("model.name", "gpt-4"))
+	_, child := Start(ctx, "child")
+	child.SetAttributes(Usage(&models.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})...)
+	RecordError(child, errors.New("failed"))
+	RecordError(root, nil)
+	child.End()
+	root.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	childSpan, rootSpan := spans[0], spans[1]
+	assert.Equal(t, "root", rootSpan.Name())
+	assert.False(t, rootSpan.Parent().IsValid())
+	assert.Contains(t, rootSpan.Attributes(), attribute.String("model.name", "gpt-4"))
+	assert.Equal(t, codes.Unset, rootSpan.Status().Code)
+
+	assert.Equal(t, "child", childSpan.Name())
+	assert.Equal(t, rootSpan.SpanContext().SpanID(), childSpan.Parent().SpanID())
+	assert.Equal(t, rootSpan.SpanContext().TraceID(), childSpan.SpanContext().TraceID())
+	assert.Contains(t, childSpan.Attributes(), attribute.Int("usage.total_tokens", 3))
+	assert.Equal(t, codes.Error, childSpan.Status().Code)
+	assert.Equal(t, "failed", childSpan.Status().Description)
+	require.Len(t, childSpan.Events(), 1)
+	assert.Equal(t, "exception", childSpan.Events()[0].Name)
+}
+
+func TestExtract(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc := trace.SpanContextFromContext(Extract(context.Background(), header))
+	assert.True(t, sc.IsRemote())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+
+	// Without a trace context the request starts a new trace
+	assert.False(t, trace.SpanContextFromContext(Extract(context.Background(), http.Header{})).IsValid())
+}
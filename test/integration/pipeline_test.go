@@ -58,6 +58,7 @@ func TestPipelineIntegration(t *testing.T) {
 
 	// Load test configuration
 	cfg := &config.PipelineConfig{
+		IncludeReasoning: true,
 		Models: config.ModelsConfig{
 			Normal: config.ModelConfig{
 				APIBase: "mock://normal",
@@ -91,7 +92,8 @@ func TestPipelineIntegration(t *testing.T) {
 		Logger:         logger.GetLogger().WithComponent("test_bridge"),
 	}
 
-	pipeline := orchestrator.NewHybridPipeline(cfg)
+	pipeline, err := orchestrator.NewHybridPipeline(cfg)
+	assert.NoError(t, err)
 	pipeline.SetBridge(bridge)
 
 	// Test cases
@@ -325,6 +327,7 @@ func TestPipelineIntegrationErrorRecovery(t *testing.T) {
 
 			// Create test config
 			cfg := &config.PipelineConfig{
+				IncludeReasoning: true,
 				Models: config.ModelsConfig{
 					Normal: config.ModelConfig{
 						APIBase: "mock://normal",
@@ -340,6 +343,10 @@ func TestPipelineIntegrationErrorRecovery(t *testing.T) {
 					Reasoning:   "Test reasoning prompt",
 					PostProcess: "Test postprocessing prompt",
 				},
+				Retry: config.RetryConfig{
+					MaxAttempts: 2,
+					RetryOn:     []string{"model_call"},
+				},
 			}
 
 			// Create pipeline with mock clients
@@ -349,7 +356,8 @@ func TestPipelineIntegrationErrorRecovery(t *testing.T) {
 				Logger:         logger.GetLogger().WithComponent("test_bridge"),
 			}
 
-			pipeline := orchestrator.NewHybridPipeline(cfg)
+			pipeline, err := orchestrator.NewHybridPipeline(cfg)
+			assert.NoError(t, err)
 			pipeline.SetBridge(bridge)
 
 			// Set short timeout for cancellation test